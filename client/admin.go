@@ -0,0 +1,139 @@
+package client
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// entryLister is implemented by Cache backends that can enumerate their
+// entries, by the time at which each expires. The zero time means never.
+// Expired entries are left out.
+type entryLister interface {
+	Expirations() map[string]time.Time
+}
+
+// flusher is implemented by Cache backends that can remove all their
+// entries at once.
+type flusher interface {
+	Flush()
+}
+
+// adminEntry is an entry as listed by the admin handler.
+type adminEntry struct {
+	Key string `json:"key"`
+	// TTLSeconds is the whole number of seconds until the entry expires,
+	// or -1 if it never does.
+	TTLSeconds int64 `json:"ttl_seconds"`
+}
+
+const (
+	adminEntriesPath = "/cache/entries"
+	adminFlushPath   = "/cache/flush"
+)
+
+// AdminHandler returns an http.Handler for operating the cache by hand. It
+// is not served anywhere unless mounted, e.g. on an internal port, and
+// offers
+//
+//	GET /cache/entries          lists the keys and their remaining TTL
+//	DELETE /cache/entries/{key} evicts an entry
+//	POST /cache/flush           evicts all entries
+//
+// Listing, and flushing backends that cannot flush themselves, require a
+// backend that can enumerate its entries, and are otherwise answered with
+// 501 Not Implemented. Keys must be escaped in the path, e.g. with
+// url.PathEscape, since they contain slashes.
+func (interceptor *InmemoryCachingInterceptor) AdminHandler() http.Handler {
+	// routed by hand rather than by http.ServeMux, which would redirect
+	// the paths of keys that contain double slashes
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == adminEntriesPath:
+			interceptor.listEntries(w, r)
+		case strings.HasPrefix(r.URL.Path, adminEntriesPath+"/"):
+			interceptor.evictEntry(w, r)
+		case r.URL.Path == adminFlushPath:
+			interceptor.flushEntries(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+func (interceptor *InmemoryCachingInterceptor) listEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	lister, ok := interceptor.backend().(entryLister)
+	if !ok {
+		http.Error(w, "cache backend cannot list entries", http.StatusNotImplemented)
+		return
+	}
+
+	now := time.Now()
+	entries := []adminEntry{}
+	for key, expiration := range lister.Expirations() {
+		entry := adminEntry{Key: key, TTLSeconds: -1}
+		if !expiration.IsZero() {
+			entry.TTLSeconds = int64(expiration.Sub(now) / time.Second)
+		}
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Key < entries[j].Key })
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(entries); err != nil {
+		interceptor.logger().Warn("Failed to write cache entries", "error", err)
+	}
+}
+
+func (interceptor *InmemoryCachingInterceptor) evictEntry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodDelete)
+		return
+	}
+	key := strings.TrimPrefix(r.URL.Path, adminEntriesPath+"/")
+	if key == "" {
+		http.Error(w, "missing key", http.StatusBadRequest)
+		return
+	}
+
+	interceptor.backend().Delete(key)
+	interceptor.recency.remove(key)
+	interceptor.logger().Info("Evicted entry from cache by request", "key", key)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (interceptor *InmemoryCachingInterceptor) flushEntries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	backend := interceptor.backend()
+	switch c := backend.(type) {
+	case flusher:
+		c.Flush()
+	case entryLister:
+		for key := range c.Expirations() {
+			backend.Delete(key)
+		}
+	default:
+		http.Error(w, "cache backend cannot be flushed", http.StatusNotImplemented)
+		return
+	}
+	interceptor.recency.clear()
+	interceptor.logger().Info("Flushed cache by request")
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// methodNotAllowed answers a request with a method other than the allowed
+// one.
+func methodNotAllowed(w http.ResponseWriter, allowed string) {
+	w.Header().Set("Allow", allowed)
+	http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+}
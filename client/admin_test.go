@@ -0,0 +1,107 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// adminRequest sends a request to the admin handler of the interceptor.
+func adminRequest(interceptor *InmemoryCachingInterceptor, method string, path string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	interceptor.AdminHandler().ServeHTTP(recorder, httptest.NewRequest(method, path, nil))
+	return recorder
+}
+
+func TestAdminListsEntries(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.Cache.Set("a", 1, time.Minute)
+	interceptor.Cache.Set("b", 2, time.Hour)
+
+	resp := adminRequest(interceptor, http.MethodGet, "/cache/entries")
+	if resp.Code != http.StatusOK {
+		test.Fatalf("Wanted 200, got %d", resp.Code)
+	}
+	var entries []adminEntry
+	if err := json.Unmarshal(resp.Body.Bytes(), &entries); err != nil {
+		test.Fatalf("Wanted a JSON list, got %q: %v", resp.Body.String(), err)
+	}
+	if len(entries) != 2 || entries[0].Key != "a" || entries[1].Key != "b" {
+		test.Fatalf("Wanted entries a and b, got %+v", entries)
+	}
+	if ttl := entries[0].TTLSeconds; ttl < 58 || ttl > 60 {
+		test.Errorf("Wanted about a minute left for a, got %ds", ttl)
+	}
+	if ttl := entries[1].TTLSeconds; ttl < 3598 || ttl > 3600 {
+		test.Errorf("Wanted about an hour left for b, got %ds", ttl)
+	}
+}
+
+func TestAdminEvictsEntry(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.Cache.Set("poisoned", 1, time.Minute)
+	interceptor.Cache.Set("fine", 2, time.Minute)
+
+	if resp := adminRequest(interceptor, http.MethodDelete, "/cache/entries/poisoned"); resp.Code != http.StatusNoContent {
+		test.Errorf("Wanted 204, got %d", resp.Code)
+	}
+	if _, found := interceptor.Cache.Get("poisoned"); found {
+		test.Errorf("Wanted the entry evicted")
+	}
+	if _, found := interceptor.Cache.Get("fine"); !found {
+		test.Errorf("Wanted other entries kept")
+	}
+
+	if resp := adminRequest(interceptor, http.MethodGet, "/cache/entries/fine"); resp.Code != http.StatusMethodNotAllowed {
+		test.Errorf("Wanted 405 for GET of a single entry, got %d", resp.Code)
+	}
+
+	key := interceptor.key(context.Background(), testMethod, &wrappers.StringValue{Value: "req"})
+	interceptor.Cache.Set(key, 3, time.Minute)
+	if resp := adminRequest(interceptor, http.MethodDelete, "/cache/entries/"+url.PathEscape(key)); resp.Code != http.StatusNoContent {
+		test.Errorf("Wanted 204 for an escaped key, got %d", resp.Code)
+	}
+	if _, found := interceptor.Cache.Get(key); found {
+		test.Errorf("Wanted the entry with an escaped key evicted")
+	}
+}
+
+func TestAdminFlushes(test *testing.T) {
+	backends := map[string]Cache{
+		"go-cache": NewGoCache(&newTestInterceptor().Cache),
+		"lru":      NewLRUCache(10),
+	}
+
+	for name, backend := range backends {
+		interceptor := &InmemoryCachingInterceptor{Backend: backend}
+		backend.Set("a", 1, time.Minute)
+		backend.Set("b", 2, time.Minute)
+
+		if resp := adminRequest(interceptor, http.MethodPost, "/cache/flush"); resp.Code != http.StatusNoContent {
+			test.Errorf("Wanted 204 flushing %s, got %d", name, resp.Code)
+		}
+		if got := backend.(entryCounter).ItemCount(); got != 0 {
+			test.Errorf("Wanted %s empty after flush, got %d entries", name, got)
+		}
+	}
+}
+
+func TestAdminWithoutListingBackend(test *testing.T) {
+	interceptor := &InmemoryCachingInterceptor{Backend: newMapCache()}
+
+	if resp := adminRequest(interceptor, http.MethodGet, "/cache/entries"); resp.Code != http.StatusNotImplemented {
+		test.Errorf("Wanted 501 listing, got %d", resp.Code)
+	}
+	if resp := adminRequest(interceptor, http.MethodPost, "/cache/flush"); resp.Code != http.StatusNotImplemented {
+		test.Errorf("Wanted 501 flushing, got %d", resp.Code)
+	}
+	if resp := adminRequest(interceptor, http.MethodDelete, "/cache/entries/a"); resp.Code != http.StatusNoContent {
+		test.Errorf("Wanted evicting to work with any backend, got %d", resp.Code)
+	}
+}
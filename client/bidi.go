@@ -0,0 +1,157 @@
+package client
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"google.golang.org/grpc"
+)
+
+// Bidirectional streams are cached per message, if CacheBidiStreams is set.
+// Each request message is assumed to be answered by exactly one response
+// message, in order, and to be independent of the messages before it, so
+// that it can be keyed just like the request of a unary call. Responses are
+// stored as long as the cache-control header of the stream allows, since
+// there is no such header per message.
+//
+// A request that is found in cache is answered directly, and never reaches
+// upstream. To keep responses in the order of their requests, a request is
+// only answered from cache when every request before it has been answered.
+
+// bidiServerStream is a grpc.ServerStream that answers the request messages
+// it finds in cache itself, and only hands the others to the handler.
+type bidiServerStream struct {
+	grpc.ServerStream
+
+	interceptor *InmemoryCachingInterceptor
+	method      string
+	csvLog      *log.Logger
+
+	// number of requests handed to the handler and not yet answered
+	outstanding int
+	// guards outstanding, and serializes sending on the stream
+	mux sync.Mutex
+}
+
+func (s *bidiServerStream) RecvMsg(m interface{}) error {
+	for {
+		if err := s.ServerStream.RecvMsg(m); err != nil {
+			return err
+		}
+		served, err := s.serveFromCache(m.(proto.Message))
+		if err != nil || !served {
+			return err
+		}
+	}
+}
+
+func (s *bidiServerStream) SendMsg(m interface{}) error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+	if s.outstanding > 0 {
+		s.outstanding--
+	}
+	return s.ServerStream.SendMsg(m)
+}
+
+// serveFromCache answers the request with its cached response, if there is
+// one and it would not overtake a response still to come from upstream.
+func (s *bidiServerStream) serveFromCache(req proto.Message) (bool, error) {
+	ctx := s.Context()
+	requestHash := hashing.String(req.String())
+	hash := s.interceptor.key(ctx, s.method, req)
+
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	if bypassRequested(ctx) {
+		s.interceptor.recordDecision(s.method, hash, Bypass, 0)
+		s.outstanding++
+		return false, nil
+	}
+
+	cached, found := s.interceptor.backend().Get(hash)
+	value, _ := unwrapEntry(cached)
+	reply, ok := value.(proto.Message)
+	if !found || !ok || s.outstanding > 0 || s.interceptor.unverifiedTooLong(s.method) {
+		s.interceptor.recordDecision(s.method, hash, Miss, 0)
+		s.outstanding++
+		return false, nil
+	}
+
+	s.interceptor.recordDecision(s.method, hash, Hit, 0)
+	s.interceptor.recordHit(s.method, reply)
+	if s.interceptor.MemoryLimit > 0 {
+		s.interceptor.recency.touch(hash)
+	}
+	s.interceptor.logCall("Using cached response", "method", s.method, "hash", requestHash, "cache_status", "hit")
+	s.csvLog.Printf("%d,cache,%s\n", time.Now().UnixNano(), s.method)
+
+	return true, s.ServerStream.SendMsg(cloneValue(reply))
+}
+
+// bidiClientStream is a grpc.ClientStream that pairs each response message
+// with the oldest unanswered request message, and stores it in cache if the
+// cache-control header of the stream allows it.
+type bidiClientStream struct {
+	grpc.ClientStream
+
+	interceptor *InmemoryCachingInterceptor
+	ctx         context.Context
+	method      string
+
+	// requests sent upstream and not yet answered, oldest first
+	pending []proto.Message
+	mux     sync.Mutex
+}
+
+func (s *bidiClientStream) SendMsg(m interface{}) error {
+	s.mux.Lock()
+	s.pending = append(s.pending, proto.Clone(m.(proto.Message)))
+	s.mux.Unlock()
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *bidiClientStream) RecvMsg(m interface{}) error {
+	if err := s.ClientStream.RecvMsg(m); err != nil {
+		return err
+	}
+
+	s.mux.Lock()
+	if len(s.pending) == 0 {
+		s.mux.Unlock()
+		s.interceptor.logger().Warn("Unsolicited response on stream, not storing it", "method", s.method)
+		return nil
+	}
+	req := s.pending[0]
+	s.pending = s.pending[1:]
+	s.mux.Unlock()
+
+	s.store(req, m.(proto.Message))
+	return nil
+}
+
+// store the response to the request in cache, if the cache headers allow it.
+func (s *bidiClientStream) store(req proto.Message, reply proto.Message) {
+	requestHash := hashing.String(req.String())
+	header, _ := s.Header()
+	expiration := ParseCacheControl(header.Get("cache-control")).expiration()
+	if expiration <= 0 || !storeAllowed(s.ctx) {
+		s.interceptor.logCall("Fetched upstream response", "method", s.method, "hash", requestHash, "cache_status", "miss", "stored", false)
+		return
+	}
+
+	hash := s.interceptor.key(s.ctx, s.method, req)
+	ttl := time.Duration(expiration) * time.Second
+	s.interceptor.backend().Set(hash, cloneValue(reply), ttl)
+	s.interceptor.keys.add(s.method, hash, ttl)
+	s.interceptor.recordDecision(s.method, hash, Store, ttl)
+	if s.interceptor.MemoryLimit > 0 {
+		s.interceptor.recency.stored(hash, ttl)
+	}
+	s.interceptor.logCall("Fetched upstream response", "method", s.method, "hash", requestHash, "cache_status", "miss", "stored", true, "max_age", expiration)
+}
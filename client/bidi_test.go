@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+var bidiStreamDesc = &grpc.StreamDesc{StreamName: "Method", ServerStreams: true, ClientStreams: true}
+
+// fakeBidiServerStream is a grpc.ServerStream that receives its requests in
+// order, and records the messages sent on it.
+type fakeBidiServerStream struct {
+	grpc.ServerStream
+
+	reqs []proto.Message
+	sent []proto.Message
+}
+
+func (s *fakeBidiServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeBidiServerStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, proto.Clone(m.(proto.Message)))
+	return nil
+}
+
+func (s *fakeBidiServerStream) RecvMsg(m interface{}) error {
+	if len(s.reqs) == 0 {
+		return io.EOF
+	}
+	m.(proto.Message).Reset()
+	proto.Merge(m.(proto.Message), s.reqs[0])
+	s.reqs = s.reqs[1:]
+	return nil
+}
+
+// echoClientStream is a grpc.ClientStream to a bidirectional method that
+// answers each request with "resp-" and the value of the request.
+type echoClientStream struct {
+	grpc.ClientStream
+
+	received []string
+	replies  []string
+}
+
+func (s *echoClientStream) Header() (metadata.MD, error) {
+	return metadata.Pairs("cache-control", "must-revalidate, max-age=60"), nil
+}
+
+func (s *echoClientStream) SendMsg(m interface{}) error {
+	value := m.(*wrappers.StringValue).Value
+	s.received = append(s.received, value)
+	s.replies = append(s.replies, "resp-"+value)
+	return nil
+}
+
+func (s *echoClientStream) RecvMsg(m interface{}) error {
+	if len(s.replies) == 0 {
+		return io.EOF
+	}
+	m.(*wrappers.StringValue).Value = s.replies[0]
+	s.replies = s.replies[1:]
+	return nil
+}
+
+// proxyBidi runs a bidirectional stream through both interceptors, with a
+// handler that forwards each request message upstream and sends back the
+// response, as a reverse proxy would.
+func proxyBidi(test *testing.T, interceptor *InmemoryCachingInterceptor, upstream *echoClientStream, values ...string) []string {
+	reqs := make([]proto.Message, len(values))
+	for i, value := range values {
+		reqs[i] = &wrappers.StringValue{Value: value}
+	}
+	ss := &fakeBidiServerStream{reqs: reqs}
+
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return upstream, nil
+	}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		cs, err := interceptor.StreamClientInterceptor()(stream.Context(), bidiStreamDesc, nil, testMethod, streamer)
+		if err != nil {
+			return err
+		}
+		for {
+			req := &wrappers.StringValue{}
+			if err := stream.RecvMsg(req); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			if err := cs.SendMsg(req); err != nil {
+				return err
+			}
+			reply := &wrappers.StringValue{}
+			if err := cs.RecvMsg(reply); err != nil {
+				return err
+			}
+			if err := stream.SendMsg(reply); err != nil {
+				return err
+			}
+		}
+	}
+
+	info := &grpc.StreamServerInfo{FullMethod: testMethod, IsServerStream: true, IsClientStream: true}
+	if err := interceptor.StreamServerInterceptor(discardLog)(nil, ss, info, handler); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	sent := make([]string, len(ss.sent))
+	for i, message := range ss.sent {
+		sent[i] = message.(*wrappers.StringValue).Value
+	}
+	return sent
+}
+
+func TestBidiStreamMessagesServedFromCache(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.CacheBidiStreams = true
+	upstream := &echoClientStream{}
+
+	sent := proxyBidi(test, interceptor, upstream, "a", "b", "a")
+
+	wanted := []string{"resp-a", "resp-b", "resp-a"}
+	if len(sent) != len(wanted) {
+		test.Fatalf("Wanted responses %v, got %v", wanted, sent)
+	}
+	for i := range wanted {
+		if sent[i] != wanted[i] {
+			test.Errorf("Wanted response %d to be %s, got %s", i, wanted[i], sent[i])
+		}
+	}
+	if len(upstream.received) != 2 || upstream.received[0] != "a" || upstream.received[1] != "b" {
+		test.Errorf("Wanted upstream to only receive a and b, got %v", upstream.received)
+	}
+
+	upstream = &echoClientStream{}
+	proxyBidi(test, interceptor, upstream, "b")
+	if len(upstream.received) != 0 {
+		test.Errorf("Wanted repeated message in a new stream to be served from cache, upstream got %v", upstream.received)
+	}
+}
+
+func TestBidiStreamsPassedThroughByDefault(test *testing.T) {
+	interceptor := newTestInterceptor()
+	upstream := &echoClientStream{}
+
+	proxyBidi(test, interceptor, upstream, "a", "a")
+
+	if len(upstream.received) != 2 {
+		test.Errorf("Wanted both messages sent upstream, got %v", upstream.received)
+	}
+	if got := interceptor.Cache.ItemCount(); got != 0 {
+		test.Errorf("Wanted nothing cached, got %d entries", got)
+	}
+}
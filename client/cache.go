@@ -0,0 +1,94 @@
+package client
+
+import (
+	"time"
+
+	"github.com/patrickmn/go-cache"
+)
+
+// Cache is a storage backend for cached responses. Implementations must be
+// safe for concurrent use.
+type Cache interface {
+	// Get returns the value stored for the key, and whether it was found.
+	// Expired values must not be returned.
+	Get(key string) (interface{}, bool)
+	// Set stores the value for the key, replacing any existing value, for
+	// as long as the ttl. A ttl of zero or less means that the value never
+	// expires.
+	Set(key string, value interface{}, ttl time.Duration)
+	// Delete removes any value stored for the key.
+	Delete(key string)
+}
+
+// entryCounter is implemented by Cache backends that can tell how many
+// entries they hold.
+type entryCounter interface {
+	ItemCount() int
+}
+
+// goCache adapts a go-cache cache.Cache to the Cache interface.
+type goCache struct {
+	cache *cache.Cache
+}
+
+// compile-time check that we adhere to interface
+var _ Cache = goCache{}
+
+// NewGoCache returns a Cache backed by the go-cache c.
+func NewGoCache(c *cache.Cache) Cache {
+	return goCache{cache: c}
+}
+
+func (c goCache) Get(key string) (interface{}, bool) {
+	return c.cache.Get(key)
+}
+
+func (c goCache) Set(key string, value interface{}, ttl time.Duration) {
+	// go-cache would use its default expiration for a zero ttl
+	if ttl <= 0 {
+		ttl = cache.NoExpiration
+	}
+	c.cache.Set(key, value, ttl)
+}
+
+func (c goCache) Delete(key string) {
+	c.cache.Delete(key)
+}
+
+// ItemCount returns the number of entries, including any that have expired
+// but not yet been cleaned up.
+func (c goCache) ItemCount() int {
+	return c.cache.ItemCount()
+}
+
+// Expirations returns the unexpired entries by when they expire.
+func (c goCache) Expirations() map[string]time.Time {
+	items := c.cache.Items()
+	expirations := make(map[string]time.Time, len(items))
+	for key, item := range items {
+		var expiration time.Time
+		if item.Expiration > 0 {
+			expiration = time.Unix(0, item.Expiration)
+		}
+		expirations[key] = expiration
+	}
+	return expirations
+}
+
+// Flush removes all entries.
+func (c goCache) Flush() {
+	c.cache.Flush()
+}
+
+// backend returns the Cache that the interceptor stores responses in.
+func (interceptor *InmemoryCachingInterceptor) backend() Cache {
+	if interceptor.Backend != nil {
+		return interceptor.Backend
+	}
+	return goCache{cache: &interceptor.Cache}
+}
+
+// GetWithExpiration returns the value for the key, and when it expires.
+func (c goCache) GetWithExpiration(key string) (interface{}, time.Time, bool) {
+	return c.cache.GetWithExpiration(key)
+}
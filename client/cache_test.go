@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/patrickmn/go-cache"
+)
+
+// mapCache is a Cache that ignores TTLs, and counts how it is used.
+type mapCache struct {
+	values map[string]interface{}
+	ttls   map[string]time.Duration
+	gets   int
+	mux    sync.Mutex
+}
+
+func newMapCache() *mapCache {
+	return &mapCache{values: make(map[string]interface{}), ttls: make(map[string]time.Duration)}
+}
+
+func (c *mapCache) Get(key string) (interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.gets++
+	value, found := c.values[key]
+	return value, found
+}
+
+func (c *mapCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.values[key] = value
+	c.ttls[key] = ttl
+}
+
+func (c *mapCache) Delete(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	delete(c.values, key)
+}
+
+func TestCustomBackend(test *testing.T) {
+	backend := newMapCache()
+	interceptor := &InmemoryCachingInterceptor{Backend: backend}
+	req := &wrappers.StringValue{Value: "req"}
+
+	err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("cached"))
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if len(backend.values) != 1 {
+		test.Fatalf("Wanted response stored in backend, got %d values", len(backend.values))
+	}
+	for _, ttl := range backend.ttls {
+		if ttl != time.Minute {
+			test.Errorf("Wanted response stored for a minute, got %v", ttl)
+		}
+	}
+
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+	resp, _, err := serve(interceptor, context.Background(), req, handler)
+	if err != nil || resp.(*wrappers.StringValue).Value != "cached" || handler.calls != 0 {
+		test.Errorf("Wanted cached response from backend, got %v (%d calls, err %v)", resp, handler.calls, err)
+	}
+	if backend.gets != 1 {
+		test.Errorf("Wanted 1 lookup in backend, got %d", backend.gets)
+	}
+}
+
+func TestZeroTTLNeverExpires(test *testing.T) {
+	disk, path := newTestDiskCache(test)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer disk.Close()
+
+	backends := map[string]Cache{
+		"go-cache": NewGoCache(cache.New(time.Millisecond, time.Minute)),
+		"lru":      &LRUCache{MaxEntries: 10},
+		"tiered":   NewTieredCache(&LRUCache{}, &LRUCache{}, 0),
+		"disk":     disk,
+	}
+	for _, backend := range backends {
+		backend.Set("forever", &wrappers.StringValue{Value: "resp"}, 0)
+	}
+	time.Sleep(5 * time.Millisecond)
+
+	for name, backend := range backends {
+		if _, found := backend.Get("forever"); !found {
+			test.Errorf("Wanted %s to keep a value stored without a ttl", name)
+		}
+		if lister, ok := backend.(entryLister); ok {
+			if expiration, found := lister.Expirations()["forever"]; !found || !expiration.IsZero() {
+				test.Errorf("Wanted %s to list the value as never expiring, got %v (found %v)", name, expiration, found)
+			}
+		}
+	}
+}
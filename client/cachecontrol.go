@@ -0,0 +1,149 @@
+package client
+
+import (
+	"math"
+	"strconv"
+	"strings"
+)
+
+// AnyStaleness is the MaxStale of a max-stale directive without a value,
+// which accepts responses of any staleness.
+const AnyStaleness = math.MaxInt32
+
+// CacheControl holds the directives of cache-control headers. Valued
+// directives are in seconds, and are -1 when absent.
+type CacheControl struct {
+	MaxAge               int
+	SMaxAge              int
+	MinFresh             int
+	MaxStale             int
+	StaleWhileRevalidate int
+	StaleIfError         int
+
+	NoCache         bool
+	NoStore         bool
+	NoTransform     bool
+	OnlyIfCached    bool
+	MustRevalidate  bool
+	ProxyRevalidate bool
+	MustUnderstand  bool
+	Public          bool
+	Private         bool
+	Immutable       bool
+
+	// Extensions holds the directives that are not recognized, by their
+	// lowercase name. Directives without a value map to the empty string.
+	Extensions map[string]string
+}
+
+// ParseCacheControl parses the directives of cache-control headers, each of
+// which may hold several comma-separated directives. Directive names are
+// case-insensitive. If a directive occurs more than once, the first
+// occurrence wins, and valued directives with malformed values are ignored.
+func ParseCacheControl(headers []string) CacheControl {
+	cc := CacheControl{
+		MaxAge:               -1,
+		SMaxAge:              -1,
+		MinFresh:             -1,
+		MaxStale:             -1,
+		StaleWhileRevalidate: -1,
+		StaleIfError:         -1,
+		Extensions:           make(map[string]string),
+	}
+
+	seen := make(map[string]bool)
+	for _, header := range headers {
+		for _, directive := range strings.Split(header, ",") {
+			name, value, valued := splitDirective(directive)
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+
+			if seconds := cc.seconds(name); seconds != nil {
+				if name == "max-stale" && !valued {
+					*seconds = AnyStaleness
+				} else if parsed, err := strconv.Atoi(value); err == nil && parsed >= 0 {
+					*seconds = parsed
+				}
+			} else if flag := cc.flag(name); flag != nil {
+				*flag = true
+			} else {
+				cc.Extensions[name] = value
+			}
+		}
+	}
+
+	return cc
+}
+
+// splitDirective splits a directive into its lowercase name and its value,
+// with any quotes removed.
+func splitDirective(directive string) (string, string, bool) {
+	parts := strings.SplitN(directive, "=", 2)
+	name := strings.ToLower(strings.TrimSpace(parts[0]))
+	if len(parts) == 1 {
+		return name, "", false
+	}
+	return name, strings.Trim(strings.TrimSpace(parts[1]), `"`), true
+}
+
+// seconds returns the field of a valued directive, or nil if the directive
+// is not one.
+func (cc *CacheControl) seconds(name string) *int {
+	switch name {
+	case "max-age":
+		return &cc.MaxAge
+	case "s-maxage":
+		return &cc.SMaxAge
+	case "min-fresh":
+		return &cc.MinFresh
+	case "max-stale":
+		return &cc.MaxStale
+	case "stale-while-revalidate":
+		return &cc.StaleWhileRevalidate
+	case "stale-if-error":
+		return &cc.StaleIfError
+	}
+	return nil
+}
+
+// flag returns the field of a boolean directive, or nil if the directive is
+// not one.
+func (cc *CacheControl) flag(name string) *bool {
+	switch name {
+	case "no-cache":
+		return &cc.NoCache
+	case "no-store":
+		return &cc.NoStore
+	case "no-transform":
+		return &cc.NoTransform
+	case "only-if-cached":
+		return &cc.OnlyIfCached
+	case "must-revalidate":
+		return &cc.MustRevalidate
+	case "proxy-revalidate":
+		return &cc.ProxyRevalidate
+	case "must-understand":
+		return &cc.MustUnderstand
+	case "public":
+		return &cc.Public
+	case "private":
+		return &cc.Private
+	case "immutable":
+		return &cc.Immutable
+	}
+	return nil
+}
+
+// expiration returns the number of seconds that a response may be stored in
+// the cache, or -1 if it must not be stored. No-cache prevents storage too,
+// since there is no revalidation that would let a stored response be
+// served. Private responses are not stored either, since the cache is shared
+// by all callers of the reverse proxy.
+func (cc CacheControl) expiration() int {
+	if cc.NoStore || cc.NoCache || cc.Private {
+		return -1
+	}
+	return cc.MaxAge
+}
@@ -0,0 +1,109 @@
+package client
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// withDefaults returns a CacheControl where unset valued directives are
+// absent, for brevity in the test table.
+func withDefaults(cc CacheControl) CacheControl {
+	for _, seconds := range []*int{&cc.MaxAge, &cc.SMaxAge, &cc.MinFresh, &cc.MaxStale, &cc.StaleWhileRevalidate, &cc.StaleIfError} {
+		if *seconds == 0 {
+			*seconds = -1
+		}
+	}
+	if cc.Extensions == nil {
+		cc.Extensions = map[string]string{}
+	}
+	return cc
+}
+
+func TestParseCacheControl(test *testing.T) {
+	cases := []struct {
+		headers []string
+		wanted  CacheControl
+	}{
+		{nil, withDefaults(CacheControl{})},
+		{[]string{""}, withDefaults(CacheControl{})},
+		{[]string{"max-age=10"}, withDefaults(CacheControl{MaxAge: 10})},
+		{[]string{"must-revalidate, max-age=10"}, withDefaults(CacheControl{MaxAge: 10, MustRevalidate: true})},
+		{[]string{"max-age=0"}, CacheControl{MaxAge: 0, SMaxAge: -1, MinFresh: -1, MaxStale: -1, StaleWhileRevalidate: -1, StaleIfError: -1, Extensions: map[string]string{}}},
+		{[]string{"MAX-AGE=5, No-Store"}, withDefaults(CacheControl{MaxAge: 5, NoStore: true})},
+		{[]string{`max-age="30"`}, withDefaults(CacheControl{MaxAge: 30})},
+		{[]string{"max-age = 7 ,public"}, withDefaults(CacheControl{MaxAge: 7, Public: true})},
+		{[]string{"max-age=10", "max-age=20"}, withDefaults(CacheControl{MaxAge: 10})},
+		{[]string{"max-age=abc"}, withDefaults(CacheControl{})},
+		{[]string{"max-age=-5"}, withDefaults(CacheControl{})},
+		{[]string{"s-maxage=60, proxy-revalidate"}, withDefaults(CacheControl{SMaxAge: 60, ProxyRevalidate: true})},
+		{[]string{"min-fresh=3"}, withDefaults(CacheControl{MinFresh: 3})},
+		{[]string{"max-stale=4"}, withDefaults(CacheControl{MaxStale: 4})},
+		{[]string{"max-stale"}, withDefaults(CacheControl{MaxStale: AnyStaleness})},
+		{[]string{"max-age=60, stale-while-revalidate=30, stale-if-error=300"}, withDefaults(CacheControl{MaxAge: 60, StaleWhileRevalidate: 30, StaleIfError: 300})},
+		{[]string{"no-cache, no-transform, only-if-cached"}, withDefaults(CacheControl{NoCache: true, NoTransform: true, OnlyIfCached: true})},
+		{[]string{"private, immutable, must-understand"}, withDefaults(CacheControl{Private: true, Immutable: true, MustUnderstand: true})},
+		{[]string{"max-age=10, x-priority=high, X-Flag"}, withDefaults(CacheControl{MaxAge: 10, Extensions: map[string]string{"x-priority": "high", "x-flag": ""}})},
+		{[]string{",, max-age=1 ,"}, withDefaults(CacheControl{MaxAge: 1})},
+	}
+
+	for _, c := range cases {
+		if got := ParseCacheControl(c.headers); !reflect.DeepEqual(got, c.wanted) {
+			test.Errorf("Wanted %+v for %q, got %+v", c.wanted, c.headers, got)
+		}
+	}
+}
+
+func TestCacheControlExpiration(test *testing.T) {
+	cases := map[string]int{
+		"must-revalidate, max-age=10": 10,
+		"max-age=0":                   0,
+		"max-age=10, no-store":        -1,
+		"no-cache":                    -1,
+		"no-store, max-age=60":        -1,
+		"no-cache, max-age=60":        -1,
+		"max-age=60, NO-CACHE":        -1,
+		"private, max-age=60":         -1,
+	}
+
+	for header, wanted := range cases {
+		if got := ParseCacheControl([]string{header}).expiration(); got != wanted {
+			test.Errorf("Wanted expiration %d for %q, got %d", wanted, header, got)
+		}
+	}
+}
+
+func TestStorageFollowsCacheControl(test *testing.T) {
+	cases := map[string]int{
+		"no-store, max-age=60": 0,
+		"no-cache, max-age=60": 0,
+		"private, max-age=60":  0,
+		"public, max-age=60":   1,
+	}
+
+	for header, wanted := range cases {
+		interceptor := newTestInterceptor()
+		invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+			reply.(*wrappers.StringValue).Value = "reply"
+			for _, opt := range opts {
+				if h, ok := opt.(grpc.HeaderCallOption); ok {
+					*h.HeaderAddr = metadata.Pairs("cache-control", header)
+				}
+			}
+			return nil
+		}
+
+		req := &wrappers.StringValue{Value: "req"}
+		err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, invoker)
+		if err != nil {
+			test.Fatalf("Wanted no error, got %v", err)
+		}
+		if got := interceptor.Cache.ItemCount(); got != wanted {
+			test.Errorf("Wanted %d stored responses for %q, got %d", wanted, header, got)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// fetch calls the handler for a call that missed the cache. If
+// DeduplicateMisses is set, concurrent misses of the same key share a
+// single call, and shared tells whether the response came from a call made
+// for another caller, who is served the original.
+func (interceptor *InmemoryCachingInterceptor) fetch(ctx context.Context, key string, req interface{}, handler grpc.UnaryHandler) (resp interface{}, err error, shared bool) {
+	if !interceptor.DeduplicateMisses || bypassRequested(ctx) {
+		resp, err := handler(ctx, req)
+		return resp, err, false
+	}
+
+	// set by whichever caller's function is run, which is then the one
+	// that made the call
+	made := false
+	results := interceptor.flights.DoChan(key, func() (interface{}, error) {
+		made = true
+		return handler(ctx, req)
+	})
+
+	select {
+	case result := <-results:
+		if made {
+			return result.Val, result.Err, false
+		}
+		if canceledByCaller(result.Err) && ctx.Err() == nil {
+			// the caller who made the call gave up on it, which says
+			// nothing about the response to this one
+			resp, err := handler(ctx, req)
+			return resp, err, false
+		}
+		return cloneValue(result.Val), result.Err, true
+	case <-ctx.Done():
+		if ctx.Err() == context.DeadlineExceeded {
+			return nil, status.Error(codes.DeadlineExceeded, ctx.Err().Error()), false
+		}
+		return nil, status.Error(codes.Canceled, ctx.Err().Error()), false
+	}
+}
+
+// canceledByCaller tells whether an error may stem from the context of the
+// caller, rather than from upstream.
+func canceledByCaller(err error) bool {
+	switch status.Code(err) {
+	case codes.Canceled, codes.DeadlineExceeded:
+		return true
+	default:
+		return err == context.Canceled || err == context.DeadlineExceeded
+	}
+}
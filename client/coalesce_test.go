@@ -0,0 +1,128 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// blockingHandler is a grpc.UnaryHandler which answers once released,
+// counting the number of times it has been called.
+type blockingHandler struct {
+	release chan struct{}
+	calls   int32
+	err     error
+}
+
+func (h *blockingHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	atomic.AddInt32(&h.calls, 1)
+	<-h.release
+	return &wrappers.StringValue{Value: "fresh"}, h.err
+}
+
+// serveConcurrently serves n identical calls at once, and releases the
+// handler once they have had time to arrive.
+func serveConcurrently(interceptor *InmemoryCachingInterceptor, n int, handler *blockingHandler) ([]interface{}, []error) {
+	responses := make([]interface{}, n)
+	errs := make([]error, n)
+	var wg sync.WaitGroup
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), &headerCapture{})
+			info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+			responses[i], errs[i] = interceptor.UnaryServerInterceptor(discardLog)(ctx, &wrappers.StringValue{Value: "req"}, info, handler.handle)
+		}(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(handler.release)
+	wg.Wait()
+	return responses, errs
+}
+
+func TestDeduplicateMissesMakesSingleCall(test *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{})}
+	interceptor := newTestInterceptor()
+	interceptor.DeduplicateMisses = true
+
+	n := 10
+	responses, errs := serveConcurrently(interceptor, n, handler)
+
+	if calls := atomic.LoadInt32(&handler.calls); calls != 1 {
+		test.Errorf("Wanted a single upstream call for %d concurrent misses, got %d", n, calls)
+	}
+	distinct := make(map[interface{}]bool)
+	for i, resp := range responses {
+		if errs[i] != nil {
+			test.Errorf("Wanted no error, got %v", errs[i])
+			continue
+		}
+		if value := resp.(*wrappers.StringValue).Value; value != "fresh" {
+			test.Errorf("Wanted the shared response, got %s", value)
+		}
+		distinct[resp] = true
+	}
+	if len(distinct) != n {
+		test.Errorf("Wanted each call served its own copy of the response, got %d distinct responses", len(distinct))
+	}
+}
+
+func TestDeduplicateMissesSharesUpstreamErrors(test *testing.T) {
+	handler := &blockingHandler{release: make(chan struct{}), err: status.Error(codes.NotFound, "gone")}
+	interceptor := newTestInterceptor()
+	interceptor.DeduplicateMisses = true
+
+	_, errs := serveConcurrently(interceptor, 5, handler)
+	for _, err := range errs {
+		if status.Code(err) != codes.NotFound {
+			test.Errorf("Wanted the upstream error, got %v", err)
+		}
+	}
+	if calls := atomic.LoadInt32(&handler.calls); calls != 1 {
+		test.Errorf("Wanted a single upstream call, got %d", calls)
+	}
+}
+
+func TestDeduplicateMissesRetriesWhenCallerCancels(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.DeduplicateMisses = true
+	var calls int32
+	started := make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			close(started)
+			<-ctx.Done()
+			return nil, status.Error(codes.Canceled, ctx.Err().Error())
+		}
+		return &wrappers.StringValue{Value: "fresh"}, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	req := &wrappers.StringValue{Value: "req"}
+
+	first, cancel := context.WithCancel(context.Background())
+	go interceptor.UnaryServerInterceptor(discardLog)(grpc.NewContextWithServerTransportStream(first, &headerCapture{}), req, info, handler)
+	<-started
+
+	done := make(chan error)
+	go func() {
+		_, err := interceptor.UnaryServerInterceptor(discardLog)(grpc.NewContextWithServerTransportStream(context.Background(), &headerCapture{}), req, info, handler)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	if err := <-done; err != nil {
+		test.Errorf("Wanted the call to be made again rather than share the cancellation, got %v", err)
+	}
+	if got := atomic.LoadInt32(&calls); got != 2 {
+		test.Errorf("Wanted 2 upstream calls, got %d", got)
+	}
+}
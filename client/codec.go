@@ -0,0 +1,198 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/any"
+	"google.golang.org/grpc/codes"
+)
+
+// Values are encoded as a kind marker, followed by one or more
+// length-prefixed google.protobuf.Any messages. The Any type URLs let values
+// be decoded into the right message types again on Get. Entries with a soft
+// TTL are stored as their own marker and the varint end of their freshness
+// in Unix nanoseconds, followed by their encoded value. Entries that know
+// when they were stored have another marker, and that time as a second
+// varint. Entries that must be revalidated are prefixed by yet another
+// marker. Cached errors are stored as their own marker, the varint status
+// code and the message.
+const (
+	valueMessage      byte = 'm'
+	valueStream       byte = 's'
+	valueEntry        byte = 'e'
+	valueStampedEntry byte = 'a'
+	valueRevalidated  byte = 'r'
+	valueError        byte = 'x'
+)
+
+// valueCodec encodes cached values for backends that store bytes. Only
+// proto.Message responses, and server streams of them, can be encoded.
+type valueCodec struct {
+	types map[string]reflect.Type
+}
+
+func newValueCodec() valueCodec {
+	return valueCodec{types: make(map[string]reflect.Type)}
+}
+
+// register prototypes of the response messages, which are used to decode
+// values whose types are not in the global protobuf registry.
+func (c valueCodec) register(prototypes ...proto.Message) {
+	for _, prototype := range prototypes {
+		c.types[proto.MessageName(prototype)] = reflect.TypeOf(prototype).Elem()
+	}
+}
+
+// encode a message, or a stream of messages.
+func (c valueCodec) encode(value interface{}) ([]byte, error) {
+	var kind byte
+	var messages []proto.Message
+	switch v := value.(type) {
+	case *entry:
+		data, err := c.encode(v.value)
+		if err != nil {
+			return nil, err
+		}
+		header := append([]byte{valueEntry}, proto.EncodeVarint(uint64(v.freshUntil.UnixNano()))...)
+		if !v.storedAt.IsZero() {
+			header[0] = valueStampedEntry
+			header = append(header, proto.EncodeVarint(uint64(v.storedAt.UnixNano()))...)
+		}
+		if v.mustRevalidate {
+			header = append([]byte{valueRevalidated}, header...)
+		}
+		return append(header, data...), nil
+	case *cachedError:
+		header := append([]byte{valueError}, proto.EncodeVarint(uint64(v.code))...)
+		return append(header, v.message...), nil
+	case proto.Message:
+		kind = valueMessage
+		messages = []proto.Message{v}
+	case []proto.Message:
+		kind = valueStream
+		messages = v
+	default:
+		return nil, fmt.Errorf("unsupported value type %T", value)
+	}
+
+	buffer := proto.NewBuffer([]byte{kind})
+	for _, message := range messages {
+		packed, err := ptypes.MarshalAny(message)
+		if err != nil {
+			return nil, err
+		}
+		data, err := proto.Marshal(packed)
+		if err != nil {
+			return nil, err
+		}
+		if err := buffer.EncodeRawBytes(data); err != nil {
+			return nil, err
+		}
+	}
+	return buffer.Bytes(), nil
+}
+
+// decode a value encoded by encode.
+func (c valueCodec) decode(data []byte) (interface{}, error) {
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+
+	if data[0] == valueRevalidated {
+		decoded, err := c.decode(data[1:])
+		if err != nil {
+			return nil, err
+		}
+		e, ok := decoded.(*entry)
+		if !ok {
+			return nil, fmt.Errorf("must-revalidate marker on %T", decoded)
+		}
+		e.mustRevalidate = true
+		return e, nil
+	}
+
+	if data[0] == valueEntry || data[0] == valueStampedEntry {
+		freshUntil, n := proto.DecodeVarint(data[1:])
+		if n == 0 {
+			return nil, errors.New("truncated entry")
+		}
+		decoded := &entry{freshUntil: time.Unix(0, int64(freshUntil))}
+		rest := data[1+n:]
+		if data[0] == valueStampedEntry {
+			storedAt, n := proto.DecodeVarint(rest)
+			if n == 0 {
+				return nil, errors.New("truncated entry")
+			}
+			decoded.storedAt = time.Unix(0, int64(storedAt))
+			rest = rest[n:]
+		}
+		value, err := c.decode(rest)
+		if err != nil {
+			return nil, err
+		}
+		decoded.value = value
+		return decoded, nil
+	}
+
+	if data[0] == valueError {
+		code, n := proto.DecodeVarint(data[1:])
+		if n == 0 {
+			return nil, errors.New("truncated error")
+		}
+		return &cachedError{code: codes.Code(code), message: string(data[1+n:])}, nil
+	}
+
+	var messages []proto.Message
+	for rest := data[1:]; len(rest) > 0; {
+		length, n := proto.DecodeVarint(rest)
+		if n == 0 || uint64(len(rest)-n) < length {
+			return nil, errors.New("truncated value")
+		}
+		raw := rest[n : n+int(length)]
+		rest = rest[n+int(length):]
+
+		packed := &any.Any{}
+		if err := proto.Unmarshal(raw, packed); err != nil {
+			return nil, err
+		}
+		message, err := c.unpack(packed)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	switch data[0] {
+	case valueMessage:
+		if len(messages) != 1 {
+			return nil, fmt.Errorf("expected 1 message, got %d", len(messages))
+		}
+		return messages[0], nil
+	case valueStream:
+		return messages, nil
+	default:
+		return nil, fmt.Errorf("unknown value kind %q", data[0])
+	}
+}
+
+// unpack the message in the Any, preferring the registered prototypes.
+func (c valueCodec) unpack(packed *any.Any) (proto.Message, error) {
+	name, err := ptypes.AnyMessageName(packed)
+	if err != nil {
+		return nil, err
+	}
+
+	var message proto.Message
+	if t, found := c.types[name]; found {
+		message = reflect.New(t).Interface().(proto.Message)
+	} else if message, err = ptypes.Empty(packed); err != nil {
+		return nil, err
+	}
+
+	return message, proto.Unmarshal(packed.Value, message)
+}
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+)
+
+// coherencyCheckTimeout bounds how long a coherency check may wait for the
+// upstream service.
+const coherencyCheckTimeout = time.Duration(10 * time.Second)
+
+// noStoreKey marks a context whose calls must not update the cache.
+type noStoreKey struct{}
+
+// coherencyCheckDue is a predicate that indicates if a cache hit should be
+// subjected to a coherency check. Checks are sampled according to the
+// configured rate, and never performed more often than the configured
+// interval allows.
+func (interceptor *InmemoryCachingInterceptor) coherencyCheckDue() bool {
+	if interceptor.CoherencyCheckRate <= 0 || rand.Float64() >= interceptor.CoherencyCheckRate {
+		return false
+	}
+
+	interceptor.stats.mux.Lock()
+	defer interceptor.stats.mux.Unlock()
+
+	now := time.Now()
+	if now.Sub(interceptor.stats.lastCoherencyCheck) < interceptor.CoherencyCheckInterval {
+		return false
+	}
+	interceptor.stats.lastCoherencyCheck = now
+
+	return true
+}
+
+// checkCoherency fetches a fresh response from upstream, and compares it to
+// the cached one, counting a stale hit if they differ. The fresh response is
+// not stored in the cache, and is not served to anyone. If there is an
+// Oracle that knows the true response, it is asked instead of upstream, and
+// the age of stale hits is recorded as well.
+func (interceptor *InmemoryCachingInterceptor) checkCoherency(ctx context.Context, method string, req interface{}, cached interface{}, handler grpc.UnaryHandler) {
+	if interceptor.Oracle != nil {
+		if truth, since, found := interceptor.Oracle.Truth(method, req.(proto.Message)); found {
+			// the age goes in before the check is counted, so that it is
+			// there for anyone who sees the check
+			if !proto.Equal(cached.(proto.Message), truth) {
+				interceptor.recordStaleness(method, time.Since(since))
+			}
+			interceptor.countCoherencyCheck(method, cached, truth)
+			return
+		}
+	}
+
+	checkCtx := context.WithValue(detachedContext(ctx), noStoreKey{}, true)
+	checkCtx, cancel := context.WithTimeout(checkCtx, coherencyCheckTimeout)
+	defer cancel()
+
+	fresh, err := handler(checkCtx, req)
+	if err != nil {
+		interceptor.logger().Warn("Coherency check failed", "method", method, "error", err)
+		return
+	}
+
+	interceptor.countCoherencyCheck(method, cached, fresh)
+}
+
+// countCoherencyCheck compares a cached response to a fresh one, and counts
+// the check, and whether it found a stale hit.
+func (interceptor *InmemoryCachingInterceptor) countCoherencyCheck(method string, cached interface{}, fresh interface{}) {
+	stale := !proto.Equal(cached.(proto.Message), fresh.(proto.Message))
+
+	interceptor.stats.mux.Lock()
+	interceptor.stats.CoherencyChecks++
+	if stale {
+		interceptor.stats.StaleHits++
+	}
+	interceptor.stats.mux.Unlock()
+
+	if stale {
+		interceptor.logger().Warn("Coherency check found stale cached response", "method", method)
+	}
+}
+
+// storeAllowed is a predicate that indicates if responses to calls made
+// with the given context may be stored in the cache.
+func storeAllowed(ctx context.Context) bool {
+	return ctx.Value(noStoreKey{}) == nil
+}
@@ -0,0 +1,106 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// waitForStats polls the interceptor's stats until the condition holds, or
+// a second has passed.
+func waitForStats(interceptor *InmemoryCachingInterceptor, condition func(Stats) bool) Stats {
+	deadline := time.Now().Add(1 * time.Second)
+	for !condition(interceptor.Stats()) && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	return interceptor.Stats()
+}
+
+func TestCoherencyCheckCountsStaleHit(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.CoherencyCheckRate = 1.0
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	resp, _, err := serve(interceptor, context.Background(), req, handler)
+	if err != nil || resp.(*wrappers.StringValue).Value != "cached" {
+		test.Errorf("Wanted cached response to be served, got %v (err %v)", resp, err)
+	}
+
+	got := waitForStats(interceptor, func(s Stats) bool { return s.CoherencyChecks > 0 })
+	if got.CoherencyChecks != 1 || got.StaleHits != 1 {
+		test.Errorf("Wanted 1 check finding 1 stale hit, got %+v", got)
+	}
+}
+
+func TestCoherencyCheckIsRateLimited(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.CoherencyCheckRate = 1.0
+	interceptor.CoherencyCheckInterval = time.Hour
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "cached"}}
+
+	for i := 0; i < 3; i++ {
+		serve(interceptor, context.Background(), req, handler)
+	}
+
+	waitForStats(interceptor, func(s Stats) bool { return s.CoherencyChecks > 0 })
+	time.Sleep(20 * time.Millisecond)
+	got := interceptor.Stats()
+	if got.CoherencyChecks != 1 || got.StaleHits != 0 {
+		test.Errorf("Wanted 1 check finding no stale hits, got %+v", got)
+	}
+}
+
+// fixedOracle is an Oracle that knows a single true response.
+type fixedOracle struct {
+	truth proto.Message
+	since time.Time
+}
+
+func (o fixedOracle) Truth(method string, req proto.Message) (proto.Message, time.Time, bool) {
+	return o.truth, o.since, true
+}
+
+func TestCoherencyCheckMeasuresStalenessAgainstOracle(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.CoherencyCheckRate = 1.0
+	interceptor.Oracle = fixedOracle{truth: &wrappers.StringValue{Value: "truth"}, since: time.Now().Add(-90 * time.Second)}
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	serve(interceptor, context.Background(), req, handler)
+
+	got := waitForStats(interceptor, func(s Stats) bool { return s.CoherencyChecks > 0 })
+	if got.StaleHits != 1 {
+		test.Errorf("Wanted 1 stale hit, got %+v", got)
+	}
+	if handler.calls != 0 {
+		test.Errorf("Wanted the oracle to be asked instead of upstream, got %d upstream calls", handler.calls)
+	}
+	age := got.StalenessAge[testMethod]
+	if age.Count != 1 || age.Sum < 90 || age.Sum > 95 {
+		test.Errorf("Wanted one staleness age of about 90 seconds, got %+v", age)
+	}
+}
+
+func TestCoherencyCheckAgainstOracleRecordsNoAgeForFreshHit(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.CoherencyCheckRate = 1.0
+	interceptor.Oracle = fixedOracle{truth: &wrappers.StringValue{Value: "cached"}, since: time.Now().Add(-90 * time.Second)}
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+
+	serve(interceptor, context.Background(), req, &countingHandler{})
+
+	got := waitForStats(interceptor, func(s Stats) bool { return s.CoherencyChecks > 0 })
+	if got.StaleHits != 0 || len(got.StalenessAge) != 0 {
+		test.Errorf("Wanted no stale hits or staleness ages, got %+v", got)
+	}
+}
@@ -0,0 +1,13 @@
+package client
+
+import (
+	// registers the gzip compressor with gRPC
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+// Responses are cached decoded, since compression is applied per hop by gRPC
+// itself. A response that is served from cache is therefore compressed just
+// like one fetched from upstream: with the compressor that the caller used
+// for its request, if gRPC knows it. The gzip compressor is registered by
+// this package, so that callers that compress with gzip are understood, and
+// answered in kind, by proxies that use it.
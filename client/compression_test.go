@@ -0,0 +1,98 @@
+package client
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/grpc/encoding/gzip"
+)
+
+// countingCompressor is gzip under another name, which counts the messages
+// it compresses.
+type countingCompressor struct {
+	encoding.Compressor
+	compressed int32
+}
+
+func (c *countingCompressor) Name() string {
+	return "counting-gzip"
+}
+
+func (c *countingCompressor) Compress(w io.Writer) (io.WriteCloser, error) {
+	atomic.AddInt32(&c.compressed, 1)
+	return c.Compressor.Compress(w)
+}
+
+var counting = &countingCompressor{Compressor: encoding.GetCompressor(gzip.Name)}
+
+func init() {
+	encoding.RegisterCompressor(counting)
+}
+
+// serveCached serves testMethod through the interceptor's server part on a
+// local port, from a handler that fails the test if it is called.
+func serveCached(test *testing.T, interceptor *InmemoryCachingInterceptor) (string, func()) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		test.Fatalf("Failed to listen: %v", err)
+	}
+	server := grpc.NewServer(grpc.UnaryInterceptor(interceptor.UnaryServerInterceptor(discardLog)))
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Service",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Method",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, unary grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &wrappers.StringValue{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+				return unary(ctx, req, info, func(ctx context.Context, req interface{}) (interface{}, error) {
+					test.Errorf("Wanted the response served from cache")
+					return &wrappers.StringValue{Value: "upstream"}, nil
+				})
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+	return listener.Addr().String(), server.Stop
+}
+
+func TestCompressedCallsAreServedFromCache(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	target, stop := serveCached(test, interceptor)
+	defer stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := grpc.DialContext(ctx, target, grpc.WithInsecure(), grpc.WithBlock())
+	if err != nil {
+		test.Fatalf("Failed to dial: %v", err)
+	}
+	defer conn.Close()
+
+	for _, compressor := range []string{gzip.Name, counting.Name()} {
+		reply := &wrappers.StringValue{}
+		if err := conn.Invoke(ctx, testMethod, req, reply, grpc.UseCompressor(compressor)); err != nil {
+			test.Fatalf("Wanted no error with %s, got %v", compressor, err)
+		}
+		if reply.Value != "cached" {
+			test.Errorf("Wanted cached response with %s, got %s", compressor, reply.Value)
+		}
+	}
+
+	// the request, and the cached response
+	if got := atomic.LoadInt32(&counting.compressed); got != 2 {
+		test.Errorf("Wanted the cached response compressed like the request, got %d compressed messages", got)
+	}
+}
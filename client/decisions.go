@@ -0,0 +1,132 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Outcome is what the interceptor decided to do with a call.
+type Outcome int
+
+const (
+	// Hit means that the call was served from cache.
+	Hit Outcome = iota
+	// Miss means that no cached response was found for the call.
+	Miss
+	// Bypass means that the caller asked for the cache to be bypassed.
+	Bypass
+	// Store means that the upstream response was stored in cache.
+	Store
+)
+
+func (o Outcome) String() string {
+	switch o {
+	case Hit:
+		return "hit"
+	case Miss:
+		return "miss"
+	case Bypass:
+		return "bypass"
+	case Store:
+		return "store"
+	default:
+		return "unknown"
+	}
+}
+
+// Decision records how the interceptor handled a call.
+type Decision struct {
+	Time    time.Time
+	Method  string
+	Key     string
+	Outcome Outcome
+	// TTL is how long the response was stored, for Store decisions.
+	TTL time.Duration
+}
+
+// decisionLog is a ring buffer of the most recent decisions.
+type decisionLog struct {
+	decisions []Decision
+	next      int
+	full      bool
+
+	mux sync.Mutex
+}
+
+// record the decision, overwriting the oldest one if the log is full.
+func (l *decisionLog) record(size int, decision Decision) {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if len(l.decisions) != size {
+		l.decisions = make([]Decision, size)
+		l.next = 0
+		l.full = false
+	}
+
+	l.decisions[l.next] = decision
+	l.next = (l.next + 1) % size
+	if l.next == 0 {
+		l.full = true
+	}
+}
+
+// recent returns the recorded decisions, oldest first.
+func (l *decisionLog) recent() []Decision {
+	l.mux.Lock()
+	defer l.mux.Unlock()
+
+	if !l.full {
+		return append([]Decision(nil), l.decisions[:l.next]...)
+	}
+	return append(append([]Decision(nil), l.decisions[l.next:]...), l.decisions[:l.next]...)
+}
+
+// recordDecision counts hits and misses, remembers the decision, if
+// decisions are being recorded, and reports hits and misses to the Metrics
+// recorder, if there is one.
+func (interceptor *InmemoryCachingInterceptor) recordDecision(method, key string, outcome Outcome, ttl time.Duration) {
+	switch outcome {
+	case Hit:
+		atomic.AddUint64(&interceptor.stats.hits, 1)
+	case Miss:
+		atomic.AddUint64(&interceptor.stats.misses, 1)
+	}
+
+	if interceptor.Metrics != nil {
+		switch outcome {
+		case Hit:
+			interceptor.Metrics.CacheHit(method)
+		case Miss:
+			interceptor.Metrics.CacheMiss(method)
+		}
+	}
+
+	if interceptor.DecisionHistory <= 0 {
+		return
+	}
+	interceptor.decisions.record(interceptor.DecisionHistory, Decision{
+		Time:    time.Now(),
+		Method:  method,
+		Key:     key,
+		Outcome: outcome,
+		TTL:     ttl,
+	})
+}
+
+// RecentDecisions returns the most recent decisions made by the
+// interceptor, oldest first. At most DecisionHistory decisions are kept.
+func (interceptor *InmemoryCachingInterceptor) RecentDecisions() []Decision {
+	return interceptor.decisions.recent()
+}
+
+// LastDecision returns the most recent decision made by the interceptor, and
+// false if there is none.
+func (interceptor *InmemoryCachingInterceptor) LastDecision() (Decision, bool) {
+	decisions := interceptor.RecentDecisions()
+	if len(decisions) == 0 {
+		return Decision{}, false
+	}
+	return decisions[len(decisions)-1], true
+}
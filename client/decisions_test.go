@@ -0,0 +1,114 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+func TestDecisionsRecordHitThenMiss(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.DecisionHistory = 10
+	cached := &wrappers.StringValue{Value: "cached"}
+	uncached := &wrappers.StringValue{Value: "uncached"}
+	cachedKey := interceptor.key(context.Background(), testMethod, cached)
+	interceptor.Cache.Set(cachedKey, &wrappers.StringValue{Value: "resp"}, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	if _, ok := interceptor.LastDecision(); ok {
+		test.Errorf("Wanted no decision before any call")
+	}
+
+	serve(interceptor, context.Background(), cached, handler)
+	serve(interceptor, context.Background(), uncached, handler)
+
+	decisions := interceptor.RecentDecisions()
+	if len(decisions) != 2 {
+		test.Fatalf("Wanted 2 decisions, got %v", decisions)
+	}
+	if decisions[0].Outcome != Hit || decisions[0].Key != cachedKey || decisions[0].Method != testMethod {
+		test.Errorf("Wanted hit on %s, got %v", cachedKey, decisions[0])
+	}
+	if decisions[1].Outcome != Miss {
+		test.Errorf("Wanted miss, got %v", decisions[1])
+	}
+	if last, ok := interceptor.LastDecision(); !ok || last != decisions[1] {
+		test.Errorf("Wanted last decision %v, got %v", decisions[1], last)
+	}
+}
+
+func TestDecisionsAreBounded(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.DecisionHistory = 3
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	for _, value := range []string{"0", "1", "2", "3", "4"} {
+		serve(interceptor, context.Background(), &wrappers.StringValue{Value: value}, handler)
+	}
+
+	decisions := interceptor.RecentDecisions()
+	if len(decisions) != 3 {
+		test.Fatalf("Wanted 3 decisions, got %d", len(decisions))
+	}
+	for i, value := range []string{"2", "3", "4"} {
+		key := interceptor.key(context.Background(), testMethod, (&wrappers.StringValue{Value: value}))
+		if decisions[i].Key != key {
+			test.Errorf("Wanted decision %d for request %s, got %v", i, value, decisions[i])
+		}
+	}
+}
+
+// countingRecorder is a metrics.Recorder that counts hits and misses, and
+// the bytes saved.
+type countingRecorder struct {
+	hits, misses map[string]int
+	// the bytes saved by hits
+	saved map[string]int
+	mux   sync.Mutex
+}
+
+func (r *countingRecorder) CacheHit(method string) {
+	r.mux.Lock()
+	r.hits[method]++
+	r.mux.Unlock()
+}
+
+func (r *countingRecorder) CacheMiss(method string) {
+	r.mux.Lock()
+	r.misses[method]++
+	r.mux.Unlock()
+}
+
+func (r *countingRecorder) Saved(method string, bytes int, upstreamTime time.Duration) {
+	r.mux.Lock()
+	r.saved[method] += bytes
+	r.mux.Unlock()
+}
+
+func (r *countingRecorder) EstimatedMaxAge(method string, maxAge time.Duration) {}
+
+func TestMetricsRecordHitsAndMisses(test *testing.T) {
+	recorder := &countingRecorder{hits: make(map[string]int), misses: make(map[string]int), saved: make(map[string]int)}
+	interceptor := newTestInterceptor()
+	interceptor.Metrics = recorder
+
+	counter := &callCounter{calls: make(map[string]int)}
+	serverInterceptor := interceptor.UnaryServerInterceptor(discardLog)
+	handler := proxyHandler(interceptor, counter.invoker)
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	for i := 0; i < 3; i++ {
+		serverInterceptor(context.Background(), &wrappers.StringValue{Value: "req"}, info, handler)
+	}
+
+	if recorder.misses[testMethod] != 1 || recorder.hits[testMethod] != 2 {
+		test.Errorf("Wanted 1 miss and 2 hits, got %d and %d", recorder.misses[testMethod], recorder.hits[testMethod])
+	}
+	if want := 2 * proto.Size(&wrappers.StringValue{Value: "fresh"}); recorder.saved[testMethod] != want {
+		test.Errorf("Wanted %d bytes saved by the hits, got %d", want, recorder.saved[testMethod])
+	}
+}
@@ -0,0 +1,189 @@
+package client
+
+import (
+	"encoding/binary"
+	"log/slog"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	bolt "go.etcd.io/bbolt"
+)
+
+// diskBucket is the bolt bucket that holds the cached responses.
+var diskBucket = []byte("responses")
+
+// DiskCache is a Cache that stores responses in a bolt database file, so
+// that they survive restarts of the reverse proxy. Only proto.Message
+// responses, and server streams of them, can be stored. Values are stored
+// after the big-endian Unix nanoseconds at which they expire, or zero if
+// they never do, and expired values are removed when they are looked up.
+type DiskCache struct {
+	// Logger, if set, receives the logs of failing database operations,
+	// e.g. the Logger of the interceptor that uses the cache. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+
+	db    *bolt.DB
+	codec valueCodec
+}
+
+// compile-time check that we adhere to interface
+var _ Cache = (*DiskCache)(nil)
+
+// NewDiskCache opens, or creates, the database file at path. Responses
+// stored there by earlier processes are served until they expire.
+// Prototypes of the response messages are used to decode values whose
+// types are not in the global protobuf registry.
+func NewDiskCache(path string, prototypes ...proto.Message) (*DiskCache, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(diskBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	c := &DiskCache{db: db, codec: newValueCodec()}
+	c.codec.register(prototypes...)
+	return c, nil
+}
+
+// logger returns the Logger of the cache, or the default one.
+func (c *DiskCache) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// Close the database file.
+func (c *DiskCache) Close() error {
+	return c.db.Close()
+}
+
+// Get the value for the key from disk. Values that cannot be read or decoded
+// are treated as not found, and expired ones are removed.
+func (c *DiskCache) Get(key string) (interface{}, bool) {
+	var data []byte
+	expired := false
+	err := c.db.View(func(tx *bolt.Tx) error {
+		stored := tx.Bucket(diskBucket).Get([]byte(key))
+		if len(stored) < 8 {
+			return nil
+		}
+		if expiresAt := int64(binary.BigEndian.Uint64(stored)); expiresAt != 0 && time.Now().UnixNano() >= expiresAt {
+			expired = true
+			return nil
+		}
+		// stored is only valid within the transaction
+		data = append([]byte(nil), stored[8:]...)
+		return nil
+	})
+	if err != nil {
+		c.logger().Warn("Failed to get value from disk", "key", key, "error", err)
+		return nil, false
+	}
+	if expired {
+		c.Delete(key)
+		return nil, false
+	}
+	if data == nil {
+		return nil, false
+	}
+
+	value, err := c.codec.decode(data)
+	if err != nil {
+		c.logger().Warn("Failed to decode value from disk", "key", key, "error", err)
+		return nil, false
+	}
+	return value, true
+}
+
+// Set the value for the key on disk, expiring it after the ttl, unless it is
+// zero or less.
+func (c *DiskCache) Set(key string, value interface{}, ttl time.Duration) {
+	data, err := c.codec.encode(value)
+	if err != nil {
+		c.logger().Warn("Failed to encode value for disk", "key", key, "error", err)
+		return
+	}
+
+	stored := make([]byte, 8, 8+len(data))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(stored, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	stored = append(stored, data...)
+
+	err = c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Put([]byte(key), stored)
+	})
+	if err != nil {
+		c.logger().Warn("Failed to set value on disk", "key", key, "error", err)
+	}
+}
+
+// Delete the value for the key from disk.
+func (c *DiskCache) Delete(key string) {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).Delete([]byte(key))
+	})
+	if err != nil {
+		c.logger().Warn("Failed to delete value from disk", "key", key, "error", err)
+	}
+}
+
+// ItemCount returns the number of values on disk, including expired ones
+// that have not been looked up since.
+func (c *DiskCache) ItemCount() int {
+	count := 0
+	c.db.View(func(tx *bolt.Tx) error {
+		count = tx.Bucket(diskBucket).Stats().KeyN
+		return nil
+	})
+	return count
+}
+
+// Expirations returns the unexpired values on disk by when they expire, or
+// the zero time if they never do.
+func (c *DiskCache) Expirations() map[string]time.Time {
+	now := time.Now().UnixNano()
+	expirations := make(map[string]time.Time)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(diskBucket).ForEach(func(key, stored []byte) error {
+			if len(stored) < 8 {
+				return nil
+			}
+			switch expiresAt := int64(binary.BigEndian.Uint64(stored)); {
+			case expiresAt == 0:
+				expirations[string(key)] = time.Time{}
+			case now < expiresAt:
+				expirations[string(key)] = time.Unix(0, expiresAt)
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		c.logger().Warn("Failed to list values on disk", "error", err)
+	}
+	return expirations
+}
+
+// Flush removes all values from disk.
+func (c *DiskCache) Flush() {
+	err := c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(diskBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(diskBucket)
+		return err
+	})
+	if err != nil {
+		c.logger().Warn("Failed to flush values on disk", "error", err)
+	}
+}
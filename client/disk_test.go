@@ -0,0 +1,126 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newTestDiskCache(test *testing.T) (*DiskCache, string) {
+	dir, err := ioutil.TempDir("", "diskcache")
+	if err != nil {
+		test.Fatalf("Unable to create directory: %v", err)
+	}
+	path := filepath.Join(dir, "cache.db")
+
+	c, err := NewDiskCache(path)
+	if err != nil {
+		test.Fatalf("Unable to open disk cache: %v", err)
+	}
+	return c, path
+}
+
+func TestDiskCacheSurvivesRestart(test *testing.T) {
+	c, path := newTestDiskCache(test)
+	defer os.RemoveAll(filepath.Dir(path))
+
+	c.Set("message", &wrappers.StringValue{Value: "resp"}, time.Minute)
+	c.Set("stream", []proto.Message{&wrappers.StringValue{Value: "0"}, &wrappers.Int64Value{Value: 1}}, time.Minute)
+	c.Set("entry", &entry{value: &wrappers.StringValue{Value: "soft"}, freshUntil: time.Now().Add(time.Minute)}, 2*time.Minute)
+	c.Delete("stream")
+	if err := c.Close(); err != nil {
+		test.Fatalf("Unable to close disk cache: %v", err)
+	}
+
+	c, err := NewDiskCache(path)
+	if err != nil {
+		test.Fatalf("Unable to reopen disk cache: %v", err)
+	}
+	defer c.Close()
+
+	value, found := c.Get("message")
+	if !found || !proto.Equal(value.(proto.Message), &wrappers.StringValue{Value: "resp"}) {
+		test.Errorf("Wanted stored message after restart, got %v (found %v)", value, found)
+	}
+	value, found = c.Get("entry")
+	if e, ok := value.(*entry); !found || !ok || !proto.Equal(e.value.(proto.Message), &wrappers.StringValue{Value: "soft"}) {
+		test.Errorf("Wanted stored entry after restart, got %v (found %v)", value, found)
+	}
+	if _, found := c.Get("stream"); found {
+		test.Errorf("Wanted deleted stream to be gone")
+	}
+}
+
+func TestDiskCacheExpires(test *testing.T) {
+	c, path := newTestDiskCache(test)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer c.Close()
+
+	c.Set("message", &wrappers.StringValue{Value: "resp"}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	if _, found := c.Get("message"); found {
+		test.Errorf("Wanted expired message to be gone")
+	}
+	c.db.View(func(tx *bolt.Tx) error {
+		if tx.Bucket(diskBucket).Get([]byte("message")) != nil {
+			test.Errorf("Wanted expired message to be purged")
+		}
+		return nil
+	})
+}
+
+func TestDiskCacheAsBackend(test *testing.T) {
+	c, path := newTestDiskCache(test)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer c.Close()
+
+	interceptor := newTestInterceptor()
+	interceptor.Backend = c
+	req := &wrappers.StringValue{Value: "req"}
+
+	err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("resp"))
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "upstream"}}
+	resp, _, err := serve(interceptor, context.Background(), req, handler)
+	if err != nil || handler.calls != 0 || resp.(*wrappers.StringValue).Value != "resp" {
+		test.Errorf("Wanted hit from disk, got %v (%d calls, %v)", resp, handler.calls, err)
+	}
+}
+
+func TestDiskCacheListsAndFlushes(test *testing.T) {
+	c, path := newTestDiskCache(test)
+	defer os.RemoveAll(filepath.Dir(path))
+	defer c.Close()
+
+	c.Set("live", &wrappers.StringValue{Value: "resp"}, time.Minute)
+	c.Set("expired", &wrappers.StringValue{Value: "resp"}, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	expirations := c.Expirations()
+	if _, found := expirations["expired"]; found || len(expirations) != 1 {
+		test.Errorf("Wanted only the live value listed, got %v", expirations)
+	}
+	if ttl := time.Until(expirations["live"]); ttl <= 0 || ttl > time.Minute {
+		test.Errorf("Wanted the live value to expire within a minute, got %v", ttl)
+	}
+
+	c.Flush()
+	if got := c.ItemCount(); got != 0 {
+		test.Errorf("Wanted nothing on disk after flush, got %d values", got)
+	}
+	c.Set("after", &wrappers.StringValue{Value: "resp"}, time.Minute)
+	if _, found := c.Get("after"); !found {
+		test.Errorf("Wanted the cache usable after flush")
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// refreshTimeout bounds how long a background refresh of a stale entry may
+// wait for the upstream service.
+const refreshTimeout = time.Duration(10 * time.Second)
+
+// entry is a cached value with a soft TTL. Until freshUntil, it is served as
+// usual. After that, and until the cache expires it at its hard TTL, it is
+// still served, but also refreshed in the background. Unary responses are
+// stored as entries, with a soft TTL that is the hard one unless there is a
+// stale window, so that their age is known. Other values are stored as-is,
+// and are fresh until they expire.
+type entry struct {
+	value      interface{}
+	freshUntil time.Time
+	// when the value was stored, or the zero time if unknown
+	storedAt time.Time
+	// whether the response was marked must-revalidate, which means that it
+	// is never served once stale, but fetched from upstream again
+	mustRevalidate bool
+}
+
+// unwrapEntry returns the value of a cached value, and whether it is stale.
+func unwrapEntry(cached interface{}) (interface{}, bool) {
+	if e, ok := cached.(*entry); ok {
+		return e.value, time.Now().After(e.freshUntil)
+	}
+	return cached, false
+}
+
+// entryAge returns how long ago a cached value was stored, and whether that
+// is known at all.
+func entryAge(cached interface{}) (time.Duration, bool) {
+	e, ok := cached.(*entry)
+	if !ok || e.storedAt.IsZero() {
+		return 0, false
+	}
+	return time.Since(e.storedAt), true
+}
+
+// reportAge calls the StaleResponseCallback for a cached value that is being
+// served, if it is old enough. Values whose age is unknown are skipped.
+func (interceptor *InmemoryCachingInterceptor) reportAge(method string, cached interface{}) {
+	if interceptor.StaleResponseCallback == nil {
+		return
+	}
+	age, known := entryAge(cached)
+	if !known {
+		return
+	}
+
+	ttl := cached.(*entry).freshUntil.Sub(cached.(*entry).storedAt)
+	if age.Seconds() < ttl.Seconds()*interceptor.StaleResponseThreshold {
+		return
+	}
+	interceptor.StaleResponseCallback(method, age, ttl)
+}
+
+// detachedContext returns a context for background work on behalf of a call,
+// which may well be finished before the work is, so only the metadata of the
+// call is carried over.
+func detachedContext(ctx context.Context) context.Context {
+	detached := context.Background()
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		detached = metadata.NewIncomingContext(detached, md)
+	}
+	return detached
+}
+
+// inFlight is a set of keys that background work is under way for.
+type inFlight struct {
+	keys map[string]struct{}
+	mux  sync.Mutex
+}
+
+// start adds the key to the set, and tells whether it was not in it yet, in
+// which case the caller is to do the work, and then call done.
+func (f *inFlight) start(key string) bool {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	if _, found := f.keys[key]; found {
+		return false
+	}
+	if f.keys == nil {
+		f.keys = make(map[string]struct{})
+	}
+	f.keys[key] = struct{}{}
+	return true
+}
+
+// done removes the key from the set.
+func (f *inFlight) done(key string) {
+	f.mux.Lock()
+	defer f.mux.Unlock()
+
+	delete(f.keys, key)
+}
+
+// refresh fetches a fresh response for a stale entry via the handler, which
+// stores it in cache like any other upstream response. The key must have
+// been started among the refreshes, so that stale hits of the same entry do
+// not each refresh it.
+func (interceptor *InmemoryCachingInterceptor) refresh(ctx context.Context, key string, method string, req interface{}, handler grpc.UnaryHandler) {
+	defer interceptor.refreshes.done(key)
+
+	refreshCtx, cancel := context.WithTimeout(detachedContext(ctx), refreshTimeout)
+	defer cancel()
+
+	if _, err := handler(refreshCtx, req); err != nil {
+		interceptor.logger().Warn("Failed to refresh stale response", "method", method, "error", err)
+		return
+	}
+	interceptor.logCall("Refreshed stale response", "method", method)
+}
@@ -0,0 +1,314 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// staleInvoker is a grpc.UnaryInvoker which answers with the given value,
+// fresh for max-age seconds, and then stale for stale-while-revalidate.
+func staleInvoker(value string, maxAge, stale string) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*wrappers.StringValue).Value = value
+		for _, opt := range opts {
+			if header, ok := opt.(grpc.HeaderCallOption); ok {
+				*header.HeaderAddr = metadata.Pairs("cache-control", "max-age="+maxAge+", stale-while-revalidate="+stale)
+			}
+		}
+		return nil
+	}
+}
+
+// refreshingHandler is a grpc.UnaryHandler which fetches responses through
+// the interceptor's client part, as a reverse proxy would.
+type refreshingHandler struct {
+	interceptor *InmemoryCachingInterceptor
+	invoker     grpc.UnaryInvoker
+	calls       sync.WaitGroup
+	count       int
+	mux         sync.Mutex
+
+	// the headers of the last response served
+	header metadata.MD
+}
+
+func (h *refreshingHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	defer h.calls.Done()
+	h.mux.Lock()
+	h.count++
+	h.mux.Unlock()
+
+	reply := &wrappers.StringValue{}
+	err := h.interceptor.UnaryClientInterceptor()(ctx, testMethod, req, reply, nil, h.invoker)
+	return reply, err
+}
+
+func (h *refreshingHandler) serve(test *testing.T, req *wrappers.StringValue, expectCall bool) string {
+	if expectCall {
+		h.calls.Add(1)
+	}
+	stream := &headerCapture{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	resp, err := h.interceptor.UnaryServerInterceptor(discardLog)(ctx, req, info, h.handle)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	h.calls.Wait()
+	h.header = stream.header
+	return resp.(*wrappers.StringValue).Value
+}
+
+func TestSoftAndHardTTL(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &refreshingHandler{interceptor: interceptor, invoker: staleInvoker("first", "60", "60")}
+
+	if got := handler.serve(test, req, true); got != "first" || handler.count != 1 {
+		test.Fatalf("Wanted miss fetching first response, got %s (%d calls)", got, handler.count)
+	}
+
+	// Within the soft TTL, the entry is served without refresh.
+	handler.invoker = staleInvoker("second", "60", "60")
+	if got := handler.serve(test, req, false); got != "first" || handler.count != 1 {
+		test.Errorf("Wanted fresh hit without refresh, got %s (%d calls)", got, handler.count)
+	}
+	if got := handler.header.Get("x-cache"); len(got) != 1 || got[0] != "hit" {
+		test.Errorf("Wanted x-cache: hit, got %v", got)
+	}
+
+	// Between the soft and hard TTL, the stale entry is served, and
+	// refreshed in the background.
+	key := interceptor.key(context.Background(), testMethod, req)
+	cached, _ := interceptor.Cache.Get(key)
+	cached.(*entry).freshUntil = time.Now().Add(-1 * time.Second)
+	if got := handler.serve(test, req, true); got != "first" || handler.count != 2 {
+		test.Errorf("Wanted stale hit with refresh, got %s (%d calls)", got, handler.count)
+	}
+	if got := handler.header.Get("x-cache"); len(got) != 1 || got[0] != "stale" {
+		test.Errorf("Wanted x-cache: stale, got %v", got)
+	}
+	if got := handler.serve(test, req, false); got != "second" {
+		test.Errorf("Wanted refreshed response, got %s", got)
+	}
+
+	// Beyond the hard TTL, the entry is gone.
+	value, _ := interceptor.Cache.Get(key)
+	interceptor.Cache.Set(key, value, time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	handler.invoker = staleInvoker("third", "60", "60")
+	if got := handler.serve(test, req, true); got != "third" || handler.count != 3 {
+		test.Errorf("Wanted miss beyond hard TTL, got %s (%d calls)", got, handler.count)
+	}
+}
+
+func TestSoftTTLExtendsStorage(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.DecisionHistory = 1
+	req := &wrappers.StringValue{Value: "req"}
+
+	interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, staleInvoker("resp", "10", "20"))
+	if last, _ := interceptor.LastDecision(); last.Outcome != Store || last.TTL != 30*time.Second {
+		test.Errorf("Wanted response stored for its hard TTL of 30s, got %v", last)
+	}
+}
+
+// ageRecorder is a StaleResponseCallback that remembers what it is called
+// with.
+type ageRecorder struct {
+	ages []time.Duration
+	ttls []time.Duration
+}
+
+func (r *ageRecorder) record(method string, age, ttl time.Duration) {
+	r.ages = append(r.ages, age)
+	r.ttls = append(r.ttls, ttl)
+}
+
+func TestStaleResponseCallbackGetsAgeOfHits(test *testing.T) {
+	interceptor := newTestInterceptor()
+	recorder := &ageRecorder{}
+	interceptor.StaleResponseCallback = recorder.record
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &refreshingHandler{interceptor: interceptor, invoker: cacheableInvoker("first")}
+
+	handler.serve(test, req, true)
+	if len(recorder.ages) != 0 {
+		test.Fatalf("Wanted no callback for a miss, got %v", recorder.ages)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	if got := handler.serve(test, req, false); got != "first" {
+		test.Fatalf("Wanted cached response, got %s", got)
+	}
+	if len(recorder.ages) != 1 || recorder.ages[0] < 10*time.Millisecond || recorder.ages[0] > time.Second {
+		test.Errorf("Wanted callback with an age of about 10ms, got %v", recorder.ages)
+	}
+	if len(recorder.ttls) != 1 || recorder.ttls[0] != time.Minute {
+		test.Errorf("Wanted callback with the 60 second max-age, got %v", recorder.ttls)
+	}
+	if got := handler.header.Get("x-cache"); len(got) != 1 || got[0] != "hit" {
+		test.Errorf("Wanted a fresh hit, got %v", got)
+	}
+}
+
+func TestStaleResponseCallbackThreshold(test *testing.T) {
+	interceptor := newTestInterceptor()
+	recorder := &ageRecorder{}
+	interceptor.StaleResponseCallback = recorder.record
+	interceptor.StaleResponseThreshold = 0.5
+	req := &wrappers.StringValue{Value: "req"}
+	key := interceptor.key(context.Background(), testMethod, req)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	now := time.Now()
+	interceptor.Cache.Set(key, &entry{value: &wrappers.StringValue{Value: "young"}, freshUntil: now.Add(50 * time.Second), storedAt: now.Add(-10 * time.Second)}, time.Minute)
+	serve(interceptor, context.Background(), req, handler)
+	if len(recorder.ages) != 0 {
+		test.Errorf("Wanted no callback below the threshold, got %v", recorder.ages)
+	}
+
+	interceptor.Cache.Set(key, &entry{value: &wrappers.StringValue{Value: "old"}, freshUntil: now.Add(20 * time.Second), storedAt: now.Add(-40 * time.Second)}, time.Minute)
+	serve(interceptor, context.Background(), req, handler)
+	if len(recorder.ages) != 1 || recorder.ttls[0] != time.Minute {
+		test.Errorf("Wanted one callback above the threshold, got ages %v and ttls %v", recorder.ages, recorder.ttls)
+	}
+}
+
+func TestAgeHeaderGrows(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &refreshingHandler{interceptor: interceptor, invoker: cacheableInvoker("first")}
+
+	handler.serve(test, req, true)
+	if got := handler.header.Get("age"); len(got) != 0 {
+		test.Errorf("Wanted no age for a miss, got %v", got)
+	}
+
+	handler.serve(test, req, false)
+	if got := handler.header.Get("age"); len(got) != 1 || got[0] != "0" {
+		test.Errorf("Wanted age 0 for a hit right away, got %v", got)
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+	handler.serve(test, req, false)
+	if got := handler.header.Get("age"); len(got) != 1 || got[0] != "1" {
+		test.Errorf("Wanted age 1 for a hit a second later, got %v", got)
+	}
+	if got := handler.header.Get("x-cache"); len(got) != 1 || got[0] != "hit" {
+		test.Errorf("Wanted age sent alongside x-cache, got %v", handler.header)
+	}
+}
+
+func TestNoAgeHeaderForUnknownAge(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+
+	_, header, err := serve(interceptor, context.Background(), req, &countingHandler{})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := header.Get("age"); len(got) != 0 {
+		test.Errorf("Wanted no age for a value stored without a time, got %v", got)
+	}
+}
+
+// headerInvoker is a grpc.UnaryInvoker which answers with the given value,
+// and cache-control header.
+func headerInvoker(value string, cacheControl string) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*wrappers.StringValue).Value = value
+		for _, opt := range opts {
+			if header, ok := opt.(grpc.HeaderCallOption); ok {
+				*header.HeaderAddr = metadata.Pairs("cache-control", cacheControl)
+			}
+		}
+		return nil
+	}
+}
+
+func TestMustRevalidateIsStoredWithEntry(test *testing.T) {
+	cc := ParseCacheControl([]string{"must-revalidate, max-age=60"})
+	if !cc.MustRevalidate || cc.MaxAge != 60 {
+		test.Fatalf("Wanted must-revalidate with max-age 60, got %+v", cc)
+	}
+
+	interceptor := newTestInterceptor()
+	interceptor.DecisionHistory = 1
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, headerInvoker("resp", "must-revalidate, max-age=60, stale-while-revalidate=60"))
+
+	cached, found := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, req))
+	if !found || !cached.(*entry).mustRevalidate {
+		test.Fatalf("Wanted the must-revalidate flag on the stored entry, got %+v", cached)
+	}
+	if last, _ := interceptor.LastDecision(); last.TTL != 60*time.Second {
+		test.Errorf("Wanted no stale window for a response that must be revalidated, got ttl %v", last.TTL)
+	}
+
+	interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("resp"))
+	if cached, _ := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, req)); cached.(*entry).mustRevalidate {
+		test.Errorf("Wanted no must-revalidate flag without the directive")
+	}
+}
+
+func TestMustRevalidateSurvivesEncoding(test *testing.T) {
+	codec := newValueCodec()
+	for _, mustRevalidate := range []bool{true, false} {
+		stored := &entry{value: &wrappers.StringValue{Value: "resp"}, freshUntil: time.Now(), storedAt: time.Now(), mustRevalidate: mustRevalidate}
+		data, err := codec.encode(stored)
+		if err != nil {
+			test.Fatalf("Wanted entry encoded, got %v", err)
+		}
+		decoded, err := codec.decode(data)
+		if err != nil {
+			test.Fatalf("Wanted entry decoded, got %v", err)
+		}
+		if got := decoded.(*entry).mustRevalidate; got != mustRevalidate {
+			test.Errorf("Wanted must-revalidate %v after decoding, got %v", mustRevalidate, got)
+		}
+	}
+}
+
+func TestConcurrentStaleHitsRefreshOnce(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	key := interceptor.key(context.Background(), testMethod, req)
+	now := time.Now()
+	interceptor.backend().Set(key, &entry{value: &wrappers.StringValue{Value: "stale"}, freshUntil: now.Add(-time.Second), storedAt: now.Add(-time.Minute)}, time.Minute)
+
+	var refreshes int32
+	release := make(chan struct{})
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		atomic.AddInt32(&refreshes, 1)
+		<-release
+		return &wrappers.StringValue{Value: "fresh"}, nil
+	}
+
+	var served sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		served.Add(1)
+		go func() {
+			defer served.Done()
+			ctx := grpc.NewContextWithServerTransportStream(context.Background(), &headerCapture{})
+			interceptor.UnaryServerInterceptor(discardLog)(ctx, req, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+		}()
+	}
+	served.Wait()
+
+	// let any redundant refreshes catch up before the first one finishes
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	if got := atomic.LoadInt32(&refreshes); got != 1 {
+		test.Errorf("Wanted a single refresh for concurrent stale hits, got %d", got)
+	}
+}
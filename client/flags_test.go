@@ -0,0 +1,54 @@
+package client
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/llarsson/grpc-caching-interceptors/flags"
+	"google.golang.org/grpc"
+)
+
+func TestCachingDisabledByFlag(test *testing.T) {
+	source := flags.Static{Bools: map[string]bool{}}
+	interceptor := newTestInterceptor()
+	interceptor.Flags = source
+
+	counter := &callCounter{calls: make(map[string]int)}
+	serverInterceptor := interceptor.UnaryServerInterceptor(discardLog)
+	handler := proxyHandler(interceptor, counter.invoker)
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	call := func(value string) {
+		if _, err := serverInterceptor(context.Background(), &wrappers.StringValue{Value: value}, info, handler); err != nil {
+			test.Fatalf("Wanted no error, got %v", err)
+		}
+	}
+
+	call("cached")
+	call("cached")
+	if got := counter.calls["cached"]; got != 1 {
+		test.Fatalf("Wanted 1 upstream call with caching enabled, got %d", got)
+	}
+
+	source.Bools[flags.CachingDisabled] = true
+
+	call("cached")
+	if got := counter.calls["cached"]; got != 2 {
+		test.Errorf("Wanted cached response to be bypassed with caching disabled, got %d upstream calls", got)
+	}
+	call("uncached")
+	call("uncached")
+	if got := counter.calls["uncached"]; got != 2 {
+		test.Errorf("Wanted every call upstream with caching disabled, got %d upstream calls", got)
+	}
+	if _, found := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, &wrappers.StringValue{Value: "uncached"})); found {
+		test.Errorf("Wanted nothing stored with caching disabled")
+	}
+
+	source.Bools[flags.CachingDisabled] = false
+
+	call("cached")
+	if got := counter.calls["cached"]; got != 2 {
+		test.Errorf("Wanted cached response to be served again once enabled, got %d upstream calls", got)
+	}
+}
@@ -4,21 +4,29 @@ package client
 
 import (
 	"context"
-	"fmt"
 	"log"
+	"log/slog"
 	"strconv"
-	"strings"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/llarsson/grpc-caching-interceptors/flags"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"golang.org/x/sync/singleflight"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
+// bypassHeader is the metadata key used to request that the cache is
+// bypassed for a single call.
+const bypassHeader = "x-cache-bypass"
+
 // A CachingInterceptor intercepts incoming calls to a reverse proxy's server
 // part, and outgoing calls from the reverse proxy's client part. It should,
 // by contract, cache the responses.
@@ -34,7 +42,145 @@ type CachingInterceptor interface {
 // InmemoryCachingInterceptor is an implementation of CachingInterceptor, which
 // uses an in-memory cache to store objects.
 type InmemoryCachingInterceptor struct {
+	// Cache is the default, in-memory, storage of responses, which is used
+	// unless a Backend is set.
 	Cache cache.Cache
+	// Backend, if set, is where responses are stored instead of Cache.
+	Backend Cache
+
+	// KeyComponents selects which parts of a call make up its cache key.
+	// Defaults to DefaultKeyComponents.
+	KeyComponents KeyComponent
+	// KeyFunc, if set, replaces the request message in the cache key, e.g.
+	// to normalize requests by leaving out fields such as request IDs, so
+	// that requests that only differ in those share a cached response.
+	KeyFunc func(fullMethod string, req proto.Message) string
+	// Vary lists the incoming metadata keys that are part of the cache key,
+	// which adds KeyMetadata to the KeyComponents.
+	Vary []string
+	// TenantHeader is the incoming metadata key that identifies the tenant
+	// when KeyTenant is among the KeyComponents.
+	TenantHeader string
+	// Namespace is folded into every cache key, so that e.g. a new
+	// deployment can use a fresh keyspace in a shared cache. Empty by
+	// default, which means no namespacing.
+	Namespace string
+	// Hasher, if set, hashes cache keys instead of hashing.Default, e.g.
+	// hashing.SHA256 to use a stronger hash function. Changing it changes
+	// all keys.
+	Hasher hashing.Hasher
+
+	// CoherencyCheckRate is the probability with which a cache hit is
+	// compared against a fresh upstream response. Zero disables checks.
+	CoherencyCheckRate float64
+	// CoherencyCheckInterval is the minimum time between two coherency
+	// checks.
+	CoherencyCheckInterval time.Duration
+	// MaxUnverified is how long responses of a method may go without being
+	// verified against the upstream service, according to Verification,
+	// before cached responses of that method are no longer served. Zero
+	// means no limit.
+	MaxUnverified time.Duration
+	// Verification tells when responses of methods were last verified,
+	// e.g. the server package's estimator.
+	Verification VerificationTracker
+
+	// Oracle, if set, is asked for the true response in coherency checks,
+	// instead of upstream, so that the age of stale hits can be measured.
+	Oracle Oracle
+
+	// WarmInterval is how often the hottest entries are refreshed ahead
+	// of their expiration. Zero disables warming.
+	WarmInterval time.Duration
+	// WarmTopK is the number of hottest entries that are kept warm.
+	WarmTopK int
+
+	// MaxResponseSize is the largest response, in bytes, that is stored
+	// in the cache. Zero means no limit.
+	MaxResponseSize int
+
+	// MemoryLimit is the heap usage, in bytes, above which the least
+	// recently used entries are evicted, regardless of their TTL. Zero
+	// disables eviction on memory pressure.
+	MemoryLimit uint64
+	// MemoryCheckInterval is how often heap usage is checked. Defaults to
+	// one second.
+	MemoryCheckInterval time.Duration
+
+	// OverheadThreshold is the time the server interceptor may add to a
+	// call, on top of the upstream call, before the call is logged as
+	// slow. Zero disables logging, but the overhead is always measured.
+	OverheadThreshold time.Duration
+
+	// CacheBidiStreams enables caching of bidirectional streams per
+	// message. Only enable it for services where each request message is
+	// answered by exactly one response message, in order, and where
+	// messages do not depend on those before them in the stream.
+	CacheBidiStreams bool
+
+	// NegativeTTL is how long error responses from upstream, with a status
+	// code among NegativeCacheCodes, are stored in cache and replayed.
+	// Zero disables caching of errors.
+	NegativeTTL time.Duration
+	// NegativeCacheCodes are the status codes of errors that are cached,
+	// e.g. codes.NotFound and codes.Unavailable.
+	NegativeCacheCodes []codes.Code
+
+	// StaleResponseCallback, if set, is called with the age and max-age
+	// of cached responses that are served, once they are older than
+	// StaleResponseThreshold of their max-age. It is called on the response
+	// path, so it must be fast, and must not block.
+	StaleResponseCallback func(method string, age, ttl time.Duration)
+	// StaleResponseThreshold is the fraction of its max-age that a cached
+	// response must be older than for StaleResponseCallback to be called.
+	// Zero means that it is called for every cache hit.
+	StaleResponseThreshold float64
+
+	// Metrics, if set, receives the hits and misses of the cache, and what
+	// the hits saved, e.g. to export them to Prometheus (see the
+	// metrics/prom package).
+	Metrics metrics.Recorder
+
+	// DeduplicateMisses makes concurrent calls that miss the cache with
+	// the same key share a single upstream call, rather than each making
+	// one, e.g. when a popular entry expires. Calls that bypass the cache
+	// are never shared.
+	DeduplicateMisses bool
+
+	// Flags, if set, are consulted on every call, so that caching can be
+	// turned off by an external feature-flag system (see the flags
+	// package).
+	Flags flags.Source
+
+	// Logger, if set, receives the operational logs of the interceptor,
+	// e.g. to filter them by level or emit them as JSON. Defaults to
+	// slog.Default(). The CSV log of the server interceptor is separate.
+	Logger *slog.Logger
+	// LogSampleRate is the fraction of calls, e.g. 0.01, whose records are
+	// logged when they go as expected, to keep busy services from flooding
+	// the logs. Zero logs every call, and a negative rate none of them.
+	// Failures and other events are always logged.
+	LogSampleRate float64
+
+	// DecisionHistory is the number of recent decisions that are kept for
+	// inspection by tests and debugging. Zero disables recording.
+	DecisionHistory int
+
+	decisions decisionLog
+	stats     stats
+	warmer    warmer
+	recency   recency
+	keys      keyIndex
+	flights   singleflight.Group
+	refreshes inFlight
+	// reports heap usage, replaceable for testing
+	heapInUse func() uint64
+
+	quit     chan struct{}
+	quitOnce sync.Once
+	closed   sync.Once
+	warming  sync.Once
+	watching sync.Once
 }
 
 // UnaryServerInterceptor catches all incoming calls, verifies if a suitable
@@ -44,25 +190,90 @@ type InmemoryCachingInterceptor struct {
 func (interceptor *InmemoryCachingInterceptor) UnaryServerInterceptor(csvLog *log.Logger) grpc.UnaryServerInterceptor {
 	csvLog.Printf("timestamp,source,method\n")
 
+	if interceptor.MemoryLimit > 0 {
+		interceptor.watching.Do(interceptor.startPressureWatcher)
+	}
+
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if interceptor.cachingDisabled() {
+			return handler(ctx, req)
+		}
+
+		start := time.Now()
+		var upstream time.Duration
+		defer func() {
+			interceptor.recordOverhead(info.FullMethod, time.Since(start)-upstream, upstream)
+		}()
+
 		reqMessage := req.(proto.Message)
-		requestHash := hashcode.String(reqMessage.String())
-		hash := hashcode.Strings([]string{info.FullMethod, reqMessage.String()})
+		requestHash := hashing.String(reqMessage.String())
+		hash := interceptor.key(ctx, info.FullMethod, reqMessage)
+
+		if interceptor.WarmInterval > 0 {
+			interceptor.warmer.recordAccess(hash, interceptor.WarmTopK)
+		}
 
-		if value, found := interceptor.Cache.Get(hash); found {
-			grpc.SendHeader(ctx, metadata.Pairs("x-cache", "hit"))
-			log.Printf("Using cached response for call to %s(%d)", info.FullMethod, requestHash)
+		if bypassRequested(ctx) {
+			interceptor.logCall("Bypassing cache", "method", info.FullMethod, "hash", requestHash, "cache_status", "bypass")
+			interceptor.recordDecision(info.FullMethod, hash, Bypass, 0)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", false))
+		} else if cached, found := interceptor.backend().Get(hash); found && !interceptor.unverifiedTooLong(info.FullMethod) {
+			value, stale := unwrapEntry(cached)
+			if interceptor.MemoryLimit > 0 {
+				interceptor.recency.touch(hash)
+			}
+			interceptor.recordDecision(info.FullMethod, hash, Hit, 0)
+			if cachedErr, ok := value.(*cachedError); ok {
+				trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", true))
+				interceptor.logCall("Using cached error", "method", info.FullMethod, "hash", requestHash, "code", cachedErr.code.String(), "cache_status", "hit")
+				csvLog.Printf("%d,cache,%s\n", time.Now().UnixNano(), info.FullMethod)
+				grpc.SendHeader(ctx, metadata.Pairs("x-cache", "hit"))
+				return nil, cachedErr.err()
+			}
+			interceptor.recordHit(info.FullMethod, value)
+			interceptor.reportAge(info.FullMethod, cached)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", true))
+			cacheStatus := "hit"
+			if stale {
+				cacheStatus = "stale"
+			}
+			interceptor.logCall("Using cached response", "method", info.FullMethod, "hash", requestHash, "cache_status", cacheStatus)
 			csvLog.Printf("%d,cache,%s\n", time.Now().UnixNano(), info.FullMethod)
-			return value, nil
+			header := metadata.Pairs("x-cache", cacheStatus)
+			if age, known := entryAge(cached); known {
+				header.Set("age", strconv.Itoa(int(age.Seconds())))
+			}
+			grpc.SendHeader(ctx, header)
+			if stale {
+				if interceptor.refreshes.start(hash) {
+					go interceptor.refresh(ctx, hash, info.FullMethod, req, handler)
+				}
+			} else {
+				if interceptor.coherencyCheckDue() {
+					go interceptor.checkCoherency(ctx, info.FullMethod, req, value, handler)
+				}
+			}
+			return cloneValue(value), nil
+		} else {
+			interceptor.recordDecision(info.FullMethod, hash, Miss, 0)
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.hit", false))
 		}
 
-		resp, err := handler(ctx, req)
+		upstreamStart := time.Now()
+		resp, err, shared := interceptor.fetch(ctx, hash, req, handler)
+		upstream = time.Since(upstreamStart)
 		if err != nil {
-			log.Printf("Failed to call upstream %s(%d): %v", info.FullMethod, requestHash, err)
+			interceptor.logger().Warn("Failed to call upstream", "method", info.FullMethod, "hash", requestHash, "error", err)
 			return nil, err
 		}
+		if shared {
+			interceptor.logCall("Using upstream response fetched for concurrent call", "method", info.FullMethod, "hash", requestHash, "cache_status", "miss-shared")
+			grpc.SendHeader(ctx, metadata.Pairs("x-cache", "miss-shared"))
+			return resp, nil
+		}
 
 		csvLog.Printf("%d,upstream,%s(%d)\n", time.Now().UnixNano(), info.FullMethod, requestHash)
+		interceptor.recordUpstream(info.FullMethod, upstream)
 
 		return resp, nil
 	}
@@ -74,42 +285,125 @@ func (interceptor *InmemoryCachingInterceptor) UnaryServerInterceptor(csvLog *lo
 // Subsequent matching operation invocations via the reverse proxy that uses
 // these Interceptors will therefore be served from cache.
 func (interceptor *InmemoryCachingInterceptor) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		reqMessage := req.(proto.Message)
-		requestHash := hashcode.String(reqMessage.String())
-		hash := hashcode.Strings([]string{method, reqMessage.String()})
+	if interceptor.WarmInterval > 0 {
+		interceptor.warming.Do(interceptor.startWarming)
+	}
 
-		var header metadata.MD
-		opts = append(opts, grpc.Header(&header))
-		err := invoker(ctx, method, req, reply, cc, opts...)
-		if err != nil {
-			log.Printf("Error calling upstream: %v", err)
-			return err
-		}
+	return interceptor.invoke
+}
 
-		cacheStatus := "response not stored"
+// invoke the upstream service, and store the response in cache if the
+// cache-control header allows it.
+func (interceptor *InmemoryCachingInterceptor) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	if interceptor.cachingDisabled() {
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
 
-		expiration, _ := cacheExpiration(header.Get("cache-control"))
-		if expiration > 0 {
-			interceptor.Cache.Set(hash, reply, time.Duration(expiration)*time.Second)
-			cacheStatus = fmt.Sprintf("response stored %d seconds", expiration)
-		}
+	hash := interceptor.key(ctx, method, req.(proto.Message))
+	return interceptor.invokeKeyed(ctx, method, hash, req, reply, cc, invoker, opts...)
+}
+
+// invokeKeyed invokes the upstream service, and stores the response under
+// the key if the cache-control header allows it.
+func (interceptor *InmemoryCachingInterceptor) invokeKeyed(ctx context.Context, method string, hash string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+	reqMessage := req.(proto.Message)
+	requestHash := hashing.String(reqMessage.String())
 
-		grpc.SendHeader(ctx, metadata.Pairs("x-cache", "miss"))
-		log.Printf("Fetched upstream response for call to %s(%d) (%s)", method, requestHash, cacheStatus)
+	var header metadata.MD
+	err := invoker(ctx, method, req, reply, cc, append(opts, grpc.Header(&header))...)
+	if err != nil {
+		interceptor.logger().Warn("Failed to call upstream", "method", method, "hash", requestHash, "error", err)
+		interceptor.storeError(ctx, method, hash, err)
+		return err
+	}
+
+	if nilReply(reply) {
+		grpc.SendHeader(ctx, metadata.Pairs("x-cache", "miss-nilreply"))
+		interceptor.logCall("Fetched nil upstream response, not storing it", "method", method, "hash", requestHash, "cache_status", "miss-nilreply")
 		return nil
 	}
+
+	stored := false
+
+	cacheControl := ParseCacheControl(header.Get("cache-control"))
+	expiration := cacheControl.expiration()
+	if expiration > 0 && interceptor.MaxResponseSize > 0 {
+		if size := proto.Size(reply.(proto.Message)); size > interceptor.MaxResponseSize {
+			interceptor.logCall("Response above the size limit for caching", "method", method, "hash", requestHash, "size", size, "limit", interceptor.MaxResponseSize)
+			expiration = -1
+		}
+	}
+	if expiration > 0 && storeAllowed(ctx) {
+		value, ttl := cloneValue(reply), time.Duration(expiration)*time.Second
+		// fresh for max-age, then served stale while refreshed, if there
+		// is a stale window, and revalidation is not required
+		now := time.Now()
+		value = &entry{value: value, freshUntil: now.Add(ttl), storedAt: now, mustRevalidate: cacheControl.MustRevalidate}
+		if staleWindow := cacheControl.StaleWhileRevalidate; staleWindow > 0 && !cacheControl.MustRevalidate {
+			ttl += time.Duration(staleWindow) * time.Second
+		}
+		interceptor.backend().Set(hash, value, ttl)
+		interceptor.keys.add(method, hash, ttl)
+		stored = true
+		interceptor.recordDecision(method, hash, Store, ttl)
+		if interceptor.MemoryLimit > 0 {
+			interceptor.recency.stored(hash, ttl)
+		}
+
+		if interceptor.WarmInterval > 0 {
+			interceptor.warmer.remember(hash, newRefresher(ctx, method, hash, reqMessage, reply.(proto.Message), cc, invoker))
+		}
+	}
+
+	grpc.SendHeader(ctx, metadata.Pairs("x-cache", "miss"))
+	logArgs := []interface{}{"method", method, "hash", requestHash, "cache_status", "miss", "stored", stored}
+	if stored {
+		logArgs = append(logArgs, "max_age", expiration)
+	}
+	interceptor.logCall("Fetched upstream response", logArgs...)
+	return nil
 }
 
-func cacheExpiration(cacheHeaders []string) (int, error) {
-	for _, header := range cacheHeaders {
-		for _, value := range strings.Split(header, ",") {
-			value = strings.Trim(value, " ")
-			if strings.HasPrefix(value, "max-age") {
-				duration := strings.Split(value, "max-age=")[1]
-				return strconv.Atoi(duration)
-			}
+// Close stops the background work of the interceptor.
+func (interceptor *InmemoryCachingInterceptor) Close() {
+	quit := interceptor.quitChannel()
+	interceptor.closed.Do(func() {
+		close(quit)
+	})
+}
+
+// quitChannel returns the channel that is closed when the interceptor is.
+func (interceptor *InmemoryCachingInterceptor) quitChannel() chan struct{} {
+	interceptor.quitOnce.Do(func() {
+		interceptor.quit = make(chan struct{})
+	})
+	return interceptor.quit
+}
+
+// WithCacheBypass returns a context that, when used for a call through the
+// reverse proxy, makes the proxy bypass its cache for that call alone. The
+// response is fetched from upstream, and replaces any cached entry.
+func WithCacheBypass(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, bypassHeader, "true")
+}
+
+// cachingDisabled is a predicate that indicates if caching has been turned
+// off by a flag.
+func (interceptor *InmemoryCachingInterceptor) cachingDisabled() bool {
+	return interceptor.Flags != nil && interceptor.Flags.Bool(flags.CachingDisabled)
+}
+
+// bypassRequested is a predicate that indicates if the incoming call asked
+// for the cache to be bypassed.
+func bypassRequested(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return false
+	}
+	for _, value := range md.Get(bypassHeader) {
+		if value == "true" {
+			return true
 		}
 	}
-	return -1, status.Errorf(codes.Internal, "No cache expiration set for the given object")
+	return false
 }
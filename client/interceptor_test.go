@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/patrickmn/go-cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testMethod = "/test.Service/Method"
+
+var discardLog = log.New(ioutil.Discard, "", 0)
+
+// headerCapture is a grpc.ServerTransportStream which records the headers
+// that the interceptor sends.
+type headerCapture struct {
+	header metadata.MD
+}
+
+func (s *headerCapture) Method() string {
+	return testMethod
+}
+
+func (s *headerCapture) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerCapture) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *headerCapture) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func newTestInterceptor() *InmemoryCachingInterceptor {
+	return &InmemoryCachingInterceptor{Cache: *cache.New(time.Minute, time.Minute)}
+}
+
+// countingHandler is a grpc.UnaryHandler which answers with its response,
+// counting the number of times it has been called.
+type countingHandler struct {
+	resp  proto.Message
+	calls int
+}
+
+func (h *countingHandler) handle(ctx context.Context, req interface{}) (interface{}, error) {
+	h.calls++
+	return h.resp, nil
+}
+
+// serve runs the interceptor's server part for a single call.
+func serve(interceptor *InmemoryCachingInterceptor, ctx context.Context, req proto.Message, handler *countingHandler) (interface{}, metadata.MD, error) {
+	stream := &headerCapture{}
+	ctx = grpc.NewContextWithServerTransportStream(ctx, stream)
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+
+	resp, err := interceptor.UnaryServerInterceptor(discardLog)(ctx, req, info, handler.handle)
+	return resp, stream.header, err
+}
+
+func TestCacheBypass(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	resp, _, err := serve(interceptor, context.Background(), req, handler)
+	if err != nil || resp.(*wrappers.StringValue).Value != "cached" || handler.calls != 0 {
+		test.Errorf("Wanted cached response without upstream call, got %v (%d calls, err %v)", resp, handler.calls, err)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(bypassHeader, "true"))
+	resp, _, err = serve(interceptor, ctx, req, handler)
+	if err != nil || resp.(*wrappers.StringValue).Value != "fresh" || handler.calls != 1 {
+		test.Errorf("Wanted fresh response from upstream call, got %v (%d calls, err %v)", resp, handler.calls, err)
+	}
+}
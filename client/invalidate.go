@@ -0,0 +1,111 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// keyIndex keeps track of the keys that have been stored for each method,
+// and of when they expire, since not every backend can list its keys to
+// find those of a method.
+type keyIndex struct {
+	keys map[string]map[string]time.Time
+	// the number of keys of each method after it was last pruned
+	pruned map[string]int
+
+	mux sync.Mutex
+}
+
+// add records that the key of the method was stored for the ttl. Expired
+// keys of the method are pruned whenever its number of keys has doubled, so
+// that the index does not grow beyond what is cached.
+func (index *keyIndex) add(method, key string, ttl time.Duration) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	if index.keys == nil {
+		index.keys = make(map[string]map[string]time.Time)
+		index.pruned = make(map[string]int)
+	}
+	keys, found := index.keys[method]
+	if !found {
+		keys = make(map[string]time.Time)
+		index.keys[method] = keys
+	}
+
+	now := time.Now()
+	keys[key] = now.Add(ttl)
+
+	if len(keys) > 2*index.pruned[method] {
+		for k, expiration := range keys {
+			if now.After(expiration) {
+				delete(keys, k)
+			}
+		}
+		index.pruned[method] = len(keys)
+	}
+}
+
+// remove forgets the key of the method.
+func (index *keyIndex) remove(method, key string) {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	delete(index.keys[method], key)
+}
+
+// take forgets, and returns, all keys of the method.
+func (index *keyIndex) take(method string) []string {
+	index.mux.Lock()
+	defer index.mux.Unlock()
+
+	var taken []string
+	for key := range index.keys[method] {
+		taken = append(taken, key)
+	}
+	delete(index.keys, method)
+	delete(index.pruned, method)
+	return taken
+}
+
+// Invalidate evicts the cached response to the request, e.g. after a write
+// that changes it, so that the next call fetches it from upstream. The key
+// is computed as for a call with the incoming metadata of the context, so
+// responses that are varied by metadata or tenant are evicted for calls
+// with the same metadata, e.g. that of the writing call, or metadata given
+// with metadata.NewIncomingContext. Use InvalidateMethod to evict them for
+// all metadata.
+func (interceptor *InmemoryCachingInterceptor) Invalidate(ctx context.Context, fullMethod string, req proto.Message) {
+	key := interceptor.key(ctx, fullMethod, req)
+	interceptor.backend().Delete(key)
+	interceptor.keys.remove(fullMethod, key)
+	interceptor.recency.remove(key)
+	interceptor.logger().Info("Invalidated cached response", "method", fullMethod, "key", key)
+}
+
+// InvalidateMethod evicts all cached responses of the method. Backends that
+// can list their entries are searched for keys of the method, which finds
+// those stored by other instances sharing the backend too, as long as they
+// use the same Namespace. Otherwise, only those stored by this interceptor
+// are known, and evicted.
+func (interceptor *InmemoryCachingInterceptor) InvalidateMethod(fullMethod string) {
+	keys := interceptor.keys.take(fullMethod)
+	backend := interceptor.backend()
+	if lister, ok := backend.(entryLister); ok && interceptor.keyComponents()&KeyMethod != 0 {
+		prefix := interceptor.keyPrefix(fullMethod)
+		for key := range lister.Expirations() {
+			if strings.HasPrefix(key, prefix) {
+				keys = append(keys, key)
+			}
+		}
+	}
+	for _, key := range keys {
+		backend.Delete(key)
+		interceptor.recency.remove(key)
+	}
+	interceptor.logger().Info("Invalidated cached responses of method", "method", fullMethod, "keys", len(keys))
+}
@@ -0,0 +1,90 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestInvalidateMakesNextCallAMiss(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	other := &wrappers.StringValue{Value: "other"}
+	for _, r := range []*wrappers.StringValue{req, other} {
+		interceptor.UnaryClientInterceptor()(context.Background(), testMethod, r, &wrappers.StringValue{}, nil, cacheableInvoker("cached"))
+	}
+
+	interceptor.Invalidate(context.Background(), testMethod, req)
+
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+	resp, _, _ := serve(interceptor, context.Background(), req, handler)
+	if handler.calls != 1 || resp.(*wrappers.StringValue).Value != "fresh" {
+		test.Errorf("Wanted invalidated response to be fetched upstream, got %v after %d calls", resp, handler.calls)
+	}
+	serve(interceptor, context.Background(), other, handler)
+	if handler.calls != 1 {
+		test.Errorf("Wanted other responses to stay cached, got %d upstream calls", handler.calls)
+	}
+}
+
+func TestInvalidateUsesMetadataOfContext(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.KeyComponents = DefaultKeyComponents | KeyMetadata
+	interceptor.Vary = []string{"accept-language"}
+	req := &wrappers.StringValue{Value: "req"}
+	contexts := map[string]context.Context{}
+	for _, language := range []string{"en", "sv"} {
+		contexts[language] = metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", language))
+		interceptor.Cache.Set(interceptor.key(contexts[language], testMethod, req), &wrappers.StringValue{Value: language}, time.Minute)
+	}
+
+	interceptor.Invalidate(contexts["sv"], testMethod, req)
+
+	if _, found := interceptor.Cache.Get(interceptor.key(contexts["sv"], testMethod, req)); found {
+		test.Errorf("Wanted the response for the metadata evicted")
+	}
+	if _, found := interceptor.Cache.Get(interceptor.key(contexts["en"], testMethod, req)); !found {
+		test.Errorf("Wanted the response for other metadata to stay cached")
+	}
+}
+
+func TestInvalidateMethodEvictsAllItsResponses(test *testing.T) {
+	interceptor := newTestInterceptor()
+	reqs := []*wrappers.StringValue{{Value: "a"}, {Value: "b"}}
+	for _, r := range reqs {
+		interceptor.UnaryClientInterceptor()(context.Background(), testMethod, r, &wrappers.StringValue{}, nil, cacheableInvoker("cached"))
+	}
+	otherMethod := "/test.Service/Other"
+	interceptor.UnaryClientInterceptor()(context.Background(), otherMethod, reqs[0], &wrappers.StringValue{}, nil, cacheableInvoker("cached"))
+
+	interceptor.InvalidateMethod(testMethod)
+
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+	for _, r := range reqs {
+		serve(interceptor, context.Background(), r, handler)
+	}
+	if handler.calls != len(reqs) {
+		test.Errorf("Wanted %d upstream calls after invalidation, got %d", len(reqs), handler.calls)
+	}
+	if got := interceptor.Cache.ItemCount(); got != 1 {
+		test.Errorf("Wanted only the other method's response kept, got %d entries", got)
+	}
+}
+
+func TestKeyIndexPrunesExpiredKeys(test *testing.T) {
+	var index keyIndex
+	index.add(testMethod, "expired", -time.Second)
+	for _, key := range []string{"a", "b", "c"} {
+		index.add(testMethod, key, time.Minute)
+	}
+
+	if got := len(index.take(testMethod)); got != 3 {
+		test.Errorf("Wanted expired key pruned, got %d keys", got)
+	}
+	if got := index.take(testMethod); len(got) != 0 {
+		test.Errorf("Wanted no keys after taking them, got %v", got)
+	}
+}
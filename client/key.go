@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"google.golang.org/grpc/metadata"
+)
+
+// A KeyComponent is a part of a call that is used when computing the key
+// under which its response is cached. Components are combined as a set, e.g.
+// KeyMethod | KeyRequest.
+type KeyComponent int
+
+const (
+	// KeyMethod includes the full method name in the key.
+	KeyMethod KeyComponent = 1 << iota
+	// KeyRequest includes the request message in the key.
+	KeyRequest
+	// KeyMetadata includes the incoming metadata listed in Vary in the key.
+	// It is implied by a non-empty Vary.
+	KeyMetadata
+	// KeyTenant includes the incoming metadata named by TenantHeader in
+	// the key.
+	KeyTenant
+)
+
+// DefaultKeyComponents are used when no key components have been configured.
+const DefaultKeyComponents = KeyMethod | KeyRequest
+
+// keySeparator ends the readable prefix of a key, which is followed by the
+// hash of its remaining components.
+const keySeparator = "\x00"
+
+// key computes the cache key for a call, from the configured key components.
+// The namespace and method are kept readable at the start of the key, see
+// keyPrefix, and the rest is hashed to bound the length of keys.
+func (interceptor *InmemoryCachingInterceptor) key(ctx context.Context, method string, req proto.Message) string {
+	components := interceptor.keyComponents()
+
+	var parts []string
+	if components&KeyRequest != 0 {
+		if interceptor.KeyFunc != nil {
+			parts = append(parts, interceptor.KeyFunc(method, req))
+		} else {
+			parts = append(parts, req.String())
+		}
+	}
+	if components&(KeyMetadata|KeyTenant) != 0 {
+		md, _ := metadata.FromIncomingContext(ctx)
+		if components&KeyMetadata != 0 {
+			for _, name := range interceptor.Vary {
+				parts = append(parts, metadataPart(md, name))
+			}
+		}
+		if components&KeyTenant != 0 {
+			parts = append(parts, metadataPart(md, interceptor.TenantHeader))
+		}
+	}
+
+	return interceptor.keyPrefix(method) + hashing.Strings(interceptor.Hasher, parts)
+}
+
+// keyPrefix returns what all keys of the method start with, so that they
+// can be found among the keys of a cache. Without KeyMethod among the key
+// components, keys of different methods cannot be told apart, and only the
+// namespace, if any, is returned.
+func (interceptor *InmemoryCachingInterceptor) keyPrefix(method string) string {
+	var prefix string
+	if interceptor.Namespace != "" {
+		prefix = interceptor.Namespace + keySeparator
+	}
+	if interceptor.keyComponents()&KeyMethod != 0 {
+		prefix += method + keySeparator
+	}
+	return prefix
+}
+
+// keyComponents returns the configured key components. Listing metadata in
+// Vary implies KeyMetadata, since responses that vary by it must never be
+// shared between calls that differ in it.
+func (interceptor *InmemoryCachingInterceptor) keyComponents() KeyComponent {
+	components := interceptor.KeyComponents
+	if components == 0 {
+		components = DefaultKeyComponents
+	}
+	if len(interceptor.Vary) > 0 {
+		components |= KeyMetadata
+	}
+	return components
+}
+
+// metadataPart formats the named metadata values as part of a key. Missing
+// metadata results in an empty value, so that keys remain stable.
+func metadataPart(md metadata.MD, name string) string {
+	return name + "=" + strings.Join(md.Get(name), ",")
+}
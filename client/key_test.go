@@ -0,0 +1,212 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestMethodOnlyKeysCollide(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.KeyComponents = KeyMethod
+	ctx := context.Background()
+
+	a := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "a"})
+	b := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "b"})
+	if a != b {
+		test.Errorf("Wanted method-only keys to collide, got %s and %s", a, b)
+	}
+
+	other := interceptor.key(ctx, "/test.Service/Other", &wrappers.StringValue{Value: "a"})
+	if a == other {
+		test.Errorf("Wanted keys for different methods to differ, got %s for both", a)
+	}
+}
+
+func TestMethodAndRequestKeysIsolate(test *testing.T) {
+	interceptor := newTestInterceptor()
+	ctx := context.Background()
+
+	a := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "a"})
+	b := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "b"})
+	if a == b {
+		test.Errorf("Wanted keys for different requests to differ, got %s for both", a)
+	}
+
+	again := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "a"})
+	if a != again {
+		test.Errorf("Wanted keys for identical requests to collide, got %s and %s", a, again)
+	}
+}
+
+func TestTenantKeysIsolate(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.KeyComponents = DefaultKeyComponents | KeyTenant
+	interceptor.TenantHeader = "x-tenant-id"
+	req := &wrappers.StringValue{Value: "a"}
+
+	first := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "first"))
+	second := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "second"))
+	if interceptor.key(first, testMethod, req) == interceptor.key(second, testMethod, req) {
+		test.Errorf("Wanted keys for different tenants to differ")
+	}
+
+	missing := interceptor.key(context.Background(), testMethod, req)
+	if missing != interceptor.key(context.Background(), testMethod, req) {
+		test.Errorf("Wanted keys without tenant metadata to be stable")
+	}
+}
+
+func TestVaryKeysIsolate(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.KeyComponents = DefaultKeyComponents | KeyMetadata
+	interceptor.Vary = []string{"x-tenant-id", "accept-language"}
+	req := &wrappers.StringValue{Value: "a"}
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "resp"}}
+
+	for _, language := range []string{"en", "sv"} {
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "first", "accept-language", language))
+		interceptor.Cache.Set(interceptor.key(ctx, testMethod, req), &wrappers.StringValue{Value: language}, time.Minute)
+	}
+	if got := interceptor.Cache.ItemCount(); got != 2 {
+		test.Errorf("Wanted an entry per language, got %d", got)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "first", "accept-language", "sv"))
+	if resp, _, _ := serve(interceptor, ctx, req, handler); resp.(*wrappers.StringValue).Value != "sv" {
+		test.Errorf("Wanted the entry for the language, got %v", resp)
+	}
+
+	missing := interceptor.key(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "first")), testMethod, req)
+	empty := interceptor.key(metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "first", "accept-language", "")), testMethod, req)
+	if missing != empty {
+		test.Errorf("Wanted missing metadata to key like empty metadata, got %s and %s", missing, empty)
+	}
+}
+
+func TestVaryImpliesKeyMetadata(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.Vary = []string{"accept-language"}
+	req := &wrappers.StringValue{Value: "a"}
+
+	en := interceptor.key(metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "en")), testMethod, req)
+	sv := interceptor.key(metadata.NewIncomingContext(context.Background(), metadata.Pairs("accept-language", "sv")), testMethod, req)
+	if en == sv {
+		test.Errorf("Wanted responses to differ by the metadata in Vary without KeyMetadata")
+	}
+}
+
+func TestNamespacesIsolate(test *testing.T) {
+	blue := newTestInterceptor()
+	blue.Namespace = "blue"
+	green := newTestInterceptor()
+	green.Namespace = "green"
+	green.Cache = blue.Cache
+	req := &wrappers.StringValue{Value: "a"}
+	ctx := context.Background()
+
+	blue.Cache.Set(blue.key(ctx, testMethod, req), &wrappers.StringValue{Value: "blue"}, time.Minute)
+	if _, found := green.Cache.Get(green.key(ctx, testMethod, req)); found {
+		test.Errorf("Wanted entry in one namespace to be invisible in another")
+	}
+
+	plain := newTestInterceptor()
+	if plain.key(ctx, testMethod, req) == blue.key(ctx, testMethod, req) {
+		test.Errorf("Wanted namespaced key to differ from plain key")
+	}
+}
+
+func TestKeyFuncNormalizesRequests(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.KeyFunc = func(fullMethod string, req proto.Message) string {
+		// leave out the request ID before the separator
+		value := req.(*wrappers.StringValue).Value
+		return value[strings.Index(value, "|")+1:]
+	}
+	ctx := context.Background()
+
+	a := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "id-1|query"})
+	b := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "id-2|query"})
+	if a != b {
+		test.Errorf("Wanted normalized keys to collide, got %s and %s", a, b)
+	}
+
+	other := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "id-1|other"})
+	if a == other {
+		test.Errorf("Wanted keys for different queries to differ, got %s for both", a)
+	}
+}
+
+// sumHasher is a weak hashing.Hasher, which sums the bytes of its input.
+type sumHasher struct{}
+
+func (sumHasher) Hash(data []byte) string {
+	var sum uint64
+	for _, b := range data {
+		sum += uint64(b)
+	}
+	return strconv.FormatUint(sum, 10)
+}
+
+func TestHasherComputesKeys(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.Hasher = sumHasher{}
+	ctx := context.Background()
+
+	// anagrams sum to the same hash
+	a := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "ab"})
+	b := interceptor.key(ctx, testMethod, &wrappers.StringValue{Value: "ba"})
+	if a != b {
+		test.Errorf("Wanted the configured Hasher to compute keys, got %s and %s", a, b)
+	}
+	if plain := newTestInterceptor().key(ctx, testMethod, &wrappers.StringValue{Value: "ab"}); plain == a {
+		test.Errorf("Wanted the default Hasher to differ, got %s for both", a)
+	}
+}
+
+func TestKeysAreEnumerableByMethodPrefix(test *testing.T) {
+	interceptor := newTestInterceptor()
+	ctx := context.Background()
+	otherMethod := "/test.Service/Other"
+	for _, value := range []string{"a", "b"} {
+		req := &wrappers.StringValue{Value: value}
+		interceptor.Cache.Set(interceptor.key(ctx, testMethod, req), 1, time.Minute)
+		interceptor.Cache.Set(interceptor.key(ctx, otherMethod, req), 2, time.Minute)
+	}
+
+	counts := make(map[string]int)
+	for key := range NewGoCache(&interceptor.Cache).(entryLister).Expirations() {
+		for _, method := range []string{testMethod, otherMethod} {
+			if strings.HasPrefix(key, interceptor.keyPrefix(method)) {
+				counts[method]++
+			}
+		}
+	}
+	if counts[testMethod] != 2 || counts[otherMethod] != 2 {
+		test.Errorf("Wanted two keys found by the prefix of each method, got %v", counts)
+	}
+
+	interceptor.KeyComponents = KeyRequest
+	if prefix := interceptor.keyPrefix(testMethod); prefix != "" {
+		test.Errorf("Wanted no method prefix without KeyMethod, got %q", prefix)
+	}
+}
+
+func TestInvalidateMethodFindsKeysOfOtherInstances(test *testing.T) {
+	writer := newTestInterceptor()
+	reader := newTestInterceptor()
+	reader.Backend = NewGoCache(&writer.Cache)
+	writer.Cache.Set(writer.key(context.Background(), testMethod, &wrappers.StringValue{Value: "a"}), 1, time.Minute)
+	writer.Cache.Set(writer.key(context.Background(), "/test.Service/Other", &wrappers.StringValue{Value: "a"}), 2, time.Minute)
+
+	reader.InvalidateMethod(testMethod)
+	if got := writer.Cache.ItemCount(); got != 1 {
+		test.Errorf("Wanted only the other method's entry left, got %d entries", got)
+	}
+}
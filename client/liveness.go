@@ -0,0 +1,30 @@
+package client
+
+import (
+	"time"
+)
+
+// A VerificationTracker knows when responses of methods were last verified
+// against the upstream service. The server package's estimator is one.
+type VerificationTracker interface {
+	// LastVerified returns when a response of the method was last
+	// verified. If none has been, found is false.
+	LastVerified(method string) (timestamp time.Time, found bool)
+}
+
+// unverifiedTooLong is a predicate that indicates if responses of the
+// method have gone unverified for longer than MaxUnverified, in which case
+// cached responses must not be served.
+func (interceptor *InmemoryCachingInterceptor) unverifiedTooLong(method string) bool {
+	if interceptor.Verification == nil || interceptor.MaxUnverified <= 0 {
+		return false
+	}
+
+	lastVerified, found := interceptor.Verification.LastVerified(method)
+	if !found || time.Since(lastVerified) <= interceptor.MaxUnverified {
+		return false
+	}
+
+	interceptor.logger().Warn("Responses unverified for too long, not serving them from cache", "method", method, "last_verified", lastVerified)
+	return true
+}
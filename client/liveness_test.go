@@ -0,0 +1,60 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/llarsson/grpc-caching-interceptors/server"
+)
+
+// compile-time check that the estimator can be used as a tracker
+var _ VerificationTracker = (*server.ConfigurableValidityEstimator)(nil)
+
+// fixedTracker is a VerificationTracker with a settable verification time.
+type fixedTracker struct {
+	lastVerified time.Time
+	mux          sync.Mutex
+}
+
+func (t *fixedTracker) LastVerified(method string) (time.Time, bool) {
+	t.mux.Lock()
+	defer t.mux.Unlock()
+	return t.lastVerified, !t.lastVerified.IsZero()
+}
+
+func (t *fixedTracker) set(timestamp time.Time) {
+	t.mux.Lock()
+	t.lastVerified = timestamp
+	t.mux.Unlock()
+}
+
+func TestUnverifiedResponsesNotServed(test *testing.T) {
+	tracker := &fixedTracker{}
+	interceptor := newTestInterceptor()
+	interceptor.Verification = tracker
+	interceptor.MaxUnverified = time.Minute
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Hour)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	// Methods never verified are not affected.
+	resp, _, _ := serve(interceptor, context.Background(), req, handler)
+	if resp.(*wrappers.StringValue).Value != "cached" {
+		test.Errorf("Wanted cached response for a method never verified, got %v", resp)
+	}
+
+	tracker.set(time.Now().Add(-30 * time.Second))
+	resp, _, _ = serve(interceptor, context.Background(), req, handler)
+	if resp.(*wrappers.StringValue).Value != "cached" || handler.calls != 0 {
+		test.Errorf("Wanted cached response while recently verified, got %v (%d upstream calls)", resp, handler.calls)
+	}
+
+	tracker.set(time.Now().Add(-2 * time.Minute))
+	resp, _, _ = serve(interceptor, context.Background(), req, handler)
+	if resp.(*wrappers.StringValue).Value != "fresh" || handler.calls != 1 {
+		test.Errorf("Wanted upstream response once unverified for too long, got %v (%d upstream calls)", resp, handler.calls)
+	}
+}
@@ -0,0 +1,29 @@
+package client
+
+import (
+	"log/slog"
+	"math/rand"
+)
+
+// logger returns the Logger of the interceptor, or the default one.
+func (interceptor *InmemoryCachingInterceptor) logger() *slog.Logger {
+	if interceptor.Logger != nil {
+		return interceptor.Logger
+	}
+	return slog.Default()
+}
+
+// logCall logs a record of a call that went as expected, if the call is
+// sampled according to LogSampleRate.
+func (interceptor *InmemoryCachingInterceptor) logCall(msg string, args ...interface{}) {
+	if sampled(interceptor.LogSampleRate) {
+		interceptor.logger().Info(msg, args...)
+	}
+}
+
+// sampled is a predicate that indicates if a call is sampled for logging at
+// the rate, where zero means that all calls are, and below zero that none
+// are.
+func sampled(rate float64) bool {
+	return rate == 0 || (rate > 0 && rand.Float64() < rate)
+}
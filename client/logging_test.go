@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// capturingHandler is a slog.Handler which keeps the records it handles.
+type capturingHandler struct {
+	records []slog.Record
+	mux     sync.Mutex
+}
+
+func (h *capturingHandler) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *capturingHandler) Handle(ctx context.Context, record slog.Record) error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.records = append(h.records, record.Clone())
+	return nil
+}
+
+func (h *capturingHandler) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *capturingHandler) WithGroup(string) slog.Handler { return h }
+
+// attrs returns the attributes of the last record with the message.
+func (h *capturingHandler) attrs(message string) (map[string]slog.Value, bool) {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	for i := len(h.records) - 1; i >= 0; i-- {
+		if h.records[i].Message != message {
+			continue
+		}
+		attrs := make(map[string]slog.Value)
+		h.records[i].Attrs(func(attr slog.Attr) bool {
+			attrs[attr.Key] = attr.Value
+			return true
+		})
+		return attrs, true
+	}
+	return nil, false
+}
+
+func TestLoggerRecordsCacheHit(test *testing.T) {
+	records := &capturingHandler{}
+	interceptor := newTestInterceptor()
+	interceptor.Logger = slog.New(records)
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &refreshingHandler{interceptor: interceptor, invoker: headerInvoker("resp", "max-age=60")}
+
+	handler.serve(test, req, true)
+	stored, found := records.attrs("Fetched upstream response")
+	if !found {
+		test.Fatalf("Wanted a record of the miss, got none")
+	}
+	if got := stored["max_age"].Int64(); got != 60 {
+		test.Errorf("Wanted max_age 60 on the miss, got %d", got)
+	}
+	if got := stored["cache_status"].String(); got != "miss" {
+		test.Errorf("Wanted cache_status miss, got %s", got)
+	}
+
+	handler.serve(test, req, false)
+	hit, found := records.attrs("Using cached response")
+	if !found {
+		test.Fatalf("Wanted a record of the hit, got none")
+	}
+	if got := hit["method"].String(); got != testMethod {
+		test.Errorf("Wanted method %s, got %s", testMethod, got)
+	}
+	if got, want := hit["hash"].Int64(), int64(hashing.String(req.String())); got != want {
+		test.Errorf("Wanted hash %d, got %d", want, got)
+	}
+	if got := hit["cache_status"].String(); got != "hit" {
+		test.Errorf("Wanted cache_status hit, got %s", got)
+	}
+}
+
+func TestLogSampleRateSilencesCalls(test *testing.T) {
+	records := &capturingHandler{}
+	interceptor := newTestInterceptor()
+	interceptor.Logger = slog.New(records)
+	interceptor.LogSampleRate = -1
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &refreshingHandler{interceptor: interceptor, invoker: headerInvoker("resp", "max-age=60")}
+
+	handler.serve(test, req, true)
+	handler.serve(test, req, false)
+	if len(records.records) != 0 {
+		test.Errorf("Wanted no records of the miss and hit, got %d", len(records.records))
+	}
+
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, &wrappers.StringValue{Value: "other"}, &wrappers.StringValue{}, nil, failing)
+	if err == nil {
+		test.Fatalf("Wanted the upstream error, got none")
+	}
+	if _, found := records.attrs("Failed to call upstream"); !found {
+		test.Errorf("Wanted the failure to be logged, got %d records", len(records.records))
+	}
+}
@@ -0,0 +1,203 @@
+package client
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// LRUCache is a Cache that holds at most MaxEntries values, of at most
+// MaxBytes in total. Inserting into a full cache evicts the least recently
+// used values, where both Get and Set count as use. Values also expire at
+// their TTL as usual, but expired values are only removed when they are
+// looked up or evicted. The zero LRUCache is empty and has no limits.
+type LRUCache struct {
+	// MaxEntries is the most values that are held at once. Zero means no
+	// limit.
+	MaxEntries int
+	// MaxBytes is the most bytes that the values held may take up in
+	// total, as approximated by the serialized size of the responses in
+	// them. Values larger than that are not held at all. Zero means no
+	// limit.
+	MaxBytes int
+
+	order    *list.List
+	elements map[string]*list.Element
+	bytes    int
+
+	mux sync.Mutex
+}
+
+// lruEntry is a value in an LRUCache, with the key it is stored under, so
+// that evicting it can remove it from the map too.
+type lruEntry struct {
+	key   string
+	value interface{}
+	size  int
+	// the zero time if the value never expires
+	expiresAt time.Time
+}
+
+// expired is a predicate that indicates if the entry has expired at now.
+func (e *lruEntry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && !now.Before(e.expiresAt)
+}
+
+// compile-time check that we adhere to interface
+var _ Cache = (*LRUCache)(nil)
+
+// NewLRUCache returns an empty LRUCache that holds at most maxEntries values.
+func NewLRUCache(maxEntries int) *LRUCache {
+	return &LRUCache{MaxEntries: maxEntries}
+}
+
+// NewMemoryBudgetCache returns an empty LRUCache that holds values of at
+// most maxBytes in total, however many there are. This suits services whose
+// responses vary widely in size.
+func NewMemoryBudgetCache(maxBytes int) *LRUCache {
+	return &LRUCache{MaxBytes: maxBytes}
+}
+
+// lazyInit initializes the zero LRUCache, which must be called with the
+// lock held.
+func (c *LRUCache) lazyInit() {
+	if c.order == nil {
+		c.order = list.New()
+		c.elements = make(map[string]*list.Element)
+	}
+}
+
+// Get the value for the key, and mark it as the most recently used. Expired
+// values are removed, and not found.
+func (c *LRUCache) Get(key string) (interface{}, bool) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	element, found := c.elements[key]
+	if !found {
+		return nil, false
+	}
+	e := element.Value.(*lruEntry)
+	if e.expired(time.Now()) {
+		c.remove(element)
+		return nil, false
+	}
+	c.order.MoveToFront(element)
+	return e.value, true
+}
+
+// Set the value for the key, as the most recently used, evicting the least
+// recently used values if the cache is full. A ttl of zero or less means
+// that the value never expires.
+func (c *LRUCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	c.lazyInit()
+
+	var expiresAt time.Time
+	if ttl > 0 {
+		expiresAt = time.Now().Add(ttl)
+	}
+	size := valueSize(value)
+	if element, found := c.elements[key]; found {
+		e := element.Value.(*lruEntry)
+		c.bytes += size - e.size
+		e.value, e.size, e.expiresAt = value, size, expiresAt
+		c.order.MoveToFront(element)
+	} else {
+		c.elements[key] = c.order.PushFront(&lruEntry{key: key, value: value, size: size, expiresAt: expiresAt})
+		c.bytes += size
+	}
+
+	for c.order.Len() > 0 && c.full() {
+		c.remove(c.order.Back())
+	}
+}
+
+// full is a predicate that indicates if the cache holds more than it may,
+// which must be called with the lock held.
+func (c *LRUCache) full() bool {
+	return (c.MaxEntries > 0 && c.order.Len() > c.MaxEntries) || (c.MaxBytes > 0 && c.bytes > c.MaxBytes)
+}
+
+// Delete the value for the key.
+func (c *LRUCache) Delete(key string) {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	if element, found := c.elements[key]; found {
+		c.remove(element)
+	}
+}
+
+// ItemCount returns the number of values held, including expired ones that
+// have not been removed yet.
+func (c *LRUCache) ItemCount() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return len(c.elements)
+}
+
+// Expirations returns the unexpired values by when they expire, or the zero
+// time if they never do, without marking them as used.
+func (c *LRUCache) Expirations() map[string]time.Time {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	now := time.Now()
+	expirations := make(map[string]time.Time, len(c.elements))
+	for key, element := range c.elements {
+		if e := element.Value.(*lruEntry); !e.expired(now) {
+			expirations[key] = e.expiresAt
+		}
+	}
+	return expirations
+}
+
+// Flush removes all values.
+func (c *LRUCache) Flush() {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+
+	c.order = nil
+	c.elements = nil
+	c.bytes = 0
+}
+
+// CurrentBytes returns the approximate number of bytes taken up by the
+// values held, including expired ones that have not been removed yet.
+func (c *LRUCache) CurrentBytes() int {
+	c.mux.Lock()
+	defer c.mux.Unlock()
+	return c.bytes
+}
+
+// remove the element, which must be called with the lock held.
+func (c *LRUCache) remove(element *list.Element) {
+	e := c.order.Remove(element).(*lruEntry)
+	delete(c.elements, e.key)
+	c.bytes -= e.size
+}
+
+// valueSize approximates the memory taken up by a cached value, as the
+// serialized size of the responses in it.
+func valueSize(value interface{}) int {
+	switch v := value.(type) {
+	case *entry:
+		return valueSize(v.value)
+	case proto.Message:
+		return proto.Size(v)
+	case []proto.Message:
+		size := 0
+		for _, message := range v {
+			size += proto.Size(message)
+		}
+		return size
+	case *cachedError:
+		return len(v.message)
+	default:
+		return 0
+	}
+}
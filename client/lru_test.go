@@ -0,0 +1,136 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestLRUCacheEvictsLeastRecentlyUsed(test *testing.T) {
+	c := NewLRUCache(3)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Set("c", 3, time.Minute)
+
+	// using a makes b the least recently used
+	c.Get("a")
+	c.Set("d", 4, time.Minute)
+
+	if _, found := c.Get("b"); found {
+		test.Errorf("Wanted b evicted as the least recently used")
+	}
+	for _, key := range []string{"a", "c", "d"} {
+		if _, found := c.Get(key); !found {
+			test.Errorf("Wanted %s kept", key)
+		}
+	}
+	if got := c.ItemCount(); got != 3 {
+		test.Errorf("Wanted 3 entries, got %d", got)
+	}
+}
+
+func TestLRUCacheReplacingDoesNotEvict(test *testing.T) {
+	c := NewLRUCache(2)
+	c.Set("a", 1, time.Minute)
+	c.Set("b", 2, time.Minute)
+	c.Set("a", 3, time.Minute)
+
+	if value, found := c.Get("a"); !found || value != 3 {
+		test.Errorf("Wanted the replaced value, got %v (found %v)", value, found)
+	}
+	if _, found := c.Get("b"); !found {
+		test.Errorf("Wanted b kept, since a was only replaced")
+	}
+}
+
+func TestLRUCacheExpiredEntriesMiss(test *testing.T) {
+	c := NewLRUCache(10)
+	c.Set("short", 1, 10*time.Millisecond)
+	c.Set("long", 2, time.Minute)
+
+	time.Sleep(20 * time.Millisecond)
+
+	if _, found := c.Get("short"); found {
+		test.Errorf("Wanted expired entry to miss")
+	}
+	if _, found := c.Get("long"); !found {
+		test.Errorf("Wanted unexpired entry to hit")
+	}
+	if got := c.ItemCount(); got != 1 {
+		test.Errorf("Wanted expired entry removed on lookup, got %d entries", got)
+	}
+}
+
+func TestLRUCacheAsBackend(test *testing.T) {
+	interceptor := &InmemoryCachingInterceptor{Backend: NewLRUCache(5)}
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "resp"}}
+
+	for i := 0; i < 10; i++ {
+		req := &wrappers.StringValue{Value: fmt.Sprintf("req-%d", i)}
+		interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("resp"))
+	}
+
+	if got := interceptor.Stats().Entries; got != 5 {
+		test.Errorf("Wanted the cache capped at 5 entries, got %d", got)
+	}
+	if _, _, err := serve(interceptor, context.Background(), &wrappers.StringValue{Value: "req-9"}, handler); err != nil || handler.calls != 0 {
+		test.Errorf("Wanted the most recent entry served from cache, got %d upstream calls (err %v)", handler.calls, err)
+	}
+}
+
+func TestMemoryBudgetCacheStaysUnderBudget(test *testing.T) {
+	value := &wrappers.StringValue{Value: "0123456789"}
+	size := valueSize(value)
+	c := NewMemoryBudgetCache(3 * size)
+
+	for i := 0; i < 10; i++ {
+		c.Set(fmt.Sprintf("key-%d", i), value, time.Minute)
+		if got := c.CurrentBytes(); got > c.MaxBytes {
+			test.Errorf("Wanted at most %d bytes, got %d", c.MaxBytes, got)
+		}
+	}
+
+	if got := c.ItemCount(); got != 3 {
+		test.Errorf("Wanted 3 entries within budget, got %d", got)
+	}
+	if _, found := c.Get("key-0"); found {
+		test.Errorf("Wanted the oldest entry evicted")
+	}
+	if _, found := c.Get("key-9"); !found {
+		test.Errorf("Wanted the newest entry kept")
+	}
+}
+
+func TestMemoryBudgetCacheTracksReplacedAndDeletedBytes(test *testing.T) {
+	c := NewMemoryBudgetCache(1000)
+	small, large := &wrappers.StringValue{Value: "a"}, &wrappers.StringValue{Value: "abcdefghij"}
+
+	c.Set("a", &entry{value: small}, time.Minute)
+	c.Set("a", &entry{value: large}, time.Minute)
+	if got, want := c.CurrentBytes(), valueSize(large); got != want {
+		test.Errorf("Wanted %d bytes after replacing, got %d", want, got)
+	}
+
+	c.Set("b", []proto.Message{small, large}, time.Minute)
+	c.Delete("a")
+	if got, want := c.CurrentBytes(), valueSize(small)+valueSize(large); got != want {
+		test.Errorf("Wanted %d bytes after deleting, got %d", want, got)
+	}
+}
+
+func TestMemoryBudgetCacheRejectsOversizedValues(test *testing.T) {
+	c := NewMemoryBudgetCache(4)
+	c.Set("small", &wrappers.StringValue{Value: "a"}, time.Minute)
+	c.Set("large", &wrappers.StringValue{Value: "far too large to fit"}, time.Minute)
+
+	if _, found := c.Get("large"); found {
+		test.Errorf("Wanted a value larger than the budget not to be held")
+	}
+	if got := c.CurrentBytes(); got > c.MaxBytes {
+		test.Errorf("Wanted at most %d bytes, got %d", c.MaxBytes, got)
+	}
+}
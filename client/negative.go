@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// cachedError is an error response from upstream, which is stored in cache
+// so that it can be replayed for a while, instead of asking an upstream
+// that just failed over and over again. Like other cached values, it is
+// immutable.
+type cachedError struct {
+	code    codes.Code
+	message string
+}
+
+// err returns the error to replay.
+func (e *cachedError) err() error {
+	return status.Error(e.code, e.message)
+}
+
+// negativelyCacheable is a predicate that indicates if the error may be
+// stored in cache, which it may if its status code is among the
+// NegativeCacheCodes.
+func (interceptor *InmemoryCachingInterceptor) negativelyCacheable(err error) bool {
+	if interceptor.NegativeTTL <= 0 {
+		return false
+	}
+	s, ok := status.FromError(err)
+	if !ok {
+		return false
+	}
+	for _, code := range interceptor.NegativeCacheCodes {
+		if s.Code() == code {
+			return true
+		}
+	}
+	return false
+}
+
+// storeError stores an error response from upstream in cache for the
+// NegativeTTL, if it is negatively cacheable. A response that is still
+// cached under the key is kept instead, since it can still be served, e.g.
+// when refreshing or warming it failed.
+func (interceptor *InmemoryCachingInterceptor) storeError(ctx context.Context, method string, key string, err error) {
+	if !interceptor.negativelyCacheable(err) || !storeAllowed(ctx) {
+		return
+	}
+	if cached, found := interceptor.backend().Get(key); found {
+		if value, _ := unwrapEntry(cached); value != nil {
+			if _, negative := value.(*cachedError); !negative {
+				return
+			}
+		}
+	}
+
+	s := status.Convert(err)
+	interceptor.backend().Set(key, &cachedError{code: s.Code(), message: s.Message()}, interceptor.NegativeTTL)
+	interceptor.keys.add(method, key, interceptor.NegativeTTL)
+	interceptor.recordDecision(method, key, Store, interceptor.NegativeTTL)
+	interceptor.logger().Info("Stored error response", "method", method, "code", s.Code().String(), "ttl", interceptor.NegativeTTL)
+}
@@ -0,0 +1,139 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingInvoker is a grpc.UnaryInvoker which fails with the given status,
+// counting the number of times it has been called.
+type failingInvoker struct {
+	code  codes.Code
+	calls int
+}
+
+func (i *failingInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	i.calls++
+	return status.Errorf(i.code, "upstream says %s", i.code)
+}
+
+// serveThrough runs a call through both parts of the interceptor, as a
+// reverse proxy would.
+func serveThrough(interceptor *InmemoryCachingInterceptor, req *wrappers.StringValue, invoker grpc.UnaryInvoker) error {
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), &headerCapture{})
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		reply := &wrappers.StringValue{}
+		return reply, interceptor.UnaryClientInterceptor()(ctx, testMethod, req, reply, nil, invoker)
+	}
+
+	_, err := interceptor.UnaryServerInterceptor(discardLog)(ctx, req, info, handler)
+	return err
+}
+
+func TestNotFoundIsCachedAndReplayed(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.NegativeTTL = time.Minute
+	interceptor.NegativeCacheCodes = []codes.Code{codes.NotFound, codes.Unavailable}
+	invoker := &failingInvoker{code: codes.NotFound}
+	req := &wrappers.StringValue{Value: "req"}
+
+	first := serveThrough(interceptor, req, invoker.invoke)
+	second := serveThrough(interceptor, req, invoker.invoke)
+
+	if invoker.calls != 1 {
+		test.Errorf("Wanted 1 upstream call, got %d", invoker.calls)
+	}
+	if status.Code(second) != codes.NotFound || status.Convert(second).Message() != status.Convert(first).Message() {
+		test.Errorf("Wanted the error replayed as %v, got %v", first, second)
+	}
+	if got := interceptor.Stats(); got.Hits != 1 || got.Misses != 1 {
+		test.Errorf("Wanted the replay to count as a hit, got %+v", got)
+	}
+}
+
+func TestUnlistedCodesAreNotCached(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.NegativeTTL = time.Minute
+	interceptor.NegativeCacheCodes = []codes.Code{codes.NotFound}
+	req := &wrappers.StringValue{Value: "req"}
+
+	for _, code := range []codes.Code{codes.Internal, codes.Unavailable, codes.PermissionDenied} {
+		invoker := &failingInvoker{code: code}
+		for i := 0; i < 2; i++ {
+			if err := serveThrough(interceptor, req, invoker.invoke); status.Code(err) != code {
+				test.Errorf("Wanted %s, got %v", code, err)
+			}
+		}
+		if invoker.calls != 2 {
+			test.Errorf("Wanted %s to go upstream every time, got %d calls", code, invoker.calls)
+		}
+	}
+	if got := interceptor.Cache.ItemCount(); got != 0 {
+		test.Errorf("Wanted nothing cached, got %d entries", got)
+	}
+}
+
+func TestErrorsAreNotCachedWithoutNegativeTTL(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.NegativeCacheCodes = []codes.Code{codes.NotFound}
+	invoker := &failingInvoker{code: codes.NotFound}
+	req := &wrappers.StringValue{Value: "req"}
+
+	serveThrough(interceptor, req, invoker.invoke)
+	serveThrough(interceptor, req, invoker.invoke)
+
+	if invoker.calls != 2 {
+		test.Errorf("Wanted 2 upstream calls, got %d", invoker.calls)
+	}
+}
+
+func TestCachedErrorsSurviveEncoding(test *testing.T) {
+	codec := newValueCodec()
+	stored := &cachedError{code: codes.NotFound, message: "no such thing"}
+
+	data, err := codec.encode(stored)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	decoded, err := codec.decode(data)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got, ok := decoded.(*cachedError); !ok || *got != *stored {
+		test.Errorf("Wanted %+v, got %+v", stored, decoded)
+	}
+}
+
+func TestErrorDoesNotReplaceCachedResponse(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.NegativeTTL = time.Minute
+	interceptor.NegativeCacheCodes = []codes.Code{codes.Unavailable}
+	req := &wrappers.StringValue{Value: "req"}
+	key := interceptor.key(context.Background(), testMethod, req)
+
+	if err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, headerInvoker("good", "max-age=60")); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	// a refresh, or warming, of the entry fails
+	failing := &failingInvoker{code: codes.Unavailable}
+	if err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, failing.invoke); status.Code(err) != codes.Unavailable {
+		test.Fatalf("Wanted Unavailable, got %v", err)
+	}
+
+	cached, found := interceptor.backend().Get(key)
+	if !found {
+		test.Fatalf("Wanted the response to stay cached")
+	}
+	value, _ := unwrapEntry(cached)
+	if reply, ok := value.(*wrappers.StringValue); !ok || reply.Value != "good" {
+		test.Errorf("Wanted the cached response kept, got %v", value)
+	}
+}
@@ -0,0 +1,36 @@
+package client
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
+)
+
+// An Oracle knows the true current response to requests, e.g. because it
+// controls the data that the upstream service serves. It lets coherency
+// checks measure how stale the responses served from cache are, rather than
+// only whether they are.
+type Oracle interface {
+	// Truth returns the true current response to the request, and when it
+	// became the current one. If the oracle does not know the response,
+	// found is false.
+	Truth(method string, req proto.Message) (resp proto.Message, since time.Time, found bool)
+}
+
+// recordStaleness records, for the method, how long ago a stale response
+// that was served stopped being the true one.
+func (interceptor *InmemoryCachingInterceptor) recordStaleness(method string, age time.Duration) {
+	interceptor.stats.mux.Lock()
+	if interceptor.stats.staleness == nil {
+		interceptor.stats.staleness = make(map[string]*metrics.Histogram)
+	}
+	histogram, found := interceptor.stats.staleness[method]
+	if !found {
+		histogram = metrics.NewHistogram()
+		interceptor.stats.staleness[method] = histogram
+	}
+	interceptor.stats.mux.Unlock()
+
+	histogram.Observe(age.Seconds())
+}
@@ -0,0 +1,23 @@
+package client
+
+import (
+	"time"
+)
+
+// recordOverhead accounts for the time that the server interceptor added to
+// a call on top of the time spent upstream, and logs calls where that
+// exceeds the OverheadThreshold.
+func (interceptor *InmemoryCachingInterceptor) recordOverhead(method string, overhead, upstream time.Duration) {
+	interceptor.stats.mux.Lock()
+	interceptor.stats.Calls++
+	interceptor.stats.Overhead += overhead
+	interceptor.stats.UpstreamTime += upstream
+	if overhead > interceptor.stats.MaxOverhead {
+		interceptor.stats.MaxOverhead = overhead
+	}
+	interceptor.stats.mux.Unlock()
+
+	if interceptor.OverheadThreshold > 0 && overhead > interceptor.OverheadThreshold {
+		interceptor.logger().Warn("Interceptor overhead above threshold", "method", method, "overhead", overhead, "upstream", upstream, "threshold", interceptor.OverheadThreshold)
+	}
+}
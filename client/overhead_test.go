@@ -0,0 +1,56 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+func TestOverheadCapturesExpensiveKeying(test *testing.T) {
+	interceptor := newTestInterceptor()
+	keyingDelay := 20 * time.Millisecond
+	upstreamDelay := 200 * time.Millisecond
+	keyed := 0
+	interceptor.KeyFunc = func(fullMethod string, req proto.Message) string {
+		keyed++
+		time.Sleep(keyingDelay)
+		return req.String()
+	}
+
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), &headerCapture{})
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	req := &wrappers.StringValue{Value: "req"}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		time.Sleep(upstreamDelay)
+		return &wrappers.StringValue{Value: "resp"}, nil
+	}
+
+	_, err := interceptor.UnaryServerInterceptor(discardLog)(ctx, req, info, handler)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	if keyed == 0 {
+		test.Fatalf("Wanted the KeyFunc to key the request")
+	}
+	stats := interceptor.Stats()
+	if stats.Calls != 1 {
+		test.Errorf("Wanted 1 call, got %d", stats.Calls)
+	}
+	if stats.Overhead < time.Duration(keyed)*keyingDelay {
+		test.Errorf("Wanted overhead of at least %v for keying %d times, got %v", time.Duration(keyed)*keyingDelay, keyed, stats.Overhead)
+	}
+	if stats.Overhead >= upstreamDelay {
+		test.Errorf("Wanted overhead to exclude the %v upstream time, got %v", upstreamDelay, stats.Overhead)
+	}
+	if stats.MaxOverhead != stats.Overhead {
+		test.Errorf("Wanted max overhead %v for a single call, got %v", stats.Overhead, stats.MaxOverhead)
+	}
+	if stats.UpstreamTime < upstreamDelay {
+		test.Errorf("Wanted upstream time of at least %v, got %v", upstreamDelay, stats.UpstreamTime)
+	}
+}
@@ -0,0 +1,197 @@
+package client
+
+import (
+	"container/list"
+	"runtime"
+	"sync"
+	"time"
+)
+
+const (
+	defaultMemoryCheckInterval = time.Duration(1 * time.Second)
+	// fraction of the tracked entries evicted per check under pressure
+	pressureEvictionFraction = 10
+)
+
+// recency keeps cache keys in least-recently-used order, along with when
+// they expire, so that keys that the cache no longer holds are not kept.
+type recency struct {
+	order    *list.List
+	elements map[string]*list.Element
+	// the number of tracked keys after expired ones were last pruned
+	pruned int
+
+	mux sync.Mutex
+}
+
+// recentKey is a tracked key, and when it expires. The zero time means
+// that it is not known, e.g. for keys stored by other instances sharing the
+// cache, which are kept until they are evicted or removed.
+type recentKey struct {
+	key        string
+	expiration time.Time
+}
+
+// touch marks the key as the most recently used, keeping its expiration if
+// it is tracked already.
+func (r *recency) touch(key string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if element, found := r.elements[key]; found {
+		r.order.MoveToFront(element)
+		return
+	}
+	r.push(recentKey{key: key})
+}
+
+// stored marks the key as the most recently used, as stored for the ttl.
+func (r *recency) stored(key string, ttl time.Duration) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if element, found := r.elements[key]; found {
+		r.order.Remove(element)
+	}
+	r.push(recentKey{key: key, expiration: time.Now().Add(ttl)})
+}
+
+// push adds the key at the front. Expired keys are pruned whenever the
+// number of tracked keys has doubled, so that the keys the cache expires
+// by itself are not kept forever.
+func (r *recency) push(k recentKey) {
+	if r.order == nil {
+		r.order = list.New()
+		r.elements = make(map[string]*list.Element)
+	}
+	r.elements[k.key] = r.order.PushFront(k)
+
+	if r.order.Len() > 2*r.pruned {
+		r.pruneExpired(time.Now())
+		r.pruned = r.order.Len()
+	}
+}
+
+// pruneExpired stops tracking the keys that have expired by now.
+func (r *recency) pruneExpired(now time.Time) {
+	for element := r.order.Front(); element != nil; {
+		next := element.Next()
+		if k := element.Value.(recentKey); !k.expiration.IsZero() && now.After(k.expiration) {
+			r.order.Remove(element)
+			delete(r.elements, k.key)
+		}
+		element = next
+	}
+}
+
+// remove stops tracking the key, e.g. since it was deleted from the cache.
+func (r *recency) remove(key string) {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if element, found := r.elements[key]; found {
+		r.order.Remove(element)
+		delete(r.elements, key)
+	}
+}
+
+// clear stops tracking all keys, e.g. since the cache was flushed.
+func (r *recency) clear() {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	r.order = nil
+	r.elements = nil
+	r.pruned = 0
+}
+
+// evict removes up to n of the least recently used keys that have not
+// expired, and returns them. Expired keys are pruned first, so that they do
+// not count towards the n.
+func (r *recency) evict(n int) []string {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.order == nil {
+		return nil
+	}
+	r.pruneExpired(time.Now())
+
+	var keys []string
+	for len(keys) < n && r.order.Len() > 0 {
+		k := r.order.Remove(r.order.Back()).(recentKey)
+		delete(r.elements, k.key)
+		keys = append(keys, k.key)
+	}
+	r.pruned = r.order.Len()
+	return keys
+}
+
+// live returns the number of tracked keys, after pruning expired ones.
+func (r *recency) live() int {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+
+	if r.order == nil {
+		return 0
+	}
+	r.pruneExpired(time.Now())
+	r.pruned = r.order.Len()
+	return r.order.Len()
+}
+
+// heapInUse reports the number of bytes allocated on the heap.
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
+
+// relievePressure evicts the least recently used entries if heap usage is
+// above the configured limit. Freed memory only shows up after garbage
+// collection, so a fraction of the entries is evicted per check, rather
+// than evicting until usage drops.
+func (interceptor *InmemoryCachingInterceptor) relievePressure() int {
+	usage := interceptor.heapInUse()
+	if usage <= interceptor.MemoryLimit {
+		return 0
+	}
+
+	n := interceptor.recency.live() / pressureEvictionFraction
+	if n < 1 {
+		n = 1
+	}
+	keys := interceptor.recency.evict(n)
+	for _, key := range keys {
+		interceptor.backend().Delete(key)
+	}
+
+	interceptor.logger().Warn("Heap usage above limit, evicted entries", "heap_in_use", usage, "limit", interceptor.MemoryLimit, "evicted", len(keys))
+	return len(keys)
+}
+
+// startPressureWatcher periodically relieves memory pressure until the
+// interceptor is closed.
+func (interceptor *InmemoryCachingInterceptor) startPressureWatcher() {
+	if interceptor.heapInUse == nil {
+		interceptor.heapInUse = heapInUse
+	}
+	interval := interceptor.MemoryCheckInterval
+	if interval <= 0 {
+		interval = defaultMemoryCheckInterval
+	}
+
+	quit := interceptor.quitChannel()
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				interceptor.relievePressure()
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
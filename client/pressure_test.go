@@ -0,0 +1,84 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestMemoryPressureEvictsLeastRecentlyUsed(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.MemoryLimit = 5
+	// Simulate each cached entry using one byte of heap.
+	interceptor.heapInUse = func() uint64 {
+		return uint64(interceptor.Cache.ItemCount())
+	}
+	defer interceptor.Close()
+
+	store := interceptor.UnaryClientInterceptor()
+	requests := make([]*wrappers.StringValue, 20)
+	for i := range requests {
+		requests[i] = &wrappers.StringValue{Value: fmt.Sprintf("%d", i)}
+		store(context.Background(), testMethod, requests[i], &wrappers.StringValue{}, nil, cacheableInvoker("value"))
+	}
+
+	// Using the oldest entry makes it the most recently used.
+	handler := &countingHandler{}
+	serve(interceptor, context.Background(), requests[0], handler)
+	if handler.calls != 0 {
+		test.Fatalf("Wanted cache hit before eviction")
+	}
+
+	for i := 0; i < 100 && interceptor.relievePressure() > 0; i++ {
+	}
+
+	if got := interceptor.Cache.ItemCount(); got != 5 {
+		test.Errorf("Wanted eviction to stop at 5 entries, got %d", got)
+	}
+	for _, i := range []int{0, 16, 17, 18, 19} {
+		if _, found := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, requests[i])); !found {
+			test.Errorf("Wanted recently used entry %d to remain", i)
+		}
+	}
+	if got := interceptor.relievePressure(); got != 0 {
+		test.Errorf("Wanted no eviction without pressure, got %d", got)
+	}
+}
+
+func TestRecencyPrunesExpiredKeys(test *testing.T) {
+	r := &recency{}
+	for i := 0; i < 1000; i++ {
+		r.stored(fmt.Sprintf("expired-%d", i), -time.Second)
+	}
+	r.stored("live", time.Minute)
+
+	if got := r.live(); got != 1 {
+		test.Errorf("Wanted expired keys to be pruned, got %d tracked", got)
+	}
+	if got := r.evict(1); len(got) != 1 || got[0] != "live" {
+		test.Errorf("Wanted only the live key to be evicted, got %v", got)
+	}
+}
+
+func TestRecencyForgetsDeletedKeys(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.MemoryLimit = 1 << 40
+	defer interceptor.Close()
+
+	store := interceptor.UnaryClientInterceptor()
+	for i := 0; i < 3; i++ {
+		store(context.Background(), testMethod, &wrappers.StringValue{Value: fmt.Sprintf("%d", i)}, &wrappers.StringValue{}, nil, cacheableInvoker("value"))
+	}
+
+	interceptor.Invalidate(context.Background(), testMethod, &wrappers.StringValue{Value: "0"})
+	if got := interceptor.recency.live(); got != 2 {
+		test.Errorf("Wanted the invalidated key untracked, got %d tracked", got)
+	}
+	interceptor.InvalidateMethod(testMethod)
+	if got := interceptor.recency.live(); got != 0 {
+		test.Errorf("Wanted the keys of the method untracked, got %d tracked", got)
+	}
+}
@@ -0,0 +1,161 @@
+package client
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/golang/protobuf/proto"
+)
+
+// RedisCache is a Cache that stores responses in Redis, so that several
+// reverse proxy replicas can share one cache. Only proto.Message responses,
+// and server streams of them, can be stored.
+type RedisCache struct {
+	// Logger, if set, receives the logs of failing Redis operations, e.g.
+	// the Logger of the interceptor that uses the cache. Defaults to
+	// slog.Default().
+	Logger *slog.Logger
+
+	client  *redis.Client
+	options redis.Options
+	prefix  string
+	codec   valueCodec
+}
+
+// compile-time check that we adhere to interface
+var _ Cache = (*RedisCache)(nil)
+
+// A RedisOption configures a RedisCache.
+type RedisOption func(*RedisCache)
+
+// WithRedisPassword sets the password used to authenticate to Redis.
+func WithRedisPassword(password string) RedisOption {
+	return func(c *RedisCache) {
+		c.options.Password = password
+	}
+}
+
+// WithRedisDB selects the Redis database to use.
+func WithRedisDB(db int) RedisOption {
+	return func(c *RedisCache) {
+		c.options.DB = db
+	}
+}
+
+// WithRedisKeyPrefix prefixes every key stored in Redis, so that the cache
+// can share a Redis instance with other data.
+func WithRedisKeyPrefix(prefix string) RedisOption {
+	return func(c *RedisCache) {
+		c.prefix = prefix
+	}
+}
+
+// WithMessageTypes registers prototypes of the response messages, which are
+// used to decode values whose types are not in the global protobuf
+// registry.
+func WithMessageTypes(prototypes ...proto.Message) RedisOption {
+	return func(c *RedisCache) {
+		c.codec.register(prototypes...)
+	}
+}
+
+// NewRedisCache creates a RedisCache that connects to the Redis server at
+// addr.
+func NewRedisCache(addr string, opts ...RedisOption) *RedisCache {
+	c := &RedisCache{
+		options: redis.Options{Addr: addr},
+		codec:   newValueCodec(),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.client = redis.NewClient(&c.options)
+	return c
+}
+
+// logger returns the Logger of the cache, or the default one.
+func (c *RedisCache) logger() *slog.Logger {
+	if c.Logger != nil {
+		return c.Logger
+	}
+	return slog.Default()
+}
+
+// Close the connections to Redis.
+func (c *RedisCache) Close() error {
+	return c.client.Close()
+}
+
+// Get the value for the key from Redis. Values that cannot be fetched or
+// decoded are treated as not found.
+func (c *RedisCache) Get(key string) (interface{}, bool) {
+	data, err := c.client.Get(c.prefix + key).Bytes()
+	if err == redis.Nil {
+		return nil, false
+	}
+	if err != nil {
+		c.logger().Warn("Failed to get value from Redis", "key", key, "error", err)
+		return nil, false
+	}
+
+	value, err := c.codec.decode(data)
+	if err != nil {
+		c.logger().Warn("Failed to decode value from Redis", "key", key, "error", err)
+		return nil, false
+	}
+	return value, true
+}
+
+// Set the value for the key in Redis, expiring it after the ttl, unless it
+// is zero or less.
+func (c *RedisCache) Set(key string, value interface{}, ttl time.Duration) {
+	data, err := c.codec.encode(value)
+	if err != nil {
+		c.logger().Warn("Failed to encode value for Redis", "key", key, "error", err)
+		return
+	}
+
+	if err := c.client.Set(c.prefix+key, data, ttl).Err(); err != nil {
+		c.logger().Warn("Failed to set value in Redis", "key", key, "error", err)
+	}
+}
+
+// Delete the value for the key from Redis.
+func (c *RedisCache) Delete(key string) {
+	if err := c.client.Del(c.prefix + key).Err(); err != nil {
+		c.logger().Warn("Failed to delete value from Redis", "key", key, "error", err)
+	}
+}
+
+// GetWithExpiration gets the value for the key from Redis, and when it
+// expires there.
+func (c *RedisCache) GetWithExpiration(key string) (interface{}, time.Time, bool) {
+	var get *redis.StringCmd
+	var pttl *redis.DurationCmd
+	_, err := c.client.Pipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(c.prefix + key)
+		pttl = pipe.PTTL(c.prefix + key)
+		return nil
+	})
+	if err == redis.Nil {
+		return nil, time.Time{}, false
+	}
+	if err != nil {
+		c.logger().Warn("Failed to get value from Redis", "key", key, "error", err)
+		return nil, time.Time{}, false
+	}
+
+	data, _ := get.Bytes()
+	value, err := c.codec.decode(data)
+	if err != nil {
+		c.logger().Warn("Failed to decode value from Redis", "key", key, "error", err)
+		return nil, time.Time{}, false
+	}
+	var expiration time.Time
+	// negative if the key has no expiration
+	if ttl := pttl.Val(); ttl > 0 {
+		expiration = time.Now().Add(ttl)
+	}
+	return value, expiration, true
+}
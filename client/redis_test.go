@@ -0,0 +1,116 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func newTestRedisCache(test *testing.T) (*RedisCache, *miniredis.Miniredis) {
+	server, err := miniredis.Run()
+	if err != nil {
+		test.Fatalf("Unable to start Redis: %v", err)
+	}
+	return NewRedisCache(server.Addr(), WithRedisKeyPrefix("test:")), server
+}
+
+func TestRedisCacheRoundTrip(test *testing.T) {
+	c, server := newTestRedisCache(test)
+	defer server.Close()
+	defer c.Close()
+
+	c.Set("message", &wrappers.StringValue{Value: "resp"}, time.Minute)
+	c.Set("stream", []proto.Message{&wrappers.StringValue{Value: "0"}, &wrappers.Int64Value{Value: 1}}, time.Minute)
+
+	value, found := c.Get("message")
+	if !found || !proto.Equal(value.(proto.Message), &wrappers.StringValue{Value: "resp"}) {
+		test.Errorf("Wanted stored message, got %v (found %v)", value, found)
+	}
+
+	value, found = c.Get("stream")
+	messages, ok := value.([]proto.Message)
+	if !found || !ok || len(messages) != 2 ||
+		!proto.Equal(messages[0], &wrappers.StringValue{Value: "0"}) ||
+		!proto.Equal(messages[1], &wrappers.Int64Value{Value: 1}) {
+		test.Errorf("Wanted stored stream, got %v (found %v)", value, found)
+	}
+
+	if !server.Exists("test:message") {
+		test.Errorf("Wanted keys to be prefixed, got %v", server.Keys())
+	}
+
+	c.Delete("message")
+	if _, found := c.Get("message"); found {
+		test.Errorf("Wanted deleted message to be gone")
+	}
+}
+
+func TestRedisCacheExpires(test *testing.T) {
+	c, server := newTestRedisCache(test)
+	defer server.Close()
+	defer c.Close()
+
+	c.Set("message", &wrappers.StringValue{Value: "resp"}, 10*time.Second)
+	if ttl := server.TTL("test:message"); ttl != 10*time.Second {
+		test.Errorf("Wanted 10 second TTL in Redis, got %v", ttl)
+	}
+
+	server.FastForward(11 * time.Second)
+	if _, found := c.Get("message"); found {
+		test.Errorf("Wanted message to expire")
+	}
+}
+
+func TestRedisCacheServesInterceptor(test *testing.T) {
+	c, server := newTestRedisCache(test)
+	defer server.Close()
+	defer c.Close()
+
+	interceptor := &InmemoryCachingInterceptor{Backend: c}
+	req := &wrappers.StringValue{Value: "req"}
+	err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("cached"))
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+	resp, _, err := serve(interceptor, context.Background(), req, handler)
+	if err != nil || resp.(*wrappers.StringValue).Value != "cached" || handler.calls != 0 {
+		test.Errorf("Wanted cached response from Redis, got %v (%d calls, err %v)", resp, handler.calls, err)
+	}
+}
+
+func TestRedisCacheKeepsSoftTTL(test *testing.T) {
+	c, server := newTestRedisCache(test)
+	defer server.Close()
+	defer c.Close()
+
+	freshUntil := time.Unix(0, time.Now().Add(time.Minute).UnixNano())
+	c.Set("entry", &entry{value: &wrappers.StringValue{Value: "resp"}, freshUntil: freshUntil}, 2*time.Minute)
+
+	value, found := c.Get("entry")
+	e, ok := value.(*entry)
+	if !found || !ok || !e.freshUntil.Equal(freshUntil) || !proto.Equal(e.value.(proto.Message), &wrappers.StringValue{Value: "resp"}) {
+		test.Errorf("Wanted stored entry fresh until %v, got %v (found %v)", freshUntil, value, found)
+	}
+}
+
+func TestRedisCacheKeepsStorageTime(test *testing.T) {
+	c, server := newTestRedisCache(test)
+	defer server.Close()
+	defer c.Close()
+
+	storedAt := time.Unix(0, time.Now().UnixNano())
+	freshUntil := storedAt.Add(time.Minute)
+	c.Set("entry", &entry{value: &wrappers.StringValue{Value: "resp"}, freshUntil: freshUntil, storedAt: storedAt}, time.Minute)
+
+	value, found := c.Get("entry")
+	e, ok := value.(*entry)
+	if !found || !ok || !e.storedAt.Equal(storedAt) || !e.freshUntil.Equal(freshUntil) {
+		test.Errorf("Wanted stored entry stored at %v, got %v (found %v)", storedAt, value, found)
+	}
+}
@@ -0,0 +1,74 @@
+package client
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Savings describes what serving a method from cache has spared upstream.
+type Savings struct {
+	// Hits is the number of calls served from cache.
+	Hits uint64
+	// BytesSaved is the total size of the responses served from cache.
+	BytesSaved uint64
+	// TimeSaved is an estimate of the upstream time saved, based on the
+	// mean latency of the upstream calls made for the method so far.
+	TimeSaved time.Duration
+}
+
+// methodSavings holds the savings of a method, and the upstream latencies
+// needed to estimate the time saved.
+type methodSavings struct {
+	Savings
+
+	upstreamCalls uint64
+	upstreamTime  time.Duration
+}
+
+// savingsFor returns the savings of the method, which must be called with
+// the stats lock held.
+func (s *stats) savingsFor(method string) *methodSavings {
+	if s.methods == nil {
+		s.methods = make(map[string]*methodSavings)
+	}
+	savings, found := s.methods[method]
+	if !found {
+		savings = &methodSavings{}
+		s.methods[method] = savings
+	}
+	return savings
+}
+
+// recordHit accounts for a call to the method that was served the value
+// from cache.
+func (interceptor *InmemoryCachingInterceptor) recordHit(method string, value interface{}) {
+	var size int
+	if message, ok := value.(proto.Message); ok {
+		size = proto.Size(message)
+	}
+
+	var timeSaved time.Duration
+	interceptor.stats.mux.Lock()
+	savings := interceptor.stats.savingsFor(method)
+	savings.Hits++
+	savings.BytesSaved += uint64(size)
+	if savings.upstreamCalls > 0 {
+		timeSaved = savings.upstreamTime / time.Duration(savings.upstreamCalls)
+		savings.TimeSaved += timeSaved
+	}
+	interceptor.stats.mux.Unlock()
+
+	if interceptor.Metrics != nil {
+		interceptor.Metrics.Saved(method, size, timeSaved)
+	}
+}
+
+// recordUpstream accounts for the latency of an upstream call to the method.
+func (interceptor *InmemoryCachingInterceptor) recordUpstream(method string, latency time.Duration) {
+	interceptor.stats.mux.Lock()
+	defer interceptor.stats.mux.Unlock()
+	savings := interceptor.stats.savingsFor(method)
+	savings.upstreamCalls++
+	savings.upstreamTime += latency
+}
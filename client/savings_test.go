@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestSavingsAccumulateOverHits(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	cached := &wrappers.StringValue{Value: "a response of known size"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), cached, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	hits := 3
+	for i := 0; i < hits; i++ {
+		serve(interceptor, context.Background(), req, handler)
+	}
+
+	savings := interceptor.Stats().Savings[testMethod]
+	if savings.Hits != uint64(hits) {
+		test.Errorf("Wanted %d hits, got %d", hits, savings.Hits)
+	}
+	if wanted := uint64(hits * proto.Size(cached)); savings.BytesSaved != wanted {
+		test.Errorf("Wanted %d bytes saved, got %d", wanted, savings.BytesSaved)
+	}
+	if savings.TimeSaved != 0 {
+		test.Errorf("Wanted no time saved without upstream latencies, got %v", savings.TimeSaved)
+	}
+}
+
+func TestSavingsEstimateTimeFromUpstreamLatency(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.recordUpstream(testMethod, 10*time.Millisecond)
+	interceptor.recordUpstream(testMethod, 30*time.Millisecond)
+
+	interceptor.recordHit(testMethod, &wrappers.StringValue{Value: "resp"})
+	interceptor.recordHit(testMethod, &wrappers.StringValue{Value: "resp"})
+
+	if got := interceptor.Stats().Savings[testMethod].TimeSaved; got != 40*time.Millisecond {
+		test.Errorf("Wanted 40ms saved, got %v", got)
+	}
+}
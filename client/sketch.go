@@ -0,0 +1,56 @@
+package client
+
+import (
+	"hash/fnv"
+	"sync"
+)
+
+const (
+	sketchDepth = 4
+	sketchWidth = 2048
+)
+
+// countMinSketch estimates how often keys have been seen, using a fixed
+// amount of memory regardless of how many distinct keys there are. The
+// estimates may be too high, but never too low.
+type countMinSketch struct {
+	counts [sketchDepth][sketchWidth]uint32
+
+	mux sync.Mutex
+}
+
+// index returns the counter that the key maps to in the given row.
+func (s *countMinSketch) index(row int, key string) int {
+	h := fnv.New32a()
+	h.Write([]byte{byte(row)})
+	h.Write([]byte(key))
+	return int(h.Sum32() % sketchWidth)
+}
+
+// add counts an occurrence of the key, and returns its new estimate.
+func (s *countMinSketch) add(key string) uint32 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	var estimate uint32
+	for row := 0; row < sketchDepth; row++ {
+		i := s.index(row, key)
+		s.counts[row][i]++
+		if row == 0 || s.counts[row][i] < estimate {
+			estimate = s.counts[row][i]
+		}
+	}
+	return estimate
+}
+
+// decay halves all counts, so that estimates follow recent access patterns.
+func (s *countMinSketch) decay() {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	for row := range s.counts {
+		for i := range s.counts[row] {
+			s.counts[row][i] /= 2
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package client
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
+)
+
+// Stats contains counters that describe how the cache has behaved so far.
+type Stats struct {
+	// Hits is the number of calls, and stream messages, served from cache.
+	Hits uint64
+	// Misses is the number of calls, and stream messages, that had to go
+	// upstream because no usable response was in cache. Bypasses are not
+	// counted.
+	Misses uint64
+	// HitRatio is the fraction of Hits among Hits and Misses, or zero if
+	// there have been neither.
+	HitRatio float64
+	// Entries is the number of responses currently in cache, or zero if
+	// the Backend cannot count them.
+	Entries int
+
+	// CoherencyChecks is the number of cache hits that have been compared
+	// against a fresh response from upstream.
+	CoherencyChecks uint64
+	// StaleHits is the number of coherency checks where the cached
+	// response differed from the fresh one.
+	StaleHits uint64
+
+	// Calls is the number of calls handled by the server interceptor.
+	Calls uint64
+	// Overhead is the total time that the server interceptor itself has
+	// added to calls, i.e., keying, lookup and header work, but not the
+	// time spent upstream.
+	Overhead time.Duration
+	// MaxOverhead is the largest overhead added to a single call.
+	MaxOverhead time.Duration
+	// UpstreamTime is the total time spent waiting for upstream.
+	UpstreamTime time.Duration
+
+	// Savings is what serving from cache has saved, per method.
+	Savings map[string]Savings
+
+	// StalenessAge holds, per method, a histogram of how long in seconds
+	// stale hits had been stale when served, as measured against the
+	// Oracle by coherency checks.
+	StalenessAge map[string]metrics.HistogramSnapshot
+}
+
+// stats holds the counters of an interceptor, and the state needed to rate
+// limit coherency checks.
+type stats struct {
+	// updated atomically, on every call, outside of the lock
+	hits   uint64
+	misses uint64
+
+	Stats
+
+	lastCoherencyCheck time.Time
+	methods            map[string]*methodSavings
+	staleness          map[string]*metrics.Histogram
+
+	mux sync.Mutex
+}
+
+// Stats returns a snapshot of the interceptor's counters.
+func (interceptor *InmemoryCachingInterceptor) Stats() Stats {
+	interceptor.stats.mux.Lock()
+	defer interceptor.stats.mux.Unlock()
+
+	snapshot := interceptor.stats.Stats
+	snapshot.Hits = atomic.LoadUint64(&interceptor.stats.hits)
+	snapshot.Misses = atomic.LoadUint64(&interceptor.stats.misses)
+	if lookups := snapshot.Hits + snapshot.Misses; lookups > 0 {
+		snapshot.HitRatio = float64(snapshot.Hits) / float64(lookups)
+	}
+	if counter, ok := interceptor.backend().(entryCounter); ok {
+		snapshot.Entries = counter.ItemCount()
+	}
+	snapshot.Savings = make(map[string]Savings, len(interceptor.stats.methods))
+	for method, savings := range interceptor.stats.methods {
+		snapshot.Savings[method] = savings.Savings
+	}
+	snapshot.StalenessAge = make(map[string]metrics.HistogramSnapshot, len(interceptor.stats.staleness))
+	for method, histogram := range interceptor.stats.staleness {
+		snapshot.StalenessAge[method] = histogram.Snapshot()
+	}
+	return snapshot
+}
+
+// ResetStats sets all counters of the interceptor back to zero, e.g. at the
+// start of a measurement. The entries in cache are left alone.
+func (interceptor *InmemoryCachingInterceptor) ResetStats() {
+	interceptor.stats.mux.Lock()
+	defer interceptor.stats.mux.Unlock()
+
+	atomic.StoreUint64(&interceptor.stats.hits, 0)
+	atomic.StoreUint64(&interceptor.stats.misses, 0)
+	interceptor.stats.Stats = Stats{}
+	interceptor.stats.methods = nil
+	interceptor.stats.staleness = nil
+}
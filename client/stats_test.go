@@ -0,0 +1,91 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestStatsCountHitsAndMisses(test *testing.T) {
+	interceptor := newTestInterceptor()
+	cachedReq := &wrappers.StringValue{Value: "cached"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, cachedReq), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	for i := 0; i < 3; i++ {
+		serve(interceptor, context.Background(), cachedReq, handler)
+	}
+	serve(interceptor, context.Background(), &wrappers.StringValue{Value: "uncached"}, handler)
+	bypass := metadata.NewIncomingContext(context.Background(), metadata.Pairs(bypassHeader, "true"))
+	serve(interceptor, bypass, cachedReq, handler)
+
+	got := interceptor.Stats()
+	if got.Hits != 3 || got.Misses != 1 {
+		test.Errorf("Wanted 3 hits and 1 miss, got %d hits and %d misses", got.Hits, got.Misses)
+	}
+	if got.HitRatio != 0.75 {
+		test.Errorf("Wanted hit ratio 0.75, got %v", got.HitRatio)
+	}
+	if got.Entries != 1 {
+		test.Errorf("Wanted 1 entry, got %d", got.Entries)
+	}
+}
+
+func TestStatsWithoutLookups(test *testing.T) {
+	got := newTestInterceptor().Stats()
+	if got.Hits != 0 || got.Misses != 0 || got.HitRatio != 0 {
+		test.Errorf("Wanted no hits, misses or ratio, got %+v", got)
+	}
+}
+
+func TestStatsAreSafeForConcurrentCalls(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+			for j := 0; j < 10; j++ {
+				serve(interceptor, context.Background(), req, handler)
+				interceptor.Stats()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got := interceptor.Stats().Hits; got != 100 {
+		test.Errorf("Wanted 100 hits, got %d", got)
+	}
+}
+
+func TestResetStats(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	serve(interceptor, context.Background(), req, handler)
+	serve(interceptor, context.Background(), &wrappers.StringValue{Value: "other"}, handler)
+
+	interceptor.ResetStats()
+
+	got := interceptor.Stats()
+	if got.Hits != 0 || got.Misses != 0 || len(got.Savings) != 0 {
+		test.Errorf("Wanted counters back at zero, got %+v", got)
+	}
+	if got.Entries != 1 {
+		test.Errorf("Wanted the entry to stay in cache, got %d entries", got.Entries)
+	}
+
+	serve(interceptor, context.Background(), req, handler)
+	if got := interceptor.Stats(); got.Hits != 1 || got.HitRatio != 1 {
+		test.Errorf("Wanted counting to go on after reset, got %+v", got)
+	}
+}
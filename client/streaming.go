@@ -0,0 +1,184 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Server-streaming calls are cached as a unit: the cache value is the
+// ordered slice of messages that made up the stream, keyed by the method and
+// its single request, just like unary calls. Client-streaming calls are
+// passed through as-is, and so are bidirectional calls, unless they are
+// cached per message (see bidi.go).
+
+// errServedFromCache is returned to the handler instead of its request when
+// the stream has already been replayed from cache, so that it returns
+// without calling upstream.
+var errServedFromCache = errors.New("stream served from cache")
+
+// StreamServerInterceptor catches incoming server-streaming calls, and
+// replays the messages of a cached stream if there is one for the request.
+// If not, the call continues as usual, via a client stream (which should be
+// intercepted also).
+func (interceptor *InmemoryCachingInterceptor) StreamServerInterceptor(csvLog *log.Logger) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if interceptor.cachingDisabled() {
+			return handler(srv, ss)
+		}
+		if info.IsServerStream && info.IsClientStream && interceptor.CacheBidiStreams {
+			return handler(srv, &bidiServerStream{ServerStream: ss, interceptor: interceptor, method: info.FullMethod, csvLog: csvLog})
+		}
+		if !info.IsServerStream || info.IsClientStream {
+			return handler(srv, ss)
+		}
+
+		stream := &cachingServerStream{ServerStream: ss, interceptor: interceptor, method: info.FullMethod, csvLog: csvLog}
+		// Handlers may wrap the error they get instead of the request,
+		// e.g. in a status, so the stream records if it was replayed.
+		err := handler(srv, stream)
+		if stream.served || errors.Is(err, errServedFromCache) {
+			return nil
+		}
+		return err
+	}
+}
+
+// cachingServerStream is a grpc.ServerStream that looks up the request in
+// cache as soon as the handler receives it, and replays the cached stream if
+// there is one.
+type cachingServerStream struct {
+	grpc.ServerStream
+
+	interceptor *InmemoryCachingInterceptor
+	method      string
+	received    bool
+	served      bool
+	csvLog      *log.Logger
+}
+
+func (s *cachingServerStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil || s.received {
+		return err
+	}
+	s.received = true
+
+	ctx := s.Context()
+	reqMessage := m.(proto.Message)
+	requestHash := hashing.String(reqMessage.String())
+	hash := s.interceptor.key(ctx, s.method, reqMessage)
+
+	if bypassRequested(ctx) {
+		s.interceptor.logCall("Bypassing cache", "method", s.method, "hash", requestHash, "cache_status", "bypass")
+		s.interceptor.recordDecision(s.method, hash, Bypass, 0)
+		return nil
+	}
+
+	value, found := s.interceptor.backend().Get(hash)
+	messages, ok := value.([]proto.Message)
+	if !found || !ok || s.interceptor.unverifiedTooLong(s.method) {
+		s.interceptor.recordDecision(s.method, hash, Miss, 0)
+		return nil
+	}
+
+	s.interceptor.recordDecision(s.method, hash, Hit, 0)
+	s.SendHeader(metadata.Pairs("x-cache", "hit"))
+	for _, message := range cloneValue(messages).([]proto.Message) {
+		if err := s.SendMsg(message); err != nil {
+			return err
+		}
+	}
+	s.interceptor.logCall("Using cached stream", "method", s.method, "hash", requestHash, "messages", len(messages), "cache_status", "hit")
+	s.csvLog.Printf("%d,cache,%s\n", time.Now().UnixNano(), s.method)
+
+	s.served = true
+	return errServedFromCache
+}
+
+// StreamClientInterceptor catches outgoing server-streaming calls, and
+// stores the whole stream in cache once it has completed successfully, if
+// its cache headers allow it. Streams that fail partway through are never
+// stored.
+func (interceptor *InmemoryCachingInterceptor) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil || interceptor.cachingDisabled() {
+			return cs, err
+		}
+		if desc.ServerStreams && desc.ClientStreams && interceptor.CacheBidiStreams {
+			return &bidiClientStream{ClientStream: cs, interceptor: interceptor, ctx: ctx, method: method}, nil
+		}
+		if !desc.ServerStreams || desc.ClientStreams {
+			return cs, nil
+		}
+
+		grpc.SetHeader(ctx, metadata.Pairs("x-cache", "miss"))
+		return &cachingClientStream{ClientStream: cs, interceptor: interceptor, ctx: ctx, method: method}, nil
+	}
+}
+
+// cachingClientStream is a grpc.ClientStream that records the request and
+// the messages of a server stream, and stores them once the stream ends.
+type cachingClientStream struct {
+	grpc.ClientStream
+
+	interceptor *InmemoryCachingInterceptor
+	ctx         context.Context
+	method      string
+
+	req      proto.Message
+	messages []proto.Message
+}
+
+func (s *cachingClientStream) SendMsg(m interface{}) error {
+	if s.req == nil {
+		s.req = proto.Clone(m.(proto.Message))
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *cachingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case err == nil:
+		s.messages = append(s.messages, proto.Clone(m.(proto.Message)))
+	case err == io.EOF:
+		s.store()
+	default:
+		s.interceptor.logger().Warn("Upstream stream failed, not storing it", "method", s.method, "messages", len(s.messages), "error", err)
+	}
+	return err
+}
+
+// store the completed stream in cache, if the cache headers allow it. The
+// cache-control may be sent in either the header or the trailer, since a
+// streaming server only knows the max-age once the stream is complete.
+func (s *cachingClientStream) store() {
+	if s.req == nil {
+		return
+	}
+
+	header, _ := s.Header()
+	expiration := ParseCacheControl(append(header.Get("cache-control"), s.Trailer().Get("cache-control")...)).expiration()
+	if expiration <= 0 || !storeAllowed(s.ctx) {
+		s.interceptor.logCall("Fetched upstream stream", "method", s.method, "messages", len(s.messages), "cache_status", "miss", "stored", false)
+		return
+	}
+
+	hash := s.interceptor.key(s.ctx, s.method, s.req)
+	ttl := time.Duration(expiration) * time.Second
+	s.interceptor.backend().Set(hash, s.messages, ttl)
+	s.interceptor.keys.add(s.method, hash, ttl)
+	s.interceptor.recordDecision(s.method, hash, Store, ttl)
+	if s.interceptor.MemoryLimit > 0 {
+		s.interceptor.recency.stored(hash, ttl)
+	}
+	s.interceptor.logCall("Fetched upstream stream", "method", s.method, "messages", len(s.messages), "cache_status", "miss", "stored", true, "max_age", expiration)
+}
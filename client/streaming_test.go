@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"io"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var serverStreamDesc = &grpc.StreamDesc{StreamName: "Method", ServerStreams: true}
+
+// fakeServerStream is a grpc.ServerStream that receives a single request,
+// and records the messages sent on it.
+type fakeServerStream struct {
+	grpc.ServerStream
+
+	req      proto.Message
+	received bool
+	header   metadata.MD
+	sent     []proto.Message
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeServerStream) SendHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	s.sent = append(s.sent, m.(proto.Message))
+	return nil
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if s.received {
+		return io.EOF
+	}
+	s.received = true
+	proto.Merge(m.(proto.Message), s.req)
+	return nil
+}
+
+// fakeClientStream is a grpc.ClientStream that answers with its messages,
+// and then ends with its error (io.EOF if unset).
+type fakeClientStream struct {
+	grpc.ClientStream
+
+	header   metadata.MD
+	messages []proto.Message
+	err      error
+}
+
+func (s *fakeClientStream) Header() (metadata.MD, error) {
+	return s.header, nil
+}
+
+func (s *fakeClientStream) Trailer() metadata.MD {
+	return nil
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if len(s.messages) == 0 {
+		if s.err != nil {
+			return s.err
+		}
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.messages[0])
+	s.messages = s.messages[1:]
+	return nil
+}
+
+// streamThrough runs a server stream for the request through the client
+// interceptor, as a reverse proxy would, and returns the messages received.
+func streamThrough(interceptor *InmemoryCachingInterceptor, req proto.Message, upstream *fakeClientStream) ([]string, error) {
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return upstream, nil
+	}
+
+	cs, err := interceptor.StreamClientInterceptor()(context.Background(), serverStreamDesc, nil, testMethod, streamer)
+	if err != nil {
+		return nil, err
+	}
+	if err := cs.SendMsg(req); err != nil {
+		return nil, err
+	}
+
+	var values []string
+	for {
+		reply := &wrappers.StringValue{}
+		if err := cs.RecvMsg(reply); err == io.EOF {
+			return values, nil
+		} else if err != nil {
+			return values, err
+		}
+		values = append(values, reply.Value)
+	}
+}
+
+func upstreamStream(err error, values ...string) *fakeClientStream {
+	messages := make([]proto.Message, len(values))
+	for i, value := range values {
+		messages[i] = &wrappers.StringValue{Value: value}
+	}
+	return &fakeClientStream{
+		header:   metadata.Pairs("cache-control", "must-revalidate, max-age=60"),
+		messages: messages,
+		err:      err,
+	}
+}
+
+// replay runs the server interceptor for the request, with a handler that
+// fails the test if it calls upstream.
+func replay(test *testing.T, interceptor *InmemoryCachingInterceptor, req proto.Message) *fakeServerStream {
+	ss := &fakeServerStream{req: req}
+	info := &grpc.StreamServerInfo{FullMethod: testMethod, IsServerStream: true}
+	upstreamCalls := 0
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&wrappers.StringValue{}); err != nil {
+			return err
+		}
+		upstreamCalls++
+		return nil
+	}
+
+	if err := interceptor.StreamServerInterceptor(discardLog)(nil, ss, info, handler); err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	if upstreamCalls != 0 && len(ss.sent) != 0 {
+		test.Errorf("Wanted either a replay or an upstream call, got both")
+	}
+	return ss
+}
+
+func TestServerStreamReplayedFromCache(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+
+	values, err := streamThrough(interceptor, req, upstreamStream(nil, "0", "1", "2"))
+	if err != nil || len(values) != 3 {
+		test.Fatalf("Wanted 3 messages from upstream, got %v (err %v)", values, err)
+	}
+
+	ss := replay(test, interceptor, req)
+	if len(ss.sent) != 3 {
+		test.Fatalf("Wanted 3 messages replayed from cache, got %d", len(ss.sent))
+	}
+	for i, message := range ss.sent {
+		if wanted := values[i]; message.(*wrappers.StringValue).Value != wanted {
+			test.Errorf("Wanted message %d to be %s, got %v", i, wanted, message)
+		}
+	}
+	if got := ss.header.Get("x-cache"); len(got) != 1 || got[0] != "hit" {
+		test.Errorf("Wanted x-cache hit header, got %v", got)
+	}
+}
+
+func TestPartialServerStreamNotCached(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+
+	failure := status.Errorf(codes.Unavailable, "Upstream went away")
+	if _, err := streamThrough(interceptor, req, upstreamStream(failure, "0", "1")); err != failure {
+		test.Fatalf("Wanted stream to fail with %v, got %v", failure, err)
+	}
+
+	if got := interceptor.Cache.ItemCount(); got != 0 {
+		test.Errorf("Wanted partial stream not to be cached, got %d entries", got)
+	}
+	if ss := replay(test, interceptor, req); len(ss.sent) != 0 {
+		test.Errorf("Wanted no messages replayed, got %d", len(ss.sent))
+	}
+}
+
+func TestReplayedStreamSucceedsWhenHandlerWrapsError(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	if _, err := streamThrough(interceptor, req, upstreamStream(nil, "0", "1")); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	ss := &fakeServerStream{req: req}
+	info := &grpc.StreamServerInfo{FullMethod: testMethod, IsServerStream: true}
+	handler := func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&wrappers.StringValue{}); err != nil {
+			return status.Errorf(codes.Internal, "Unable to receive request: %v", err)
+		}
+		return nil
+	}
+
+	if err := interceptor.StreamServerInterceptor(discardLog)(nil, ss, info, handler); err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	if len(ss.sent) != 2 {
+		test.Errorf("Wanted 2 messages replayed from cache, got %d", len(ss.sent))
+	}
+}
@@ -0,0 +1,88 @@
+package client
+
+import "time"
+
+// expirationGetter is implemented by Cache backends that can tell when the
+// values they return expire. The zero time means never.
+type expirationGetter interface {
+	GetWithExpiration(key string) (interface{}, time.Time, bool)
+}
+
+// TieredCache is a Cache that puts a fast, local, L1 in front of a slower,
+// shared, L2, e.g. a RedisCache, so that reverse proxy replicas benefit
+// from each other's upstream calls without asking the L2 on every call.
+// Values are written to both, and values only found in L2 are promoted to
+// L1. No value is kept longer in L1 than in L2.
+type TieredCache struct {
+	L1 Cache
+	L2 Cache
+	// L1TTL is the longest a value is kept in L1, after which it is
+	// fetched from L2 again, e.g. to pick up values replaced by other
+	// replicas. Zero means as long as in L2.
+	L1TTL time.Duration
+}
+
+// compile-time check that we adhere to interface
+var _ Cache = (*TieredCache)(nil)
+
+// NewTieredCache returns a TieredCache that keeps values in l1 for at most
+// l1TTL, and in l2 for as long as they are stored.
+func NewTieredCache(l1, l2 Cache, l1TTL time.Duration) *TieredCache {
+	return &TieredCache{L1: l1, L2: l2, L1TTL: l1TTL}
+}
+
+// Get the value for the key from L1, or from L2, in which case it is
+// promoted to L1 for the rest of its lifetime in L2, or L1TTL if shorter.
+// Values whose expiration from L2 is unknown, or that never expire, are
+// promoted for L1TTL, and not at all without one.
+func (c *TieredCache) Get(key string) (interface{}, bool) {
+	if value, found := c.L1.Get(key); found {
+		return value, true
+	}
+
+	var value interface{}
+	var expiration time.Time
+	var found bool
+	if getter, ok := c.L2.(expirationGetter); ok {
+		value, expiration, found = getter.GetWithExpiration(key)
+	} else {
+		value, found = c.L2.Get(key)
+	}
+	if !found {
+		return nil, false
+	}
+
+	ttl := c.L1TTL
+	if !expiration.IsZero() {
+		remaining := time.Until(expiration)
+		if remaining <= 0 {
+			return nil, false
+		}
+		if ttl <= 0 || remaining < ttl {
+			ttl = remaining
+		}
+	}
+	if ttl > 0 {
+		c.L1.Set(key, value, ttl)
+	}
+	return value, true
+}
+
+// Set the value for the key in both L2 and L1, where it is kept for at most
+// L1TTL.
+func (c *TieredCache) Set(key string, value interface{}, ttl time.Duration) {
+	c.L2.Set(key, value, ttl)
+
+	l1TTL := ttl
+	if c.L1TTL > 0 && (l1TTL <= 0 || c.L1TTL < l1TTL) {
+		l1TTL = c.L1TTL
+	}
+	c.L1.Set(key, value, l1TTL)
+}
+
+// Delete the value for the key from both L1 and L2. Other replicas keep it
+// in their L1 until it expires there.
+func (c *TieredCache) Delete(key string) {
+	c.L1.Delete(key)
+	c.L2.Delete(key)
+}
@@ -0,0 +1,87 @@
+package client
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/patrickmn/go-cache"
+)
+
+func newTestTieredCache(test *testing.T, l1TTL time.Duration) (*TieredCache, *cache.Cache, *RedisCache, func()) {
+	l1 := cache.New(time.Minute, time.Minute)
+	l2, server := newTestRedisCache(test)
+	return NewTieredCache(NewGoCache(l1), l2, l1TTL), l1, l2, func() {
+		l2.Close()
+		server.Close()
+	}
+}
+
+func TestTieredCacheWritesThrough(test *testing.T) {
+	c, l1, l2, stop := newTestTieredCache(test, 10*time.Second)
+	defer stop()
+
+	c.Set("key", &wrappers.StringValue{Value: "resp"}, time.Minute)
+
+	if _, expiration, found := l1.GetWithExpiration("key"); !found || time.Until(expiration) > 10*time.Second {
+		test.Errorf("Wanted the value in L1 for at most L1TTL, got expiration in %v (found %v)", time.Until(expiration), found)
+	}
+	if _, expiration, found := l2.GetWithExpiration("key"); !found || time.Until(expiration) <= 10*time.Second {
+		test.Errorf("Wanted the value in L2 for its full ttl, got expiration in %v (found %v)", time.Until(expiration), found)
+	}
+
+	c.Delete("key")
+	if _, found := l1.Get("key"); found {
+		test.Errorf("Wanted the value deleted from L1")
+	}
+	if _, found := l2.Get("key"); found {
+		test.Errorf("Wanted the value deleted from L2")
+	}
+}
+
+func TestTieredCachePromotesL2Hits(test *testing.T) {
+	c, l1, l2, stop := newTestTieredCache(test, time.Minute)
+	defer stop()
+
+	// as if stored by another replica
+	l2.Set("key", &wrappers.StringValue{Value: "resp"}, 5*time.Second)
+
+	value, found := c.Get("key")
+	if !found || !proto.Equal(value.(proto.Message), &wrappers.StringValue{Value: "resp"}) {
+		test.Fatalf("Wanted the value from L2, got %v (found %v)", value, found)
+	}
+	_, expiration, found := l1.GetWithExpiration("key")
+	if !found {
+		test.Fatalf("Wanted the value promoted to L1")
+	}
+	if remaining := time.Until(expiration); remaining > 5*time.Second {
+		test.Errorf("Wanted the value kept in L1 no longer than in L2, got %v", remaining)
+	}
+
+	// served from L1, even once gone from L2
+	l2.Delete("key")
+	if _, found := c.Get("key"); !found {
+		test.Errorf("Wanted the promoted value served from L1")
+	}
+}
+
+func TestTieredCacheWithoutL2Expirations(test *testing.T) {
+	l1 := cache.New(time.Minute, time.Minute)
+	l2 := newMapCache()
+	l2.Set("key", 1, time.Minute)
+
+	if _, found := NewTieredCache(NewGoCache(l1), l2, 0).Get("key"); !found {
+		test.Errorf("Wanted the value from L2")
+	}
+	if _, found := l1.Get("key"); found {
+		test.Errorf("Wanted no promotion without L1TTL, since the expiration in L2 is unknown")
+	}
+
+	if _, found := NewTieredCache(NewGoCache(l1), l2, time.Second).Get("key"); !found {
+		test.Errorf("Wanted the value from L2")
+	}
+	if _, expiration, found := l1.GetWithExpiration("key"); !found || time.Until(expiration) > time.Second {
+		test.Errorf("Wanted promotion for L1TTL, got expiration in %v (found %v)", time.Until(expiration), found)
+	}
+}
@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// recordingSpan is a trace.Span that remembers its attributes.
+type recordingSpan struct {
+	trace.Span
+	attributes map[attribute.Key]attribute.Value
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attributes[attr.Key] = attr.Value
+	}
+}
+
+func tracedContext() (context.Context, *recordingSpan) {
+	span := &recordingSpan{Span: trace.SpanFromContext(context.Background()), attributes: make(map[attribute.Key]attribute.Value)}
+	return trace.ContextWithSpan(context.Background(), span), span
+}
+
+func TestSpanAnnotatedWithCacheHit(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	handler := &countingHandler{resp: &wrappers.StringValue{Value: "fresh"}}
+
+	ctx, span := tracedContext()
+	serve(interceptor, ctx, req, handler)
+	if hit, found := span.attributes["cache.hit"]; !found || hit.AsBool() {
+		test.Errorf("Wanted cache.hit false on a miss, got %v (found %v)", hit.AsBool(), found)
+	}
+
+	interceptor.Cache.Set(interceptor.key(context.Background(), testMethod, req), &wrappers.StringValue{Value: "cached"}, time.Minute)
+	ctx, span = tracedContext()
+	serve(interceptor, ctx, req, handler)
+	if hit, found := span.attributes["cache.hit"]; !found || !hit.AsBool() {
+		test.Errorf("Wanted cache.hit true on a hit, got %v (found %v)", hit.AsBool(), found)
+	}
+}
@@ -0,0 +1,45 @@
+package client
+
+import (
+	"reflect"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// Values in the cache are shared between every call that hits them, so they
+// must never be stored or served in a form that anyone else may mutate.
+//
+// Unary responses (proto.Message pointers) are cloned by cloneValue when
+// stored, since the reply buffer belongs to the caller and may be reused,
+// and again when served, since gRPC and other interceptors are free to
+// modify the response they are handed. Server streams ([]proto.Message) have
+// each message cloned by the cachingClientStream as it is received, and are
+// cloned by cloneValue when served. Cached errors (*cachedError) are never
+// modified, and are turned into a new error each time they are replayed. Any
+// other type of value is stored and served as-is, so it must be immutable.
+
+// cloneValue returns a copy of a value that is safe to store in cache, or to
+// serve from it.
+func cloneValue(value interface{}) interface{} {
+	switch value := value.(type) {
+	case proto.Message:
+		return proto.Clone(value)
+	case []proto.Message:
+		cloned := make([]proto.Message, len(value))
+		for i, message := range value {
+			cloned[i] = proto.Clone(message)
+		}
+		return cloned
+	}
+	return value
+}
+
+// nilReply is a predicate that indicates if a reply is missing altogether,
+// i.e. nil or a nil pointer, which must never be cached.
+func nilReply(reply interface{}) bool {
+	if reply == nil {
+		return true
+	}
+	value := reflect.ValueOf(reply)
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
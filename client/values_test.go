@@ -0,0 +1,162 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// cacheableInvoker is a grpc.UnaryInvoker which answers with the given
+// value, marked as cacheable for a minute.
+func cacheableInvoker(value string) grpc.UnaryInvoker {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*wrappers.StringValue).Value = value
+		for _, opt := range opts {
+			if header, ok := opt.(grpc.HeaderCallOption); ok {
+				*header.HeaderAddr = metadata.Pairs("cache-control", "max-age=60")
+			}
+		}
+		return nil
+	}
+}
+
+func TestStoredResponseIsNotShared(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	reply := &wrappers.StringValue{}
+
+	err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, reply, nil, cacheableInvoker("original"))
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	// The caller may reuse its reply buffer.
+	reply.Value = "mutated"
+
+	resp, _, _ := serve(interceptor, context.Background(), req, &countingHandler{})
+	if got := resp.(*wrappers.StringValue).Value; got != "original" {
+		test.Errorf("Wanted cached response to be unaffected by mutation, got %s", got)
+	}
+}
+
+func TestServedResponsesAreNotShared(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("original"))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			resp, _, _ := serve(interceptor, context.Background(), req, &countingHandler{})
+			message := resp.(*wrappers.StringValue)
+			if message.Value != "original" {
+				test.Errorf("Wanted unmodified cached response, got %s", message.Value)
+			}
+			message.Value = "mutated"
+			proto.Size(message)
+		}()
+	}
+	wg.Wait()
+}
+
+func TestOversizedResponseIsNotStored(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.MaxResponseSize = 4
+	req := &wrappers.StringValue{Value: "req"}
+
+	err := interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("too large to cache"))
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	if _, found := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, req)); found {
+		test.Errorf("Wanted response above size limit not to be cached")
+	}
+
+	interceptor.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, nil, cacheableInvoker("ok"))
+	if _, found := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, req)); !found {
+		test.Errorf("Wanted response within size limit to be cached")
+	}
+}
+
+func TestNilReplyNotStored(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	var reply *wrappers.StringValue
+
+	stream := &headerCapture{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		for _, opt := range opts {
+			if header, ok := opt.(grpc.HeaderCallOption); ok {
+				*header.HeaderAddr = metadata.Pairs("cache-control", "max-age=60")
+			}
+		}
+		return nil
+	}
+
+	if err := interceptor.UnaryClientInterceptor()(ctx, testMethod, req, reply, nil, invoker); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := interceptor.Cache.ItemCount(); got != 0 {
+		test.Errorf("Wanted nil reply not to be cached, got %d entries", got)
+	}
+	if got := stream.header.Get("x-cache"); len(got) != 1 || got[0] != "miss-nilreply" {
+		test.Errorf("Wanted x-cache miss-nilreply header, got %v", got)
+	}
+}
+
+func TestReplayedStreamIsNotShared(test *testing.T) {
+	interceptor := newTestInterceptor()
+	req := &wrappers.StringValue{Value: "req"}
+	if _, err := streamThrough(interceptor, req, upstreamStream(nil, "0", "1")); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	first := replay(test, interceptor, req)
+	for _, message := range first.sent {
+		message.(*wrappers.StringValue).Value = "mutated"
+	}
+
+	second := replay(test, interceptor, req)
+	for i, message := range second.sent {
+		if got := message.(*wrappers.StringValue).Value; got == "mutated" {
+			test.Errorf("Wanted replayed message %d to be unaffected by mutation, got %s", i, got)
+		}
+	}
+}
+
+func TestReplayedErrorIsNotShared(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.NegativeTTL = time.Minute
+	interceptor.NegativeCacheCodes = []codes.Code{codes.NotFound}
+	invoker := &failingInvoker{code: codes.NotFound}
+	req := &wrappers.StringValue{Value: "req"}
+	serveThrough(interceptor, req, invoker.invoke)
+
+	first := serveThrough(interceptor, req, invoker.invoke)
+	second := serveThrough(interceptor, req, invoker.invoke)
+	if first == second {
+		test.Errorf("Wanted each replay to get its own error, got %p twice", first)
+	}
+
+	// Altering the status of a replayed error must not reach the cache.
+	status.Convert(first).Proto().Message = "mutated"
+	value, _ := interceptor.Cache.Get(interceptor.key(context.Background(), testMethod, req))
+	if cached := value.(*cachedError); cached.message == "mutated" {
+		test.Errorf("Wanted the cached error to be unaffected by mutation, got %s", cached.message)
+	}
+	if got := status.Convert(second).Message(); got != status.Convert(first).Message() {
+		test.Errorf("Wanted replays to carry the same message, got %s and %s", got, status.Convert(first).Message())
+	}
+}
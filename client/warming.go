@@ -0,0 +1,165 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// warmingTimeout bounds how long refreshing a single entry may take.
+const warmingTimeout = time.Duration(10 * time.Second)
+
+// refresher holds what is needed to fetch a fresh response for a key. The
+// CallOptions of the call that stored it are not kept, since they may point
+// into that call, e.g. to receive its header.
+type refresher struct {
+	method string
+	key    string
+	// the metadata of the call that stored the key, which it is refreshed
+	// with, so that it is fetched on behalf of the same caller
+	incoming metadata.MD
+	outgoing metadata.MD
+	req      proto.Message
+	reply    proto.Message
+	cc       *grpc.ClientConn
+	invoker  grpc.UnaryInvoker
+}
+
+// newRefresher returns how to refresh the key, as stored by a call with the
+// context.
+func newRefresher(ctx context.Context, method string, key string, req proto.Message, reply proto.Message, cc *grpc.ClientConn, invoker grpc.UnaryInvoker) *refresher {
+	r := &refresher{
+		method:  method,
+		key:     key,
+		req:     proto.Clone(req),
+		reply:   cloneValue(reply).(proto.Message),
+		cc:      cc,
+		invoker: invoker,
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		r.incoming = md.Copy()
+	}
+	if md, ok := metadata.FromOutgoingContext(ctx); ok {
+		r.outgoing = md.Copy()
+	}
+	return r
+}
+
+// context returns a context for a refresh, which carries the metadata of
+// the call that stored the key.
+func (r *refresher) context() (context.Context, context.CancelFunc) {
+	ctx := context.Background()
+	if r.incoming != nil {
+		ctx = metadata.NewIncomingContext(ctx, r.incoming)
+	}
+	if r.outgoing != nil {
+		ctx = metadata.NewOutgoingContext(ctx, r.outgoing)
+	}
+	return context.WithTimeout(ctx, warmingTimeout)
+}
+
+// warmer keeps track of the most frequently accessed keys, and of how to
+// refresh them.
+type warmer struct {
+	sketch countMinSketch
+
+	// the hottest keys, and their estimated access counts
+	hot        map[string]uint32
+	refreshers map[string]*refresher
+
+	mux sync.Mutex
+}
+
+// recordAccess counts an access to the key, and keeps track of whether it
+// is among the topK hottest keys.
+func (w *warmer) recordAccess(key string, topK int) {
+	estimate := w.sketch.add(key)
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if w.hot == nil {
+		w.hot = make(map[string]uint32)
+		w.refreshers = make(map[string]*refresher)
+	}
+
+	if _, found := w.hot[key]; found || len(w.hot) < topK {
+		w.hot[key] = estimate
+		return
+	}
+
+	coldest, coldestCount := "", estimate
+	for hotKey, count := range w.hot {
+		if count < coldestCount {
+			coldest, coldestCount = hotKey, count
+		}
+	}
+	if coldest != "" {
+		delete(w.hot, coldest)
+		delete(w.refreshers, coldest)
+		w.hot[key] = estimate
+	}
+}
+
+// remember how to refresh the key, if it is currently hot.
+func (w *warmer) remember(key string, r *refresher) {
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	if _, found := w.hot[key]; found {
+		w.refreshers[key] = r
+	}
+}
+
+// hottest returns how to refresh each of the currently hottest keys, and
+// ages the access counts.
+func (w *warmer) hottest() []*refresher {
+	w.sketch.decay()
+
+	w.mux.Lock()
+	defer w.mux.Unlock()
+
+	refreshers := make([]*refresher, 0, len(w.refreshers))
+	for key, r := range w.refreshers {
+		refreshers = append(refreshers, r)
+		w.hot[key] /= 2
+	}
+	return refreshers
+}
+
+// warm refreshes the hottest entries in the cache, so that popular data
+// does not cause misses when it expires.
+func (interceptor *InmemoryCachingInterceptor) warm() {
+	for _, r := range interceptor.warmer.hottest() {
+		ctx, cancel := r.context()
+		reply := proto.Clone(r.reply)
+		reply.Reset()
+		err := interceptor.invokeKeyed(ctx, r.method, r.key, r.req, reply, r.cc, r.invoker)
+		cancel()
+		if err != nil {
+			interceptor.logger().Warn("Failed to warm cache", "method", r.method, "error", err)
+		}
+	}
+}
+
+// startWarming periodically warms the cache until the interceptor is
+// closed.
+func (interceptor *InmemoryCachingInterceptor) startWarming() {
+	quit := interceptor.quitChannel()
+	go func() {
+		ticker := time.NewTicker(interceptor.WarmInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				interceptor.warm()
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
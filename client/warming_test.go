@@ -0,0 +1,108 @@
+package client
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// callCounter counts upstream calls per request value.
+type callCounter struct {
+	calls map[string]int
+	mux   sync.Mutex
+}
+
+func (c *callCounter) invoker(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	c.mux.Lock()
+	c.calls[req.(*wrappers.StringValue).Value]++
+	c.mux.Unlock()
+	return cacheableInvoker("fresh")(ctx, method, req, reply, cc, opts...)
+}
+
+// proxyHandler is a grpc.UnaryHandler that calls upstream through the
+// interceptor's client part, like a reverse proxy does.
+func proxyHandler(interceptor *InmemoryCachingInterceptor, invoker grpc.UnaryInvoker) grpc.UnaryHandler {
+	return func(ctx context.Context, req interface{}) (interface{}, error) {
+		reply := &wrappers.StringValue{}
+		err := interceptor.UnaryClientInterceptor()(ctx, testMethod, req, reply, nil, invoker)
+		return reply, err
+	}
+}
+
+func TestWarmingRefreshesHottestKeys(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.WarmInterval = time.Hour
+	interceptor.WarmTopK = 2
+	defer interceptor.Close()
+
+	counter := &callCounter{calls: make(map[string]int)}
+	serverInterceptor := interceptor.UnaryServerInterceptor(discardLog)
+	handler := proxyHandler(interceptor, counter.invoker)
+	access := func(value string, times int) {
+		for i := 0; i < times; i++ {
+			serverInterceptor(context.Background(), &wrappers.StringValue{Value: value}, &grpc.UnaryServerInfo{FullMethod: testMethod}, handler)
+		}
+	}
+
+	access("hot", 50)
+	access("warm", 30)
+	for _, cold := range []string{"a", "b", "c", "d", "e"} {
+		access(cold, 1)
+	}
+
+	counter.calls = make(map[string]int)
+	interceptor.warm()
+
+	if counter.calls["hot"] != 1 || counter.calls["warm"] != 1 {
+		test.Errorf("Wanted hottest keys to be refreshed once each, got %v", counter.calls)
+	}
+	if len(counter.calls) != 2 {
+		test.Errorf("Wanted no cold keys to be refreshed, got %v", counter.calls)
+	}
+}
+
+func TestWarmingKeepsMetadataOfCaller(test *testing.T) {
+	interceptor := newTestInterceptor()
+	interceptor.WarmInterval = time.Hour
+	interceptor.WarmTopK = 1
+	interceptor.KeyComponents = DefaultKeyComponents | KeyTenant
+	interceptor.TenantHeader = "x-tenant-id"
+	defer interceptor.Close()
+
+	var authorizations []string
+	value := "first"
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ := metadata.FromOutgoingContext(ctx)
+		authorizations = append(authorizations, strings.Join(md.Get("authorization"), ","))
+		return cacheableInvoker(value)(ctx, method, req, reply, cc, opts...)
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("x-tenant-id", "a"))
+	ctx = metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer a")
+	req := &wrappers.StringValue{Value: "req"}
+	interceptor.UnaryServerInterceptor(discardLog)(ctx, req, &grpc.UnaryServerInfo{FullMethod: testMethod}, proxyHandler(interceptor, invoker))
+
+	value = "second"
+	interceptor.warm()
+
+	if len(authorizations) != 2 || authorizations[1] != "Bearer a" {
+		test.Errorf("Wanted the refresh to carry the caller's metadata, got %v", authorizations)
+	}
+	cached, found := interceptor.backend().Get(interceptor.key(ctx, testMethod, req))
+	if !found {
+		test.Fatalf("Wanted the tenant's entry to stay cached")
+	}
+	if got, _ := unwrapEntry(cached); got.(proto.Message).String() != (&wrappers.StringValue{Value: "second"}).String() {
+		test.Errorf("Wanted the tenant's entry to be refreshed, got %v", got)
+	}
+	if _, found := interceptor.backend().Get(interceptor.key(context.Background(), testMethod, req)); found {
+		test.Errorf("Wanted nothing stored for calls without a tenant")
+	}
+}
@@ -0,0 +1,103 @@
+// Package flags lets the caching and estimating interceptors be driven by an
+// external feature-flag system, instead of only by their configuration.
+package flags
+
+import (
+	"sync"
+	"time"
+)
+
+// Names of the flags that the interceptors consult. Flags that are not set
+// are false or zero, which leaves the interceptors as configured.
+const (
+	// CachingDisabled turns the caching interceptor into a pass-through,
+	// which neither serves nor stores responses.
+	CachingDisabled = "caching.disabled"
+	// EstimationDisabled stops the estimator from emitting cache-control
+	// headers and from verifying responses.
+	EstimationDisabled = "estimation.disabled"
+	// StrategyAlpha, if positive, overrides the alpha parameter of the
+	// estimation strategies.
+	StrategyAlpha = "strategy.alpha"
+	// StrategyRho, if positive, overrides the rho parameter of the
+	// estimation strategies.
+	StrategyRho = "strategy.rho"
+)
+
+// A Source provides the current values of flags. Both methods return the
+// zero value for flags that are not set.
+type Source interface {
+	Bool(name string) bool
+	Float(name string) float64
+}
+
+// Static is a Source with fixed values, e.g. taken from configuration.
+type Static struct {
+	Bools  map[string]bool
+	Floats map[string]float64
+}
+
+// Bool returns the value of the named boolean flag.
+func (s Static) Bool(name string) bool {
+	return s.Bools[name]
+}
+
+// Float returns the value of the named numeric flag.
+func (s Static) Float(name string) float64 {
+	return s.Floats[name]
+}
+
+// Cached wraps a Source that may be expensive to consult, e.g. one that asks
+// a remote flag service, so that each flag is looked up at most once per
+// interval. Changes to a flag thus take effect within the interval.
+func Cached(source Source, interval time.Duration) Source {
+	return &cachedSource{
+		source:   source,
+		interval: interval,
+		bools:    make(map[string]cachedBool),
+		floats:   make(map[string]cachedFloat),
+	}
+}
+
+type cachedBool struct {
+	value   bool
+	fetched time.Time
+}
+
+type cachedFloat struct {
+	value   float64
+	fetched time.Time
+}
+
+type cachedSource struct {
+	source   Source
+	interval time.Duration
+
+	bools  map[string]cachedBool
+	floats map[string]cachedFloat
+	mux    sync.Mutex
+}
+
+func (s *cachedSource) Bool(name string) bool {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	cached, found := s.bools[name]
+	if !found || time.Since(cached.fetched) >= s.interval {
+		cached = cachedBool{value: s.source.Bool(name), fetched: time.Now()}
+		s.bools[name] = cached
+	}
+	return cached.value
+}
+
+func (s *cachedSource) Float(name string) float64 {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	cached, found := s.floats[name]
+	if !found || time.Since(cached.fetched) >= s.interval {
+		cached = cachedFloat{value: s.source.Float(name), fetched: time.Now()}
+		s.floats[name] = cached
+	}
+	return cached.value
+}
@@ -0,0 +1,47 @@
+package flags
+
+import (
+	"testing"
+	"time"
+)
+
+// countingSource is a Source that counts how often it is consulted.
+type countingSource struct {
+	Static
+	lookups int
+}
+
+func (s *countingSource) Bool(name string) bool {
+	s.lookups++
+	return s.Static.Bool(name)
+}
+
+func TestCachedSourceLooksUpOncePerInterval(test *testing.T) {
+	source := &countingSource{Static: Static{Bools: map[string]bool{CachingDisabled: true}}}
+	cached := Cached(source, 20*time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		if !cached.Bool(CachingDisabled) {
+			test.Errorf("Wanted flag to be set")
+		}
+	}
+	if source.lookups != 1 {
+		test.Errorf("Wanted 1 lookup, got %d", source.lookups)
+	}
+
+	source.Bools[CachingDisabled] = false
+	time.Sleep(30 * time.Millisecond)
+	if cached.Bool(CachingDisabled) {
+		test.Errorf("Wanted changed flag to be picked up after the interval")
+	}
+	if source.lookups != 2 {
+		test.Errorf("Wanted 2 lookups, got %d", source.lookups)
+	}
+}
+
+func TestStaticSourceDefaults(test *testing.T) {
+	var source Static
+	if source.Bool(EstimationDisabled) || source.Float(StrategyRho) != 0 {
+		test.Errorf("Wanted unset flags to be false and zero")
+	}
+}
@@ -0,0 +1,74 @@
+// Package hashing provides the hash functions that the caching and
+// estimating interceptors use to key responses by their requests, and to
+// tell responses apart.
+package hashing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"hash/fnv"
+	"strconv"
+)
+
+// A Hasher hashes data to a digest, which is used as is in keys, so it
+// must be printable. Digests must be stable across runs and processes,
+// since they key responses in shared caches.
+type Hasher interface {
+	Hash(data []byte) string
+}
+
+// FNV is a Hasher using the 64-bit FNV-1a hash function, whose digest is
+// the hash in decimal. It is fast, but its digests are short enough that
+// distinct keys may collide.
+type FNV struct{}
+
+// Hash the data.
+func (FNV) Hash(data []byte) string {
+	return strconv.FormatUint(fnv64a(data), 10)
+}
+
+// SHA256 is a Hasher using the SHA-256 hash function, whose digest is the
+// hash in hexadecimal, for when keys must not collide.
+type SHA256 struct{}
+
+// Hash the data.
+func (SHA256) Hash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Default is the Hasher used unless another one is given.
+var Default Hasher = FNV{}
+
+// fnv64a returns the 64-bit FNV-1a hash of the data.
+func fnv64a(data []byte) uint64 {
+	h := fnv.New64a()
+	h.Write(data)
+	return h.Sum64()
+}
+
+// maxInt is the largest int, whatever its size on the platform.
+const maxInt = int(^uint(0) >> 1)
+
+// String hashes the string with FNV-1a to a non-negative int, e.g. to
+// identify a request in logs.
+func String(s string) int {
+	return int(fnv64a([]byte(s)) & uint64(maxInt))
+}
+
+// Strings hashes the parts, in order, to a key, using the given Hasher, or
+// the Default one if nil. Each part is prefixed by its length, so that
+// parts cannot run into each other.
+func Strings(hasher Hasher, parts []string) string {
+	if hasher == nil {
+		hasher = Default
+	}
+
+	var buf []byte
+	for _, part := range parts {
+		buf = strconv.AppendInt(buf, int64(len(part)), 10)
+		buf = append(buf, ':')
+		buf = append(buf, part...)
+	}
+	return hasher.Hash(buf)
+}
@@ -0,0 +1,67 @@
+package hashing
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestStringsAvoidsCollisions(test *testing.T) {
+	const n = 100000
+	seen := make(map[string]string, n)
+	for i := 0; i < n; i++ {
+		var message proto.Message = &wrappers.StringValue{Value: fmt.Sprintf("request-%d", i)}
+		if i%2 == 1 {
+			message = &wrappers.Int64Value{Value: int64(i)}
+		}
+		s := message.String()
+
+		key := Strings(nil, []string{"/test.Service/Method", s})
+		if other, found := seen[key]; found {
+			test.Fatalf("Wanted distinct keys, got %s for both %q and %q", key, other, s)
+		}
+		seen[key] = s
+	}
+}
+
+func TestStringsSeparatesParts(test *testing.T) {
+	if Strings(nil, []string{"ab", "c"}) == Strings(nil, []string{"a", "bc"}) {
+		test.Errorf("Wanted parts that only differ in where they split to hash differently")
+	}
+}
+
+func TestHashesAreStable(test *testing.T) {
+	// FNV-1a of the empty string is its offset basis, and must never change
+	// between runs, or shared caches would be invalidated.
+	if got := (FNV{}).Hash(nil); got != "14695981039346656037" {
+		test.Errorf("Wanted the FNV-1a offset basis, got %s", got)
+	}
+	if String("req") != String("req") || String("req") < 0 {
+		test.Errorf("Wanted a stable non-negative hash")
+	}
+}
+
+// constantHasher is a Hasher that hashes everything to the same value.
+type constantHasher struct{}
+
+func (constantHasher) Hash(data []byte) string {
+	return "42"
+}
+
+func TestStringsUsesGivenHasher(test *testing.T) {
+	if got := Strings(constantHasher{}, []string{"anything"}); got != "42" {
+		test.Errorf("Wanted the given Hasher used, got %s", got)
+	}
+}
+
+func TestSHA256Digests(test *testing.T) {
+	// SHA-256 of the empty string
+	if got := (SHA256{}).Hash(nil); got != "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855" {
+		test.Errorf("Wanted the SHA-256 of nothing, got %s", got)
+	}
+	if Strings(SHA256{}, []string{"ab", "c"}) == Strings(SHA256{}, []string{"a", "bc"}) {
+		test.Errorf("Wanted parts that only differ in where they split to hash differently")
+	}
+}
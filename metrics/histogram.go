@@ -0,0 +1,74 @@
+// Package metrics contains the metric types shared by the caching and
+// estimating interceptors.
+package metrics
+
+import (
+	"sort"
+	"sync"
+)
+
+// DefaultDurationBuckets are upper bounds, in seconds, suitable for
+// durations from milliseconds to tens of minutes.
+var DefaultDurationBuckets = []float64{0.01, 0.1, 0.5, 1, 5, 10, 30, 60, 300, 600, 1800}
+
+// A Histogram counts observations in buckets with fixed upper bounds. It is
+// safe for concurrent use.
+type Histogram struct {
+	bounds []float64
+	// one count per bound, and a last one for observations above all
+	// bounds
+	counts []uint64
+	count  uint64
+	sum    float64
+
+	mux sync.Mutex
+}
+
+// HistogramSnapshot is the state of a Histogram at some point in time.
+type HistogramSnapshot struct {
+	// Bounds are the inclusive upper bounds of the buckets.
+	Bounds []float64
+	// Counts holds the number of observations in each bucket, and has one
+	// more element than Bounds, for observations above the last bound.
+	Counts []uint64
+	Count  uint64
+	Sum    float64
+}
+
+// NewHistogram creates a Histogram with the given bucket upper bounds, or
+// DefaultDurationBuckets if none are given.
+func NewHistogram(bounds ...float64) *Histogram {
+	if len(bounds) == 0 {
+		bounds = DefaultDurationBuckets
+	}
+	sorted := append([]float64(nil), bounds...)
+	sort.Float64s(sorted)
+
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records a value.
+func (h *Histogram) Observe(value float64) {
+	bucket := sort.SearchFloat64s(h.bounds, value)
+
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	h.counts[bucket]++
+	h.count++
+	h.sum += value
+}
+
+// Snapshot returns the current state of the histogram.
+func (h *Histogram) Snapshot() HistogramSnapshot {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return HistogramSnapshot{
+		Bounds: append([]float64(nil), h.bounds...),
+		Counts: append([]uint64(nil), h.counts...),
+		Count:  h.count,
+		Sum:    h.sum,
+	}
+}
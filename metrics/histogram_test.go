@@ -0,0 +1,24 @@
+package metrics
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestHistogramBuckets(test *testing.T) {
+	h := NewHistogram(10, 1, 5)
+	for _, value := range []float64{0.5, 1, 3, 5, 7, 20} {
+		h.Observe(value)
+	}
+
+	snapshot := h.Snapshot()
+	if wanted := []float64{1, 5, 10}; !reflect.DeepEqual(snapshot.Bounds, wanted) {
+		test.Errorf("Wanted sorted bounds %v, got %v", wanted, snapshot.Bounds)
+	}
+	if wanted := []uint64{2, 2, 1, 1}; !reflect.DeepEqual(snapshot.Counts, wanted) {
+		test.Errorf("Wanted bucket counts %v, got %v", wanted, snapshot.Counts)
+	}
+	if snapshot.Count != 6 || snapshot.Sum != 36.5 {
+		test.Errorf("Wanted 6 observations summing to 36.5, got %d summing to %v", snapshot.Count, snapshot.Sum)
+	}
+}
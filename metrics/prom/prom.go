@@ -0,0 +1,91 @@
+// Package prom exports the metrics of the interceptors to Prometheus. It is
+// kept apart from the metrics package, so that only those who want
+// Prometheus depend on it.
+package prom
+
+import (
+	"time"
+
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Recorder is a metrics.Recorder that keeps Prometheus metrics, labelled
+// with the full gRPC method.
+type Recorder struct {
+	hits       *prometheus.CounterVec
+	misses     *prometheus.CounterVec
+	savedBytes *prometheus.CounterVec
+	savedTime  *prometheus.CounterVec
+	maxAges    *prometheus.HistogramVec
+}
+
+// compile-time check that we adhere to interface
+var _ metrics.Recorder = (*Recorder)(nil)
+
+// NewRecorder creates a Recorder whose metrics are in the given namespace,
+// e.g. "grpc_cache".
+func NewRecorder(namespace string) *Recorder {
+	return &Recorder{
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "hits_total",
+			Help:      "Calls served from cache.",
+		}, []string{"method"}),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "misses_total",
+			Help:      "Calls not found in cache.",
+		}, []string{"method"}),
+		savedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "saved_bytes_total",
+			Help:      "Size of the responses served from cache.",
+		}, []string{"method"}),
+		savedTime: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "saved_upstream_seconds_total",
+			Help:      "Estimated upstream time saved by serving from cache.",
+		}, []string{"method"}),
+		maxAges: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "estimated_max_age_seconds",
+			Help:      "Estimated max-age of responses.",
+			Buckets:   metrics.DefaultDurationBuckets,
+		}, []string{"method"}),
+	}
+}
+
+// Register creates a Recorder, and registers its metrics with the
+// registerer, e.g. prometheus.DefaultRegisterer.
+func Register(registerer prometheus.Registerer, namespace string) (*Recorder, error) {
+	r := NewRecorder(namespace)
+	for _, collector := range []prometheus.Collector{r.hits, r.misses, r.savedBytes, r.savedTime, r.maxAges} {
+		if err := registerer.Register(collector); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// CacheHit counts a call to the method served from cache.
+func (r *Recorder) CacheHit(method string) {
+	r.hits.WithLabelValues(method).Inc()
+}
+
+// CacheMiss counts a call to the method not found in cache.
+func (r *Recorder) CacheMiss(method string) {
+	r.misses.WithLabelValues(method).Inc()
+}
+
+// Saved counts the bytes and upstream time saved by serving a call to the
+// method from cache.
+func (r *Recorder) Saved(method string, bytes int, upstreamTime time.Duration) {
+	r.savedBytes.WithLabelValues(method).Add(float64(bytes))
+	r.savedTime.WithLabelValues(method).Add(upstreamTime.Seconds())
+}
+
+// EstimatedMaxAge observes a max-age estimated for a response of the method.
+func (r *Recorder) EstimatedMaxAge(method string, maxAge time.Duration) {
+	r.maxAges.WithLabelValues(method).Observe(maxAge.Seconds())
+}
@@ -0,0 +1,64 @@
+package prom
+
+import (
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const testMethod = "/test.Service/Method"
+
+func TestRecorderCountsPerMethod(test *testing.T) {
+	registry := prometheus.NewRegistry()
+	r, err := Register(registry, "grpc_cache")
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	r.CacheHit(testMethod)
+	r.CacheHit(testMethod)
+	r.CacheMiss(testMethod)
+	r.Saved(testMethod, 100, 20*time.Millisecond)
+	r.Saved(testMethod, 50, 0)
+	r.EstimatedMaxAge(testMethod, 30*time.Second)
+
+	if got := testutil.ToFloat64(r.hits.WithLabelValues(testMethod)); got != 2 {
+		test.Errorf("Wanted 2 hits, got %v", got)
+	}
+	if got := testutil.ToFloat64(r.misses.WithLabelValues(testMethod)); got != 1 {
+		test.Errorf("Wanted 1 miss, got %v", got)
+	}
+	if got := testutil.ToFloat64(r.savedBytes.WithLabelValues(testMethod)); got != 150 {
+		test.Errorf("Wanted 150 bytes saved, got %v", got)
+	}
+	if got := testutil.ToFloat64(r.savedTime.WithLabelValues(testMethod)); got != 0.02 {
+		test.Errorf("Wanted 0.02 seconds saved, got %v", got)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	for _, family := range families {
+		if family.GetName() == "grpc_cache_estimated_max_age_seconds" {
+			histogram := family.GetMetric()[0].GetHistogram()
+			if histogram.GetSampleCount() != 1 || histogram.GetSampleSum() != 30 {
+				test.Errorf("Wanted one max-age of 30 seconds, got %v", histogram)
+			}
+			return
+		}
+	}
+	test.Errorf("Wanted max-age histogram to be registered")
+}
+
+func TestRegisterTwiceFails(test *testing.T) {
+	registry := prometheus.NewRegistry()
+	if _, err := Register(registry, "grpc_cache"); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if _, err := Register(registry, "grpc_cache"); err == nil {
+		test.Errorf("Wanted duplicate registration to fail")
+	}
+}
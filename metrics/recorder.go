@@ -0,0 +1,21 @@
+package metrics
+
+import "time"
+
+// A Recorder receives the metrics of the interceptors as they happen, so
+// that they can be exported to a monitoring system. Implementations must be
+// safe for concurrent use.
+type Recorder interface {
+	// CacheHit is called when a call to the method is served from cache.
+	CacheHit(method string)
+	// CacheMiss is called when a call to the method is not found in cache.
+	CacheMiss(method string)
+	// Saved is called when a call to the method is served from cache, with
+	// the size in bytes of the response, and an estimate of the upstream
+	// time that was saved, which is zero until an upstream call has been
+	// timed.
+	Saved(method string, bytes int, upstreamTime time.Duration)
+	// EstimatedMaxAge is called with each max-age estimated for responses
+	// of the method.
+	EstimatedMaxAge(method string, maxAge time.Duration)
+}
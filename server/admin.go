@@ -0,0 +1,95 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/golang/protobuf/jsonpb"
+	"github.com/golang/protobuf/proto"
+)
+
+const adminExplainPath = "/estimator/explain"
+
+// adminExplanation is an Explanation as answered by the admin handler.
+type adminExplanation struct {
+	Method       string     `json:"method"`
+	Blacklisted  bool       `json:"blacklisted"`
+	Unlisted     bool       `json:"unlisted"`
+	Verified     bool       `json:"verified"`
+	Strategy     string     `json:"strategy,omitempty"`
+	Observations int        `json:"observations"`
+	LastChange   *time.Time `json:"last_change,omitempty"`
+	// RawEstimateSeconds and TTLSeconds are whole numbers of seconds.
+	RawEstimateSeconds int64  `json:"raw_estimate_seconds"`
+	Clamp              string `json:"clamp,omitempty"`
+	WarmingUp          bool   `json:"warming_up"`
+	TTLSeconds         int64  `json:"ttl_seconds"`
+}
+
+// AdminHandler returns an http.Handler for diagnosing the estimator. It is
+// not served anywhere unless mounted, e.g. on an internal port, and offers
+//
+//	POST /estimator/explain?method={method} explains the max-age of a request
+//
+// The request is sent in the body, in the JSON mapping of protocol buffers,
+// and decoded into the empty message that newRequest returns for the
+// method. Methods for which it returns nil are answered with 404 Not Found.
+func (e *ConfigurableValidityEstimator) AdminHandler(newRequest func(fullMethod string) proto.Message) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != adminExplainPath {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		e.explain(w, r, newRequest)
+	})
+}
+
+func (e *ConfigurableValidityEstimator) explain(w http.ResponseWriter, r *http.Request, newRequest func(fullMethod string) proto.Message) {
+	method := r.URL.Query().Get("method")
+	if method == "" {
+		http.Error(w, "missing method", http.StatusBadRequest)
+		return
+	}
+	req := newRequest(method)
+	if req == nil {
+		http.Error(w, "unknown method", http.StatusNotFound)
+		return
+	}
+	if err := jsonpb.Unmarshal(r.Body, req); err != nil {
+		http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	explanation, err := e.Explain(method, req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	answer := adminExplanation{
+		Method:             explanation.Method,
+		Blacklisted:        explanation.Blacklisted,
+		Unlisted:           explanation.Unlisted,
+		Verified:           explanation.Verified,
+		Strategy:           explanation.Strategy,
+		Observations:       explanation.Observations,
+		RawEstimateSeconds: int64(explanation.RawEstimate / time.Second),
+		Clamp:              explanation.Clamp,
+		WarmingUp:          explanation.WarmingUp,
+		TTLSeconds:         int64(explanation.TTL / time.Second),
+	}
+	if !explanation.LastChange.IsZero() {
+		answer.LastChange = &explanation.LastChange
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(answer); err != nil {
+		e.logger().Warn("Failed to write explanation", "error", err)
+	}
+}
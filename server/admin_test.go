@@ -0,0 +1,59 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+// explainRequest asks the admin handler of the estimator to explain the
+// request of the method, which takes StringValues.
+func explainRequest(e *ConfigurableValidityEstimator, method string, body string) *httptest.ResponseRecorder {
+	newRequest := func(fullMethod string) proto.Message {
+		if fullMethod != testMethod {
+			return nil
+		}
+		return &wrappers.StringValue{}
+	}
+	recorder := httptest.NewRecorder()
+	e.AdminHandler(newRequest).ServeHTTP(recorder, httptest.NewRequest(http.MethodPost, "/estimator/explain?method="+method, strings.NewReader(body)))
+	return recorder
+}
+
+func TestAdminExplainsRequest(test *testing.T) {
+	e := newTestEstimator()
+	e.MinTTL = 30 * time.Second
+	req := &wrappers.StringValue{Value: "req"}
+	v := addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+	v.update(&wrappers.StringValue{Value: "resp"}, clientSource)
+
+	resp := explainRequest(e, testMethod, `"req"`)
+	if resp.Code != http.StatusOK {
+		test.Fatalf("Wanted 200, got %d: %s", resp.Code, resp.Body.String())
+	}
+	var explanation adminExplanation
+	if err := json.Unmarshal(resp.Body.Bytes(), &explanation); err != nil {
+		test.Fatalf("Wanted a JSON explanation, got %q: %v", resp.Body.String(), err)
+	}
+	want := adminExplanation{Method: testMethod, Verified: true, Strategy: "static(ttl=10s)", Observations: 1, RawEstimateSeconds: 10, Clamp: "min", TTLSeconds: 30}
+	if explanation != want {
+		test.Errorf("Wanted %+v, got %+v", want, explanation)
+	}
+}
+
+func TestAdminRejectsUnknownMethod(test *testing.T) {
+	e := newTestEstimator()
+
+	if resp := explainRequest(e, "/test.Service/Unknown", `"req"`); resp.Code != http.StatusNotFound {
+		test.Errorf("Wanted 404 for an unknown method, got %d", resp.Code)
+	}
+	if resp := explainRequest(e, testMethod, `{`); resp.Code != http.StatusBadRequest {
+		test.Errorf("Wanted 400 for an invalid request, got %d", resp.Code)
+	}
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"regexp"
+	"testing"
+)
+
+const benchmarkBlacklist = "^/(admin|internal)\\.[A-Za-z]+/(Create|Update|Delete)[A-Za-z]*$"
+
+// BenchmarkBlacklistCompiledPerCall measures how blacklisting used to work,
+// compiling the pattern for every intercepted call.
+func BenchmarkBlacklistCompiledPerCall(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		regexp.Match(benchmarkBlacklist, []byte(testMethod))
+	}
+}
+
+// BenchmarkBlacklistCompiledOnce measures blacklisting with the pattern
+// compiled when the estimator is initialized.
+func BenchmarkBlacklistCompiledOnce(b *testing.B) {
+	e := &ConfigurableValidityEstimator{}
+	if err := e.InitializeWithConfig(Config{BlacklistPattern: benchmarkBlacklist}, log.New(ioutil.Discard, "", 0)); err != nil {
+		b.Fatalf("Unable to initialize estimator: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		e.blacklisted(testMethod)
+	}
+}
@@ -0,0 +1,313 @@
+package server
+
+import (
+	"fmt"
+	"time"
+)
+
+// A Strategy estimates for how long responses may be cached. Strategies are
+// assembled with the builders below, e.g.
+//
+//	strategy, err := server.Adaptive().WithAlpha(0.5).WithMinInterval(2 * time.Second).Build()
+//
+// and used by setting the Strategy of a ConfigurableValidityEstimator. Each
+// method gets its own instance, so one Strategy can serve all methods.
+type Strategy struct {
+	description string
+	create      func() estimationStrategy
+}
+
+// String describes the strategy and its parameters.
+func (s *Strategy) String() string {
+	return s.description
+}
+
+// newInstance creates and initializes a new instance of the strategy.
+func (s *Strategy) newInstance() estimationStrategy {
+	strategy := s.create()
+	strategy.initialize()
+	return strategy
+}
+
+// newBuiltStrategy wraps the constructor of an estimation strategy, named
+// by an instance of it.
+func newBuiltStrategy(create func() estimationStrategy) *Strategy {
+	return &Strategy{description: create().name(), create: create}
+}
+
+// AdaptiveBuilder assembles an Adaptive TTL strategy. Alpha is required.
+type AdaptiveBuilder struct {
+	alpha       float64
+	window      time.Duration
+	minInterval time.Duration
+}
+
+// Adaptive starts building an Adaptive TTL strategy.
+func Adaptive() *AdaptiveBuilder {
+	return &AdaptiveBuilder{}
+}
+
+// WithAlpha sets the fraction of the time since the last change that
+// responses may be cached, in (0, 1].
+func (b *AdaptiveBuilder) WithAlpha(alpha float64) *AdaptiveBuilder {
+	b.alpha = alpha
+	return b
+}
+
+// WithWindow sets how long a changed response must persist before it is
+// accepted as a modification.
+func (b *AdaptiveBuilder) WithWindow(window time.Duration) *AdaptiveBuilder {
+	b.window = window
+	return b
+}
+
+// WithMinInterval sets the shortest time between verifications.
+func (b *AdaptiveBuilder) WithMinInterval(interval time.Duration) *AdaptiveBuilder {
+	b.minInterval = interval
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *AdaptiveBuilder) Build() (*Strategy, error) {
+	if err := validateParam("alpha", b.alpha); err != nil {
+		return nil, fmt.Errorf("adaptive strategy: %v", err)
+	}
+	if b.window < 0 {
+		return nil, fmt.Errorf("adaptive strategy: negative window %s", b.window)
+	}
+	if b.minInterval < 0 {
+		return nil, fmt.Errorf("adaptive strategy: negative minimum interval %s", b.minInterval)
+	}
+
+	params := *b
+	return newBuiltStrategy(func() estimationStrategy {
+		return &adaptiveStrategy{alpha: params.alpha, window: params.window, minInterval: params.minInterval}
+	}), nil
+}
+
+// InterArrivalBuilder assembles an Inter-arrival strategy. Alpha is
+// required.
+type InterArrivalBuilder struct {
+	alpha       float64
+	minInterval time.Duration
+}
+
+// InterArrival starts building an Inter-arrival strategy.
+func InterArrival() *InterArrivalBuilder {
+	return &InterArrivalBuilder{}
+}
+
+// WithAlpha sets the fraction of the time since the last change that
+// responses may be cached, in (0, 1].
+func (b *InterArrivalBuilder) WithAlpha(alpha float64) *InterArrivalBuilder {
+	b.alpha = alpha
+	return b
+}
+
+// WithMinInterval sets the shortest time between verifications.
+func (b *InterArrivalBuilder) WithMinInterval(interval time.Duration) *InterArrivalBuilder {
+	b.minInterval = interval
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *InterArrivalBuilder) Build() (*Strategy, error) {
+	if err := validateParam("alpha", b.alpha); err != nil {
+		return nil, fmt.Errorf("inter-arrival strategy: %v", err)
+	}
+	if b.minInterval < 0 {
+		return nil, fmt.Errorf("inter-arrival strategy: negative minimum interval %s", b.minInterval)
+	}
+
+	params := *b
+	return newBuiltStrategy(func() estimationStrategy {
+		return &interArrivalStrategy{alpha: params.alpha, minInterval: params.minInterval}
+	}), nil
+}
+
+// HeaderBuilder assembles a strategy that prefers the freshness given by
+// the headers of upstream responses. Alpha is required.
+type HeaderBuilder struct {
+	alpha float64
+}
+
+// Header starts building a strategy that uses upstream headers.
+func Header() *HeaderBuilder {
+	return &HeaderBuilder{}
+}
+
+// WithAlpha sets the fraction of the time since the last modification that
+// responses may be cached, in (0, 1].
+func (b *HeaderBuilder) WithAlpha(alpha float64) *HeaderBuilder {
+	b.alpha = alpha
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *HeaderBuilder) Build() (*Strategy, error) {
+	if err := validateParam("alpha", b.alpha); err != nil {
+		return nil, fmt.Errorf("header strategy: %v", err)
+	}
+
+	alpha := b.alpha
+	return newBuiltStrategy(func() estimationStrategy {
+		return &headerStrategy{alpha: alpha}
+	}), nil
+}
+
+// ETagBuilder assembles a strategy that detects changes by the ETags of
+// upstream responses. Alpha is required.
+type ETagBuilder struct {
+	alpha float64
+}
+
+// ETag starts building a strategy that uses upstream ETags.
+func ETag() *ETagBuilder {
+	return &ETagBuilder{}
+}
+
+// WithAlpha sets the fraction of the time since the last change that
+// responses may be cached, in (0, 1].
+func (b *ETagBuilder) WithAlpha(alpha float64) *ETagBuilder {
+	b.alpha = alpha
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *ETagBuilder) Build() (*Strategy, error) {
+	if err := validateParam("alpha", b.alpha); err != nil {
+		return nil, fmt.Errorf("etag strategy: %v", err)
+	}
+
+	alpha := b.alpha
+	return newBuiltStrategy(func() estimationStrategy {
+		return &etagStrategy{alpha: alpha}
+	}), nil
+}
+
+// LastModifiedBuilder assembles a strategy that anchors the last change of
+// responses at their last-modified headers. Alpha is required.
+type LastModifiedBuilder struct {
+	alpha float64
+}
+
+// LastModified starts building a strategy that uses upstream last-modified
+// headers.
+func LastModified() *LastModifiedBuilder {
+	return &LastModifiedBuilder{}
+}
+
+// WithAlpha sets the fraction of the time since the last modification that
+// responses may be cached, in (0, 1].
+func (b *LastModifiedBuilder) WithAlpha(alpha float64) *LastModifiedBuilder {
+	b.alpha = alpha
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *LastModifiedBuilder) Build() (*Strategy, error) {
+	if err := validateParam("alpha", b.alpha); err != nil {
+		return nil, fmt.Errorf("last-modified strategy: %v", err)
+	}
+
+	alpha := b.alpha
+	return newBuiltStrategy(func() estimationStrategy {
+		return &lastModifiedStrategy{alpha: alpha}
+	}), nil
+}
+
+// UpdateRiskBuilder assembles an Update-risk Based strategy. Rho is
+// required.
+type UpdateRiskBuilder struct {
+	rho         float64
+	minInterval time.Duration
+}
+
+// UpdateRisk starts building an Update-risk Based strategy.
+func UpdateRisk() *UpdateRiskBuilder {
+	return &UpdateRiskBuilder{}
+}
+
+// WithRho sets the accepted risk of serving a stale response, in (0, 1).
+func (b *UpdateRiskBuilder) WithRho(rho float64) *UpdateRiskBuilder {
+	b.rho = rho
+	return b
+}
+
+// WithMinInterval sets the shortest time between verifications.
+func (b *UpdateRiskBuilder) WithMinInterval(interval time.Duration) *UpdateRiskBuilder {
+	b.minInterval = interval
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *UpdateRiskBuilder) Build() (*Strategy, error) {
+	if err := validateParam("rho", b.rho); err != nil {
+		return nil, fmt.Errorf("update-risk strategy: %v", err)
+	}
+	if b.minInterval < 0 {
+		return nil, fmt.Errorf("update-risk strategy: negative minimum interval %s", b.minInterval)
+	}
+
+	params := *b
+	return newBuiltStrategy(func() estimationStrategy {
+		return &updateRiskBasedStrategy{rho: params.rho, minInterval: params.minInterval}
+	}), nil
+}
+
+// StaticBuilder assembles a strategy that gives all responses the same TTL.
+type StaticBuilder struct {
+	ttl time.Duration
+}
+
+// Static starts building a static strategy.
+func Static() *StaticBuilder {
+	return &StaticBuilder{}
+}
+
+// WithTTL sets the TTL given to all responses.
+func (b *StaticBuilder) WithTTL(ttl time.Duration) *StaticBuilder {
+	b.ttl = ttl
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *StaticBuilder) Build() (*Strategy, error) {
+	if b.ttl < 0 {
+		return nil, fmt.Errorf("static strategy: negative TTL %s", b.ttl)
+	}
+
+	ttl := b.ttl
+	return newBuiltStrategy(func() estimationStrategy {
+		return &staticStrategy{ttl: ttl}
+	}), nil
+}
+
+// BoundaryBuilder assembles a strategy that lets responses be cached until
+// the next wall-clock boundary. The period is required.
+type BoundaryBuilder struct {
+	period time.Duration
+}
+
+// Boundary starts building a boundary strategy.
+func Boundary() *BoundaryBuilder {
+	return &BoundaryBuilder{}
+}
+
+// WithPeriod sets the time between boundaries, e.g. time.Hour.
+func (b *BoundaryBuilder) WithPeriod(period time.Duration) *BoundaryBuilder {
+	b.period = period
+	return b
+}
+
+// Build validates the parameters and creates the strategy.
+func (b *BoundaryBuilder) Build() (*Strategy, error) {
+	if b.period <= 0 {
+		return nil, fmt.Errorf("boundary strategy: period must be positive, got %s", b.period)
+	}
+
+	period := b.period
+	return newBuiltStrategy(func() estimationStrategy {
+		return &boundaryStrategy{period: period}
+	}), nil
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+)
+
+func TestBuildersRejectInvalidParameters(test *testing.T) {
+	builders := map[string]func() (*Strategy, error){
+		"adaptive without alpha":      Adaptive().Build,
+		"adaptive with alpha 1.5":     Adaptive().WithAlpha(1.5).Build,
+		"adaptive with negative wait": Adaptive().WithAlpha(0.5).WithMinInterval(-time.Second).Build,
+		"interarrival without alpha":  InterArrival().Build,
+		"updaterisk with rho 1":       UpdateRisk().WithRho(1).Build,
+		"static with negative ttl":    Static().WithTTL(-time.Second).Build,
+		"boundary without period":     Boundary().Build,
+	}
+
+	for name, build := range builders {
+		if strategy, err := build(); err == nil {
+			test.Errorf("Wanted %s to be rejected, got %v", name, strategy)
+		}
+	}
+}
+
+func TestBuiltStrategiesMatchParsedOnes(test *testing.T) {
+	cases := []struct {
+		builder func() (*Strategy, error)
+		spec    string
+	}{
+		{Adaptive().WithAlpha(0.5).WithWindow(3 * time.Second).Build, "dynamic-adaptive-0.5-3"},
+		{InterArrival().WithAlpha(0.2).Build, "dynamic-interarrival-0.2"},
+		{UpdateRisk().WithRho(0.1).Build, "dynamic-updaterisk-0.1"},
+		{Header().WithAlpha(0.5).Build, "dynamic-header-0.5"},
+		{ETag().WithAlpha(0.5).Build, "dynamic-etag-0.5"},
+		{LastModified().WithAlpha(0.5).Build, "dynamic-lastmodified-0.5"},
+		{Static().WithTTL(10 * time.Second).Build, "static-10"},
+		{Boundary().WithPeriod(time.Hour).Build, "boundary-3600"},
+	}
+
+	for _, c := range cases {
+		strategy, err := c.builder()
+		if err != nil {
+			test.Errorf("Wanted %s to build, got %v", c.spec, err)
+			continue
+		}
+		parsed, err := parseStrategy(c.spec)
+		if err != nil {
+			test.Fatalf("Wanted %s to parse, got %v", c.spec, err)
+		}
+		if got, wanted := strategy.String(), parsed.name(); got != wanted {
+			test.Errorf("Wanted %s, got %s", wanted, got)
+		}
+	}
+}
+
+func TestBuiltStrategyEstimates(test *testing.T) {
+	strategy, err := Adaptive().WithAlpha(0.5).Build()
+	if err != nil {
+		test.Fatalf("Wanted strategy, got %v", err)
+	}
+
+	first := strategy.newInstance()
+	second := strategy.newInstance()
+	if first == second {
+		test.Errorf("Wanted a new instance per call, got the same")
+	}
+
+	t := time.Now().Add(-10 * time.Second)
+	first.update(t, sample{value: "0"})
+	for i := 0; i < 10; i++ {
+		first.update(t, sample{value: "1"})
+		t = t.Add(time.Second)
+	}
+
+	if got := first.determineEstimation(); int(got.Seconds()) != 5 {
+		test.Errorf("Wanted 5 second TTL, got %v", got)
+	}
+}
+
+func TestBuiltStrategyMinInterval(test *testing.T) {
+	strategy, err := UpdateRisk().WithRho(0.1).WithMinInterval(2 * time.Second).Build()
+	if err != nil {
+		test.Fatalf("Wanted strategy, got %v", err)
+	}
+
+	if got := strategy.newInstance().determineInterval(); got != 2*time.Second {
+		test.Errorf("Wanted 2s interval, got %v", got)
+	}
+
+	strategy, _ = UpdateRisk().WithRho(0.1).Build()
+	if got := strategy.newInstance().determineInterval(); got != defaultInterval {
+		test.Errorf("Wanted default interval, got %v", got)
+	}
+}
+
+func TestEstimatorUsesBuiltStrategy(test *testing.T) {
+	strategy, err := Static().WithTTL(42 * time.Second).Build()
+	if err != nil {
+		test.Fatalf("Wanted strategy, got %v", err)
+	}
+
+	e := &ConfigurableValidityEstimator{Strategy: strategy}
+	e.InitializeWithConfig(Config{MaxAgeStrategy: "static-10"}, log.New(ioutil.Discard, "", 0))
+
+	created := e.newStrategy(testMethod)
+	if created == nil || created.determineEstimation() != 42*time.Second {
+		test.Errorf("Wanted the built strategy, got %v", created)
+	}
+}
@@ -0,0 +1,105 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+)
+
+// Config determines which responses an estimator estimates the max-age of,
+// and how. Unlike the fields of ConfigurableValidityEstimator, it is read
+// once, when the estimator is initialized.
+type Config struct {
+	// MaxAgeStrategy is the strategy used for all methods, unless they are
+	// configured by a StrategyConfig, e.g. "dynamic-adaptive-0.5". Empty
+	// means passthrough mode. The syntax is the same as for the
+	// PROXY_MAX_AGE environment variable.
+	MaxAgeStrategy string
+	// BlacklistPattern is a regular expression matching the methods that
+	// must never be cached. Empty means that no method is blacklisted.
+	BlacklistPattern string
+	// WhitelistPattern is a regular expression matching the only methods
+	// that may be cached. Empty means that all methods may be. Methods
+	// that are also blacklisted are never cached.
+	WhitelistPattern string
+	// StrategyParams overrides parameters of the strategies, by name, such
+	// as "alpha" or "rho".
+	StrategyParams map[string]float64
+	// LogFormat is the format in which estimates are written to the log
+	// given to the estimator, CSVLogFormat or JSONLinesLogFormat. Empty
+	// means CSV.
+	LogFormat string
+}
+
+// ConfigFromEnv creates a Config from the PROXY_MAX_AGE,
+// PROXY_CACHE_BLACKLIST, PROXY_CACHE_WHITELIST and PROXY_LOG_FORMAT
+// environment variables.
+func ConfigFromEnv() Config {
+	return Config{
+		MaxAgeStrategy:   os.Getenv("PROXY_MAX_AGE"),
+		BlacklistPattern: os.Getenv("PROXY_CACHE_BLACKLIST"),
+		WhitelistPattern: os.Getenv("PROXY_CACHE_WHITELIST"),
+		LogFormat:        os.Getenv("PROXY_LOG_FORMAT"),
+	}
+}
+
+// compilePattern compiles a method pattern of the configuration. A nil
+// expression means that the pattern is not set.
+func compilePattern(kind string, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	expression, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s pattern: %v", kind, err)
+	}
+	return expression, nil
+}
+
+// validate checks that the configuration can be used as given.
+func (c Config) validate() error {
+	if _, err := compilePattern("blacklist", c.BlacklistPattern); err != nil {
+		return err
+	}
+	if _, err := compilePattern("whitelist", c.WhitelistPattern); err != nil {
+		return err
+	}
+	if c.MaxAgeStrategy != "" {
+		if _, err := parseStrategy(c.MaxAgeStrategy); err != nil {
+			return fmt.Errorf("invalid max-age strategy: %v", err)
+		}
+	}
+	for name, value := range c.StrategyParams {
+		if err := validateParam(name, value); err != nil {
+			return err
+		}
+	}
+	if _, err := newRecordEncoder(c.LogFormat, nil, nil); err != nil {
+		return err
+	}
+	return nil
+}
+
+// apply the configuration to the estimator. Invalid parts are left out, as
+// if they had not been set.
+func (e *ConfigurableValidityEstimator) applyConfig(config Config) {
+	e.config = config
+
+	blacklist, err := compilePattern("blacklist", config.BlacklistPattern)
+	if err != nil {
+		e.logger().Warn("Not blacklisting any methods", "error", err)
+	}
+	e.blacklist = blacklist
+
+	whitelist, err := compilePattern("whitelist", config.WhitelistPattern)
+	if err != nil {
+		e.logger().Warn("Not whitelisting any methods", "error", err)
+	}
+	e.whitelist = whitelist
+
+	for name, value := range config.StrategyParams {
+		if err := e.SetStrategyParam(name, value); err != nil {
+			e.logger().Warn("Ignoring strategy parameter", "error", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestInitializeWithConfig(test *testing.T) {
+	e := &ConfigurableValidityEstimator{}
+	config := Config{
+		MaxAgeStrategy:   "dynamic-updaterisk-0.1",
+		BlacklistPattern: "Blacklisted$",
+		StrategyParams:   map[string]float64{"rho": 0.3},
+	}
+	if err := e.InitializeWithConfig(config, log.New(ioutil.Discard, "", 0)); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	if !e.blacklisted("/test.Service/Blacklisted") {
+		test.Errorf("Wanted method to be blacklisted")
+	}
+	if e.blacklisted(testMethod) {
+		test.Errorf("Wanted %s not to be blacklisted", testMethod)
+	}
+	if strategy, ok := e.newStrategy(testMethod).(*updateRiskBasedStrategy); !ok || strategy.rho != 0.3 {
+		test.Errorf("Wanted update-risk strategy with rho 0.3, got %v", e.newStrategy(testMethod))
+	}
+}
+
+func TestEstimatorsConfiguredIndependently(test *testing.T) {
+	static := &ConfigurableValidityEstimator{}
+	static.InitializeWithConfig(Config{MaxAgeStrategy: "static-10"}, log.New(ioutil.Discard, "", 0))
+	passthrough := &ConfigurableValidityEstimator{}
+	passthrough.InitializeWithConfig(Config{BlacklistPattern: "."}, log.New(ioutil.Discard, "", 0))
+
+	if _, ok := static.newStrategy(testMethod).(*staticStrategy); !ok || static.blacklisted(testMethod) {
+		test.Errorf("Wanted static strategy for %s", testMethod)
+	}
+	if strategy := passthrough.newStrategy(testMethod); strategy != nil || !passthrough.blacklisted(testMethod) {
+		test.Errorf("Wanted %s to be blacklisted in passthrough mode, got %v", testMethod, strategy)
+	}
+}
+
+func TestInitializeWithInvalidConfig(test *testing.T) {
+	tests := []Config{
+		{BlacklistPattern: "("},
+		{MaxAgeStrategy: "dynamic-bogus-1"},
+		{MaxAgeStrategy: "dynamic-etag-x"},
+		{MaxAgeStrategy: "dynamic-header-2"},
+		{StrategyParams: map[string]float64{"rho": 2}},
+	}
+	for _, config := range tests {
+		e := &ConfigurableValidityEstimator{}
+		if err := e.InitializeWithConfig(config, log.New(ioutil.Discard, "", 0)); err == nil {
+			test.Errorf("Wanted %+v to be rejected", config)
+		}
+	}
+}
+
+func TestConfigFromEnv(test *testing.T) {
+	os.Setenv("PROXY_MAX_AGE", "static-5")
+	defer os.Unsetenv("PROXY_MAX_AGE")
+	os.Setenv("PROXY_CACHE_BLACKLIST", "Blacklisted")
+	defer os.Unsetenv("PROXY_CACHE_BLACKLIST")
+
+	config := ConfigFromEnv()
+	if config.MaxAgeStrategy != "static-5" || config.BlacklistPattern != "Blacklisted" {
+		test.Errorf("Wanted configuration from environment, got %+v", config)
+	}
+}
+
+func TestWhitelistAndBlacklist(test *testing.T) {
+	const (
+		readMethod  = "/test.Service/GetValue"
+		writeMethod = "/test.Service/SetValue"
+		debugMethod = "/test.Service/GetDebug"
+	)
+
+	tests := []struct {
+		name      string
+		config    Config
+		cacheable map[string]bool
+	}{
+		{
+			name:      "whitelist only",
+			config:    Config{MaxAgeStrategy: "static-10", WhitelistPattern: "/Get"},
+			cacheable: map[string]bool{readMethod: true, writeMethod: false, debugMethod: true},
+		},
+		{
+			name:      "blacklist only",
+			config:    Config{MaxAgeStrategy: "static-10", BlacklistPattern: "Debug$"},
+			cacheable: map[string]bool{readMethod: true, writeMethod: true, debugMethod: false},
+		},
+		{
+			name:      "both",
+			config:    Config{MaxAgeStrategy: "static-10", WhitelistPattern: "/Get", BlacklistPattern: "Debug$"},
+			cacheable: map[string]bool{readMethod: true, writeMethod: false, debugMethod: false},
+		},
+	}
+
+	for _, tt := range tests {
+		e := &ConfigurableValidityEstimator{}
+		if err := e.InitializeWithConfig(tt.config, log.New(ioutil.Discard, "", 0)); err != nil {
+			test.Fatalf("%s: wanted no error, got %v", tt.name, err)
+		}
+
+		for method, cacheable := range tt.cacheable {
+			req := sample{value: method}
+			if needed, _ := e.verificationNeeded(method, nil, req); needed != cacheable {
+				test.Errorf("%s: wanted verification needed for %s to be %v, got %v", tt.name, method, cacheable, needed)
+			}
+
+			addVerifier(e, method, req, time.Now().Add(time.Minute))
+			value, _, err := e.cacheControl(context.Background(), method, req, sample{value: "resp"}, false)
+			if err != nil {
+				test.Errorf("%s: wanted no error for %s, got %v", tt.name, method, err)
+			}
+			if (value != "") != cacheable {
+				test.Errorf("%s: wanted %s to be cacheable: %v, got cache-control %q", tt.name, method, cacheable, value)
+			}
+		}
+	}
+}
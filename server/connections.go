@@ -0,0 +1,89 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errConnectionBudgetExhausted is returned when a verifier would need a
+// connection to the upstream service, but MaxVerifierConnections are
+// already open. The request is verified once a later call finds a free
+// connection.
+var errConnectionBudgetExhausted = status.Errorf(codes.ResourceExhausted, "Verifier connection budget exhausted")
+
+// acquireConnection reserves a connection for a verifier, unless
+// MaxVerifierConnections are already reserved.
+func (e *ConfigurableValidityEstimator) acquireConnection() bool {
+	for {
+		current := atomic.LoadUint64(&e.verifierConnections)
+		if e.MaxVerifierConnections > 0 && current >= uint64(e.MaxVerifierConnections) {
+			return false
+		}
+		if atomic.CompareAndSwapUint64(&e.verifierConnections, current, current+1) {
+			return true
+		}
+	}
+}
+
+// releaseConnection returns a connection reserved by acquireConnection.
+func (e *ConfigurableValidityEstimator) releaseConnection() {
+	atomic.AddUint64(&e.verifierConnections, ^uint64(0))
+}
+
+// pooledConn is a connection to an upstream target, shared by all verifiers
+// of that target.
+type pooledConn struct {
+	cc   *grpc.ClientConn
+	refs int
+}
+
+// connect returns a connection to the target for a verifier, dialing one
+// unless another verifier already holds one. The returned function must be
+// called once the verifier is done with the connection, which is closed
+// when the last verifier using it is.
+func (e *ConfigurableValidityEstimator) connect(target string) (*grpc.ClientConn, func(), error) {
+	e.connsMux.Lock()
+	defer e.connsMux.Unlock()
+
+	conn, found := e.conns[target]
+	if !found {
+		if !e.acquireConnection() {
+			return nil, nil, errConnectionBudgetExhausted
+		}
+		cc, err := grpc.Dial(target, e.dialOptions()...)
+		if err != nil {
+			e.releaseConnection()
+			return nil, nil, err
+		}
+		if e.conns == nil {
+			e.conns = make(map[string]*pooledConn)
+		}
+		conn = &pooledConn{cc: cc}
+		e.conns[target] = conn
+	}
+	conn.refs++
+
+	return conn.cc, func() { e.disconnect(target, conn) }, nil
+}
+
+// disconnect gives up a reference to the pooled connection, closing it if
+// it was the last one.
+func (e *ConfigurableValidityEstimator) disconnect(target string, conn *pooledConn) {
+	e.connsMux.Lock()
+	defer e.connsMux.Unlock()
+
+	conn.refs--
+	if conn.refs > 0 {
+		return
+	}
+	if e.conns[target] == conn {
+		delete(e.conns, target)
+	}
+	if err := conn.cc.Close(); err != nil {
+		e.logger().Warn("Failed to close connection", "target", target, "error", err)
+	}
+	e.releaseConnection()
+}
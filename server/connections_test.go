@@ -0,0 +1,132 @@
+package server
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc/connectivity"
+)
+
+func TestVerifierConnectionsWithinBudget(test *testing.T) {
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	e.MaxVerifierConnections = 2
+
+	var targets []string
+	for i := 0; i < 3; i++ {
+		target, stop := startUpstream(test, "resp")
+		defer stop()
+		targets = append(targets, target)
+	}
+
+	reqs := make([]*wrappers.StringValue, len(targets))
+	for i, target := range targets {
+		reqs[i] = &wrappers.StringValue{Value: fmt.Sprintf("req-%d", i)}
+		e.startVerification(target, testMethod, nil, reqs[i], &wrappers.StringValue{Value: "resp"}, nil)
+	}
+
+	if got := e.Stats().VerifierConnections; got != 2 {
+		test.Errorf("Wanted 2 verifier connections, got %d", got)
+	}
+	if got := e.verifiers.ItemCount(); got != 2 {
+		test.Errorf("Wanted 2 verifiers, got %d", got)
+	}
+	if got := e.Stats().VerifierFailures; got != 0 {
+		test.Errorf("Wanted deferred verification not to count as a failure, got %d", got)
+	}
+
+	value, found := e.verifiers.Get(hash(testMethod, reqs[0]))
+	if !found {
+		test.Fatalf("Wanted a verifier for the first request")
+	}
+	e.verifiers.Delete(hash(testMethod, reqs[0]))
+	value.(*verifier).stop()
+
+	if got := e.Stats().VerifierConnections; got != 1 {
+		test.Errorf("Wanted 1 verifier connection after stopping one, got %d", got)
+	}
+
+	e.startVerification(targets[2], testMethod, nil, reqs[2], &wrappers.StringValue{Value: "resp"}, nil)
+	if _, found := e.verifiers.Get(hash(testMethod, reqs[2])); !found {
+		test.Errorf("Wanted deferred request to be verified once a connection was free")
+	}
+	if got := e.Stats().VerifierConnections; got != 2 {
+		test.Errorf("Wanted 2 verifier connections, got %d", got)
+	}
+
+	for _, item := range e.verifiers.Items() {
+		item.Object.(*verifier).stop()
+	}
+}
+
+func TestVerifierCountWithinCap(test *testing.T) {
+	e := newTestEstimator()
+	e.MaxVerifiers = 2
+
+	first := addVerifier(e, testMethod, sample{value: "req-0"}, time.Now().Add(time.Minute))
+	addVerifier(e, testMethod, sample{value: "req-1"}, time.Now().Add(time.Minute))
+
+	if needed, _ := e.verificationNeeded(testMethod, nil, sample{value: "req-2"}); needed {
+		test.Errorf("Wanted no verification beyond the cap")
+	}
+	if got := e.Stats().Verifiers; got != 2 {
+		test.Errorf("Wanted 2 verifiers, got %d", got)
+	}
+
+	// Once a verifier has expired and finished, there is room for
+	// another.
+	first.expiration = time.Now().Add(-time.Second)
+	if !first.finished() {
+		test.Fatalf("Wanted expired verifier to be finished")
+	}
+	e.done <- first.key
+	for deadline := time.Now().Add(time.Second); e.Stats().Verifiers != 1 && time.Now().Before(deadline); {
+		time.Sleep(time.Millisecond)
+	}
+	if needed, _ := e.verificationNeeded(testMethod, nil, sample{value: "req-2"}); !needed {
+		test.Errorf("Wanted verification once a verifier had finished")
+	}
+}
+
+func TestVerifiersShareConnection(test *testing.T) {
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+
+	target, stop := startUpstream(test, "resp")
+	defer stop()
+
+	var verifiers []*verifier
+	for i := 0; i < 2; i++ {
+		req := &wrappers.StringValue{Value: fmt.Sprintf("req-%d", i)}
+		e.startVerification(target, testMethod, nil, req, &wrappers.StringValue{Value: "resp"}, nil)
+		value, found := e.verifiers.Get(hash(testMethod, req))
+		if !found {
+			test.Fatalf("Wanted a verifier for %s", req.Value)
+		}
+		verifiers = append(verifiers, value.(*verifier))
+	}
+
+	if verifiers[0].cc != verifiers[1].cc {
+		test.Errorf("Wanted verifiers of the same target to share a connection")
+	}
+	if got := e.Stats().VerifierConnections; got != 1 {
+		test.Errorf("Wanted 1 verifier connection, got %d", got)
+	}
+
+	verifiers[0].stop()
+	if state := verifiers[1].cc.GetState(); state == connectivity.Shutdown {
+		test.Errorf("Wanted connection to stay open while still in use")
+	}
+
+	verifiers[1].stop()
+	if state := verifiers[1].cc.GetState(); state != connectivity.Shutdown {
+		test.Errorf("Wanted connection closed with its last verifier, got %v", state)
+	}
+	if got := e.Stats().VerifierConnections; got != 0 {
+		test.Errorf("Wanted no verifier connections, got %d", got)
+	}
+}
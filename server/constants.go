@@ -5,4 +5,23 @@ import "time"
 const (
 	defaultInterval     = time.Duration(5 * time.Second)
 	maxVerifierLifetime = time.Duration(1800 * time.Second)
+
+	defaultCompactionInterval = time.Duration(60 * time.Second)
+
+	defaultFlagPollInterval = time.Duration(30 * time.Second)
+
+	defaultVerifierRetryBackoff = time.Duration(100 * time.Millisecond)
+	// how long a verifier first waits for a strategy that is not ready to
+	// give an interval, doubling up to the longest wait
+	notReadyBackoff    = time.Duration(500 * time.Millisecond)
+	maxNotReadyBackoff = time.Duration(30 * time.Second)
+	// how much, and up to how long, verifiers of unchanged responses back
+	// off by default
+	defaultBackoffFactor      = 2.0
+	defaultMaxBackoffInterval = time.Duration(10 * time.Minute)
+	// how long a verifier waits for the upstream when polling it
+	defaultVerifierFetchTimeout = time.Duration(5 * time.Second)
+	// number of consecutive compaction passes an upstream must be
+	// unreachable before its verifiers are removed
+	unreachableCompactionPasses = 2
 )
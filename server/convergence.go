@@ -0,0 +1,38 @@
+package server
+
+import (
+	"time"
+
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
+)
+
+// convergenceObserver returns a function that records, for the method, how
+// long it took a verifier to produce its first cacheable estimate.
+func (e *ConfigurableValidityEstimator) convergenceObserver(method string) func(time.Duration) {
+	return func(d time.Duration) {
+		e.convergenceMux.Lock()
+		if e.convergence == nil {
+			e.convergence = make(map[string]*metrics.Histogram)
+		}
+		histogram, found := e.convergence[method]
+		if !found {
+			histogram = metrics.NewHistogram()
+			e.convergence[method] = histogram
+		}
+		e.convergenceMux.Unlock()
+
+		histogram.Observe(d.Seconds())
+	}
+}
+
+// convergenceSnapshots returns the convergence time histograms per method.
+func (e *ConfigurableValidityEstimator) convergenceSnapshots() map[string]metrics.HistogramSnapshot {
+	e.convergenceMux.Lock()
+	defer e.convergenceMux.Unlock()
+
+	snapshots := make(map[string]metrics.HistogramSnapshot, len(e.convergence))
+	for method, histogram := range e.convergence {
+		snapshots[method] = histogram.Snapshot()
+	}
+	return snapshots
+}
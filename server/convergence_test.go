@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestConvergenceTimeRecordedOnceStable(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	strategy := &confirmationStrategy{strategyWrapper: strategyWrapper{&staticStrategy{ttl: 10 * time.Second}}, required: 3}
+	strategy.initialize()
+
+	resp := &wrappers.StringValue{Value: "resp"}
+	v, err := e.newVerifier("", testMethod, &wrappers.StringValue{Value: "req"}, resp, time.Now().Add(1*time.Hour), strategy)
+	if err != nil {
+		test.Fatalf("Unable to create verifier: %v", err)
+	}
+	defer v.stop()
+
+	if got := e.Stats().Convergence[testMethod].Count; got != 0 {
+		test.Errorf("Wanted no convergence before the estimate is stable, got %d", got)
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 4; i++ {
+		if err := v.update(resp, clientSource); err != nil {
+			test.Fatalf("Wanted update to succeed, got %v", err)
+		}
+	}
+
+	snapshot := e.Stats().Convergence[testMethod]
+	if snapshot.Count != 1 {
+		test.Errorf("Wanted convergence to be recorded once, got %d", snapshot.Count)
+	}
+	if snapshot.Sum < 0.01 {
+		test.Errorf("Wanted convergence time of at least 10ms, got %vs", snapshot.Sum)
+	}
+}
@@ -0,0 +1,122 @@
+package server
+
+import (
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// An Explanation describes how the estimator currently arrives at the
+// max-age for a particular request.
+type Explanation struct {
+	// Method is the full method that was explained.
+	Method string
+	// Blacklisted is true if the method is blacklisted from caching.
+	Blacklisted bool
+	// Unlisted is true if there is a whitelist, and the method is not on
+	// it, so it is not cached either.
+	Unlisted bool
+	// Verified is true if a verifier exists for the request. Without one,
+	// no max-age is estimated, unless it is overridden or a fallback.
+	Verified bool
+	// Strategy describes the estimation strategy and its parameters, or is
+	// "override" or "fallback" if the max-age comes from MaxAgeOverrides or
+	// VerifierFailureMaxAge.
+	Strategy string
+	// Observations is the number of responses the verifier has observed.
+	Observations int
+	// LastChange is when the response was last seen changing, if the
+	// strategy keeps track of that.
+	LastChange time.Time
+	// RawEstimate is the estimate produced by the strategy.
+	RawEstimate time.Duration
+	// Clamp is "min" or "max" if the MinTTL or MaxTTL bound was applied,
+	// and empty otherwise.
+	Clamp string
+	// WarmingUp is true while the verifier has observed fewer than
+	// MinSamples responses, in which case no max-age is emitted at all.
+	WarmingUp bool
+	// TTL is the max-age that would be emitted, after any
+	// SizeBasedTTLModifier and RateAwareTTLModifier, but before any
+	// TTLJitter.
+	TTL time.Duration
+}
+
+// An EstimationResult describes how the estimator arrived at the max-age
+// for a particular response.
+type EstimationResult struct {
+	// StrategyName describes the estimation strategy and its parameters,
+	// or is "override" or "fallback" if the max-age came from
+	// MaxAgeOverrides or VerifierFailureMaxAge. It is empty if no max-age
+	// was estimated, since the request has no verifier.
+	StrategyName string
+	// RawTTL is the estimate produced by the strategy.
+	RawTTL time.Duration
+	// ClampedTTL is the max-age to emit, after any SizeBasedTTLModifier,
+	// RateAwareTTLModifier, MinTTL and MaxTTL, but before any TTLJitter.
+	ClampedTTL time.Duration
+	// VerificationCount is the number of responses the verifier has
+	// observed, including this one.
+	VerificationCount int
+	// WarmingUp is true while the verifier has observed fewer than
+	// MinSamples responses, in which case no max-age is emitted at all,
+	// and ClampedTTL is zero.
+	WarmingUp bool
+}
+
+const (
+	overrideStrategyName = "override"
+	fallbackStrategyName = "fallback"
+)
+
+// EstimateDetail estimates the max-age for the given request and response,
+// like the server interceptor would, and describes how the estimate came
+// about. The response is observed by the verifier of the request, if any,
+// just as if it had been served. Requests are estimated as if made without
+// any of the metadata listed in Vary.
+func (e *ConfigurableValidityEstimator) EstimateDetail(fullMethod string, req, resp interface{}) (EstimationResult, error) {
+	if _, ok := resp.(proto.Message); !ok {
+		return EstimationResult{}, status.Errorf(codes.InvalidArgument, "No response to estimate for %s", fullMethod)
+	}
+	return e.estimateDetail(fullMethod, nil, req, resp)
+}
+
+// Explain describes how the max-age for the given request is currently
+// determined, without affecting the state of the estimator. Requests are
+// explained as if made without any of the metadata listed in Vary.
+func (e *ConfigurableValidityEstimator) Explain(fullMethod string, req proto.Message) (Explanation, error) {
+	if req == nil {
+		return Explanation{}, status.Errorf(codes.InvalidArgument, "No request to explain for %s", fullMethod)
+	}
+
+	explanation := Explanation{Method: fullMethod}
+	if e.blacklisted(fullMethod) {
+		explanation.Blacklisted = true
+		return explanation, nil
+	}
+	if !e.whitelisted(fullMethod) {
+		explanation.Unlisted = true
+		return explanation, nil
+	}
+
+	// decided like an estimate, except that the verifier observes nothing
+	d, err := e.decide(fullMethod, nil, req, func(verifier *verifier) (float64, interface{}, error) {
+		return verifier.requestRate(), verifier.reply(), nil
+	})
+	if d.verifier != nil {
+		explanation.Verified = true
+		if tracker, ok := d.verifier.strategy.(changeTracker); ok {
+			explanation.LastChange = tracker.lastChange()
+		}
+	}
+	explanation.Strategy = d.StrategyName
+	explanation.Observations = d.VerificationCount
+	explanation.RawEstimate = d.RawTTL
+	explanation.Clamp = d.clamp
+	explanation.WarmingUp = d.WarmingUp
+	explanation.TTL = d.ClampedTTL
+
+	return explanation, err
+}
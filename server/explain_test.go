@@ -0,0 +1,117 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExplainReflectsMinTTLClamp(test *testing.T) {
+	e := newTestEstimator()
+	e.MinTTL = 30 * time.Second
+	req := sample{value: "req"}
+	v := addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+	v.update(sample{value: "resp"}, clientSource)
+
+	explanation, err := e.Explain(testMethod, req)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	if !explanation.Verified || explanation.Observations != 1 {
+		test.Errorf("Wanted a verifier with 1 observation, got %+v", explanation)
+	}
+	if explanation.Strategy != "static(ttl=10s)" {
+		test.Errorf("Wanted static strategy, got %s", explanation.Strategy)
+	}
+	if explanation.RawEstimate != 10*time.Second || explanation.Clamp != "min" || explanation.TTL != 30*time.Second {
+		test.Errorf("Wanted 10s raw estimate clamped to 30s, got %+v", explanation)
+	}
+}
+
+func TestExplainWithoutVerifier(test *testing.T) {
+	e := newTestEstimator()
+
+	explanation, err := e.Explain(testMethod, sample{value: "req"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if explanation.Verified || explanation.TTL != 0 {
+		test.Errorf("Wanted no verifier and no TTL, got %+v", explanation)
+	}
+}
+
+func TestEstimateDetailDescribesEstimate(test *testing.T) {
+	e := newTestEstimator()
+	e.MaxTTL = 5 * time.Second
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+
+	result, err := e.EstimateDetail(testMethod, req, sample{value: "resp"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	want := EstimationResult{StrategyName: "static(ttl=10s)", RawTTL: 10 * time.Second, ClampedTTL: 5 * time.Second, VerificationCount: 1}
+	if result != want {
+		test.Errorf("Wanted %+v, got %+v", want, result)
+	}
+	if maxAge, _ := e.estimateMaxAge(testMethod, nil, req, sample{value: "resp"}); maxAge != result.ClampedTTL {
+		test.Errorf("Wanted estimateMaxAge to agree with %s, got %s", result.ClampedTTL, maxAge)
+	}
+}
+
+func TestEstimateDetailForOverride(test *testing.T) {
+	e := newTestEstimator()
+	e.MaxAgeOverrides = map[string]time.Duration{testMethod: time.Minute}
+	e.compileOverrides()
+
+	result, err := e.EstimateDetail(testMethod, sample{value: "req"}, sample{value: "resp"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if result.StrategyName != overrideStrategyName || result.ClampedTTL != time.Minute {
+		test.Errorf("Wanted the overridden max-age, got %+v", result)
+	}
+}
+
+func TestExplainForOverride(test *testing.T) {
+	e := newTestEstimator()
+	e.MaxAgeOverrides = map[string]time.Duration{testMethod: time.Minute}
+	e.compileOverrides()
+
+	explanation, err := e.Explain(testMethod, sample{value: "req"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if explanation.Strategy != overrideStrategyName || explanation.TTL != time.Minute {
+		test.Errorf("Wanted the overridden max-age, got %+v", explanation)
+	}
+}
+
+func TestExplainAppliesModifiersAndMinSamples(test *testing.T) {
+	e := newTestEstimator()
+	e.RateAwareTTLModifier = func(rate float64, ttl time.Duration) time.Duration { return ttl / 2 }
+	req := sample{value: "req"}
+	v := addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+	v.update(sample{value: "resp"}, clientSource)
+
+	explanation, err := e.Explain(testMethod, req)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if explanation.RawEstimate != 10*time.Second || explanation.TTL != 5*time.Second {
+		test.Errorf("Wanted 10s raw estimate halved to 5s, got %+v", explanation)
+	}
+
+	e.MinSamples = 2
+	explanation, err = e.Explain(testMethod, req)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if !explanation.WarmingUp || explanation.TTL != 0 {
+		test.Errorf("Wanted no max-age while warming up, got %+v", explanation)
+	}
+	if v.observationCount() != 1 {
+		test.Errorf("Wanted Explain to observe nothing, got %d observations", v.observationCount())
+	}
+}
@@ -0,0 +1,72 @@
+package server
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// verifierFailed counts a failure to create a verifier for the method, and
+// reports when the method has failed often enough to be degraded.
+func (e *ConfigurableValidityEstimator) verifierFailed(method string) {
+	atomic.AddUint64(&e.verifierFailures, 1)
+
+	e.failuresMux.Lock()
+	defer e.failuresMux.Unlock()
+	if e.failures == nil {
+		e.failures = make(map[string]int)
+	}
+	e.failures[method]++
+
+	if e.VerifierFailureThreshold > 0 && e.failures[method] == e.VerifierFailureThreshold {
+		if e.VerifierFailureMaxAge > 0 {
+			e.logger().Warn("Verifiers failed repeatedly, falling back to fixed max-age", "method", method, "failures", e.failures[method], "max_age", e.VerifierFailureMaxAge)
+		} else {
+			e.logger().Warn("Verifiers failed repeatedly, responses will not be cached", "method", method, "failures", e.failures[method])
+		}
+	}
+}
+
+// verifierCreated resets the failure count of the method.
+func (e *ConfigurableValidityEstimator) verifierCreated(method string) {
+	e.failuresMux.Lock()
+	defer e.failuresMux.Unlock()
+	delete(e.failures, method)
+}
+
+// degraded is a predicate that indicates if verifiers for the method have
+// failed to be created at least VerifierFailureThreshold times in a row.
+func (e *ConfigurableValidityEstimator) degraded(method string) bool {
+	if e.VerifierFailureThreshold <= 0 {
+		return false
+	}
+
+	e.failuresMux.Lock()
+	defer e.failuresMux.Unlock()
+	return e.failures[method] >= e.VerifierFailureThreshold
+}
+
+// degradedMethods returns the methods that are currently degraded.
+func (e *ConfigurableValidityEstimator) degradedMethods() []string {
+	if e.VerifierFailureThreshold <= 0 {
+		return nil
+	}
+
+	e.failuresMux.Lock()
+	defer e.failuresMux.Unlock()
+	var methods []string
+	for method, failures := range e.failures {
+		if failures >= e.VerifierFailureThreshold {
+			methods = append(methods, method)
+		}
+	}
+	return methods
+}
+
+// fallbackMaxAge returns the max-age to use for the method while it has no
+// verifier, and whether there is one.
+func (e *ConfigurableValidityEstimator) fallbackMaxAge(method string) (time.Duration, bool) {
+	if e.VerifierFailureMaxAge <= 0 || !e.degraded(method) {
+		return 0, false
+	}
+	return e.VerifierFailureMaxAge, true
+}
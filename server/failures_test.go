@@ -0,0 +1,54 @@
+package server
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+func TestPersistentVerifierFailureFallsBack(test *testing.T) {
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	e.VerifierFailureThreshold = 3
+	e.VerifierFailureMaxAge = 5 * time.Second
+	// verifiers must connect right away, which never succeeds
+	e.DialOptions = []grpc.DialOption{grpc.WithInsecure(), grpc.WithBlock(), grpc.WithTimeout(20 * time.Millisecond)}
+
+	cc, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+	if err != nil {
+		test.Fatalf("Unable to dial: %v", err)
+	}
+	defer cc.Close()
+
+	req := &wrappers.StringValue{Value: "req"}
+	resp := &wrappers.StringValue{Value: "resp"}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	for i := 1; i <= e.VerifierFailureThreshold; i++ {
+		if maxAge, _ := e.estimateMaxAge(testMethod, nil, req, resp); maxAge != 0 {
+			test.Errorf("Wanted no max-age before %d failures, got %v", i, maxAge)
+		}
+		e.UnaryClientInterceptor()(context.Background(), testMethod, req, resp, cc, invoker)
+	}
+
+	if got := e.Stats().VerifierFailures; got != 3 {
+		test.Errorf("Wanted 3 verifier failures, got %d", got)
+	}
+	if got := e.Stats().DegradedMethods; len(got) != 1 || got[0] != testMethod {
+		test.Errorf("Wanted %s to be degraded, got %v", testMethod, got)
+	}
+	if maxAge, err := e.estimateMaxAge(testMethod, nil, req, resp); err != nil || maxAge != 5*time.Second {
+		test.Errorf("Wanted fallback max-age of 5s, got %v (err %v)", maxAge, err)
+	}
+
+	e.verifierCreated(testMethod)
+	if maxAge, _ := e.estimateMaxAge(testMethod, nil, req, resp); maxAge != 0 {
+		test.Errorf("Wanted fallback to end once a verifier is created, got %v", maxAge)
+	}
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"time"
+
+	"github.com/llarsson/grpc-caching-interceptors/flags"
+)
+
+// estimationDisabled is a predicate that indicates if estimation has been
+// turned off by a flag.
+func (e *ConfigurableValidityEstimator) estimationDisabled() bool {
+	return e.Flags != nil && e.Flags.Bool(flags.EstimationDisabled)
+}
+
+// watchFlags polls the strategy parameter flags, and applies them whenever
+// they change.
+func (e *ConfigurableValidityEstimator) watchFlags() {
+	interval := e.FlagPollInterval
+	if interval <= 0 {
+		interval = defaultFlagPollInterval
+	}
+
+	applied := make(map[string]float64)
+	for {
+		e.applyParamFlags(applied)
+		select {
+		case <-time.After(interval):
+		case <-e.quit:
+			return
+		}
+	}
+}
+
+// applyParamFlags sets the strategy parameters whose flags are set, and
+// differ from the values that were last applied.
+func (e *ConfigurableValidityEstimator) applyParamFlags(applied map[string]float64) {
+	for name, flag := range map[string]string{"alpha": flags.StrategyAlpha, "rho": flags.StrategyRho} {
+		value := e.Flags.Float(flag)
+		if value <= 0 || value == applied[name] {
+			continue
+		}
+		if err := e.SetStrategyParam(name, value); err != nil {
+			e.logger().Warn("Ignoring flag", "flag", flag, "error", err)
+		}
+		applied[name] = value
+	}
+}
@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/llarsson/grpc-caching-interceptors/flags"
+)
+
+func TestEstimationDisabledByFlag(test *testing.T) {
+	source := flags.Static{Bools: map[string]bool{}}
+	e := newTestEstimator()
+	e.Flags = source
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Minute))
+
+	header, err := invoke(e, req, sample{value: "resp"})
+	if err != nil || len(header.Get("cache-control")) != 1 {
+		test.Fatalf("Wanted cache-control with estimation enabled, got %v (err %v)", header, err)
+	}
+
+	source.Bools[flags.EstimationDisabled] = true
+
+	header, err = invoke(e, req, sample{value: "resp"})
+	if err != nil || len(header.Get("cache-control")) != 0 {
+		test.Errorf("Wanted no cache-control with estimation disabled, got %v (err %v)", header, err)
+	}
+	if needed, _ := e.verificationNeeded(testMethod, nil, sample{value: "other"}); needed {
+		test.Errorf("Wanted no verification with estimation disabled")
+	}
+}
+
+func TestStrategyParamFlagsApplied(test *testing.T) {
+	source := flags.Static{Floats: map[string]float64{flags.StrategyRho: 0.4}}
+	e := newTestEstimator()
+	e.Flags = source
+	v := addVerifier(e, testMethod, sample{value: "req"}, time.Now().Add(time.Minute))
+	strategy := &updateRiskBasedStrategy{rho: 0.1}
+	v.strategy = strategy
+
+	applied := make(map[string]float64)
+	e.applyParamFlags(applied)
+	if strategy.rho != 0.4 {
+		test.Errorf("Wanted rho 0.4 from flag, got %v", strategy.rho)
+	}
+
+	source.Floats[flags.StrategyRho] = 2
+	e.applyParamFlags(applied)
+	if strategy.rho != 0.4 {
+		test.Errorf("Wanted out of range flag to be ignored, got rho %v", strategy.rho)
+	}
+}
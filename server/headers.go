@@ -0,0 +1,69 @@
+package server
+
+import (
+	"sync"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// cacheableHeader is the header that handlers can set to "false" to signal
+// that a particular response must not be cached.
+const cacheableHeader = "x-cacheable"
+
+const (
+	// etagHeader is the header in which upstream services may identify
+	// the version of a response.
+	etagHeader = "etag"
+	// ifNoneMatchHeader is the header in which verifiers send the ETag of
+	// the response they fetched last. An upstream service that supports it
+	// may echo the ETag and leave out the response if it has not changed.
+	ifNoneMatchHeader = "if-none-match"
+)
+
+// headerRecorder wraps a grpc.ServerTransportStream, and records the headers
+// that are set or sent through it. This lets the interceptor inspect the
+// headers that the handler has set on the response.
+type headerRecorder struct {
+	grpc.ServerTransportStream
+
+	header metadata.MD
+	mux    sync.Mutex
+}
+
+func (r *headerRecorder) record(md metadata.MD) {
+	r.mux.Lock()
+	r.header = metadata.Join(r.header, md)
+	r.mux.Unlock()
+}
+
+func (r *headerRecorder) SetHeader(md metadata.MD) error {
+	r.record(md)
+	return r.ServerTransportStream.SetHeader(md)
+}
+
+func (r *headerRecorder) SendHeader(md metadata.MD) error {
+	r.record(md)
+	return r.ServerTransportStream.SendHeader(md)
+}
+
+// uncacheable is a predicate that indicates if the handler has marked the
+// response as not cacheable.
+func (r *headerRecorder) uncacheable() bool {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	for _, value := range r.header.Get(cacheableHeader) {
+		if value == "false" {
+			return true
+		}
+	}
+	return false
+}
+
+// responseETag returns the ETag given in the header, if any.
+func responseETag(header metadata.MD) string {
+	if values := header.Get(etagHeader); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
@@ -10,62 +10,268 @@ import (
 	"fmt"
 	"log"
 	"math"
-	"os"
-	"regexp"
+	"math/rand"
+	"reflect"
 	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
 	"github.com/patrickmn/go-cache"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
-// Initialize new ConfigurableValidityEstimator.
-func (e *ConfigurableValidityEstimator) Initialize(csvLog *log.Logger) {
-	e.verifiers = cache.New(maxVerifierLifetime, time.Duration(maxVerifierLifetime)*2)
+// Initialize new ConfigurableValidityEstimator, configured by the
+// environment (see ConfigFromEnv).
+func (e *ConfigurableValidityEstimator) Initialize(estimateLog *log.Logger) {
+	e.InitializeWithCache(cache.New(e.defaultVerifierLifetime(), e.defaultVerifierLifetime()*2), estimateLog)
+}
+
+// InitializeWithCache initializes a new ConfigurableValidityEstimator like
+// Initialize does, but keeps its verifiers in the given cache rather than
+// in one of its own, e.g. to clean up expired verifiers at another
+// interval, or to inspect them in tests. Verifiers are stored with their
+// lifetime, so the default expiration of the cache does not matter.
+// Estimators that share a cache also share their verifiers.
+func (e *ConfigurableValidityEstimator) InitializeWithCache(verifiers *cache.Cache, estimateLog *log.Logger) {
+	config := ConfigFromEnv()
+	if err := config.validate(); err != nil {
+		e.logger().Warn("Invalid configuration in environment", "error", err)
+	}
+	e.verifiers = verifiers
+	e.initialize(config, estimateLog)
+}
+
+// InitializeWithConfig initializes a new ConfigurableValidityEstimator with
+// the given configuration instead of the environment, which lets several
+// differently configured estimators live in the same process. An invalid
+// configuration is rejected, leaving the estimator uninitialized.
+func (e *ConfigurableValidityEstimator) InitializeWithConfig(config Config, estimateLog *log.Logger) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	e.verifiers = cache.New(e.defaultVerifierLifetime(), e.defaultVerifierLifetime()*2)
+	e.initialize(config, estimateLog)
+	return nil
+}
+
+func (e *ConfigurableValidityEstimator) initialize(config Config, estimateLog *log.Logger) {
 	e.done = make(chan string, 1000)
-	e.csvLog = csvLog
-	e.csvLog.Printf("timestamp,source,method,estimate\n")
+	e.quit = make(chan struct{})
+	records, err := newRecordEncoder(config.LogFormat, estimateLog, e.logger())
+	if err != nil {
+		e.logger().Warn("Logging estimates as CSV", "error", err)
+		records, _ = newRecordEncoder(CSVLogFormat, estimateLog, e.logger())
+	}
+	e.records = records
+	e.records.writeHeader()
+
+	e.applyConfig(config)
+	e.compileOverrides()
+	e.loadStrategyConfig()
+	if e.Flags != nil {
+		go e.watchFlags()
+	}
 
 	// clean up finished verifiers
 	go func() {
 		for {
-			finishedVerifier := <-e.done
-			log.Printf("Verifier %s finished (currently %d) in set", finishedVerifier, e.verifiers.ItemCount())
-			e.verifiers.Delete(finishedVerifier)
+			select {
+			case finishedVerifier := <-e.done:
+				e.logger().Debug("Verifier finished", "key", finishedVerifier, "verifiers", e.verifiers.ItemCount())
+				e.verifiers.Delete(finishedVerifier)
+			case <-e.quit:
+				return
+			}
+		}
+	}()
+
+	// proactively remove verifiers that are no longer useful
+	go func() {
+		interval := e.CompactionInterval
+		if interval <= 0 {
+			interval = defaultCompactionInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.compact()
+			case <-e.quit:
+				return
+			}
 		}
 	}()
 }
 
+// removeVerifier removes the verifier stored under the key, unless it has
+// been replaced by another one since, and reports whether it did.
+func (e *ConfigurableValidityEstimator) removeVerifier(key string, v *verifier) bool {
+	current, found := e.verifiers.Get(key)
+	if !found || current.(*verifier) != v {
+		return false
+	}
+	e.verifiers.Delete(key)
+	return true
+}
+
+// compact removes verifiers that will not produce useful estimations, even
+// though they have not yet signalled that they are done. It returns the
+// number of verifiers that were removed.
+func (e *ConfigurableValidityEstimator) compact() int {
+	removed := 0
+	for key, item := range e.verifiers.Items() {
+		v := item.Object.(*verifier)
+
+		var reason string
+		if e.blacklisted(v.method) {
+			reason = "method blacklisted"
+		} else if !e.whitelisted(v.method) {
+			reason = "method not whitelisted"
+		} else if v.finished() {
+			reason = "expired"
+		} else if v.unreachable() {
+			v.unreachablePasses++
+			if v.unreachablePasses >= unreachableCompactionPasses {
+				reason = "upstream unreachable"
+			}
+		} else {
+			v.unreachablePasses = 0
+		}
+
+		if reason != "" && e.removeVerifier(key, v) {
+			v.stop()
+			v.logger().Info("Compacted verifier", "reason", reason)
+			removed++
+		}
+	}
+
+	if removed > 0 {
+		e.logger().Info("Compaction removed verifiers", "removed", removed, "verifiers", e.verifiers.ItemCount())
+	}
+
+	return removed
+}
+
 // estimateMaxAge estimates the cache validity of the specified
 // request/response pair for the given method. The result is given
 // in seconds.
-func (e *ConfigurableValidityEstimator) estimateMaxAge(fullMethod string, req interface{}, resp interface{}) (time.Duration, error) {
-	value, found := e.verifiers.Get(hash(fullMethod, req))
+func (e *ConfigurableValidityEstimator) estimateMaxAge(fullMethod string, md metadata.MD, req interface{}, resp interface{}) (time.Duration, error) {
+	result, err := e.estimateDetail(fullMethod, md, req, resp)
+	if err != nil {
+		return -1, err
+	}
+	return result.ClampedTTL, nil
+}
+
+// estimateDetail estimates the cache validity of the specified
+// request/response pair for the given method, made with the given metadata,
+// and describes how the estimate came about.
+func (e *ConfigurableValidityEstimator) estimateDetail(fullMethod string, md metadata.MD, req interface{}, resp interface{}) (EstimationResult, error) {
+	d, err := e.decide(fullMethod, md, req, func(verifier *verifier) (float64, interface{}, error) {
+		if observer, ok := verifier.strategy.(arrivalObserver); ok {
+			observer.observeArrival(time.Now())
+		}
+
+		rate := verifier.recordRequest(time.Now())
+
+		verifier.adoptResponseType(resp.(proto.Message))
+		if err := verifier.update(resp.(proto.Message), clientSource); err != nil {
+			verifier.logger().Warn("Unable to update verifier", "error", err)
+			return 0, nil, err
+		}
+		return rate, resp, nil
+	})
+	return d.EstimationResult, err
+}
+
+// A decision is how the max-age for a request was arrived at.
+type decision struct {
+	EstimationResult
+	// the verifier of the request, if it has one
+	verifier *verifier
+	// "min" or "max" if ClampedTTL was bounded by MinTTL or MaxTTL
+	clamp string
+}
+
+// decide arrives at the max-age for a request, for both estimateDetail and
+// Explain. If the request has a verifier, observe is called with it before
+// the estimate is made, and returns the rate at which the response is
+// requested and the response, for the TTL modifiers.
+func (e *ConfigurableValidityEstimator) decide(fullMethod string, md metadata.MD, req interface{}, observe func(*verifier) (float64, interface{}, error)) (decision, error) {
+	if maxAge, found := e.overriddenMaxAge(fullMethod); found {
+		return decision{EstimationResult: EstimationResult{StrategyName: overrideStrategyName, RawTTL: maxAge, ClampedTTL: maxAge}}, nil
+	}
+
+	value, found := e.verifiers.Get(e.key(fullMethod, md, req))
 
 	if found {
-		verifier := value.(*verifier)
-		err := verifier.update(resp.(proto.Message), clientSource)
+		d := decision{verifier: value.(*verifier)}
+		rate, resp, err := observe(d.verifier)
 		if err != nil {
-			log.Printf("Unable to update verifier %s", verifier.string())
-			return -1, err
+			return d, err
 		}
 
-		maxAge, err := verifier.estimate()
+		d.StrategyName = d.verifier.strategy.name()
+		d.VerificationCount = d.verifier.observationCount()
+		d.RawTTL, err = d.verifier.estimate()
 		if err != nil {
-			return -1, err
+			return d, err
 		}
 
-		return maxAge, nil
+		if d.VerificationCount < e.MinSamples {
+			d.WarmingUp = true
+			return d, nil
+		}
+
+		maxAge := d.RawTTL
+		if e.SizeBasedTTLModifier != nil && maxAge > 0 {
+			maxAge = e.SizeBasedTTLModifier(responseSize(resp), maxAge)
+		}
+		if e.RateAwareTTLModifier != nil && maxAge > 0 {
+			maxAge = e.RateAwareTTLModifier(rate, maxAge)
+		}
+		d.ClampedTTL, d.clamp = e.clamp(maxAge)
+		return d, nil
+	}
+
+	// Methods whose verifiers keep failing may be cached conservatively
+	// anyway.
+	if maxAge, found := e.fallbackMaxAge(fullMethod); found {
+		return decision{EstimationResult: EstimationResult{StrategyName: fallbackStrategyName, RawTTL: maxAge, ClampedTTL: maxAge}}, nil
 	}
 
 	// No estimation at this time is not an error. But that means that caching
 	// should not occur, either.
-	return 0, nil
+	return decision{}, nil
+}
+
+// responseSize returns the size in bytes of a response, or of all messages
+// of a stream.
+func responseSize(resp interface{}) int {
+	switch r := resp.(type) {
+	case *streamResponse:
+		size := 0
+		for _, message := range r.messages {
+			size += proto.Size(message)
+		}
+		return size
+	case *rawResponse:
+		return len(r.data)
+	case proto.Message:
+		return proto.Size(r)
+	default:
+		return 0
+	}
 }
 
 // UnaryServerInterceptor creates the server-side gRPC Unary Interceptor
@@ -74,160 +280,487 @@ func (e *ConfigurableValidityEstimator) estimateMaxAge(fullMethod string, req in
 func (e *ConfigurableValidityEstimator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
 
 	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		// Record what headers the handler sets, since it may mark the
+		// response as uncacheable.
+		var recorder *headerRecorder
+		if stream := grpc.ServerTransportStreamFromContext(ctx); stream != nil {
+			recorder = &headerRecorder{ServerTransportStream: stream}
+			ctx = grpc.NewContextWithServerTransportStream(ctx, recorder)
+		}
+
 		resp, err := handler(ctx, req)
 		if err != nil {
-			log.Printf("Upstream call failed with error %v", err)
+			e.logger().Warn("Upstream call failed", "method", info.FullMethod, "error", err)
 			return resp, err
 		}
 
-		// Only upstream call failures constitute true errors, so we only log others.
-		var maxAgeMessage string
-		if e.blacklisted(info.FullMethod) {
-			maxAgeMessage = fmt.Sprintf(", but method %s blacklisted from caching", info.FullMethod)
-		} else {
-			maxAge, err := e.estimateMaxAge(info.FullMethod, req, resp)
-			if err == nil {
-				ttl := int(math.Round(maxAge.Seconds()))
-				grpc.SetHeader(ctx, metadata.Pairs("cache-control", fmt.Sprintf("must-revalidate, max-age=%d", ttl)))
-				maxAgeMessage = fmt.Sprintf(" and cache max-age set to %d", ttl)
+		cacheControl, decision, err := e.cacheControl(ctx, info.FullMethod, req, resp, recorder != nil && recorder.uncacheable())
+		if err != nil {
+			return nil, err
+		}
+		if cacheControl != "" {
+			if e.ObserveOnly {
+				decision = append(decision, "observed_only", true)
 			} else {
-				maxAgeMessage = ", but an error occurred estimating max-age"
+				grpc.SetHeader(ctx, metadata.Pairs("cache-control", cacheControl))
 			}
 		}
 
-		requestHash := hashcode.String((req.(proto.Message).String()))
-		log.Printf("%s(%d) hit upstream%s", info.FullMethod, requestHash, maxAgeMessage)
+		requestHash := hashing.String((req.(proto.Message).String()))
+		e.logCall("Responded from upstream", append([]interface{}{"method", info.FullMethod, "hash", requestHash}, decision...)...)
 
 		return resp, nil
 	}
 }
 
-func (e *ConfigurableValidityEstimator) blacklisted(method string) bool {
-	if blacklistExpression, found := os.LookupEnv("PROXY_CACHE_BLACKLIST"); found {
-		blacklisted, err := regexp.Match(blacklistExpression, []byte(method))
-		if err == nil && blacklisted {
-			return true
+// cacheControl determines the cache-control value to emit for the response
+// to a call, along with attributes describing the decision for logging. No value
+// is emitted if the response must not be cached. An error is returned if the
+// call must fail. The decision is also noted on the span of the call, if it
+// is traced.
+func (e *ConfigurableValidityEstimator) cacheControl(ctx context.Context, fullMethod string, req, resp interface{}, uncacheable bool) (string, []interface{}, error) {
+	blacklisted := e.blacklisted(fullMethod)
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Bool("cache.blacklisted", blacklisted))
+
+	// Only upstream call failures constitute true errors, so we only log others.
+	if blacklisted {
+		return "", []interface{}{"reason", "blacklisted"}, nil
+	}
+	if !e.whitelisted(fullMethod) {
+		return "", []interface{}{"reason", "not whitelisted"}, nil
+	}
+	if e.estimationDisabled() {
+		return "", []interface{}{"reason", "estimation disabled by flag"}, nil
+	}
+	if uncacheable {
+		return "", []interface{}{"reason", "marked uncacheable by handler"}, nil
+	}
+	if !e.cacheableResponse(resp) {
+		return "", []interface{}{"reason", "rejected by predicate"}, nil
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	result, err := e.estimateDetail(fullMethod, md, req, resp)
+	maxAge := result.ClampedTTL
+	if err == nil && result.WarmingUp {
+		return "", []interface{}{"reason", "verifier warming up"}, nil
+	}
+	if err == nil && e.Metrics != nil {
+		e.Metrics.EstimatedMaxAge(fullMethod, maxAge)
+	}
+	if err != nil {
+		atomic.AddUint64(&e.estimationErrors, 1)
+
+		switch e.EstimationErrorPolicy {
+		case FailOnEstimationError:
+			e.logger().Warn("Failing call, since max-age estimation failed", "method", fullMethod, "error", err)
+			return "", nil, status.Errorf(codes.Internal, "Unable to estimate max-age for %s", fullMethod)
+		case FallbackOnEstimationError:
+			maxAge = e.FallbackMaxAge
+		default:
+			return "", []interface{}{"reason", "estimation failed"}, nil
 		}
 	}
-	return false
+
+	maxAge = e.jitter(maxAge)
+	ttl := int(math.Round(maxAge.Seconds()))
+	span.SetAttributes(attribute.Int("cache.max_age_seconds", ttl))
+	if e.StaleWhileRevalidate > 0 && ttl > 0 {
+		window := int(math.Round(e.StaleWhileRevalidate.Seconds()))
+		return fmt.Sprintf("max-age=%d, stale-while-revalidate=%d", ttl, window), []interface{}{"max_age", ttl, "stale_while_revalidate", window}, nil
+	}
+	return fmt.Sprintf("must-revalidate, max-age=%d", ttl), []interface{}{"max_age", ttl}, nil
+}
+
+// cacheableResponse is a predicate that indicates if the response may be
+// cached according to the CacheableResponsePredicate, if any.
+func (e *ConfigurableValidityEstimator) cacheableResponse(resp interface{}) bool {
+	if e.CacheableResponsePredicate == nil {
+		return true
+	}
+	if stream, ok := resp.(*streamResponse); ok {
+		for _, message := range stream.messages {
+			if !e.CacheableResponsePredicate(message) {
+				return false
+			}
+		}
+		return true
+	}
+	message, ok := resp.(proto.Message)
+	return ok && e.CacheableResponsePredicate(message)
+}
+
+// clamp the estimated max-age into the configured range, and report which
+// bound, if any, was applied. Estimates of zero (or less) mean that the
+// response should not be cached, and are left alone.
+func (e *ConfigurableValidityEstimator) clamp(maxAge time.Duration) (time.Duration, string) {
+	if maxAge <= 0 {
+		return maxAge, ""
+	}
+	if maxAge < e.MinTTL {
+		return e.MinTTL, "min"
+	}
+	if e.MaxTTL > 0 && maxAge > e.MaxTTL {
+		return e.MaxTTL, "max"
+	}
+	return maxAge, ""
+}
+
+// jitter randomly makes the max-age up to TTLJitter longer or shorter. The
+// result stays within MinTTL and MaxTTL, and is never negative. Max-ages of
+// zero (or less) are left alone.
+func (e *ConfigurableValidityEstimator) jitter(maxAge time.Duration) time.Duration {
+	if e.TTLJitter <= 0 || maxAge <= 0 {
+		return maxAge
+	}
+
+	factor := 1 + e.TTLJitter*(2*rand.Float64()-1)
+	jittered := time.Duration(float64(maxAge) * factor)
+	if jittered < 0 {
+		jittered = 0
+	}
+	jittered, _ = e.clamp(jittered)
+	return jittered
+}
+
+func (e *ConfigurableValidityEstimator) blacklisted(method string) bool {
+	return e.blacklist != nil && e.blacklist.MatchString(method)
+}
+
+// whitelisted is a predicate that indicates if the method may be cached
+// according to the whitelist, which is true for all methods without one.
+func (e *ConfigurableValidityEstimator) whitelisted(method string) bool {
+	return e.whitelist == nil || e.whitelist.MatchString(method)
 }
 
-func (e *ConfigurableValidityEstimator) verificationNeeded(method string, req interface{}) (bool, time.Duration) {
+func (e *ConfigurableValidityEstimator) verificationNeeded(method string, md metadata.MD, req interface{}) (bool, time.Duration) {
 	// TODO Take into consideration, e.g., how often we have been asked to
 	// verify this one particular method and its request. Just to filter
 	// the verification process a bit, keeping the number of verifiers
 	// down.
 
-	if e.blacklisted(method) {
+	if e.blacklisted(method) || !e.whitelisted(method) || e.estimationDisabled() {
+		return false, -1
+	}
+	if _, overridden := e.overriddenMaxAge(method); overridden {
 		return false, -1
 	}
 
-	hash := hash(method, req)
+	hash := e.key(method, md, req)
 	_, expiration, found := e.verifiers.GetWithExpiration(hash)
 	if found {
 		if expiration.IsZero() || time.Now().Before(expiration) {
 			return false, -1
 		}
-		return true, maxVerifierLifetime
+		return true, e.verifierLifetime(method)
+	}
+	if e.MaxVerifiers > 0 && e.verifiers.ItemCount() >= e.MaxVerifiers {
+		e.logger().Info("Not verifying, since there are too many verifiers", "method", method, "max_verifiers", e.MaxVerifiers)
+		return false, -1
 	}
-	return true, maxVerifierLifetime
+	return true, e.verifierLifetime(method)
 }
 
 func hash(method string, req interface{}) string {
 	reqMessage := req.(proto.Message)
-	hash := hashcode.Strings([]string{method, reqMessage.String()})
+	hash := hashing.Strings(nil, []string{method, reqMessage.String()})
 
 	return hash
 }
 
+// key returns the key under which the verifier of a request is stored,
+// which is its hash unless a KeyFunc has been configured. It is hashed by
+// the Hasher, if one has been configured. The metadata
+// listed in Vary is part of the key, and missing metadata counts as empty,
+// so that keys remain stable.
+func (e *ConfigurableValidityEstimator) key(method string, md metadata.MD, req interface{}) string {
+	if e.KeyFunc == nil && len(e.Vary) == 0 && e.Hasher == nil {
+		return hash(method, req)
+	}
+
+	parts := []string{method}
+	if e.KeyFunc != nil {
+		parts = append(parts, e.KeyFunc(method, req.(proto.Message)))
+	} else {
+		parts = append(parts, req.(proto.Message).String())
+	}
+	for _, name := range e.Vary {
+		parts = append(parts, name+"="+strings.Join(md.Get(name), ","))
+	}
+	return hashing.Strings(e.Hasher, parts)
+}
+
+// varied returns the metadata listed in Vary, which verifiers send along
+// when they poll the upstream service.
+func (e *ConfigurableValidityEstimator) varied(md metadata.MD) metadata.MD {
+	if len(e.Vary) == 0 {
+		return nil
+	}
+	varied := metadata.MD{}
+	for _, name := range e.Vary {
+		if values := md.Get(name); len(values) > 0 {
+			varied.Set(name, values...)
+		}
+	}
+	return varied
+}
+
 // UnaryClientInterceptor catches outgoing calls and stores information
 // about them to enable verification of estimated cache validity
 // times.
 func (e *ConfigurableValidityEstimator) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
 	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		// TODO(llarsson): store headers as well
+		var header metadata.MD
+		opts = append(opts[:len(opts):len(opts)], grpc.Header(&header))
 		err := invoker(ctx, method, req, reply, cc, opts...)
 		if err != nil {
-			log.Printf("Failure to invoke upstream %s(%s): %v", method, req, err)
+			e.logger().Warn("Failed to invoke upstream", "method", method, "error", err)
 			return err
 		}
 
-		if needed, expiration := e.verificationNeeded(method, req); needed {
-			hash := hash(method, req)
-			now := time.Now()
+		if nilReply(reply) {
+			e.logger().Info("Not verifying, since the reply is nil", "method", method)
+			return nil
+		}
 
-			strategy := initializeStrategy()
-			requestMessage := req.(proto.Message)
-			replyMessage := req.(proto.Message)
-			verifier, err := newVerifier(cc.Target(), method, requestMessage, replyMessage, now.Add(expiration), strategy, e.csvLog, e.done)
-			if err != nil {
-				log.Printf("Unable to create verifier for %s(%d): %v", method, hashcode.String(requestMessage.String()), err)
-				return err
-			}
+		requestMessage := req.(proto.Message)
+		replyMessage := reply.(proto.Message)
+		md, _ := metadata.FromIncomingContext(ctx)
+		created := e.startVerification(cc.Target(), method, md, requestMessage, replyMessage, header)
+		trace.SpanFromContext(ctx).SetAttributes(attribute.Bool("cache.verifier_created", created))
 
-			// expiration is manually handled by our use of the "done" channel
-			err = e.verifiers.Add(hash, verifier, time.Duration(0))
-			if err != nil {
-				log.Printf("Failed to store verifier for %s: %v", verifier.string(), err)
-				return err
-			}
+		return nil
+	}
+}
 
-			log.Printf("Stored %s for verification", verifier.string())
-		}
+// nilReply is a predicate that indicates if a reply is missing altogether,
+// i.e. nil or a nil pointer, which cannot be verified.
+func nilReply(reply interface{}) bool {
+	if reply == nil {
+		return true
+	}
+	value := reflect.ValueOf(reply)
+	return value.Kind() == reflect.Ptr && value.IsNil()
+}
 
-		return nil
+// startVerification creates and stores a verifier for the request, made
+// with the given incoming metadata, given the reply and its header, which
+// may be nil, unless one is not needed. Failing to do so is not an error,
+// since the call itself succeeded, so we just go without verification this
+// time. It returns true if a verifier was created.
+func (e *ConfigurableValidityEstimator) startVerification(target string, method string, md metadata.MD, req proto.Message, reply proto.Message, header metadata.MD) bool {
+	needed, expiration := e.verificationNeeded(method, md, req)
+	if !needed {
+		return false
+	}
+
+	strategy := e.newStrategy(method)
+	if strategy == nil {
+		e.passedThrough(method)
+		return false
+	}
+	e.strategyCreated(method)
+
+	verifier, err := e.prepareVerifier(target, method, md, req, time.Now().Add(expiration), strategy)
+	if err == nil {
+		err = e.startVerifier(verifier, reply, header)
+	}
+	if err == errConnectionBudgetExhausted {
+		e.logger().Info("Deferring verification", "method", method, "hash", hashing.String(req.String()), "error", err)
+		return false
+	}
+	if err == errShutDown {
+		return false
+	}
+	if err != nil {
+		e.logger().Warn("Unable to create verifier", "method", method, "hash", hashing.String(req.String()), "error", err)
+		e.verifierFailed(method)
+		return false
 	}
+	e.verifierCreated(method)
+
+	// expiration is mostly handled by our use of the "done" channel, but
+	// the entry must not outlive the verifier
+	err = e.verifiers.Add(verifier.key, verifier, expiration)
+	if err != nil {
+		verifier.logger().Warn("Failed to store verifier", "error", err)
+		verifier.stop()
+		return false
+	}
+
+	verifier.logger().Info("Stored verifier")
+	return true
 }
 
-func initializeStrategy() estimationStrategy {
+// newStrategy creates the estimation strategy for a new verifier of the
+// method, wrapped according to how the estimator has been configured. A nil
+// strategy means that we act in passthrough mode.
+func (e *ConfigurableValidityEstimator) newStrategy(method string) estimationStrategy {
 	var strategy estimationStrategy
+	if router := e.strategyRouter(); router != nil {
+		var err error
+		strategy, err = router.strategyFor(method)
+		if err != nil {
+			e.logger().Warn("Invalid strategy specification, acting in passthrough mode", "method", method, "error", err)
+			return nil
+		}
+		if strategy == nil {
+			e.logCall("No strategy configured, acting in passthrough mode", "method", method)
+		}
+	} else {
+		strategy = e.defaultStrategy()
+	}
+	if strategy == nil {
+		return nil
+	}
+	e.applyParams(method, strategy)
+
+	if e.Confirmations > 1 {
+		strategy = &confirmationStrategy{strategyWrapper: strategyWrapper{strategy}, required: e.Confirmations}
+		strategy.initialize()
+	}
+
+	if e.Cooldown > 0 {
+		strategy = &cooldownStrategy{strategyWrapper: strategyWrapper{strategy}, cooldown: e.Cooldown}
+		strategy.initialize()
+	}
 
-	proxyMaxAge, found := os.LookupEnv("PROXY_MAX_AGE")
-	if !found {
-		log.Printf("PROXY_MAX_AGE not found, acting in passthrough mode")
+	if e.BackoffAfterUnchanged > 0 {
+		factor, maxInterval := e.BackoffFactor, e.MaxBackoffInterval
+		if factor <= 1 {
+			factor = defaultBackoffFactor
+		}
+		if maxInterval <= 0 {
+			maxInterval = defaultMaxBackoffInterval
+		}
+		strategy = &backoffStrategy{strategyWrapper: strategyWrapper{strategy}, after: e.BackoffAfterUnchanged, factor: factor, maxInterval: maxInterval}
+		strategy.initialize()
+	}
+
+	e.logger().Debug("Using strategy", "method", method, "strategy", strategy.name())
+	return strategy
+}
+
+// defaultStrategy creates the strategy that is used for all methods, unless
+// strategies are configured per method.
+func (e *ConfigurableValidityEstimator) defaultStrategy() estimationStrategy {
+	if e.Strategy != nil {
+		return e.Strategy.newInstance()
+	}
+	if e.config.MaxAgeStrategy == "" {
+		e.logCall("No max-age strategy configured, acting in passthrough mode")
 		return nil
 	}
 
-	if strings.HasPrefix(proxyMaxAge, "dynamic-") {
-		dynamicStrategySpecifiers := strings.Split(proxyMaxAge, "-")
-		strategyName := strings.Split(proxyMaxAge, "-")[1]
+	strategy, err := parseStrategy(e.config.MaxAgeStrategy)
+	if err != nil {
+		e.logger().Warn("Invalid max-age strategy, acting in passthrough mode", "error", err)
+		return nil
+	}
+	return strategy
+}
+
+// parseStrategy creates and initializes the strategy described by the
+// specification, e.g. "dynamic-adaptive-0.5". Specifications that cannot
+// be parsed are rejected with an error.
+func parseStrategy(spec string) (estimationStrategy, error) {
+	var strategy estimationStrategy
+
+	if strings.HasPrefix(spec, "dynamic-") {
+		dynamicStrategySpecifiers := strings.Split(spec, "-")
+		if len(dynamicStrategySpecifiers) < 3 {
+			return nil, fmt.Errorf("missing parameter for dynamic strategy %s", strconv.Quote(spec))
+		}
+		strategyName := dynamicStrategySpecifiers[1]
 		switch strategyName {
 		case "adaptive":
-			alphaStr := dynamicStrategySpecifiers[2]
-			alpha, err := strconv.ParseFloat(alphaStr, 64)
+			alpha, err := parseAlpha(spec, dynamicStrategySpecifiers)
 			if err != nil {
-				log.Printf("Failed to parse alpha parameter for Adaptive strategy (%s), acting in passthrough mode", alphaStr)
-				return nil
+				return nil, err
+			}
+
+			var window time.Duration
+			if len(dynamicStrategySpecifiers) > 3 {
+				windowStr := dynamicStrategySpecifiers[3]
+				seconds, err := strconv.Atoi(windowStr)
+				if err != nil {
+					return nil, fmt.Errorf("failed to parse window parameter for Adaptive strategy %s", strconv.Quote(spec))
+				}
+				window = time.Duration(seconds) * time.Second
 			}
 
-			strategy = &adaptiveStrategy{alpha: alpha}
+			strategy = &adaptiveStrategy{alpha: alpha, window: window}
+		case "interarrival":
+			alpha, err := parseAlpha(spec, dynamicStrategySpecifiers)
+			if err != nil {
+				return nil, err
+			}
+			strategy = &interArrivalStrategy{alpha: alpha}
+		case "header":
+			alpha, err := parseAlpha(spec, dynamicStrategySpecifiers)
+			if err != nil {
+				return nil, err
+			}
+			strategy = &headerStrategy{alpha: alpha}
+		case "etag":
+			alpha, err := parseAlpha(spec, dynamicStrategySpecifiers)
+			if err != nil {
+				return nil, err
+			}
+			strategy = &etagStrategy{alpha: alpha}
+		case "lastmodified":
+			alpha, err := parseAlpha(spec, dynamicStrategySpecifiers)
+			if err != nil {
+				return nil, err
+			}
+			strategy = &lastModifiedStrategy{alpha: alpha}
 		case "updaterisk":
 			rhoStr := dynamicStrategySpecifiers[2]
 			rho, err := strconv.ParseFloat(rhoStr, 64)
 			if err != nil {
-				log.Printf("Failed to parse rho parameter for Update-risk Based strategy (%s), acting in passthrough mode", rhoStr)
-				return nil
+				return nil, fmt.Errorf("failed to parse rho parameter for Update-risk Based strategy %s", strconv.Quote(spec))
+			}
+			if err := validateParam("rho", rho); err != nil {
+				return nil, fmt.Errorf("invalid rho parameter for Update-risk Based strategy %s: %v", strconv.Quote(spec), err)
 			}
 
 			strategy = &updateRiskBasedStrategy{rho: rho}
 		default:
-			log.Printf("Unknown dynamic strategy (%s), acting passthrough mode", strategyName)
-			return nil
+			return nil, fmt.Errorf("unknown dynamic strategy %s", strconv.Quote(spec))
 		}
-	} else if strings.HasPrefix(proxyMaxAge, "static-") {
-		ageSpecifier := strings.Split(proxyMaxAge, "-")[1]
+	} else if strings.HasPrefix(spec, "static-") {
+		ageSpecifier := strings.Split(spec, "-")[1]
 		maxAge, err := strconv.Atoi(ageSpecifier)
 		if err != nil {
-			log.Printf("Failed to parse PROXY_MAX_AGE (%s) into integer, acting in passthrough mode", ageSpecifier)
-			return nil
+			return nil, fmt.Errorf("failed to parse static max-age into integer in %s", strconv.Quote(spec))
 		}
 		strategy = &staticStrategy{ttl: time.Duration(maxAge) * time.Second}
+	} else if strings.HasPrefix(spec, "boundary-") {
+		periodSpecifier := strings.Split(spec, "-")[1]
+		period, err := strconv.Atoi(periodSpecifier)
+		if err != nil || period <= 0 {
+			return nil, fmt.Errorf("failed to parse boundary period into positive integer in %s", strconv.Quote(spec))
+		}
+		strategy = &boundaryStrategy{period: time.Duration(period) * time.Second}
 	} else {
-		log.Printf("Unknown value for PROXY_MAX_AGE=%s, acting in passthrough mode", proxyMaxAge)
-		return nil
+		return nil, fmt.Errorf("unknown strategy specification %s", strconv.Quote(spec))
 	}
 
 	strategy.initialize()
 
-	return strategy
+	return strategy, nil
+}
+
+// parseAlpha parses and validates the alpha parameter of a dynamic strategy,
+// which is its third specifier, e.g. 0.5 in "dynamic-adaptive-0.5".
+func parseAlpha(spec string, specifiers []string) (float64, error) {
+	alpha, err := strconv.ParseFloat(specifiers[2], 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse alpha parameter of strategy %s", strconv.Quote(spec))
+	}
+	if err := validateParam("alpha", alpha); err != nil {
+		return 0, fmt.Errorf("invalid alpha parameter of strategy %s: %v", strconv.Quote(spec), err)
+	}
+	return alpha, nil
 }
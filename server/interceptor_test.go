@@ -0,0 +1,529 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/patrickmn/go-cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+const testMethod = "/test.Service/Method"
+
+// headerCapture is a grpc.ServerTransportStream which records the headers
+// that the interceptor sets.
+type headerCapture struct {
+	header metadata.MD
+}
+
+func (s *headerCapture) Method() string {
+	return testMethod
+}
+
+func (s *headerCapture) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerCapture) SendHeader(md metadata.MD) error {
+	return s.SetHeader(md)
+}
+
+func (s *headerCapture) SetTrailer(md metadata.MD) error {
+	return nil
+}
+
+func newTestEstimator() *ConfigurableValidityEstimator {
+	e := &ConfigurableValidityEstimator{}
+	e.Initialize(log.New(ioutil.Discard, "", 0))
+	return e
+}
+
+// invoke runs the estimator's server interceptor for a single call, and
+// returns the headers that were set on the response.
+func invoke(e *ConfigurableValidityEstimator, req sample, resp sample) (metadata.MD, error) {
+	stream := &headerCapture{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return resp, nil
+	}
+
+	_, err := e.UnaryServerInterceptor()(ctx, req, info, handler)
+	return stream.header, err
+}
+
+// addVerifier stores a verifier for the given method and request, without
+// starting its goroutine or connecting it to an upstream.
+func addVerifier(e *ConfigurableValidityEstimator, method string, req proto.Message, expiration time.Time) *verifier {
+	v := &verifier{
+		method:               method,
+		req:                  req,
+		key:                  e.key(method, nil, req),
+		expiration:           expiration,
+		strategy:             &staticStrategy{ttl: 10 * time.Second},
+		records:              e.records,
+		done:                 e.done,
+		quit:                 make(chan struct{}),
+		stringRepresentation: method,
+	}
+	e.verifiers.Set(v.key, v, 0)
+	return v
+}
+
+// addFailingVerifier stores a verifier that has already finished, which
+// makes any attempt to estimate max-age using it fail.
+func addFailingVerifier(e *ConfigurableValidityEstimator, req sample) {
+	addVerifier(e, testMethod, req, time.Now().Add(-1*time.Second))
+}
+
+func TestEstimationErrorOmitsHeader(test *testing.T) {
+	e := newTestEstimator()
+	req := sample{value: "req"}
+	addFailingVerifier(e, req)
+
+	header, err := invoke(e, req, sample{value: "resp"})
+	if err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	if got := header.Get("cache-control"); len(got) != 0 {
+		test.Errorf("Wanted no cache-control header, got %v", got)
+	}
+	if got := e.Stats().EstimationErrors; got != 1 {
+		test.Errorf("Wanted 1 estimation error, got %d", got)
+	}
+}
+
+func TestEstimationErrorFallback(test *testing.T) {
+	e := newTestEstimator()
+	e.EstimationErrorPolicy = FallbackOnEstimationError
+	e.FallbackMaxAge = 3 * time.Second
+	req := sample{value: "req"}
+	addFailingVerifier(e, req)
+
+	header, err := invoke(e, req, sample{value: "resp"})
+	if err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	got := header.Get("cache-control")
+	if len(got) != 1 || got[0] != "must-revalidate, max-age=3" {
+		test.Errorf("Wanted fallback max-age of 3, got %v", got)
+	}
+	if got := e.Stats().EstimationErrors; got != 1 {
+		test.Errorf("Wanted 1 estimation error, got %d", got)
+	}
+}
+
+func TestEstimationErrorFails(test *testing.T) {
+	e := newTestEstimator()
+	e.EstimationErrorPolicy = FailOnEstimationError
+	req := sample{value: "req"}
+	addFailingVerifier(e, req)
+
+	header, err := invoke(e, req, sample{value: "resp"})
+	if err == nil {
+		test.Errorf("Wanted an error in strict mode, got none")
+	}
+	if got := header.Get("cache-control"); len(got) != 0 {
+		test.Errorf("Wanted no cache-control header, got %v", got)
+	}
+	if got := e.Stats().EstimationErrors; got != 1 {
+		test.Errorf("Wanted 1 estimation error, got %d", got)
+	}
+}
+
+func TestHandlerMarksResponseUncacheable(test *testing.T) {
+	e := newTestEstimator()
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+
+	stream := &headerCapture{}
+	ctx := grpc.NewContextWithServerTransportStream(context.Background(), stream)
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		grpc.SetHeader(ctx, metadata.Pairs(cacheableHeader, "false"))
+		return sample{value: "volatile"}, nil
+	}
+
+	_, err := e.UnaryServerInterceptor()(ctx, req, info, handler)
+	if err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	if got := stream.header.Get("cache-control"); len(got) != 0 {
+		test.Errorf("Wanted no cache-control header for uncacheable response, got %v", got)
+	}
+
+	header, err := invoke(e, req, sample{value: "stable"})
+	if err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	got := header.Get("cache-control")
+	if len(got) != 1 || got[0] != "must-revalidate, max-age=10" {
+		test.Errorf("Wanted max-age of 10 for cacheable response, got %v", got)
+	}
+}
+
+func TestStaleWhileRevalidateAdvertised(test *testing.T) {
+	e := newTestEstimator()
+	e.StaleWhileRevalidate = 30 * time.Second
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+
+	header, err := invoke(e, req, sample{value: "resp"})
+	if err != nil {
+		test.Errorf("Wanted no error, got %v", err)
+	}
+	got := header.Get("cache-control")
+	if len(got) != 1 || got[0] != "max-age=10, stale-while-revalidate=30" {
+		test.Errorf("Wanted soft and hard TTL advertised, got %v", got)
+	}
+}
+
+// maxAgeRecorder is a metrics.Recorder that remembers estimated max-ages.
+type maxAgeRecorder struct {
+	maxAges map[string][]time.Duration
+}
+
+func (r *maxAgeRecorder) CacheHit(method string) {}
+
+func (r *maxAgeRecorder) CacheMiss(method string) {}
+
+func (r *maxAgeRecorder) Saved(method string, bytes int, upstreamTime time.Duration) {}
+
+func (r *maxAgeRecorder) EstimatedMaxAge(method string, maxAge time.Duration) {
+	r.maxAges[method] = append(r.maxAges[method], maxAge)
+}
+
+func TestMetricsRecordEstimatedMaxAge(test *testing.T) {
+	recorder := &maxAgeRecorder{maxAges: make(map[string][]time.Duration)}
+	e := newTestEstimator()
+	e.Metrics = recorder
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Minute))
+
+	if _, err := invoke(e, req, sample{value: "resp"}); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	if got := recorder.maxAges[testMethod]; len(got) != 1 || got[0] != 10*time.Second {
+		test.Errorf("Wanted one estimated max-age of 10s, got %v", got)
+	}
+}
+
+func TestKeyFuncSharesVerifiers(test *testing.T) {
+	e := newTestEstimator()
+	e.KeyFunc = func(fullMethod string, req proto.Message) string {
+		// leave out the request ID before the separator
+		value := req.String()
+		return value[strings.Index(value, "|")+1:]
+	}
+	addVerifier(e, testMethod, sample{value: "id-1|query"}, time.Now().Add(time.Minute))
+
+	if needed, _ := e.verificationNeeded(testMethod, nil, sample{value: "id-2|query"}); needed {
+		test.Errorf("Wanted normalized request to share the verifier")
+	}
+	if needed, _ := e.verificationNeeded(testMethod, nil, sample{value: "id-1|other"}); !needed {
+		test.Errorf("Wanted a different query to need its own verifier")
+	}
+}
+
+func TestVaryKeysVerifiers(test *testing.T) {
+	e := newTestEstimator()
+	e.Vary = []string{"x-tenant-id", "accept-language"}
+	req := sample{value: "req"}
+
+	first := metadata.Pairs("x-tenant-id", "first")
+	second := metadata.Pairs("x-tenant-id", "second")
+	if e.key(testMethod, first, req) == e.key(testMethod, second, req) {
+		test.Errorf("Wanted keys for different tenants to differ")
+	}
+	if e.key(testMethod, nil, req) != e.key(testMethod, metadata.Pairs("x-tenant-id", ""), req) {
+		test.Errorf("Wanted missing metadata to key like empty metadata")
+	}
+
+	v := addVerifier(e, testMethod, req, time.Now().Add(time.Hour))
+	e.verifiers.Delete(v.key)
+	v.key = e.key(testMethod, first, req)
+	e.verifiers.Set(v.key, v, 0)
+
+	if needed, _ := e.verificationNeeded(testMethod, first, req); needed {
+		test.Errorf("Wanted the first tenant to have a verifier")
+	}
+	if needed, _ := e.verificationNeeded(testMethod, second, req); !needed {
+		test.Errorf("Wanted the second tenant to need its own verifier")
+	}
+}
+
+// metadataFetcher is a Fetcher that records the outgoing metadata it is
+// called with.
+type metadataFetcher struct {
+	md chan metadata.MD
+}
+
+func (f metadataFetcher) Fetch(ctx context.Context, method string, req, resp interface{}, opts ...grpc.CallOption) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	select {
+	case f.md <- md:
+	default:
+	}
+	return nil
+}
+
+func TestVerifiersSendVariedMetadata(test *testing.T) {
+	e := newTestEstimator()
+	e.Vary = []string{"accept-language"}
+	fetcher := metadataFetcher{md: make(chan metadata.MD, 1)}
+	e.Fetcher = fetcher
+
+	md := metadata.Pairs("accept-language", "sv", "authorization", "secret")
+	v, err := e.prepareVerifier("in-memory", testMethod, md, &wrappers.StringValue{Value: "req"}, time.Now().Add(time.Hour), &staticStrategy{})
+	if err != nil {
+		test.Fatalf("Wanted verifier, got %v", err)
+	}
+	v.responseArchetype = &wrappers.StringValue{}
+	if _, _, err := v.fetch(); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	sent := <-fetcher.md
+	if got := sent.Get("accept-language"); len(got) != 1 || got[0] != "sv" {
+		test.Errorf("Wanted the varied metadata sent upstream, got %v", sent)
+	}
+	if got := sent.Get("authorization"); len(got) != 0 {
+		test.Errorf("Wanted only the varied metadata sent upstream, got %v", sent)
+	}
+}
+
+func TestJitterStaysWithinBandAndAveragesToBase(test *testing.T) {
+	e := newTestEstimator()
+	e.TTLJitter = 0.1
+	base := 100 * time.Second
+
+	n := 10000
+	var sum time.Duration
+	for i := 0; i < n; i++ {
+		jittered := e.jitter(base)
+		if jittered < 90*time.Second || jittered > 110*time.Second {
+			test.Fatalf("Wanted max-age within 10%% of %v, got %v", base, jittered)
+		}
+		sum += jittered
+	}
+
+	if mean := sum / time.Duration(n); mean < 99*time.Second || mean > 101*time.Second {
+		test.Errorf("Wanted mean max-age of about %v, got %v", base, mean)
+	}
+}
+
+func TestJitterNeverNegative(test *testing.T) {
+	e := newTestEstimator()
+	e.TTLJitter = 5
+
+	for i := 0; i < 1000; i++ {
+		if jittered := e.jitter(10 * time.Second); jittered < 0 {
+			test.Fatalf("Wanted non-negative max-age, got %v", jittered)
+		}
+	}
+	if jittered := e.jitter(0); jittered != 0 {
+		test.Errorf("Wanted uncacheable responses left alone, got %v", jittered)
+	}
+}
+
+func TestJitterAppliedToCacheControl(test *testing.T) {
+	e := newTestEstimator()
+	e.TTLJitter = 0.5
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+
+	seen := make(map[string]bool)
+	for i := 0; i < 50; i++ {
+		header, err := invoke(e, req, sample{value: "resp"})
+		if err != nil {
+			test.Fatalf("Wanted no error, got %v", err)
+		}
+		for _, value := range header.Get("cache-control") {
+			seen[value] = true
+		}
+	}
+
+	if len(seen) < 2 {
+		test.Errorf("Wanted jittered max-ages, got %v", seen)
+	}
+}
+
+func TestMaxAgeClampedToMinAndMaxTTL(test *testing.T) {
+	cases := []struct {
+		estimate time.Duration
+		minTTL   time.Duration
+		maxTTL   time.Duration
+		wanted   string
+	}{
+		{10 * time.Second, 30 * time.Second, time.Hour, "must-revalidate, max-age=30"},
+		{5 * time.Hour, 30 * time.Second, time.Hour, "must-revalidate, max-age=3600"},
+		{10 * time.Minute, 30 * time.Second, time.Hour, "must-revalidate, max-age=600"},
+		{5 * time.Hour, 0, 0, "must-revalidate, max-age=18000"},
+		{0, 30 * time.Second, time.Hour, "must-revalidate, max-age=0"},
+	}
+
+	for _, c := range cases {
+		e := newTestEstimator()
+		e.MinTTL = c.minTTL
+		e.MaxTTL = c.maxTTL
+		req := sample{value: "req"}
+		v := addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+		v.strategy = &staticStrategy{ttl: c.estimate}
+
+		header, err := invoke(e, req, sample{value: "resp"})
+		if err != nil {
+			test.Errorf("Wanted no error, got %v", err)
+			continue
+		}
+		if got := header.Get("cache-control"); len(got) != 1 || got[0] != c.wanted {
+			test.Errorf("Wanted %q for %v estimate within [%v, %v], got %v", c.wanted, c.estimate, c.minTTL, c.maxTTL, got)
+		}
+	}
+}
+
+func TestSizeBasedTTLModifier(test *testing.T) {
+	e := newTestEstimator()
+	e.MaxTTL = 15 * time.Second
+	e.SizeBasedTTLModifier = func(respSize int, baseTTL time.Duration) time.Duration {
+		if respSize > 10 {
+			return 2 * baseTTL
+		}
+		return baseTTL
+	}
+	req := &wrappers.StringValue{Value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Hour))
+
+	small, _ := e.estimateMaxAge(testMethod, nil, req, &wrappers.StringValue{Value: "small"})
+	if small != 10*time.Second {
+		test.Errorf("Wanted 10s for a small response, got %v", small)
+	}
+
+	e.MaxTTL = 0
+	large, _ := e.estimateMaxAge(testMethod, nil, req, &wrappers.StringValue{Value: "a rather large response"})
+	if large != 20*time.Second {
+		test.Errorf("Wanted 20s for a large response, got %v", large)
+	}
+
+	e.MaxTTL = 15 * time.Second
+	if clamped, _ := e.estimateMaxAge(testMethod, nil, req, &wrappers.StringValue{Value: "a rather large response"}); clamped != 15*time.Second {
+		test.Errorf("Wanted the modified max-age clamped to 15s, got %v", clamped)
+	}
+}
+
+func TestResponseSizeOfStreams(test *testing.T) {
+	messages := []proto.Message{&wrappers.StringValue{Value: "one"}, &wrappers.StringValue{Value: "two"}}
+	if got, wanted := responseSize(&streamResponse{messages: messages}), proto.Size(messages[0])+proto.Size(messages[1]); got != wanted {
+		test.Errorf("Wanted %d bytes, got %d", wanted, got)
+	}
+}
+
+func TestObserveOnlyOmitsHeaderButLogs(test *testing.T) {
+	var csv strings.Builder
+	e := &ConfigurableValidityEstimator{}
+	e.Initialize(log.New(&csv, "", 0))
+	e.ObserveOnly = true
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Hour))
+
+	header, err := invoke(e, req, sample{value: "resp"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := header.Get("cache-control"); len(got) != 0 {
+		test.Errorf("Wanted no cache-control in observe-only mode, got %v", got)
+	}
+
+	records := strings.Split(strings.TrimSpace(csv.String()), "\n")
+	if len(records) < 2 || !strings.Contains(records[1], ","+clientSource+","+testMethod) {
+		test.Errorf("Wanted the estimate logged to CSV, got %q", csv.String())
+	}
+}
+
+func TestCacheableResponsePredicateRejectsEmptyResults(test *testing.T) {
+	e := newTestEstimator()
+	e.CacheableResponsePredicate = func(resp proto.Message) bool {
+		return resp.(sample).value != ""
+	}
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Hour))
+
+	header, err := invoke(e, req, sample{value: ""})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := header.Get("cache-control"); len(got) != 0 {
+		test.Errorf("Wanted no cache-control for empty results, got %v", got)
+	}
+
+	header, _ = invoke(e, req, sample{value: "results"})
+	if got := header.Get("cache-control"); len(got) != 1 {
+		test.Errorf("Wanted cache-control for non-empty results, got %v", got)
+	}
+}
+
+func TestCacheableResponsePredicateCoversStreamedMessages(test *testing.T) {
+	e := newTestEstimator()
+	e.CacheableResponsePredicate = func(resp proto.Message) bool {
+		return resp.(*wrappers.StringValue).Value != ""
+	}
+
+	full := &streamResponse{messages: []proto.Message{&wrappers.StringValue{Value: "a"}, &wrappers.StringValue{Value: "b"}}}
+	if !e.cacheableResponse(full) {
+		test.Errorf("Wanted a stream of non-empty messages to be cacheable")
+	}
+	partial := &streamResponse{messages: []proto.Message{&wrappers.StringValue{Value: "a"}, &wrappers.StringValue{}}}
+	if e.cacheableResponse(partial) {
+		test.Errorf("Wanted a stream with an empty message to be rejected")
+	}
+}
+
+func TestMinSamplesDefersCaching(test *testing.T) {
+	e := newTestEstimator()
+	e.MinSamples = 3
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Hour))
+
+	for i := 1; i <= 3; i++ {
+		header, err := invoke(e, req, sample{value: "resp"})
+		if err != nil {
+			test.Fatalf("Wanted no error, got %v", err)
+		}
+		got := header.Get("cache-control")
+		if i < 3 && len(got) != 0 {
+			test.Errorf("Wanted no cache-control for call %d, got %v", i, got)
+		}
+		if i == 3 && (len(got) != 1 || got[0] != "must-revalidate, max-age=10") {
+			test.Errorf("Wanted max-age=10 once warmed up, got %v", got)
+		}
+	}
+}
+
+func TestInitializeWithCacheStoresVerifiersInIt(test *testing.T) {
+	verifiers := cache.New(time.Minute, time.Second)
+	strategy, _ := Static().WithTTL(10 * time.Second).Build()
+	e := &ConfigurableValidityEstimator{Strategy: strategy}
+	e.InitializeWithCache(verifiers, log.New(ioutil.Discard, "", 0))
+	defer e.Shutdown(context.Background())
+
+	req := &wrappers.StringValue{Value: "req"}
+	if !e.startVerification("localhost:0", testMethod, nil, req, &wrappers.StringValue{Value: "resp"}, nil) {
+		test.Fatalf("Wanted a verifier to be created")
+	}
+
+	if got := verifiers.ItemCount(); got != 1 {
+		test.Fatalf("Wanted the verifier in the injected cache, got %d items", got)
+	}
+	value, found := verifiers.Get(e.key(testMethod, nil, req))
+	if !found || value.(*verifier).method != testMethod {
+		test.Errorf("Wanted the verifier of %s stored under its key, got %v", testMethod, value)
+	}
+}
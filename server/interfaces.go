@@ -1,19 +1,89 @@
 package server
 
 import (
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
 )
 
 type estimationStrategy interface {
+	name() string
 	initialize()
-	update(timestamp time.Time, reply proto.Message)
+	update(timestamp time.Time, reply proto.Message) error
+	// determineInterval returns the time until the next verification,
+	// zero if the strategy cannot tell yet, or a negative duration if it
+	// never verifies.
 	determineInterval() time.Duration
 	determineEstimation() time.Duration
 }
 
+// arrivalObserver is implemented by strategies that take into account when
+// clients ask for responses.
+type arrivalObserver interface {
+	observeArrival(timestamp time.Time)
+}
+
+// changeTracker is implemented by strategies that keep track of when the
+// response last changed.
+type changeTracker interface {
+	lastChange() time.Time
+}
+
+// headerObserver is implemented by strategies that take into account the
+// headers that the upstream service sends along with its responses.
+type headerObserver interface {
+	observeHeader(timestamp time.Time, header metadata.MD)
+}
+
+// tunable is implemented by strategies whose parameters may be changed
+// while they are in use. An error means that the strategy lacks the named
+// parameter.
+type tunable interface {
+	setParam(name string, value float64) error
+}
+
+// strategyWrapper is embedded by strategies that wrap another strategy to
+// change how its estimations are used, such as those of Confirmations,
+// Cooldown and BackoffAfterUnchanged, and passes the optional interfaces
+// above through to the wrapped strategy. Wrappers pass every update on to
+// the wrapped strategy, and always ask it for its estimation, even when
+// they discard it, since it may keep state based on its own estimations.
+type strategyWrapper struct {
+	strategy estimationStrategy
+}
+
+func (w strategyWrapper) observeArrival(timestamp time.Time) {
+	if observer, ok := w.strategy.(arrivalObserver); ok {
+		observer.observeArrival(timestamp)
+	}
+}
+
+func (w strategyWrapper) observeHeader(timestamp time.Time, header metadata.MD) {
+	if observer, ok := w.strategy.(headerObserver); ok {
+		observer.observeHeader(timestamp, header)
+	}
+}
+
+func (w strategyWrapper) setParam(name string, value float64) error {
+	if t, ok := w.strategy.(tunable); ok {
+		return t.setParam(name, value)
+	}
+	return fmt.Errorf("%s has no parameter %q", w.strategy.name(), name)
+}
+
+func (w strategyWrapper) lastChange() time.Time {
+	if tracker, ok := w.strategy.(changeTracker); ok {
+		return tracker.lastChange()
+	}
+	return time.Time{}
+}
+
 // A ValidityEstimator hooks into the server side, and performs estimation of
 // how long responses may be stored in cache.
 type ValidityEstimator interface {
@@ -28,3 +98,53 @@ type ValidityEstimator interface {
 	// more accurate by polling the origin server.
 	UnaryClientInterceptor() grpc.UnaryClientInterceptor
 }
+
+// pollingInterval is how long the dynamic strategies wait between
+// verifications: half of the last estimation, in whole seconds, but never
+// less than the minimum interval, which defaults to defaultInterval.
+func pollingInterval(lastEstimation time.Duration, minInterval time.Duration) time.Duration {
+	if minInterval <= 0 {
+		minInterval = defaultInterval
+	}
+	interval := (lastEstimation / 2).Truncate(time.Second)
+	if interval < minInterval {
+		return minInterval
+	}
+	return interval
+}
+
+// generatedMessage is implemented by the messages that protoc-gen-go
+// generates, which can be encoded deterministically.
+type generatedMessage interface {
+	XXX_Size() int
+}
+
+// responseHash hashes a response, so that the strategies can tell if it has
+// changed. The String of a message is not meant to be stable, e.g. in the
+// order of map entries, so generated messages are hashed by their
+// deterministic encoding instead, and streams by that of their messages.
+// Responses of seeded verifiers, whose type is not known, are hashed by
+// their wire format, so that they compare equal to the same response once
+// decoded. Other messages are hashed by their String.
+func responseHash(reply proto.Message) int {
+	if stream, ok := reply.(*streamResponse); ok {
+		parts := make([]string, len(stream.messages))
+		for i, message := range stream.messages {
+			parts[i] = strconv.Itoa(responseHash(message))
+		}
+		return hashing.String(strings.Join(parts, ","))
+	}
+
+	if raw, ok := reply.(*rawResponse); ok {
+		return hashing.String(string(raw.data))
+	}
+
+	if _, ok := reply.(generatedMessage); ok {
+		buf := proto.NewBuffer(nil)
+		buf.SetDeterministic(true)
+		if err := buf.Marshal(reply); err == nil {
+			return hashing.String(string(buf.Bytes()))
+		}
+	}
+	return hashing.String(reply.String())
+}
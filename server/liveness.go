@@ -0,0 +1,28 @@
+package server
+
+import "time"
+
+// verificationObserver returns a function that records that a response of
+// the method has just been verified against the upstream service.
+func (e *ConfigurableValidityEstimator) verificationObserver(method string) func(time.Time) {
+	return func(timestamp time.Time) {
+		e.verifiedMux.Lock()
+		defer e.verifiedMux.Unlock()
+		if e.verified == nil {
+			e.verified = make(map[string]time.Time)
+		}
+		if timestamp.After(e.verified[method]) {
+			e.verified[method] = timestamp
+		}
+	}
+}
+
+// LastVerified returns when a response of the method was last verified
+// against the upstream service, either by a verifier or by a call that went
+// upstream. If no response of the method has been verified, found is false.
+func (e *ConfigurableValidityEstimator) LastVerified(method string) (timestamp time.Time, found bool) {
+	e.verifiedMux.Lock()
+	defer e.verifiedMux.Unlock()
+	timestamp, found = e.verified[method]
+	return timestamp, found
+}
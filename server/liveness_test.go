@@ -0,0 +1,63 @@
+package server
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// switchableFetcher is a Fetcher that answers until it is made to fail.
+type switchableFetcher struct {
+	failing *int32
+}
+
+func (f switchableFetcher) Fetch(ctx context.Context, method string, req, resp interface{}, opts ...grpc.CallOption) error {
+	if atomic.LoadInt32(f.failing) != 0 {
+		return status.Errorf(codes.Unavailable, "Upstream unreachable")
+	}
+	proto.Merge(resp.(proto.Message), &wrappers.StringValue{Value: "resp"})
+	return nil
+}
+
+func TestLastVerifiedStopsWhenVerificationFails(test *testing.T) {
+	var failing int32
+	e := newTestEstimator()
+	e.Fetcher = switchableFetcher{failing: &failing}
+
+	if _, found := e.LastVerified(testMethod); found {
+		test.Errorf("Wanted no verification before any verifier")
+	}
+
+	strategy := &pollingStrategy{&staticStrategy{ttl: 10 * time.Second}}
+	v, err := e.newVerifier("upstream", testMethod, &wrappers.StringValue{Value: "req"}, &wrappers.StringValue{Value: "resp"}, time.Now().Add(time.Hour), strategy)
+	if err != nil {
+		test.Fatalf("Unable to create verifier: %v", err)
+	}
+	defer v.stop()
+
+	first, found := e.LastVerified(testMethod)
+	if !found {
+		test.Fatalf("Wanted the initial update to count as verification")
+	}
+
+	time.Sleep(50 * time.Millisecond)
+	polled, _ := e.LastVerified(testMethod)
+	if !polled.After(first) {
+		test.Errorf("Wanted polling to verify responses after %v, last verified %v", first, polled)
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	time.Sleep(20 * time.Millisecond)
+	stopped, _ := e.LastVerified(testMethod)
+	time.Sleep(50 * time.Millisecond)
+	if last, _ := e.LastVerified(testMethod); !last.Equal(stopped) {
+		test.Errorf("Wanted no verification while upstream fails, last verified %v, then %v", stopped, last)
+	}
+}
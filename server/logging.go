@@ -0,0 +1,38 @@
+package server
+
+import (
+	"log/slog"
+	"math/rand"
+)
+
+// logger returns the Logger of the estimator, or the default one.
+func (e *ConfigurableValidityEstimator) logger() *slog.Logger {
+	if e.Logger != nil {
+		return e.Logger
+	}
+	return slog.Default()
+}
+
+// logCall logs a record of a call that went as expected, if the call is
+// sampled according to LogSampleRate.
+func (e *ConfigurableValidityEstimator) logCall(msg string, args ...interface{}) {
+	if sampled(e.LogSampleRate) {
+		e.logger().Info(msg, args...)
+	}
+}
+
+// sampled is a predicate that indicates if a call is sampled for logging at
+// the rate, where zero means that all calls are, and below zero that none
+// are.
+func sampled(rate float64) bool {
+	return rate == 0 || (rate > 0 && rand.Float64() < rate)
+}
+
+// logger returns the logger of the verifier, whose records note the method
+// of the request that it verifies.
+func (v *verifier) logger() *slog.Logger {
+	if v.logs != nil {
+		return v.logs
+	}
+	return slog.Default().With("method", v.method)
+}
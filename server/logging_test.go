@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+)
+
+// messageCounter is a slog.Handler which counts the records it handles by
+// their message.
+type messageCounter struct {
+	counts map[string]int
+	mux    sync.Mutex
+}
+
+func (h *messageCounter) Enabled(context.Context, slog.Level) bool { return true }
+
+func (h *messageCounter) Handle(ctx context.Context, record slog.Record) error {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	if h.counts == nil {
+		h.counts = make(map[string]int)
+	}
+	h.counts[record.Message]++
+	return nil
+}
+
+func (h *messageCounter) WithAttrs([]slog.Attr) slog.Handler { return h }
+
+func (h *messageCounter) WithGroup(string) slog.Handler { return h }
+
+func (h *messageCounter) count(message string) int {
+	h.mux.Lock()
+	defer h.mux.Unlock()
+	return h.counts[message]
+}
+
+func TestLogSampleRate(test *testing.T) {
+	records := &messageCounter{}
+	e := newTestEstimator()
+	e.Logger = slog.New(records)
+
+	invoke(e, sample{value: "req"}, sample{value: "resp"})
+	if got := records.count("Responded from upstream"); got != 1 {
+		test.Errorf("Wanted every call logged by default, got %d records", got)
+	}
+
+	e.LogSampleRate = -1
+	invoke(e, sample{value: "req"}, sample{value: "resp"})
+	if got := records.count("Responded from upstream"); got != 1 {
+		test.Errorf("Wanted no further records with sampling disabled, got %d", got-1)
+	}
+
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	failing := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, errors.New("down")
+	}
+	if _, err := e.UnaryServerInterceptor()(context.Background(), sample{value: "req"}, info, failing); err == nil {
+		test.Fatalf("Wanted the upstream error, got none")
+	}
+	if got := records.count("Upstream call failed"); got != 1 {
+		test.Errorf("Wanted the failure to be logged, got %d records", got)
+	}
+}
+
+func TestStrategyLogsGoToLogger(test *testing.T) {
+	records := &messageCounter{}
+	e := newTestEstimator()
+	e.Logger = slog.New(records)
+	e.StrategyConfig = &StrategyConfig{Methods: []MethodStrategy{{Pattern: "Config$", Strategy: "dynamic-bogus-1"}}}
+	e.loadStrategyConfig()
+
+	if strategy := e.newStrategy(configMethod); strategy != nil {
+		test.Fatalf("Wanted passthrough for an invalid strategy, got %v", strategy)
+	}
+	if got := records.count("Invalid strategy specification, acting in passthrough mode"); got != 1 {
+		test.Errorf("Wanted the invalid strategy logged, got %d records", got)
+	}
+
+	e.newStrategy(otherMethod)
+	if got := records.count("No strategy configured, acting in passthrough mode"); got != 1 {
+		test.Errorf("Wanted the passthrough logged, got %d records", got)
+	}
+	e.LogSampleRate = -1
+	e.newStrategy(otherMethod)
+	if got := records.count("No strategy configured, acting in passthrough mode"); got != 1 {
+		test.Errorf("Wanted no further records with sampling disabled, got %d", got-1)
+	}
+}
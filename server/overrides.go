@@ -0,0 +1,83 @@
+package server
+
+import (
+	"regexp"
+	"sort"
+	"time"
+)
+
+// durationOverride is a compiled entry of a map from methods to durations,
+// such as MaxAgeOverrides.
+type durationOverride struct {
+	pattern  *regexp.Regexp
+	duration time.Duration
+}
+
+// compileOverrides compiles the patterns of MaxAgeOverrides and
+// VerifierLifetimeOverrides.
+func (e *ConfigurableValidityEstimator) compileOverrides() {
+	e.overrides = e.compileDurationOverrides(e.MaxAgeOverrides, "max-age")
+	e.lifetimeOverrides = e.compileDurationOverrides(e.VerifierLifetimeOverrides, "verifier lifetime")
+}
+
+// compileDurationOverrides compiles the patterns of the overrides. Invalid
+// ones are left out. Patterns are tried in lexical order, so that the
+// outcome does not depend on the iteration order of the map.
+func (e *ConfigurableValidityEstimator) compileDurationOverrides(overrides map[string]time.Duration, what string) []durationOverride {
+	patterns := make([]string, 0, len(overrides))
+	for pattern := range overrides {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var compiled []durationOverride
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			e.logger().Warn("Ignoring override", "override", what, "pattern", pattern, "error", err)
+			continue
+		}
+		compiled = append(compiled, durationOverride{pattern: re, duration: overrides[pattern]})
+	}
+	return compiled
+}
+
+// overriddenDuration returns the duration that the overrides give the
+// method, if any. A key that is exactly the method wins over patterns that
+// match it.
+func overriddenDuration(overrides map[string]time.Duration, compiled []durationOverride, method string) (time.Duration, bool) {
+	if duration, found := overrides[method]; found {
+		return duration, true
+	}
+	for _, override := range compiled {
+		if override.pattern.MatchString(method) {
+			return override.duration, true
+		}
+	}
+	return 0, false
+}
+
+// overriddenMaxAge returns the max-age that overrides estimation for the
+// method, if any. A key of MaxAgeOverrides that is exactly the method wins
+// over patterns that match it.
+func (e *ConfigurableValidityEstimator) overriddenMaxAge(method string) (time.Duration, bool) {
+	return overriddenDuration(e.MaxAgeOverrides, e.overrides, method)
+}
+
+// verifierLifetime returns how long verifiers of the method run, from
+// VerifierLifetimeOverrides, or VerifierLifetime.
+func (e *ConfigurableValidityEstimator) verifierLifetime(method string) time.Duration {
+	if lifetime, found := overriddenDuration(e.VerifierLifetimeOverrides, e.lifetimeOverrides, method); found && lifetime > 0 {
+		return lifetime
+	}
+	return e.defaultVerifierLifetime()
+}
+
+// defaultVerifierLifetime returns how long verifiers of methods without an
+// override run.
+func (e *ConfigurableValidityEstimator) defaultVerifierLifetime() time.Duration {
+	if e.VerifierLifetime > 0 {
+		return e.VerifierLifetime
+	}
+	return maxVerifierLifetime
+}
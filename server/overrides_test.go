@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestMaxAgeOverrideSkipsEstimation(test *testing.T) {
+	e := &ConfigurableValidityEstimator{MaxAgeOverrides: map[string]time.Duration{testMethod: 300 * time.Second}}
+	e.InitializeWithConfig(Config{MaxAgeStrategy: "static-10"}, log.New(ioutil.Discard, "", 0))
+
+	header, err := invoke(e, sample{value: "req"}, sample{value: "resp"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := header.Get("cache-control"); len(got) != 1 || got[0] != "must-revalidate, max-age=300" {
+		test.Errorf("Wanted overridden max-age of 300, got %v", got)
+	}
+
+	req := &wrappers.StringValue{Value: "req"}
+	if e.startVerification("localhost:0", testMethod, nil, req, &wrappers.StringValue{Value: "resp"}, nil) {
+		test.Errorf("Wanted no verifier for overridden method")
+	}
+	if got := e.verifiers.ItemCount(); got != 0 {
+		test.Errorf("Wanted no verifiers, got %d", got)
+	}
+}
+
+func TestMaxAgeOverridePatterns(test *testing.T) {
+	e := &ConfigurableValidityEstimator{MaxAgeOverrides: map[string]time.Duration{
+		"^/config\\.Service/":    300 * time.Second,
+		"^/config\\.Service/Get": 60 * time.Second,
+		"/config.Service/Watch":  0,
+		"[":                      time.Second,
+	}}
+	e.InitializeWithConfig(Config{}, log.New(ioutil.Discard, "", 0))
+
+	cases := []struct {
+		method     string
+		maxAge     time.Duration
+		overridden bool
+	}{
+		// patterns are tried in lexical order
+		{"/config.Service/Get", 300 * time.Second, true},
+		{"/config.Service/List", 300 * time.Second, true},
+		// exact method names win over patterns
+		{"/config.Service/Watch", 0, true},
+		{testMethod, 0, false},
+	}
+
+	for _, c := range cases {
+		maxAge, overridden := e.overriddenMaxAge(c.method)
+		if maxAge != c.maxAge || overridden != c.overridden {
+			test.Errorf("Wanted %v (%v) for %s, got %v (%v)", c.maxAge, c.overridden, c.method, maxAge, overridden)
+		}
+	}
+}
+
+func TestVerifierLifetimeIsConfigurable(test *testing.T) {
+	e := &ConfigurableValidityEstimator{
+		VerifierLifetime:          time.Hour,
+		VerifierLifetimeOverrides: map[string]time.Duration{"^/short\\.Service/": time.Minute},
+	}
+	e.InitializeWithConfig(Config{MaxAgeStrategy: "static-10"}, log.New(ioutil.Discard, "", 0))
+	defer e.Shutdown(context.Background())
+
+	cases := []struct {
+		method   string
+		lifetime time.Duration
+	}{
+		{testMethod, time.Hour},
+		{"/short.Service/Get", time.Minute},
+	}
+	for _, c := range cases {
+		if _, lifetime := e.verificationNeeded(c.method, nil, sample{value: "req"}); lifetime != c.lifetime {
+			test.Errorf("Wanted lifetime %s for %s, got %s", c.lifetime, c.method, lifetime)
+		}
+	}
+
+	req := &wrappers.StringValue{Value: "req"}
+	before := time.Now()
+	if !e.startVerification("localhost:0", "/short.Service/Get", nil, req, &wrappers.StringValue{Value: "resp"}, nil) {
+		test.Fatalf("Wanted a verifier to be created")
+	}
+	v, _ := e.verifiers.Get(e.key("/short.Service/Get", nil, req))
+	if expiration := v.(*verifier).expiration; expiration.Before(before.Add(time.Minute)) || expiration.After(time.Now().Add(time.Minute)) {
+		test.Errorf("Wanted the verifier to expire in a minute, got %s", time.Until(expiration))
+	}
+
+	if lifetime := (&ConfigurableValidityEstimator{}).verifierLifetime(testMethod); lifetime != maxVerifierLifetime {
+		test.Errorf("Wanted default lifetime %s, got %s", maxVerifierLifetime, lifetime)
+	}
+}
@@ -0,0 +1,111 @@
+package server
+
+import (
+	"fmt"
+)
+
+// validateParam checks that the value is within the range of the named
+// strategy parameter.
+func validateParam(name string, value float64) error {
+	switch name {
+	case "alpha":
+		if value <= 0 || value > 1 {
+			return fmt.Errorf("alpha must be in (0, 1], got %v", value)
+		}
+	case "rho":
+		if value <= 0 || value >= 1 {
+			return fmt.Errorf("rho must be in (0, 1), got %v", value)
+		}
+	default:
+		return fmt.Errorf("unknown strategy parameter %q", name)
+	}
+	return nil
+}
+
+// SetStrategyParam changes a strategy parameter, "alpha" or "rho", for all
+// methods. Both the strategies of running verifiers and those created later
+// use the new value, and running verifiers keep the history they have
+// observed so far. Strategies that lack the parameter are left unchanged.
+func (e *ConfigurableValidityEstimator) SetStrategyParam(name string, value float64) error {
+	return e.setStrategyParam("", name, value)
+}
+
+// SetMethodStrategyParam is like SetStrategyParam, but only changes the
+// parameter for the given method. It takes precedence over values set for
+// all methods.
+func (e *ConfigurableValidityEstimator) SetMethodStrategyParam(method string, name string, value float64) error {
+	if method == "" {
+		return fmt.Errorf("no method given")
+	}
+	return e.setStrategyParam(method, name, value)
+}
+
+func (e *ConfigurableValidityEstimator) setStrategyParam(method string, name string, value float64) error {
+	if err := validateParam(name, value); err != nil {
+		return err
+	}
+
+	e.paramsMux.Lock()
+	if e.params == nil {
+		e.params = make(map[string]map[string]float64)
+	}
+	if e.params[method] == nil {
+		e.params[method] = make(map[string]float64)
+	}
+	e.params[method][name] = value
+	e.paramsMux.Unlock()
+
+	if e.verifiers == nil {
+		return nil
+	}
+
+	changed := 0
+	for _, item := range e.verifiers.Items() {
+		v := item.Object.(*verifier)
+		if method != "" && v.method != method {
+			continue
+		}
+		if method == "" && e.methodOverrides(v.method, name) {
+			continue
+		}
+		if t, ok := v.strategy.(tunable); ok && t.setParam(name, value) == nil {
+			changed++
+		}
+	}
+
+	if method == "" {
+		e.logger().Info("Set strategy parameter for all methods", "param", name, "value", value, "verifiers_changed", changed)
+	} else {
+		e.logger().Info("Set strategy parameter", "method", method, "param", name, "value", value, "verifiers_changed", changed)
+	}
+	return nil
+}
+
+// methodOverrides is a predicate that indicates if the parameter has been
+// set specifically for the method.
+func (e *ConfigurableValidityEstimator) methodOverrides(method string, name string) bool {
+	e.paramsMux.Lock()
+	defer e.paramsMux.Unlock()
+	_, found := e.params[method][name]
+	return found
+}
+
+// applyParams sets the parameters that have been changed at runtime on a
+// newly created strategy.
+func (e *ConfigurableValidityEstimator) applyParams(method string, strategy estimationStrategy) {
+	t, ok := strategy.(tunable)
+	if !ok {
+		return
+	}
+
+	e.paramsMux.Lock()
+	defer e.paramsMux.Unlock()
+	for name, value := range e.params[""] {
+		if _, found := e.params[method][name]; !found {
+			t.setParam(name, value)
+		}
+	}
+	for name, value := range e.params[method] {
+		t.setParam(name, value)
+	}
+}
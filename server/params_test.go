@@ -0,0 +1,84 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSetStrategyParamChangesRunningEstimates(test *testing.T) {
+	e := newTestEstimator()
+	v := addVerifier(e, testMethod, sample{value: "req"}, time.Now().Add(time.Minute))
+
+	newer := time.Now().Add(-50 * time.Second)
+	strategy := &updateRiskBasedStrategy{
+		rho:               0.1,
+		olderModification: time.Now().Add(-100 * time.Second),
+		newerModification: newer,
+		responseHash:      42,
+		observedUpdates:   2,
+	}
+	v.strategy = strategy
+
+	before := strategy.determineEstimation()
+
+	if err := e.SetStrategyParam("rho", 0.5); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	after := strategy.determineEstimation()
+	if after <= before {
+		test.Errorf("Wanted estimate above %v after raising rho, got %v", before, after)
+	}
+	if strategy.observedUpdates != 2 || !strategy.newerModification.Equal(newer) || strategy.responseHash != 42 {
+		test.Errorf("Wanted history to be kept, got %d updates, last at %v", strategy.observedUpdates, strategy.newerModification)
+	}
+}
+
+func TestSetStrategyParamValidatesRange(test *testing.T) {
+	e := newTestEstimator()
+
+	tests := []struct {
+		name  string
+		value float64
+	}{
+		{"alpha", 0},
+		{"alpha", 1.5},
+		{"rho", 0},
+		{"rho", 1},
+		{"rho", -0.1},
+		{"beta", 0.5},
+	}
+	for _, tt := range tests {
+		if err := e.SetStrategyParam(tt.name, tt.value); err == nil {
+			test.Errorf("Wanted error for %s = %v, got none", tt.name, tt.value)
+		}
+	}
+
+	if err := e.SetStrategyParam("alpha", 1); err != nil {
+		test.Errorf("Wanted alpha = 1 to be accepted, got %v", err)
+	}
+}
+
+func TestMethodStrategyParamTakesPrecedence(test *testing.T) {
+	e := newTestEstimator()
+	other := "/test.Service/Other"
+
+	if err := e.SetStrategyParam("rho", 0.2); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if err := e.SetMethodStrategyParam(testMethod, "rho", 0.7); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	strategy := &updateRiskBasedStrategy{rho: 0.1}
+	e.applyParams(testMethod, strategy)
+	if strategy.rho != 0.7 {
+		test.Errorf("Wanted rho 0.7 for %s, got %v", testMethod, strategy.rho)
+	}
+
+	strategy = &updateRiskBasedStrategy{rho: 0.1}
+	e.applyParams(other, strategy)
+	if strategy.rho != 0.2 {
+		test.Errorf("Wanted rho 0.2 for %s, got %v", other, strategy.rho)
+	}
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"sort"
+)
+
+// passthroughMethod counts the requests of a method that were passed
+// through uncached, because there was no estimation strategy for it.
+type passthroughMethod struct {
+	requests uint64
+	// whether the method had no strategy the last time one was created
+	active bool
+}
+
+// passedThrough counts a request of the method that is passed through
+// uncached, since no estimation strategy could be created for it.
+func (e *ConfigurableValidityEstimator) passedThrough(method string) {
+	e.passthroughMux.Lock()
+	defer e.passthroughMux.Unlock()
+	if e.passthrough == nil {
+		e.passthrough = make(map[string]*passthroughMethod)
+	}
+	state, found := e.passthrough[method]
+	if !found {
+		state = &passthroughMethod{}
+		e.passthrough[method] = state
+	}
+	if !state.active {
+		e.logger().Info("No estimation strategy, passing requests through uncached", "method", method)
+	}
+	state.requests++
+	state.active = true
+}
+
+// strategyCreated notes that the method has an estimation strategy, e.g.
+// after the strategy configuration was reloaded, so it is no longer passed
+// through.
+func (e *ConfigurableValidityEstimator) strategyCreated(method string) {
+	e.passthroughMux.Lock()
+	defer e.passthroughMux.Unlock()
+	if state, found := e.passthrough[method]; found {
+		state.active = false
+	}
+}
+
+// passthroughStats returns the number of requests passed through per
+// method, and the methods that are currently passed through.
+func (e *ConfigurableValidityEstimator) passthroughStats() (map[string]uint64, []string) {
+	e.passthroughMux.Lock()
+	defer e.passthroughMux.Unlock()
+	if len(e.passthrough) == 0 {
+		return nil, nil
+	}
+
+	requests := make(map[string]uint64, len(e.passthrough))
+	var active []string
+	for method, state := range e.passthrough {
+		requests[method] = state.requests
+		if state.active {
+			active = append(active, method)
+		}
+	}
+	sort.Strings(active)
+	return requests, active
+}
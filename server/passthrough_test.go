@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestPassthroughIsCounted(test *testing.T) {
+	e := &ConfigurableValidityEstimator{}
+	e.InitializeWithConfig(Config{}, log.New(ioutil.Discard, "", 0))
+	defer e.Shutdown(context.Background())
+
+	if stats := e.Stats(); stats.PassthroughRequests != nil || stats.PassthroughMethods != nil {
+		test.Errorf("Wanted no passthrough before any request, got %v and %v", stats.PassthroughRequests, stats.PassthroughMethods)
+	}
+
+	req := &wrappers.StringValue{Value: "req"}
+	resp := &wrappers.StringValue{Value: "resp"}
+	for i := 0; i < 2; i++ {
+		if e.startVerification("localhost:0", testMethod, nil, req, resp, nil) {
+			test.Fatalf("Wanted no verifier without a strategy")
+		}
+	}
+
+	stats := e.Stats()
+	if got := stats.PassthroughRequests[testMethod]; got != 2 {
+		test.Errorf("Wanted 2 requests passed through, got %d", got)
+	}
+	if got := stats.PassthroughMethods; len(got) != 1 || got[0] != testMethod {
+		test.Errorf("Wanted %s in passthrough, got %v", testMethod, got)
+	}
+
+	strategy, _ := Static().WithTTL(10 * time.Second).Build()
+	e.Strategy = strategy
+	if !e.startVerification("localhost:0", testMethod, nil, req, resp, nil) {
+		test.Fatalf("Wanted a verifier once there is a strategy")
+	}
+	stats = e.Stats()
+	if got := stats.PassthroughMethods; len(got) != 0 {
+		test.Errorf("Wanted no method in passthrough once there is a strategy, got %v", got)
+	}
+	if got := stats.PassthroughRequests[testMethod]; got != 2 {
+		test.Errorf("Wanted the passed through requests still counted, got %d", got)
+	}
+}
@@ -0,0 +1,49 @@
+package server
+
+import "time"
+
+// recordRequest notes that a client asked for the verifier's response at
+// the given time, and returns the rate at which clients ask for it, in
+// requests per second. The rate is the inverse of a moving average of the
+// times between requests, weighted like that of the Inter-arrival strategy,
+// and zero until there have been two requests.
+func (v *verifier) recordRequest(timestamp time.Time) float64 {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if !v.lastRequest.IsZero() {
+		interRequest := timestamp.Sub(v.lastRequest)
+		if v.meanInterRequest == 0 {
+			v.meanInterRequest = interRequest
+		} else {
+			mean := interArrivalWeight*float64(interRequest) + (1-interArrivalWeight)*float64(v.meanInterRequest)
+			v.meanInterRequest = time.Duration(mean)
+		}
+	}
+	v.lastRequest = timestamp
+	v.requests++
+
+	return v.rate()
+}
+
+// requestRate returns the rate at which clients ask for the verifier's
+// response, like recordRequest, without noting a request.
+func (v *verifier) requestRate() float64 {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	return v.rate()
+}
+
+// rate computes the request rate. The caller must hold the lock.
+func (v *verifier) rate() float64 {
+	if v.requests < 2 {
+		return 0
+	}
+	// requests that arrive at the same instant are as hot as it gets
+	mean := v.meanInterRequest
+	if mean <= 0 {
+		mean = time.Nanosecond
+	}
+	return float64(time.Second) / float64(mean)
+}
@@ -0,0 +1,54 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestRequestRate(test *testing.T) {
+	v := &verifier{}
+	t := time.Now()
+	if rate := v.recordRequest(t); rate != 0 {
+		test.Errorf("Wanted no rate after a single request, got %v", rate)
+	}
+	for i := 0; i < 10; i++ {
+		t = t.Add(500 * time.Millisecond)
+		v.recordRequest(t)
+	}
+	if rate := v.recordRequest(t.Add(500 * time.Millisecond)); rate < 1.99 || rate > 2.01 {
+		test.Errorf("Wanted 2 requests per second, got %v", rate)
+	}
+}
+
+func TestRateAwareTTLModifierShortensColdKeys(test *testing.T) {
+	e := newTestEstimator()
+	e.RateAwareTTLModifier = func(requestsPerSecond float64, baseTTL time.Duration) time.Duration {
+		if requestsPerSecond < 1 {
+			return baseTTL / 5
+		}
+		return baseTTL
+	}
+	hot := &wrappers.StringValue{Value: "hot"}
+	cold := &wrappers.StringValue{Value: "cold"}
+	addVerifier(e, testMethod, hot, time.Now().Add(time.Hour))
+	addVerifier(e, testMethod, cold, time.Now().Add(time.Hour))
+	resp := &wrappers.StringValue{Value: "resp"}
+
+	var hotTTL time.Duration
+	for i := 0; i < 5; i++ {
+		hotTTL, _ = e.estimateMaxAge(testMethod, nil, hot, resp)
+	}
+	// asked for once an hour ago, and once now
+	value, _ := e.verifiers.Get(e.key(testMethod, nil, cold))
+	value.(*verifier).recordRequest(time.Now().Add(-time.Hour))
+	coldTTL, _ := e.estimateMaxAge(testMethod, nil, cold, resp)
+
+	if hotTTL != 10*time.Second {
+		test.Errorf("Wanted the full 10s for a hot key, got %v", hotTTL)
+	}
+	if coldTTL != 2*time.Second {
+		test.Errorf("Wanted a shortened 2s for a cold key, got %v", coldTTL)
+	}
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"log/slog"
+)
+
+// The formats in which estimates can be written to the log given to
+// Initialize.
+const (
+	// CSVLogFormat writes a header line, followed by a comma-separated
+	// line for each estimate.
+	CSVLogFormat = "csv"
+	// JSONLinesLogFormat writes a JSON object on a line of its own for
+	// each estimate.
+	JSONLinesLogFormat = "jsonl"
+)
+
+// estimateRecord is an estimate, as written to the estimate log.
+type estimateRecord struct {
+	// Timestamp is when the estimate was made, in nanoseconds since the
+	// epoch.
+	Timestamp int64 `json:"timestamp"`
+	// Source is where the response came from, a verifier or a client.
+	Source string `json:"source"`
+	// Method identifies the method and request that was estimated.
+	Method          string `json:"method"`
+	EstimateSeconds int    `json:"estimate_seconds"`
+}
+
+// recordEncoder writes estimates to a log in some format.
+type recordEncoder interface {
+	// writeHeader writes whatever the format needs before the first
+	// record.
+	writeHeader()
+	// write a single record.
+	write(record estimateRecord)
+}
+
+// newRecordEncoder returns an encoder of the given format writing to the
+// log. An empty format means CSV. Records that cannot be encoded are logged
+// to the logger instead.
+func newRecordEncoder(format string, out *log.Logger, logs *slog.Logger) (recordEncoder, error) {
+	switch format {
+	case "", CSVLogFormat:
+		return csvEncoder{out: out}, nil
+	case JSONLinesLogFormat:
+		return jsonLinesEncoder{out: out, logs: logs}, nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// csvEncoder writes records as comma-separated values.
+type csvEncoder struct {
+	out *log.Logger
+}
+
+func (enc csvEncoder) writeHeader() {
+	enc.out.Printf("timestamp,source,method,estimate\n")
+}
+
+func (enc csvEncoder) write(record estimateRecord) {
+	enc.out.Printf("%d,%s,%s,%d\n", record.Timestamp, record.Source, record.Method, record.EstimateSeconds)
+}
+
+// jsonLinesEncoder writes records as JSON objects, one per line.
+type jsonLinesEncoder struct {
+	out  *log.Logger
+	logs *slog.Logger
+}
+
+func (enc jsonLinesEncoder) writeHeader() {}
+
+func (enc jsonLinesEncoder) write(record estimateRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		enc.logs.Warn("Unable to encode estimate record", "error", err)
+		return
+	}
+	enc.out.Printf("%s\n", line)
+}
@@ -0,0 +1,99 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// decodeCSV reads back the records written by a csvEncoder.
+func decodeCSV(test *testing.T, written string) []estimateRecord {
+	rows, err := csv.NewReader(strings.NewReader(written)).ReadAll()
+	if err != nil {
+		test.Fatalf("Wanted valid CSV, got %v", err)
+	}
+	if len(rows) == 0 || strings.Join(rows[0], ",") != "timestamp,source,method,estimate" {
+		test.Fatalf("Wanted a header line, got %q", written)
+	}
+
+	var records []estimateRecord
+	for _, row := range rows[1:] {
+		timestamp, _ := strconv.ParseInt(row[0], 10, 64)
+		estimate, _ := strconv.Atoi(row[3])
+		records = append(records, estimateRecord{Timestamp: timestamp, Source: row[1], Method: row[2], EstimateSeconds: estimate})
+	}
+	return records
+}
+
+// decodeJSONLines reads back the records written by a jsonLinesEncoder.
+func decodeJSONLines(test *testing.T, written string) []estimateRecord {
+	var records []estimateRecord
+	for _, line := range strings.Split(strings.TrimSpace(written), "\n") {
+		var record estimateRecord
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			test.Fatalf("Wanted a JSON object per line, got %q: %v", line, err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestLogFormatsRoundTrip(test *testing.T) {
+	records := []estimateRecord{
+		{Timestamp: 1600000000000000000, Source: clientSource, Method: testMethod + "(42)", EstimateSeconds: 10},
+		{Timestamp: 1600000001000000000, Source: verifierSource, Method: testMethod + "(42)", EstimateSeconds: 0},
+	}
+
+	for format, decode := range map[string]func(*testing.T, string) []estimateRecord{
+		CSVLogFormat:       decodeCSV,
+		JSONLinesLogFormat: decodeJSONLines,
+	} {
+		var written strings.Builder
+		enc, err := newRecordEncoder(format, log.New(&written, "", 0), nil)
+		if err != nil {
+			test.Fatalf("Wanted an encoder for %s, got %v", format, err)
+		}
+		enc.writeHeader()
+		for _, record := range records {
+			enc.write(record)
+		}
+
+		got := decode(test, written.String())
+		if len(got) != len(records) {
+			test.Fatalf("Wanted %d %s records, got %d", len(records), format, len(got))
+		}
+		for i := range records {
+			if got[i] != records[i] {
+				test.Errorf("Wanted %s record %+v, got %+v", format, records[i], got[i])
+			}
+		}
+	}
+}
+
+func TestEstimatorLogsJSONLines(test *testing.T) {
+	var written strings.Builder
+	e := &ConfigurableValidityEstimator{}
+	if err := e.InitializeWithConfig(Config{LogFormat: JSONLinesLogFormat}, log.New(&written, "", 0)); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Hour))
+	invoke(e, req, sample{value: "resp"})
+
+	got := decodeJSONLines(test, written.String())
+	if len(got) != 1 || got[0].Source != clientSource || got[0].Method != testMethod || got[0].EstimateSeconds != 10 {
+		test.Errorf("Wanted a single JSON record of the estimate, got %+v", got)
+	}
+}
+
+func TestUnknownLogFormatRejected(test *testing.T) {
+	e := &ConfigurableValidityEstimator{}
+	if err := e.InitializeWithConfig(Config{LogFormat: "xml"}, log.New(ioutil.Discard, "", 0)); err == nil {
+		test.Errorf("Wanted an unknown log format to be rejected")
+	}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// SeedVerifier creates and starts a verifier for the method and request
+// ahead of any client call, so that estimations are available before real
+// traffic arrives. The initial response is fetched from the upstream
+// service at target. Seeding a request that is already being verified does
+// nothing.
+func (e *ConfigurableValidityEstimator) SeedVerifier(ctx context.Context, target, method string, req proto.Message) error {
+	if e.blacklisted(method) {
+		return status.Errorf(codes.FailedPrecondition, "Method %s is blacklisted from caching", method)
+	}
+	if !e.whitelisted(method) {
+		return status.Errorf(codes.FailedPrecondition, "Method %s is not whitelisted for caching", method)
+	}
+
+	// the metadata that the initial response is fetched with
+	md, _ := metadata.FromOutgoingContext(ctx)
+	needed, expiration := e.verificationNeeded(method, md, req)
+	if !needed {
+		return nil
+	}
+
+	strategy := e.newStrategy(method)
+	if strategy == nil {
+		return status.Errorf(codes.FailedPrecondition, "No estimation strategy for %s", method)
+	}
+
+	v, err := e.prepareVerifier(target, method, md, req, time.Now().Add(expiration), strategy)
+	if err != nil {
+		return err
+	}
+
+	// The response type of the method is not known here, so the response
+	// is kept in its wire format, until the first client call shows the
+	// type (see adoptResponseType).
+	resp := &rawResponse{}
+	var header metadata.MD
+	if err := v.fetcher.Fetch(ctx, method, req, resp, grpc.ForceCodec(rawCodec{}), grpc.Header(&header)); err != nil {
+		v.logger().Warn("Failed to fetch initial response", "error", err)
+		v.close()
+		return err
+	}
+
+	if err := e.startVerifier(v, resp, header); err != nil {
+		return err
+	}
+
+	if err := e.verifiers.Add(v.key, v, expiration); err != nil {
+		v.stop()
+		return err
+	}
+
+	v.logger().Info("Seeded verifier")
+	return nil
+}
+
+// rawResponse is a response of unknown type, in its wire format.
+type rawResponse struct {
+	data []byte
+}
+
+func (r *rawResponse) Reset() {
+	r.data = nil
+}
+
+func (r *rawResponse) String() string {
+	return fmt.Sprintf("%x", r.data)
+}
+
+func (r *rawResponse) ProtoMessage() {}
+
+func (r *rawResponse) Merge(src proto.Message) {
+	r.data = append([]byte(nil), src.(*rawResponse).data...)
+}
+
+// rawCodec marshals requests as usual, but leaves responses of unknown type
+// in their wire format.
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error) {
+	if raw, ok := v.(*rawResponse); ok {
+		return raw.data, nil
+	}
+	return proto.Marshal(v.(proto.Message))
+}
+
+func (rawCodec) Unmarshal(data []byte, v interface{}) error {
+	if raw, ok := v.(*rawResponse); ok {
+		raw.data = append([]byte(nil), data...)
+		return nil
+	}
+	return proto.Unmarshal(data, v.(proto.Message))
+}
+
+func (rawCodec) Name() string {
+	return "proto"
+}
@@ -0,0 +1,128 @@
+package server
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+// startUpstream serves testMethod on a local port, always answering with
+// the same response.
+func startUpstream(test *testing.T, resp string) (string, func()) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		test.Fatalf("Unable to listen: %v", err)
+	}
+
+	return listener.Addr().String(), serveUpstream(listener, func() string { return resp })
+}
+
+// serveUpstream serves testMethod on the listener, answering with whatever
+// respond returns at the time.
+func serveUpstream(listener net.Listener, respond func() string, opts ...grpc.ServerOption) func() {
+	server := grpc.NewServer(opts...)
+	server.RegisterService(&grpc.ServiceDesc{
+		ServiceName: "test.Service",
+		HandlerType: (*interface{})(nil),
+		Methods: []grpc.MethodDesc{{
+			MethodName: "Method",
+			Handler: func(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+				req := &wrappers.StringValue{}
+				if err := dec(req); err != nil {
+					return nil, err
+				}
+				return &wrappers.StringValue{Value: respond()}, nil
+			},
+		}},
+	}, struct{}{})
+	go server.Serve(listener)
+
+	return server.Stop
+}
+
+func TestSeedVerifierEstimatesWithoutClientCall(test *testing.T) {
+	target, stop := startUpstream(test, "resp")
+	defer stop()
+
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	req := &wrappers.StringValue{Value: "req"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.SeedVerifier(ctx, target, testMethod, req); err != nil {
+		test.Fatalf("Wanted verifier to be seeded, got %v", err)
+	}
+
+	value, found := e.verifiers.Get(hash(testMethod, req))
+	if !found {
+		test.Fatalf("Wanted a verifier for the seeded request")
+	}
+	v := value.(*verifier)
+	defer v.stop()
+
+	if got := v.observationCount(); got != 1 {
+		test.Errorf("Wanted the initial response to be observed, got %d observations", got)
+	}
+	if got, _ := v.estimate(); got != 10*time.Second {
+		test.Errorf("Wanted 10 second estimate, got %v", got)
+	}
+
+	if err := e.SeedVerifier(ctx, target, testMethod, req); err != nil {
+		test.Errorf("Wanted seeding twice to do nothing, got %v", err)
+	}
+	if got := e.verifiers.ItemCount(); got != 1 {
+		test.Errorf("Wanted 1 verifier, got %d", got)
+	}
+}
+
+func TestSeededVerifierAdoptsResponseType(test *testing.T) {
+	target, stop := startUpstream(test, "resp")
+	defer stop()
+
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "dynamic-adaptive-0.5"}
+	e.loadStrategyConfig()
+	req := &wrappers.StringValue{Value: "req"}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.SeedVerifier(ctx, target, testMethod, req); err != nil {
+		test.Fatalf("Wanted verifier to be seeded, got %v", err)
+	}
+	value, found := e.verifiers.Get(hash(testMethod, req))
+	if !found {
+		test.Fatalf("Wanted a verifier for the seeded request")
+	}
+	v := value.(*verifier)
+	defer v.stop()
+	seeded := v.strategy.(changeTracker).lastChange()
+
+	time.Sleep(10 * time.Millisecond)
+	result, err := e.estimateDetail(testMethod, nil, req, &wrappers.StringValue{Value: "resp"})
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := v.strategy.(changeTracker).lastChange(); !got.Equal(seeded) {
+		test.Errorf("Wanted the identical client response to be no change, got change at %v", got)
+	}
+	if result.RawTTL < 5*time.Millisecond {
+		test.Errorf("Wanted the estimate to keep growing, got %v", result.RawTTL)
+	}
+
+	// polls now decode the real type, which is no change either
+	if err := v.verify(); err != nil {
+		test.Fatalf("Wanted verification to succeed, got %v", err)
+	}
+	if _, ok := v.lastReply.(*wrappers.StringValue); !ok {
+		test.Errorf("Wanted polls to fetch the response type, got %T", v.lastReply)
+	}
+	if got := v.strategy.(changeTracker).lastChange(); !got.Equal(seeded) {
+		test.Errorf("Wanted the polled response to be no change, got change at %v", got)
+	}
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"context"
+	"os/signal"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// errShutDown is returned when verifiers are to be started after Shutdown.
+var errShutDown = status.Errorf(codes.Unavailable, "Estimator has been shut down")
+
+// Shutdown stops all verifiers, closing their connections to the upstream
+// service, along with the background work of the estimator, and waits for
+// the verifiers to exit. No verifiers are started afterwards, so responses
+// are no longer estimated to be cacheable. If the context is done before
+// all verifiers have exited, its error is returned.
+func (e *ConfigurableValidityEstimator) Shutdown(ctx context.Context) error {
+	e.liveMux.Lock()
+	if !e.shutDown {
+		e.shutDown = true
+		if e.quit != nil {
+			close(e.quit)
+		}
+		if e.hangups != nil {
+			signal.Stop(e.hangups)
+		}
+	}
+	live := make([]*verifier, 0, len(e.live))
+	for v := range e.live {
+		live = append(live, v)
+	}
+	e.liveMux.Unlock()
+
+	e.logger().Info("Shutting down, stopping verifiers", "verifiers", len(live))
+	for _, v := range live {
+		e.verifiers.Delete(v.key)
+		v.stop()
+	}
+
+	exited := make(chan struct{})
+	go func() {
+		e.running.Wait()
+		close(exited)
+	}()
+
+	select {
+	case <-exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// track the verifier as live until its goroutine exits, which it does by
+// calling the returned function. Verifiers are not tracked after Shutdown,
+// and must then not be started.
+func (e *ConfigurableValidityEstimator) track(v *verifier) (func(), error) {
+	e.liveMux.Lock()
+	defer e.liveMux.Unlock()
+
+	if e.shutDown {
+		return nil, errShutDown
+	}
+	if e.live == nil {
+		e.live = make(map[*verifier]struct{})
+	}
+	e.live[v] = struct{}{}
+	e.running.Add(1)
+
+	return func() {
+		e.liveMux.Lock()
+		delete(e.live, v)
+		e.liveMux.Unlock()
+		e.running.Done()
+	}, nil
+}
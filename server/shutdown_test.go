@@ -0,0 +1,69 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+func TestShutdownStopsVerifiers(test *testing.T) {
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+
+	target, stop := startUpstream(test, "resp")
+	defer stop()
+
+	for i := 0; i < 3; i++ {
+		req := &wrappers.StringValue{Value: fmt.Sprintf("req-%d", i)}
+		if !e.startVerification(target, testMethod, nil, req, &wrappers.StringValue{Value: "resp"}, nil) {
+			test.Fatalf("Wanted verifier for %s", req.Value)
+		}
+	}
+	if got := e.Stats().VerifierConnections; got != 1 {
+		test.Fatalf("Wanted 1 verifier connection, got %d", got)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		test.Fatalf("Wanted verifiers to exit, got %v", err)
+	}
+
+	if got := e.Stats().VerifierConnections; got != 0 {
+		test.Errorf("Wanted no verifier connections after shutdown, got %d", got)
+	}
+	if got := e.verifiers.ItemCount(); got != 0 {
+		test.Errorf("Wanted no verifiers after shutdown, got %d", got)
+	}
+	if len(e.live) != 0 {
+		test.Errorf("Wanted no running verifiers after shutdown, got %d", len(e.live))
+	}
+
+	if e.startVerification(target, testMethod, nil, &wrappers.StringValue{Value: "late"}, &wrappers.StringValue{Value: "resp"}, nil) {
+		test.Errorf("Wanted no verifiers to start after shutdown")
+	}
+	if got := e.Stats().VerifierFailures; got != 0 {
+		test.Errorf("Wanted shutdown not to count as verifier failures, got %d", got)
+	}
+}
+
+func TestShutdownRespectsContext(test *testing.T) {
+	e := newTestEstimator()
+
+	// a verifier whose goroutine never exits
+	untrack, err := e.track(&verifier{quit: make(chan struct{})})
+	if err != nil {
+		test.Fatalf("Wanted verifier to be tracked, got %v", err)
+	}
+	defer untrack()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != context.DeadlineExceeded {
+		test.Errorf("Wanted %v, got %v", context.DeadlineExceeded, err)
+	}
+}
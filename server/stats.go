@@ -0,0 +1,60 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
+)
+
+// EstimatorStats contains counters that describe how the estimator has
+// behaved so far.
+type EstimatorStats struct {
+	// EstimationErrors is the number of times max-age estimation failed.
+	EstimationErrors uint64
+	// VerifierFailures is the number of times a verifier could not be
+	// created.
+	VerifierFailures uint64
+	// VerifierConnections is the number of connections to the upstream
+	// service currently held by verifiers, which share a connection per
+	// target.
+	VerifierConnections uint64
+	// Verifiers is the number of verifiers currently kept.
+	Verifiers int
+	// DegradedMethods are the methods whose verifiers have failed to be
+	// created at least VerifierFailureThreshold times in a row.
+	DegradedMethods []string
+	// Convergence holds, per method, a histogram of the time in seconds it
+	// took new verifiers to produce their first cacheable estimate.
+	Convergence map[string]metrics.HistogramSnapshot
+	// PassthroughRequests counts, per method, the requests that were
+	// passed through uncached, because no estimation strategy was
+	// configured for the method, e.g. since PROXY_MAX_AGE is unset or
+	// invalid.
+	PassthroughRequests map[string]uint64
+	// PassthroughMethods are the methods whose requests are currently
+	// passed through for lack of an estimation strategy.
+	PassthroughMethods []string
+}
+
+// Stats returns a snapshot of the estimator's counters.
+func (e *ConfigurableValidityEstimator) Stats() EstimatorStats {
+	passthroughRequests, passthroughMethods := e.passthroughStats()
+	return EstimatorStats{
+		EstimationErrors:    atomic.LoadUint64(&e.estimationErrors),
+		VerifierFailures:    atomic.LoadUint64(&e.verifierFailures),
+		VerifierConnections: atomic.LoadUint64(&e.verifierConnections),
+		Verifiers:           e.verifierCount(),
+		DegradedMethods:     e.degradedMethods(),
+		Convergence:         e.convergenceSnapshots(),
+		PassthroughRequests: passthroughRequests,
+		PassthroughMethods:  passthroughMethods,
+	}
+}
+
+// verifierCount returns the number of verifiers currently kept.
+func (e *ConfigurableValidityEstimator) verifierCount() int {
+	if e.verifiers == nil {
+		return 0
+	}
+	return e.verifiers.ItemCount()
+}
@@ -1,21 +1,29 @@
 package server
 
 import (
-	"log"
-	"math"
+	"fmt"
 	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hashicorp/terraform/helper/hashcode"
 )
 
 type adaptiveStrategy struct {
 	alpha float64
+	// window is how long a changed response must persist before it is
+	// accepted as a modification. Zero accepts changes immediately.
+	window time.Duration
+	// minInterval is the shortest time between verifications. Zero means
+	// defaultInterval.
+	minInterval time.Duration
 
 	lastModification time.Time
 	responseHash     int
 
+	// a changed response that has not yet persisted for the window
+	pendingHash  int
+	pendingSince time.Time
+
 	lastEstimation time.Duration
 
 	mux sync.Mutex
@@ -24,36 +32,78 @@ type adaptiveStrategy struct {
 // compile-time check that we adhere to interface
 var _ estimationStrategy = (*adaptiveStrategy)(nil)
 
-func (strat *adaptiveStrategy) initialize() {
-	log.Printf("Using Adaptive TTL strategy with alpha=%f", strat.alpha)
+func (strat *adaptiveStrategy) name() string {
+	if strat.window > 0 {
+		return fmt.Sprintf("adaptive(alpha=%v, window=%s)", strat.alpha, strat.window)
+	}
+	return fmt.Sprintf("adaptive(alpha=%v)", strat.alpha)
+}
 
+func (strat *adaptiveStrategy) initialize() {
 	strat.lastModification = time.Now()
 	strat.responseHash = 11
+	strat.pendingHash = -1
 
 	strat.lastEstimation = 0
 }
 
-func (strat *adaptiveStrategy) update(timestamp time.Time, reply proto.Message) {
-	incomingHash := hashcode.String(reply.String())
+func (strat *adaptiveStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
 	strat.mux.Lock()
-	if incomingHash != strat.responseHash {
+	defer strat.mux.Unlock()
+
+	if incomingHash == strat.responseHash {
+		// Unchanged, or reverted before the change persisted.
+		strat.pendingHash = -1
+		return nil
+	}
+
+	if strat.window <= 0 {
 		strat.lastModification = timestamp
 		strat.responseHash = incomingHash
+		return nil
 	}
-	strat.mux.Unlock()
+
+	if incomingHash != strat.pendingHash {
+		strat.pendingHash = incomingHash
+		strat.pendingSince = timestamp
+	} else if timestamp.Sub(strat.pendingSince) >= strat.window {
+		strat.lastModification = strat.pendingSince
+		strat.responseHash = incomingHash
+		strat.pendingHash = -1
+	}
+
+	return nil
+}
+
+func (strat *adaptiveStrategy) lastChange() time.Time {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return strat.lastModification
 }
 
 func (strat *adaptiveStrategy) determineInterval() time.Duration {
-	bounded := math.Max(strat.lastEstimation.Seconds()/2.0, defaultInterval.Seconds())
-	return time.Duration(bounded) * time.Second
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return pollingInterval(strat.lastEstimation, strat.minInterval)
 }
 
 func (strat *adaptiveStrategy) determineEstimation() time.Duration {
-	estimatedTTL := float64(time.Now().Sub(strat.lastModification).Nanoseconds()) * strat.alpha
-
 	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	estimatedTTL := float64(time.Now().Sub(strat.lastModification).Nanoseconds()) * strat.alpha
 	strat.lastEstimation = time.Duration(int64(estimatedTTL))
-	strat.mux.Unlock()
 
 	return strat.lastEstimation
 }
+
+func (strat *adaptiveStrategy) setParam(name string, value float64) error {
+	if name != "alpha" {
+		return fmt.Errorf("%s has no parameter %q", strat.name(), name)
+	}
+	strat.mux.Lock()
+	strat.alpha = value
+	strat.mux.Unlock()
+	return nil
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/proto"
+	structpb "github.com/golang/protobuf/ptypes/struct"
 )
 
 type mockMessage interface {
@@ -92,3 +93,73 @@ func TestAdaptiveWithChange(test *testing.T) {
 		test.Errorf("Wanted 5 second TTL, got %v", got)
 	}
 }
+
+func TestAdaptiveWindowIgnoresTransientChange(test *testing.T) {
+	transient := []string{"0", "0", "0", "0", "0", "0", "0", "0", "0", "0", "1", "0", "0", "0"}
+
+	windowed := &adaptiveStrategy{alpha: 0.5, window: 5 * time.Second}
+	windowed.initialize()
+	immediate := &adaptiveStrategy{alpha: 0.5}
+	immediate.initialize()
+
+	t := time.Now().Add(-20 * time.Second)
+	for _, value := range transient {
+		windowed.update(t, sample{value: value})
+		immediate.update(t, sample{value: value})
+		t = t.Add(1 * time.Second)
+	}
+
+	if got := windowed.determineEstimation(); int(got.Seconds()) != 10 {
+		test.Errorf("Wanted 10 second TTL with transient change ignored, got %v", got)
+	}
+	if got := immediate.determineEstimation(); int(got.Seconds()) != 4 {
+		test.Errorf("Wanted 4 second TTL with transient change accepted, got %v", got)
+	}
+}
+
+func TestAdaptiveWindowAcceptsPersistentChange(test *testing.T) {
+	strat := &adaptiveStrategy{alpha: 0.5, window: 5 * time.Second}
+	strat.initialize()
+
+	t := time.Now().Add(-20 * time.Second)
+	for i := 0; i < 10; i++ {
+		strat.update(t, sample{value: "0"})
+		t = t.Add(1 * time.Second)
+	}
+	changed := t
+	for i := 0; i < 10; i++ {
+		strat.update(t, sample{value: "1"})
+		t = t.Add(1 * time.Second)
+	}
+
+	if got := strat.lastChange(); !got.Equal(changed) {
+		test.Errorf("Wanted persistent change at %v to be accepted, got %v", changed, got)
+	}
+}
+
+// mapMessage builds a message with map entries, inserted in the given order.
+func mapMessage(keys ...string) *structpb.Struct {
+	message := &structpb.Struct{Fields: make(map[string]*structpb.Value)}
+	for _, key := range keys {
+		message.Fields[key] = &structpb.Value{Kind: &structpb.Value_StringValue{StringValue: key}}
+	}
+	return message
+}
+
+func TestAdaptiveIgnoresMapOrder(test *testing.T) {
+	strat := &adaptiveStrategy{alpha: 0.5}
+	strat.initialize()
+
+	first := time.Now().Add(-10 * time.Second)
+	strat.update(first, mapMessage("a", "b", "c", "d"))
+	strat.update(first.Add(5*time.Second), mapMessage("d", "c", "b", "a"))
+
+	if got := strat.lastChange(); !got.Equal(first) {
+		test.Errorf("Wanted equal messages not to count as a change, got last change at %v", got)
+	}
+
+	strat.update(first.Add(6*time.Second), mapMessage("a", "b"))
+	if got := strat.lastChange(); !got.Equal(first.Add(6 * time.Second)) {
+		test.Errorf("Wanted a different message to count as a change, got last change at %v", got)
+	}
+}
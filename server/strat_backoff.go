@@ -0,0 +1,78 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// backoffStrategy wraps another strategy, and verifies responses that have
+// stayed the same for a while less and less often. Once a number of
+// consecutive responses have been unchanged, each further unchanged one
+// multiplies the interval of the wrapped strategy by a factor, up to a cap.
+// The first change goes back to the interval of the wrapped strategy.
+type backoffStrategy struct {
+	strategyWrapper
+	after       int
+	factor      float64
+	maxInterval time.Duration
+
+	responseHash int
+	unchanged    int
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*backoffStrategy)(nil)
+
+func (strat *backoffStrategy) name() string {
+	return fmt.Sprintf("backoff(after=%d, factor=%v, max=%v, %s)", strat.after, strat.factor, strat.maxInterval, strat.strategy.name())
+}
+
+func (strat *backoffStrategy) initialize() {
+	strat.responseHash = -1
+	strat.unchanged = 0
+}
+
+func (strat *backoffStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
+	strat.mux.Lock()
+	if incomingHash == strat.responseHash {
+		strat.unchanged++
+	} else {
+		strat.responseHash = incomingHash
+		strat.unchanged = 0
+	}
+	strat.mux.Unlock()
+
+	return strat.strategy.update(timestamp, reply)
+}
+
+func (strat *backoffStrategy) determineInterval() time.Duration {
+	interval := strat.strategy.determineInterval()
+	if interval <= 0 {
+		// never verifying, or not ready to
+		return interval
+	}
+
+	strat.mux.Lock()
+	steps := strat.unchanged - strat.after + 1
+	strat.mux.Unlock()
+	if steps <= 0 || interval >= strat.maxInterval {
+		return interval
+	}
+
+	backedOff := float64(interval) * math.Pow(strat.factor, float64(steps))
+	if backedOff >= float64(strat.maxInterval) {
+		return strat.maxInterval
+	}
+	return time.Duration(backedOff)
+}
+
+func (strat *backoffStrategy) determineEstimation() time.Duration {
+	return strat.strategy.determineEstimation()
+}
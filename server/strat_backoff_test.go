@@ -0,0 +1,52 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBackoffGrowsWhileStableAndResetsOnChange(test *testing.T) {
+	inner := &adaptiveStrategy{alpha: 0.5, minInterval: time.Second}
+	inner.initialize()
+	strat := &backoffStrategy{strategyWrapper: strategyWrapper{inner}, after: 2, factor: 2, maxInterval: 10 * time.Second}
+	strat.initialize()
+
+	values := []string{"0", "0", "0", "0", "0", "0", "0", "1", "1"}
+	wanted := []time.Duration{1, 1, 2, 4, 8, 10, 10, 1, 1}
+
+	t := time.Now()
+	for i, value := range values {
+		strat.update(t, sample{value: value})
+		t = t.Add(time.Second)
+
+		if got := strat.determineInterval(); got != wanted[i]*time.Second {
+			test.Errorf("Wanted %ds interval after observation %d, got %v", wanted[i], i, got)
+		}
+	}
+}
+
+func TestBackoffLeavesNonVerifyingStrategiesAlone(test *testing.T) {
+	strat := &backoffStrategy{strategyWrapper: strategyWrapper{&staticStrategy{ttl: time.Minute}}, after: 1, factor: 2, maxInterval: time.Minute}
+	strat.initialize()
+
+	for i := 0; i < 5; i++ {
+		strat.update(time.Now(), sample{value: "0"})
+	}
+	if got := strat.determineInterval(); got >= 0 {
+		test.Errorf("Wanted a strategy that never verifies to stay that way, got %v", got)
+	}
+}
+
+func TestBackoffConfiguredByEstimator(test *testing.T) {
+	e := newTestEstimator()
+	e.Strategy, _ = Static().WithTTL(10 * time.Second).Build()
+	e.BackoffAfterUnchanged = 3
+
+	strat, ok := e.newStrategy(testMethod).(*backoffStrategy)
+	if !ok {
+		test.Fatalf("Wanted a backoff strategy")
+	}
+	if strat.after != 3 || strat.factor != defaultBackoffFactor || strat.maxInterval != defaultMaxBackoffInterval {
+		test.Errorf("Wanted defaults for the factor and cap, got %+v", strat)
+	}
+}
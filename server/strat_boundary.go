@@ -0,0 +1,53 @@
+package server
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// boundaryStrategy lets responses be cached until the next wall-clock
+// boundary, e.g. the top of the next hour, instead of for a fixed duration.
+// All caches therefore expire their entries at the same instants.
+type boundaryStrategy struct {
+	period time.Duration
+
+	// now is used to tell time, which lets tests control the clock.
+	now func() time.Time
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*boundaryStrategy)(nil)
+
+func (strat *boundaryStrategy) name() string {
+	return fmt.Sprintf("boundary(period=%s)", strat.period)
+}
+
+func (strat *boundaryStrategy) initialize() {
+	if strat.now == nil {
+		strat.now = time.Now
+	}
+}
+
+func (strat *boundaryStrategy) update(timestamp time.Time, reply proto.Message) error {
+	// Boundaries do not depend on responses.
+	return nil
+}
+
+func (strat *boundaryStrategy) determineInterval() time.Duration {
+	// Nor do they need verification.
+	return time.Duration(-1)
+}
+
+func (strat *boundaryStrategy) determineEstimation() time.Duration {
+	if strat.period <= 0 {
+		return 0
+	}
+	now := time.Now()
+	if strat.now != nil {
+		now = strat.now()
+	}
+	nextBoundary := now.Truncate(strat.period).Add(strat.period)
+	return nextBoundary.Sub(now)
+}
@@ -0,0 +1,26 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBoundaryShrinksTowardsBoundary(test *testing.T) {
+	now := time.Date(2020, 1, 1, 12, 0, 0, 0, time.UTC)
+	strat := &boundaryStrategy{period: time.Hour, now: func() time.Time { return now }}
+	strat.initialize()
+
+	if got := strat.determineEstimation(); got != time.Hour {
+		test.Errorf("Wanted 1h TTL at the boundary, got %v", got)
+	}
+
+	now = now.Add(15 * time.Minute)
+	if got := strat.determineEstimation(); got != 45*time.Minute {
+		test.Errorf("Wanted 45m TTL, got %v", got)
+	}
+
+	now = now.Add(44 * time.Minute)
+	if got := strat.determineEstimation(); got != 1*time.Minute {
+		test.Errorf("Wanted 1m TTL, got %v", got)
+	}
+}
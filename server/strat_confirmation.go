@@ -0,0 +1,64 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// confirmationStrategy wraps another strategy, and only lets its estimations
+// through once the same response has been observed a number of times in a
+// row. Until then, the response is considered too volatile to be cached.
+type confirmationStrategy struct {
+	strategyWrapper
+	required int
+
+	responseHash int
+	consecutive  int
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*confirmationStrategy)(nil)
+
+func (strat *confirmationStrategy) name() string {
+	return fmt.Sprintf("confirmation(required=%d, %s)", strat.required, strat.strategy.name())
+}
+
+func (strat *confirmationStrategy) initialize() {
+	strat.responseHash = -1
+	strat.consecutive = 0
+}
+
+func (strat *confirmationStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
+	strat.mux.Lock()
+	if incomingHash != strat.responseHash {
+		strat.responseHash = incomingHash
+		strat.consecutive = 0
+	}
+	strat.consecutive++
+	strat.mux.Unlock()
+
+	return strat.strategy.update(timestamp, reply)
+}
+
+func (strat *confirmationStrategy) determineInterval() time.Duration {
+	return strat.strategy.determineInterval()
+}
+
+func (strat *confirmationStrategy) determineEstimation() time.Duration {
+	// always asked, see strategyWrapper
+	estimation := strat.strategy.determineEstimation()
+
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	if strat.consecutive < strat.required {
+		return 0
+	}
+
+	return estimation
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfirmationWaitsForStableResponse(test *testing.T) {
+	strat := &confirmationStrategy{
+		strategyWrapper: strategyWrapper{&staticStrategy{ttl: 10 * time.Second}},
+		required:        3,
+	}
+	strat.initialize()
+
+	values := []string{"0", "1", "2", "3", "3", "3", "3"}
+	wanted := []int{0, 0, 0, 0, 0, 10, 10}
+
+	t := time.Now()
+	for i, value := range values {
+		strat.update(t, sample{value: value})
+		t = t.Add(1 * time.Second)
+
+		got := strat.determineEstimation()
+		if int(got.Seconds()) != wanted[i] {
+			test.Errorf("Wanted %d second TTL after observation %d, got %v", wanted[i], i, got)
+		}
+	}
+}
+
+func TestConfirmationResetsOnChange(test *testing.T) {
+	strat := &confirmationStrategy{
+		strategyWrapper: strategyWrapper{&staticStrategy{ttl: 10 * time.Second}},
+		required:        2,
+	}
+	strat.initialize()
+
+	t := time.Now()
+	strat.update(t, sample{value: "0"})
+	strat.update(t, sample{value: "0"})
+	if got := strat.determineEstimation(); int(got.Seconds()) != 10 {
+		test.Errorf("Wanted 10 second TTL, got %v", got)
+	}
+
+	strat.update(t, sample{value: "1"})
+	if got := strat.determineEstimation(); got != 0 {
+		test.Errorf("Wanted no TTL after change, got %v", got)
+	}
+}
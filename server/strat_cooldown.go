@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// cooldownStrategy wraps another strategy, and disables caching for a
+// while after each detected change. A value that has just changed is likely
+// to be in the middle of a burst of changes, so its estimations are only
+// let through once it has stayed the same for the whole cooldown.
+type cooldownStrategy struct {
+	strategyWrapper
+	cooldown time.Duration
+
+	responseHash int
+	changedAt    time.Time
+	latest       time.Time
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*cooldownStrategy)(nil)
+
+func (strat *cooldownStrategy) name() string {
+	return fmt.Sprintf("cooldown(period=%v, %s)", strat.cooldown, strat.strategy.name())
+}
+
+func (strat *cooldownStrategy) initialize() {
+	strat.responseHash = -1
+	strat.changedAt = time.Time{}
+	strat.latest = time.Time{}
+}
+
+func (strat *cooldownStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
+	strat.mux.Lock()
+	// the first response is not a change, since there is nothing to
+	// compare it to
+	if strat.responseHash != -1 && incomingHash != strat.responseHash {
+		strat.changedAt = timestamp
+	}
+	strat.responseHash = incomingHash
+	strat.latest = timestamp
+	strat.mux.Unlock()
+
+	return strat.strategy.update(timestamp, reply)
+}
+
+func (strat *cooldownStrategy) determineInterval() time.Duration {
+	return strat.strategy.determineInterval()
+}
+
+func (strat *cooldownStrategy) determineEstimation() time.Duration {
+	// always asked, see strategyWrapper
+	estimation := strat.strategy.determineEstimation()
+
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	if !strat.changedAt.IsZero() && strat.latest.Sub(strat.changedAt) < strat.cooldown {
+		return 0
+	}
+
+	return estimation
+}
@@ -0,0 +1,50 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCooldownAfterChange(test *testing.T) {
+	strat := &cooldownStrategy{
+		strategyWrapper: strategyWrapper{&staticStrategy{ttl: 10 * time.Second}},
+		cooldown:        3 * time.Second,
+	}
+	strat.initialize()
+
+	values := []string{"0", "0", "1", "1", "1", "1", "1", "2", "2"}
+	wanted := []int{10, 10, 0, 0, 0, 10, 10, 0, 0}
+
+	t := time.Now()
+	for i, value := range values {
+		strat.update(t, sample{value: value})
+		t = t.Add(1 * time.Second)
+
+		got := strat.determineEstimation()
+		if int(got.Seconds()) != wanted[i] {
+			test.Errorf("Wanted %d second TTL after observation %d, got %v", wanted[i], i, got)
+		}
+	}
+}
+
+func TestCooldownRestartsOnRepeatedChange(test *testing.T) {
+	strat := &cooldownStrategy{
+		strategyWrapper: strategyWrapper{&staticStrategy{ttl: 10 * time.Second}},
+		cooldown:        2 * time.Second,
+	}
+	strat.initialize()
+
+	t := time.Now()
+	strat.update(t, sample{value: "0"})
+	strat.update(t.Add(1*time.Second), sample{value: "1"})
+	strat.update(t.Add(2*time.Second), sample{value: "2"})
+	strat.update(t.Add(3*time.Second), sample{value: "2"})
+	if got := strat.determineEstimation(); got != 0 {
+		test.Errorf("Wanted no TTL within cooldown of latest change, got %v", got)
+	}
+
+	strat.update(t.Add(4*time.Second), sample{value: "2"})
+	if got := strat.determineEstimation(); int(got.Seconds()) != 10 {
+		test.Errorf("Wanted 10 second TTL after cooldown, got %v", got)
+	}
+}
@@ -0,0 +1,106 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// etagStrategy estimates like the Adaptive TTL strategy, but detects changes
+// by the ETags that the upstream service gives its responses, rather than
+// by comparing the responses themselves. That is exact, and an unchanged
+// ETag means that the response need not even be hashed. Responses without
+// an ETag, such as those seen by client calls, are compared as usual.
+type etagStrategy struct {
+	alpha float64
+
+	lastModification time.Time
+	responseHash     int
+	etag             string
+	// the ETag of the response that is about to be updated with, if any
+	pendingETag string
+
+	lastEstimation time.Duration
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*etagStrategy)(nil)
+
+func (strat *etagStrategy) name() string {
+	return fmt.Sprintf("etag(alpha=%v)", strat.alpha)
+}
+
+func (strat *etagStrategy) initialize() {
+	strat.lastModification = time.Now()
+	strat.responseHash = 11
+	strat.etag = ""
+	strat.pendingETag = ""
+
+	strat.lastEstimation = 0
+}
+
+func (strat *etagStrategy) observeHeader(timestamp time.Time, header metadata.MD) {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	strat.pendingETag = responseETag(header)
+}
+
+func (strat *etagStrategy) update(timestamp time.Time, reply proto.Message) error {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	etag := strat.pendingETag
+	strat.pendingETag = ""
+	if etag != "" {
+		if etag == strat.etag {
+			return nil
+		}
+		strat.etag = etag
+		strat.lastModification = timestamp
+		strat.responseHash = responseHash(reply)
+		return nil
+	}
+
+	if incomingHash := responseHash(reply); incomingHash != strat.responseHash {
+		strat.lastModification = timestamp
+		strat.responseHash = incomingHash
+	}
+	return nil
+}
+
+func (strat *etagStrategy) lastChange() time.Time {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return strat.lastModification
+}
+
+func (strat *etagStrategy) determineInterval() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return pollingInterval(strat.lastEstimation, 0)
+}
+
+func (strat *etagStrategy) determineEstimation() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	estimatedTTL := float64(time.Now().Sub(strat.lastModification).Nanoseconds()) * strat.alpha
+	strat.lastEstimation = time.Duration(int64(estimatedTTL))
+
+	return strat.lastEstimation
+}
+
+func (strat *etagStrategy) setParam(name string, value float64) error {
+	if name != "alpha" {
+		return fmt.Errorf("%s has no parameter %q", strat.name(), name)
+	}
+	strat.mux.Lock()
+	strat.alpha = value
+	strat.mux.Unlock()
+	return nil
+}
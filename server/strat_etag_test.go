@@ -0,0 +1,132 @@
+package server
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestETagStrategyDetectsChangesByETag(test *testing.T) {
+	strat := &etagStrategy{alpha: 0.5}
+	strat.initialize()
+
+	t := time.Now().Add(-10 * time.Second)
+	strat.observeHeader(t, metadata.Pairs(etagHeader, "v1"))
+	strat.update(t, sample{value: "0"})
+
+	// An unchanged ETag is no change, whatever the response.
+	strat.observeHeader(t.Add(5*time.Second), metadata.Pairs(etagHeader, "v1"))
+	strat.update(t.Add(5*time.Second), sample{value: ""})
+	if got := strat.lastChange(); !got.Equal(t) {
+		test.Errorf("Wanted no change for unchanged ETag, got change at %v", got)
+	}
+
+	// A new ETag is a change, even if the response looks the same.
+	strat.observeHeader(t.Add(6*time.Second), metadata.Pairs(etagHeader, "v2"))
+	strat.update(t.Add(6*time.Second), sample{value: "0"})
+	if got := strat.lastChange(); !got.Equal(t.Add(6 * time.Second)) {
+		test.Errorf("Wanted change for new ETag, got change at %v", got)
+	}
+
+	// Without an ETag, responses are compared.
+	strat.update(t.Add(7*time.Second), sample{value: "0"})
+	if got := strat.lastChange(); !got.Equal(t.Add(6 * time.Second)) {
+		test.Errorf("Wanted no change for identical response, got change at %v", got)
+	}
+	strat.update(t.Add(8*time.Second), sample{value: "1"})
+	if got := strat.lastChange(); !got.Equal(t.Add(8 * time.Second)) {
+		test.Errorf("Wanted change for different response, got change at %v", got)
+	}
+}
+
+// etagFetcher is a Fetcher for an upstream that supports conditional
+// requests: if asked with the current ETag, it echoes it, and leaves out
+// the response.
+type etagFetcher struct {
+	etag string
+	resp string
+
+	// the If-None-Match values of the requests
+	conditions []string
+	mux        sync.Mutex
+}
+
+func (f *etagFetcher) Fetch(ctx context.Context, method string, req, resp interface{}, opts ...grpc.CallOption) error {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	condition := ""
+	if values := md.Get(ifNoneMatchHeader); len(values) > 0 {
+		condition = values[0]
+	}
+
+	f.mux.Lock()
+	defer f.mux.Unlock()
+	f.conditions = append(f.conditions, condition)
+
+	if condition != f.etag {
+		proto.Merge(resp.(proto.Message), &wrappers.StringValue{Value: f.resp})
+	}
+	for _, opt := range opts {
+		if header, ok := opt.(grpc.HeaderCallOption); ok {
+			*header.HeaderAddr = metadata.Pairs(etagHeader, f.etag)
+		}
+	}
+	return nil
+}
+
+func TestVerifierSendsETag(test *testing.T) {
+	fetcher := &etagFetcher{etag: "v1", resp: "original"}
+	e := newTestEstimator()
+	e.Fetcher = fetcher
+
+	strategy := &etagStrategy{alpha: 0.5}
+	strategy.initialize()
+	v, err := e.prepareVerifier("in-memory", testMethod, nil, &wrappers.StringValue{Value: "req"}, time.Now().Add(time.Hour), strategy)
+	if err != nil {
+		test.Fatalf("Wanted verifier, got %v", err)
+	}
+	defer v.stop()
+	if err := e.startVerifier(v, &wrappers.StringValue{Value: "original"}, metadata.Pairs(etagHeader, "v1")); err != nil {
+		test.Fatalf("Wanted verifier to start, got %v", err)
+	}
+	created := strategy.lastChange()
+
+	// The upstream leaves out the unchanged response.
+	if err := v.verify(); err != nil {
+		test.Fatalf("Wanted verification, got %v", err)
+	}
+	if got := strategy.lastChange(); !got.Equal(created) {
+		test.Errorf("Wanted no change while the ETag is the same, got change at %v", got)
+	}
+	if got := v.lastReply.(*wrappers.StringValue).Value; got != "original" {
+		test.Errorf("Wanted the left out response to stand in for the original, got %q", got)
+	}
+
+	fetcher.mux.Lock()
+	fetcher.etag, fetcher.resp = "v2", "changed"
+	fetcher.mux.Unlock()
+	if err := v.verify(); err != nil {
+		test.Fatalf("Wanted verification, got %v", err)
+	}
+	if got := strategy.lastChange(); !got.After(created) {
+		test.Errorf("Wanted change once the ETag changed")
+	}
+
+	if err := v.verify(); err != nil {
+		test.Fatalf("Wanted verification, got %v", err)
+	}
+	fetcher.mux.Lock()
+	defer fetcher.mux.Unlock()
+	wanted := []string{"v1", "v1", "v2"}
+	for i, condition := range fetcher.conditions {
+		if i >= len(wanted) || condition != wanted[i] {
+			test.Errorf("Wanted If-None-Match values %v, got %v", wanted, fetcher.conditions)
+			break
+		}
+	}
+}
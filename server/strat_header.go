@@ -0,0 +1,167 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// headerStrategy prefers what the upstream service itself says about the
+// freshness of its responses, in the cache-control and last-modified
+// headers sent along with them. An upstream max-age is used as is, minus
+// the time since it was given. A last-modified time is used like the
+// Adaptive TTL strategy uses the time it observed the last change, which is
+// more accurate, since it is known rather than inferred. Without either,
+// estimation falls back to the Adaptive TTL strategy.
+type headerStrategy struct {
+	alpha    float64
+	fallback *adaptiveStrategy
+
+	// the upstream max-age, or -1 if none was given, and when it was
+	maxAge     time.Duration
+	maxAgeFrom time.Time
+	// the upstream last-modified time, if any
+	lastModified time.Time
+
+	lastEstimation time.Duration
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*headerStrategy)(nil)
+
+func (strat *headerStrategy) name() string {
+	return fmt.Sprintf("header(alpha=%v)", strat.alpha)
+}
+
+func (strat *headerStrategy) initialize() {
+	strat.fallback = &adaptiveStrategy{alpha: strat.alpha}
+	strat.fallback.initialize()
+
+	strat.maxAge = -1
+	strat.maxAgeFrom = time.Time{}
+	strat.lastModified = time.Time{}
+	strat.lastEstimation = 0
+}
+
+func (strat *headerStrategy) update(timestamp time.Time, reply proto.Message) error {
+	// The fallback keeps track of changes, in case the headers go away.
+	return strat.fallback.update(timestamp, reply)
+}
+
+// observeHeader takes note of the freshness information in the headers of
+// an upstream response. Headers without any replace what was noted before.
+func (strat *headerStrategy) observeHeader(timestamp time.Time, header metadata.MD) {
+	maxAge := upstreamMaxAge(header)
+	lastModified := upstreamLastModified(header)
+
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	strat.maxAge = maxAge
+	strat.maxAgeFrom = timestamp
+	strat.lastModified = lastModified
+}
+
+func (strat *headerStrategy) lastChange() time.Time {
+	strat.mux.Lock()
+	lastModified := strat.lastModified
+	strat.mux.Unlock()
+
+	if !lastModified.IsZero() {
+		return lastModified
+	}
+	return strat.fallback.lastChange()
+}
+
+func (strat *headerStrategy) determineInterval() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return pollingInterval(strat.lastEstimation, 0)
+}
+
+func (strat *headerStrategy) determineEstimation() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	now := time.Now()
+	switch {
+	case strat.maxAge >= 0:
+		strat.lastEstimation = strat.maxAge - now.Sub(strat.maxAgeFrom)
+		if strat.lastEstimation < 0 {
+			strat.lastEstimation = 0
+		}
+	case !strat.lastModified.IsZero():
+		estimatedTTL := float64(now.Sub(strat.lastModified).Nanoseconds()) * strat.alpha
+		strat.lastEstimation = time.Duration(int64(estimatedTTL))
+	default:
+		strat.lastEstimation = strat.fallback.determineEstimation()
+	}
+
+	return strat.lastEstimation
+}
+
+func (strat *headerStrategy) setParam(name string, value float64) error {
+	if name != "alpha" {
+		return fmt.Errorf("%s has no parameter %q", strat.name(), name)
+	}
+	strat.mux.Lock()
+	strat.alpha = value
+	strat.mux.Unlock()
+	return strat.fallback.setParam(name, value)
+}
+
+// upstreamMaxAge returns the max-age given by the cache-control headers, or
+// -1 if there is none. The s-maxage meant for shared caches, like ours,
+// takes precedence, and responses that must not be cached get zero.
+func upstreamMaxAge(header metadata.MD) time.Duration {
+	maxAge, sharedMaxAge := -1, -1
+	for _, value := range header.Get("cache-control") {
+		for _, directive := range strings.Split(value, ",") {
+			parts := strings.SplitN(strings.TrimSpace(directive), "=", 2)
+			name := strings.ToLower(parts[0])
+			switch name {
+			case "no-store", "no-cache", "private":
+				return 0
+			case "max-age", "s-maxage":
+				if len(parts) != 2 {
+					continue
+				}
+				seconds, err := strconv.Atoi(strings.Trim(parts[1], `"`))
+				if err != nil || seconds < 0 {
+					continue
+				}
+				if name == "max-age" {
+					maxAge = seconds
+				} else {
+					sharedMaxAge = seconds
+				}
+			}
+		}
+	}
+
+	if sharedMaxAge >= 0 {
+		maxAge = sharedMaxAge
+	}
+	if maxAge < 0 {
+		return -1
+	}
+	return time.Duration(maxAge) * time.Second
+}
+
+// upstreamLastModified returns the time given by the last-modified header,
+// in any of the time formats HTTP allows, or the zero time if there is none.
+func upstreamLastModified(header metadata.MD) time.Time {
+	for _, value := range header.Get("last-modified") {
+		if t, err := http.ParseTime(value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
@@ -0,0 +1,109 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+func TestUpstreamMaxAge(test *testing.T) {
+	cases := map[string]time.Duration{
+		"max-age=60":                        60 * time.Second,
+		"public, MAX-AGE=\"30\"":            30 * time.Second,
+		"max-age=60, s-maxage=10":           10 * time.Second,
+		"no-store, max-age=60":              0,
+		"private, max-age=60":               0,
+		"must-revalidate":                   -1,
+		"max-age=bogus":                     -1,
+		"stale-while-revalidate=5, max-age": -1,
+	}
+
+	for header, wanted := range cases {
+		if got := upstreamMaxAge(metadata.Pairs("cache-control", header)); got != wanted {
+			test.Errorf("Wanted %v for %q, got %v", wanted, header, got)
+		}
+	}
+}
+
+func TestUpstreamLastModified(test *testing.T) {
+	wanted := time.Date(1994, time.November, 6, 8, 49, 37, 0, time.UTC)
+	formats := []string{
+		"Sun, 06 Nov 1994 08:49:37 GMT",
+		"Sunday, 06-Nov-94 08:49:37 GMT",
+		"Sun Nov  6 08:49:37 1994",
+	}
+
+	for _, format := range formats {
+		if got := upstreamLastModified(metadata.Pairs("last-modified", format)); !got.Equal(wanted) {
+			test.Errorf("Wanted %v for %q, got %v", wanted, format, got)
+		}
+	}
+	if got := upstreamLastModified(metadata.Pairs("last-modified", "yesterday")); !got.IsZero() {
+		test.Errorf("Wanted no time for malformed header, got %v", got)
+	}
+}
+
+func TestHeaderStrategyPrefersUpstreamHeaders(test *testing.T) {
+	strat := &headerStrategy{alpha: 0.5}
+	strat.initialize()
+
+	// Without headers, the response changing right now allows no caching.
+	now := time.Now()
+	strat.update(now, sample{value: "0"})
+	if got := strat.determineEstimation(); got > time.Second {
+		test.Errorf("Wanted fallback estimation close to zero, got %v", got)
+	}
+
+	strat.observeHeader(now, metadata.Pairs("last-modified", now.Add(-100*time.Second).UTC().Format(http.TimeFormat)))
+	if got := strat.determineEstimation(); int(got.Seconds()) != 50 {
+		test.Errorf("Wanted 50s based on last-modified, got %v", got)
+	}
+
+	strat.observeHeader(now, metadata.Pairs("cache-control", "max-age=300", "last-modified", now.Add(-100*time.Second).UTC().Format(http.TimeFormat)))
+	if got := strat.determineEstimation(); got > 300*time.Second || got < 299*time.Second {
+		test.Errorf("Wanted upstream max-age of 300s, got %v", got)
+	}
+
+	// Headers without freshness information make it fall back again.
+	strat.observeHeader(now, metadata.MD{})
+	if got := strat.determineEstimation(); got > time.Second {
+		test.Errorf("Wanted fallback estimation close to zero, got %v", got)
+	}
+}
+
+func TestClientInterceptorPassesHeaderToStrategy(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	e.StrategyConfig = &StrategyConfig{Default: "dynamic-header-0.5"}
+	e.loadStrategyConfig()
+
+	req := &wrappers.StringValue{Value: "req"}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*wrappers.StringValue).Value = "resp"
+		for _, opt := range opts {
+			if header, ok := opt.(grpc.HeaderCallOption); ok {
+				*header.HeaderAddr = metadata.Pairs("cache-control", "max-age=120")
+			}
+		}
+		return nil
+	}
+	cc, err := grpc.Dial("upstream", grpc.WithInsecure())
+	if err != nil {
+		test.Fatalf("Unable to create client connection: %v", err)
+	}
+	defer cc.Close()
+
+	if err := e.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, cc, invoker); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	maxAge, err := e.estimateMaxAge(testMethod, nil, req, &wrappers.StringValue{Value: "resp"})
+	if err != nil || maxAge < 119*time.Second || maxAge > 120*time.Second {
+		test.Errorf("Wanted upstream max-age of 120s, got %v (%v)", maxAge, err)
+	}
+}
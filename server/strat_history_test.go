@@ -0,0 +1,82 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// strategiesUnderTest creates a fresh, initialized instance of every
+// strategy, plain and wrapped, by name.
+func strategiesUnderTest() map[string]estimationStrategy {
+	strategies := make(map[string]estimationStrategy)
+	for _, spec := range []string{
+		"static-10",
+		"boundary-60",
+		"dynamic-adaptive-0.5",
+		"dynamic-adaptive-0.5-5",
+		"dynamic-interarrival-0.5",
+		"dynamic-updaterisk-0.5",
+		"dynamic-header-0.5",
+		"dynamic-etag-0.5",
+		"dynamic-lastmodified-0.5",
+	} {
+		strategies[spec], _ = parseStrategy(spec)
+	}
+
+	adaptive := func() estimationStrategy {
+		strategy, _ := parseStrategy("dynamic-adaptive-0.5")
+		return strategy
+	}
+
+	wrappers := map[string]estimationStrategy{
+		"confirmation": &confirmationStrategy{strategyWrapper: strategyWrapper{adaptive()}, required: 2},
+		"cooldown":     &cooldownStrategy{strategyWrapper: strategyWrapper{adaptive()}, cooldown: time.Second},
+		"backoff":      &backoffStrategy{strategyWrapper: strategyWrapper{adaptive()}, after: 1, factor: defaultBackoffFactor, maxInterval: defaultMaxBackoffInterval},
+	}
+	for name, strategy := range wrappers {
+		strategy.initialize()
+		strategies[name] = strategy
+	}
+	return strategies
+}
+
+func TestStrategiesWithShortHistories(test *testing.T) {
+	for name := range strategiesUnderTest() {
+		for _, updates := range []int{0, 1} {
+			// a fresh instance for every history
+			strategy := strategiesUnderTest()[name]
+			for i := 0; i < updates; i++ {
+				strategy.update(time.Now(), sample{value: "resp"})
+			}
+
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						test.Errorf("Wanted %s not to panic after %d updates, got %v", name, updates, r)
+					}
+				}()
+				if interval := strategy.determineInterval(); interval == 0 || interval < -1 {
+					test.Errorf("Wanted a usable interval from %s after %d updates, got %v", name, updates, interval)
+				}
+				if estimate := strategy.determineEstimation(); estimate < 0 {
+					test.Errorf("Wanted a non-negative estimate from %s after %d updates, got %v", name, updates, estimate)
+				}
+			}()
+		}
+	}
+}
+
+func TestUninitializedBoundaryStrategy(test *testing.T) {
+	cases := []struct {
+		strategy *boundaryStrategy
+		wanted   func(time.Duration) bool
+	}{
+		{&boundaryStrategy{period: time.Minute}, func(d time.Duration) bool { return d > 0 && d <= time.Minute }},
+		{&boundaryStrategy{}, func(d time.Duration) bool { return d == 0 }},
+	}
+	for _, c := range cases {
+		if got := c.strategy.determineEstimation(); !c.wanted(got) {
+			test.Errorf("Wanted a sane estimate for period %s without initialization, got %v", c.strategy.period, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+)
+
+// interArrivalWeight is the weight given to the latest inter-arrival time
+// in the moving average.
+const interArrivalWeight = 0.2
+
+// interArrivalStrategy bounds staleness like the Adaptive TTL strategy does,
+// i.e. by alpha times the time since the response last changed, but also
+// takes into account how often clients ask for the response. If clients
+// arrive every D seconds, a cached response is only reused once per D, so
+// the TTL is rounded down to a multiple of D. Any time beyond that would
+// only add staleness without adding hits. If the bound is shorter than D,
+// caching would not give a single hit, and no TTL is given at all.
+type interArrivalStrategy struct {
+	alpha float64
+	// minInterval is the shortest time between verifications. Zero means
+	// defaultInterval.
+	minInterval time.Duration
+
+	lastModification time.Time
+	responseHash     int
+
+	lastArrival      time.Time
+	meanInterArrival time.Duration
+
+	lastEstimation time.Duration
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*interArrivalStrategy)(nil)
+
+func (strat *interArrivalStrategy) name() string {
+	return fmt.Sprintf("interarrival(alpha=%v)", strat.alpha)
+}
+
+func (strat *interArrivalStrategy) initialize() {
+	strat.lastModification = time.Now()
+	strat.responseHash = -1
+
+	strat.lastEstimation = 0
+}
+
+func (strat *interArrivalStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
+	strat.mux.Lock()
+	if incomingHash != strat.responseHash {
+		strat.lastModification = timestamp
+		strat.responseHash = incomingHash
+	}
+	strat.mux.Unlock()
+
+	return nil
+}
+
+func (strat *interArrivalStrategy) observeArrival(timestamp time.Time) {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	if !strat.lastArrival.IsZero() {
+		interArrival := timestamp.Sub(strat.lastArrival)
+		if strat.meanInterArrival == 0 {
+			strat.meanInterArrival = interArrival
+		} else {
+			mean := interArrivalWeight*float64(interArrival) + (1-interArrivalWeight)*float64(strat.meanInterArrival)
+			strat.meanInterArrival = time.Duration(mean)
+		}
+	}
+	strat.lastArrival = timestamp
+}
+
+func (strat *interArrivalStrategy) lastChange() time.Time {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return strat.lastModification
+}
+
+func (strat *interArrivalStrategy) determineInterval() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return pollingInterval(strat.lastEstimation, strat.minInterval)
+}
+
+func (strat *interArrivalStrategy) determineEstimation() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	bound := time.Duration(float64(time.Now().Sub(strat.lastModification)) * strat.alpha)
+
+	estimation := bound
+	if strat.meanInterArrival > 0 {
+		reuses := int64(bound / strat.meanInterArrival)
+		estimation = time.Duration(reuses) * strat.meanInterArrival
+	}
+
+	strat.lastEstimation = estimation
+	return estimation
+}
+
+func (strat *interArrivalStrategy) setParam(name string, value float64) error {
+	if name != "alpha" {
+		return fmt.Errorf("%s has no parameter %q", strat.name(), name)
+	}
+	strat.mux.Lock()
+	strat.alpha = value
+	strat.mux.Unlock()
+	return nil
+}
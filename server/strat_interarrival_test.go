@@ -0,0 +1,36 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+// interArrivalEstimate runs the Inter-arrival strategy over an unchanging
+// response, last modified 20 seconds ago, with clients arriving at the
+// given interval.
+func interArrivalEstimate(interArrival time.Duration) time.Duration {
+	strat := &interArrivalStrategy{alpha: 0.5}
+	strat.initialize()
+
+	start := time.Now().Add(-20 * time.Second)
+	strat.update(start, sample{value: "0"})
+	for t := start; t.Before(time.Now()); t = t.Add(interArrival) {
+		strat.observeArrival(t)
+	}
+
+	return strat.determineEstimation()
+}
+
+func TestInterArrivalFrequentClients(test *testing.T) {
+	// alpha * 20s bounds the TTL at 10s, which allows for 3 reuses
+	if got := interArrivalEstimate(3 * time.Second); got != 9*time.Second {
+		test.Errorf("Wanted 9 second TTL, got %v", got)
+	}
+}
+
+func TestInterArrivalSparseClients(test *testing.T) {
+	// Clients arriving every 15s will never hit a response cached for 10s.
+	if got := interArrivalEstimate(15 * time.Second); got != 0 {
+		test.Errorf("Wanted no TTL, got %v", got)
+	}
+}
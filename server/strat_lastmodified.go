@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc/metadata"
+)
+
+// lastModifiedStrategy is like the Adaptive TTL strategy, but anchors the
+// last change at the last-modified header of upstream responses, which is
+// known rather than inferred from sampled responses. Responses are still
+// compared, and a change is taken from that comparison instead when the
+// header is absent, or does not advance although the response changed.
+type lastModifiedStrategy struct {
+	alpha float64
+
+	// when the response last changed, by either account
+	lastModification time.Time
+	// the latest last-modified header seen
+	lastModified time.Time
+	// the last-modified header of the response about to be updated with,
+	// if any
+	pendingLastModified time.Time
+	responseHash        int
+
+	lastEstimation time.Duration
+
+	mux sync.Mutex
+}
+
+// compile-time check that we adhere to interface
+var _ estimationStrategy = (*lastModifiedStrategy)(nil)
+
+func (strat *lastModifiedStrategy) name() string {
+	return fmt.Sprintf("lastmodified(alpha=%v)", strat.alpha)
+}
+
+func (strat *lastModifiedStrategy) initialize() {
+	strat.lastModification = time.Now()
+	strat.lastModified = time.Time{}
+	strat.pendingLastModified = time.Time{}
+	strat.responseHash = -1
+
+	strat.lastEstimation = 0
+}
+
+func (strat *lastModifiedStrategy) observeHeader(timestamp time.Time, header metadata.MD) {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	strat.pendingLastModified = upstreamLastModified(header)
+}
+
+func (strat *lastModifiedStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	lastModified := strat.pendingLastModified
+	strat.pendingLastModified = time.Time{}
+	changed := incomingHash != strat.responseHash
+	strat.responseHash = incomingHash
+
+	switch {
+	case lastModified.After(strat.lastModified):
+		strat.lastModified = lastModified
+		strat.lastModification = lastModified
+	case changed:
+		strat.lastModification = timestamp
+	}
+	return nil
+}
+
+func (strat *lastModifiedStrategy) lastChange() time.Time {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return strat.lastModification
+}
+
+func (strat *lastModifiedStrategy) determineInterval() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return pollingInterval(strat.lastEstimation, 0)
+}
+
+func (strat *lastModifiedStrategy) determineEstimation() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
+	estimatedTTL := float64(time.Now().Sub(strat.lastModification).Nanoseconds()) * strat.alpha
+	strat.lastEstimation = time.Duration(int64(estimatedTTL))
+	if strat.lastEstimation < 0 {
+		// a last-modified time in the future
+		strat.lastEstimation = 0
+	}
+
+	return strat.lastEstimation
+}
+
+func (strat *lastModifiedStrategy) setParam(name string, value float64) error {
+	if name != "alpha" {
+		return fmt.Errorf("%s has no parameter %q", strat.name(), name)
+	}
+	strat.mux.Lock()
+	strat.alpha = value
+	strat.mux.Unlock()
+	return nil
+}
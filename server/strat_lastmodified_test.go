@@ -0,0 +1,82 @@
+package server
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// lastModifiedHeader returns headers with the given last-modified time.
+func lastModifiedHeader(t time.Time) metadata.MD {
+	return metadata.Pairs("last-modified", t.UTC().Format(http.TimeFormat))
+}
+
+func TestLastModifiedStrategyAnchorsAtHeader(test *testing.T) {
+	strat := &lastModifiedStrategy{alpha: 0.5}
+	strat.initialize()
+
+	// The response was modified well before it was first seen, which
+	// comparing responses could not know.
+	now := time.Now()
+	modified := now.Add(-100 * time.Second).Truncate(time.Second)
+	strat.observeHeader(now, lastModifiedHeader(modified))
+	strat.update(now, sample{value: "0"})
+
+	if got := strat.lastChange(); !got.Equal(modified) {
+		test.Errorf("Wanted last change at %v, got %v", modified, got)
+	}
+	if got := strat.determineEstimation(); got < 49*time.Second || got > 51*time.Second {
+		test.Errorf("Wanted about 50s TTL, got %v", got)
+	}
+
+	// An advancing header moves the anchor, even if the response is the
+	// same as before.
+	later := now.Add(-10 * time.Second).Truncate(time.Second)
+	strat.observeHeader(now, lastModifiedHeader(later))
+	strat.update(now, sample{value: "0"})
+	if got := strat.lastChange(); !got.Equal(later) {
+		test.Errorf("Wanted last change at %v, got %v", later, got)
+	}
+}
+
+func TestLastModifiedStrategyFallsBackToComparing(test *testing.T) {
+	strat := &lastModifiedStrategy{alpha: 0.5}
+	strat.initialize()
+
+	// Without headers, the first response is a change.
+	first := time.Now().Add(-60 * time.Second)
+	strat.update(first, sample{value: "0"})
+	strat.update(first.Add(10*time.Second), sample{value: "0"})
+	if got := strat.lastChange(); !got.Equal(first) {
+		test.Errorf("Wanted last change at %v, got %v", first, got)
+	}
+
+	changed := first.Add(20 * time.Second)
+	strat.update(changed, sample{value: "1"})
+	if got := strat.lastChange(); !got.Equal(changed) {
+		test.Errorf("Wanted a changed response without header to count, got %v", got)
+	}
+	if got := strat.determineEstimation(); got < 19*time.Second || got > 21*time.Second {
+		test.Errorf("Wanted about 20s TTL, got %v", got)
+	}
+}
+
+func TestLastModifiedStrategyDistrustsStuckHeader(test *testing.T) {
+	strat := &lastModifiedStrategy{alpha: 0.5}
+	strat.initialize()
+
+	now := time.Now()
+	modified := now.Add(-time.Hour).Truncate(time.Second)
+	strat.observeHeader(now.Add(-30*time.Second), lastModifiedHeader(modified))
+	strat.update(now.Add(-30*time.Second), sample{value: "0"})
+
+	// The response changes, but the header does not advance.
+	strat.observeHeader(now, lastModifiedHeader(modified))
+	strat.update(now, sample{value: "1"})
+
+	if got := strat.lastChange(); !got.Equal(now) {
+		test.Errorf("Wanted the observed change at %v to win over the stuck header, got %v", now, got)
+	}
+}
@@ -1,7 +1,7 @@
 package server
 
 import (
-	"log"
+	"fmt"
 	"time"
 
 	"github.com/golang/protobuf/proto"
@@ -14,12 +14,17 @@ type staticStrategy struct {
 // compile-time check that we adhere to interface
 var _ estimationStrategy = (*staticStrategy)(nil)
 
+func (strat *staticStrategy) name() string {
+	return fmt.Sprintf("static(ttl=%s)", strat.ttl)
+}
+
 func (strat *staticStrategy) initialize() {
-	log.Printf("Using static TTL=%d for all non-blacklisted responses", int(strat.ttl.Seconds()))
+	// Static has no state to initialize
 }
 
-func (strat *staticStrategy) update(timestamp time.Time, reply proto.Message) {
+func (strat *staticStrategy) update(timestamp time.Time, reply proto.Message) error {
 	// Static does not concern iteself with updates :)
+	return nil
 }
 
 func (strat *staticStrategy) determineInterval() time.Duration {
@@ -1,12 +1,12 @@
 package server
 
 import (
-	"log"
+	"fmt"
 	"math"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hashicorp/terraform/helper/hashcode"
 )
 
 // This implementation embodies (our understanding of) Lee et al.
@@ -17,6 +17,9 @@ import (
 // save the two "last modification" times, and base our calculations on that.
 type updateRiskBasedStrategy struct {
 	rho float64
+	// minInterval is the shortest time between verifications. Zero means
+	// defaultInterval.
+	minInterval time.Duration
 
 	olderModification time.Time
 	newerModification time.Time
@@ -26,14 +29,20 @@ type updateRiskBasedStrategy struct {
 	lastEstimation time.Duration
 
 	observedUpdates int
+
+	mux sync.Mutex
 }
 
 // compile-time check that we adhere to interface
 var _ estimationStrategy = (*updateRiskBasedStrategy)(nil)
 
-func (strat *updateRiskBasedStrategy) initialize() {
-	log.Printf("Using Update-Risk Based strategy (rho = %v)", strat.rho)
+func (strat *updateRiskBasedStrategy) name() string {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return fmt.Sprintf("updaterisk(rho=%v)", strat.rho)
+}
 
+func (strat *updateRiskBasedStrategy) initialize() {
 	strat.responseHash = -1
 
 	now := time.Now()
@@ -45,8 +54,10 @@ func (strat *updateRiskBasedStrategy) initialize() {
 	strat.observedUpdates = 0
 }
 
-func (strat *updateRiskBasedStrategy) update(timestamp time.Time, reply proto.Message) {
-	incomingHash := hashcode.String(reply.String())
+func (strat *updateRiskBasedStrategy) update(timestamp time.Time, reply proto.Message) error {
+	incomingHash := responseHash(reply)
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
 
 	if incomingHash != strat.responseHash {
 		strat.olderModification = strat.newerModification
@@ -58,24 +69,46 @@ func (strat *updateRiskBasedStrategy) update(timestamp time.Time, reply proto.Me
 			strat.observedUpdates++
 		}
 	}
+
+	return nil
+}
+
+func (strat *updateRiskBasedStrategy) lastChange() time.Time {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return strat.newerModification
 }
 
 // This comes in no way from the original paper, but our interface demands it,
 // so this should be a reasonable implementation of interval determination.
 func (strat *updateRiskBasedStrategy) determineInterval() time.Duration {
-	bounded := math.Max(strat.lastEstimation.Seconds()/2.0, defaultInterval.Seconds())
-	return time.Duration(bounded) * time.Second
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return pollingInterval(strat.lastEstimation, strat.minInterval)
 }
 
 func (strat *updateRiskBasedStrategy) determineEstimation() time.Duration {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+
 	mu := strat.averageUpdateFrequency()
 	t := -1.0 / mu * math.Log(1.0-strat.rho)
 	return time.Duration(t) * time.Second
 }
 
+func (strat *updateRiskBasedStrategy) setParam(name string, value float64) error {
+	if name != "rho" {
+		return fmt.Errorf("%s has no parameter %q", strat.name(), name)
+	}
+	strat.mux.Lock()
+	strat.rho = value
+	strat.mux.Unlock()
+	return nil
+}
+
 func (strat *updateRiskBasedStrategy) averageUpdateFrequency() float64 {
+	// without observed updates yet, the update frequency is taken to be 1.0
 	if strat.observedUpdates == 0 {
-		log.Printf("No observed value updates yet, using 1.0 as update frequency")
 		return 1.0
 	}
 
@@ -0,0 +1,21 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateRiskIgnoresMapOrder(test *testing.T) {
+	strat := &updateRiskBasedStrategy{rho: 0.5}
+	strat.initialize()
+
+	first := time.Now().Add(-10 * time.Second)
+	strat.update(first, mapMessage("a", "b", "c", "d"))
+	for i := 1; i <= 5; i++ {
+		strat.update(first.Add(time.Duration(i)*time.Second), mapMessage("d", "c", "b", "a"))
+	}
+
+	if strat.observedUpdates != 1 || !strat.lastChange().Equal(first) {
+		test.Errorf("Wanted only the first response to count as an update, got %d updates, last at %v", strat.observedUpdates, strat.lastChange())
+	}
+}
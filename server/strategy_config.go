@@ -0,0 +1,172 @@
+package server
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"regexp"
+	"syscall"
+)
+
+// StrategyConfig maps methods to estimation strategies, using the same
+// specifications as the PROXY_MAX_AGE environment variable, e.g.
+//
+//	{
+//		"default": "dynamic-adaptive-0.5",
+//		"methods": [
+//			{"pattern": "^/config.Service/", "strategy": "static-300"},
+//			{"pattern": "Metrics$", "strategy": "dynamic-updaterisk-0.1"}
+//		]
+//	}
+//
+// Methods are matched against the patterns in order, and methods that match
+// no pattern use the default strategy. An empty default means passthrough.
+type StrategyConfig struct {
+	Default string           `json:"default"`
+	Methods []MethodStrategy `json:"methods"`
+}
+
+// MethodStrategy selects a strategy for the methods matching a regular
+// expression.
+type MethodStrategy struct {
+	Pattern  string `json:"pattern"`
+	Strategy string `json:"strategy"`
+}
+
+// LoadStrategyConfig reads a StrategyConfig from a JSON file.
+func LoadStrategyConfig(path string) (*StrategyConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var config StrategyConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	return &config, nil
+}
+
+// methodRoute is a compiled MethodStrategy.
+type methodRoute struct {
+	pattern *regexp.Regexp
+	spec    string
+}
+
+// router selects the strategy specification for methods.
+type router struct {
+	defaultSpec string
+	routes      []methodRoute
+}
+
+// newRouter compiles the patterns of the configuration.
+func newRouter(config *StrategyConfig) (*router, error) {
+	r := &router{defaultSpec: config.Default}
+	for _, method := range config.Methods {
+		pattern, err := regexp.Compile(method.Pattern)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, methodRoute{pattern: pattern, spec: method.Strategy})
+	}
+	return r, nil
+}
+
+// specFor returns the strategy specification for the method.
+func (r *router) specFor(method string) string {
+	for _, route := range r.routes {
+		if route.pattern.MatchString(method) {
+			return route.spec
+		}
+	}
+	return r.defaultSpec
+}
+
+// strategyFor creates the strategy for the method, which is nil if the
+// method has none and is to be passed through.
+func (r *router) strategyFor(method string) (estimationStrategy, error) {
+	spec := r.specFor(method)
+	if spec == "" {
+		return nil, nil
+	}
+	return parseStrategy(spec)
+}
+
+// strategyRouter returns the current router, or nil if strategies are not
+// configured per method.
+func (e *ConfigurableValidityEstimator) strategyRouter() *router {
+	r, _ := e.strategies.Load().(*router)
+	return r
+}
+
+// loadStrategyConfig sets up per-method strategies, if configured.
+func (e *ConfigurableValidityEstimator) loadStrategyConfig() {
+	if e.StrategyConfig != nil {
+		r, err := newRouter(e.StrategyConfig)
+		if err != nil {
+			e.logger().Warn("Invalid strategy configuration, using the max-age strategy for all methods", "error", err)
+			return
+		}
+		e.strategies.Store(r)
+		return
+	}
+
+	if e.StrategyConfigFile == "" {
+		e.StrategyConfigFile = os.Getenv("PROXY_STRATEGY_CONFIG")
+	}
+	if e.StrategyConfigFile == "" {
+		return
+	}
+
+	e.reloadStrategyConfig()
+	e.reloadOnHangup()
+}
+
+// reloadOnHangup reloads the strategy configuration file whenever the
+// process receives SIGHUP, until the estimator is shut down.
+func (e *ConfigurableValidityEstimator) reloadOnHangup() {
+	e.liveMux.Lock()
+	defer e.liveMux.Unlock()
+
+	if e.hangups != nil || e.shutDown {
+		return
+	}
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	e.hangups = hangups
+
+	quit := e.quit
+	go func() {
+		for {
+			select {
+			case <-hangups:
+				e.reloadStrategyConfig()
+			case <-quit:
+				return
+			}
+		}
+	}()
+}
+
+// reloadStrategyConfig reads the strategy configuration file again. If that
+// fails, the current configuration is kept. Verifiers that already exist
+// keep their strategies until they finish.
+func (e *ConfigurableValidityEstimator) reloadStrategyConfig() error {
+	config, err := LoadStrategyConfig(e.StrategyConfigFile)
+	if err != nil {
+		e.logger().Warn("Failed to load strategy configuration", "file", e.StrategyConfigFile, "error", err)
+		return err
+	}
+
+	r, err := newRouter(config)
+	if err != nil {
+		e.logger().Warn("Invalid strategy configuration", "file", e.StrategyConfigFile, "error", err)
+		return err
+	}
+
+	e.strategies.Store(r)
+	e.logger().Info("Loaded strategy configuration", "file", e.StrategyConfigFile, "patterns", len(r.routes))
+	return nil
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+)
+
+const (
+	configMethod  = "/test.Service/Config"
+	metricsMethod = "/test.Service/Metrics"
+	otherMethod   = "/test.Service/Other"
+)
+
+func writeStrategyConfig(test *testing.T, dir string, content string) string {
+	path := filepath.Join(dir, "strategies.json")
+	if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+		test.Fatalf("Unable to write configuration: %v", err)
+	}
+	return path
+}
+
+func TestStrategyConfigSelectsPerMethod(test *testing.T) {
+	dir, err := ioutil.TempDir("", "strategies")
+	if err != nil {
+		test.Fatalf("Unable to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := &ConfigurableValidityEstimator{
+		StrategyConfigFile: writeStrategyConfig(test, dir, `{
+			"default": "static-10",
+			"methods": [
+				{"pattern": "Config$", "strategy": "dynamic-adaptive-0.3"},
+				{"pattern": "Metrics$", "strategy": "dynamic-updaterisk-0.2"}
+			]
+		}`),
+	}
+	e.Initialize(log.New(ioutil.Discard, "", 0))
+
+	if strategy, ok := e.newStrategy(configMethod).(*adaptiveStrategy); !ok || strategy.alpha != 0.3 {
+		test.Errorf("Wanted adaptive strategy with alpha 0.3 for %s, got %v", configMethod, e.newStrategy(configMethod))
+	}
+	if strategy, ok := e.newStrategy(metricsMethod).(*updateRiskBasedStrategy); !ok || strategy.rho != 0.2 {
+		test.Errorf("Wanted update-risk strategy with rho 0.2 for %s, got %v", metricsMethod, e.newStrategy(metricsMethod))
+	}
+	if strategy, ok := e.newStrategy(otherMethod).(*staticStrategy); !ok || strategy.ttl != 10*time.Second {
+		test.Errorf("Wanted default static strategy for %s, got %v", otherMethod, e.newStrategy(otherMethod))
+	}
+
+	writeStrategyConfig(test, dir, `{"methods": [{"pattern": "Config$", "strategy": "static-300"}]}`)
+	if err := e.reloadStrategyConfig(); err != nil {
+		test.Fatalf("Wanted configuration to reload, got %v", err)
+	}
+
+	if strategy, ok := e.newStrategy(configMethod).(*staticStrategy); !ok || strategy.ttl != 300*time.Second {
+		test.Errorf("Wanted reloaded static strategy for %s, got %v", configMethod, e.newStrategy(configMethod))
+	}
+	if strategy := e.newStrategy(otherMethod); strategy != nil {
+		test.Errorf("Wanted passthrough for %s without default, got %v", otherMethod, strategy)
+	}
+}
+
+func TestHangupDoesNotReloadAfterShutdown(test *testing.T) {
+	dir, err := ioutil.TempDir("", "strategies")
+	if err != nil {
+		test.Fatalf("Unable to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := &ConfigurableValidityEstimator{
+		StrategyConfigFile: writeStrategyConfig(test, dir, `{"default": "static-10"}`),
+	}
+	e.Initialize(log.New(ioutil.Discard, "", 0))
+	if err := e.Shutdown(context.Background()); err != nil {
+		test.Fatalf("Wanted shutdown to succeed, got %v", err)
+	}
+
+	// keep the hangup from terminating the test, and know when it arrived
+	hangups := make(chan os.Signal, 1)
+	signal.Notify(hangups, syscall.SIGHUP)
+	defer signal.Stop(hangups)
+
+	writeStrategyConfig(test, dir, `{"default": "static-300"}`)
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+	select {
+	case <-hangups:
+	case <-time.After(time.Second):
+		test.Fatalf("Wanted the hangup to be delivered")
+	}
+	time.Sleep(50 * time.Millisecond)
+
+	if strategy, ok := e.newStrategy(otherMethod).(*staticStrategy); !ok || strategy.ttl != 10*time.Second {
+		test.Errorf("Wanted the configuration from before shutdown, got %v", e.newStrategy(otherMethod))
+	}
+}
+
+func TestInvalidStrategyConfigIsNotLoaded(test *testing.T) {
+	dir, err := ioutil.TempDir("", "strategies")
+	if err != nil {
+		test.Fatalf("Unable to create directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	e := &ConfigurableValidityEstimator{
+		StrategyConfigFile: writeStrategyConfig(test, dir, `{"methods": [{"pattern": "(", "strategy": "static-1"}]}`),
+	}
+	if err := e.reloadStrategyConfig(); err == nil {
+		test.Errorf("Wanted invalid pattern to be rejected")
+	}
+	if e.strategyRouter() != nil {
+		test.Errorf("Wanted no configuration to be loaded")
+	}
+}
+
+func TestStrategyConfigSelectsEstimatesPerMethod(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{resp: &wrappers.StringValue{Value: "resp"}}
+	e.StrategyConfig = &StrategyConfig{
+		Default: "static-60",
+		Methods: []MethodStrategy{
+			{Pattern: "^/test.Service/Conf", Strategy: "static-300"},
+			{Pattern: "Metrics$", Strategy: "dynamic-adaptive-0.5"},
+		},
+	}
+	e.loadStrategyConfig()
+	defer e.Shutdown(context.Background())
+
+	req, resp := &wrappers.StringValue{Value: "req"}, &wrappers.StringValue{Value: "resp"}
+	cases := map[string]struct {
+		strategy string
+		ttl      time.Duration
+	}{
+		configMethod:  {"static(ttl=5m0s)", 300 * time.Second},
+		metricsMethod: {"adaptive(alpha=0.5)", 0},
+		otherMethod:   {"static(ttl=1m0s)", 60 * time.Second},
+	}
+
+	for method, wanted := range cases {
+		if !e.startVerification("in-memory", method, nil, req, resp, nil) {
+			test.Fatalf("Wanted a verifier for %s", method)
+		}
+		result, err := e.EstimateDetail(method, req, resp)
+		if err != nil {
+			test.Fatalf("Wanted no error for %s, got %v", method, err)
+		}
+		if result.StrategyName != wanted.strategy || result.ClampedTTL.Truncate(time.Second) != wanted.ttl {
+			test.Errorf("Wanted %s to estimate %v with %s, got %+v", method, wanted.ttl, wanted.strategy, result)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package server
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Server-streaming calls are estimated as a unit: the messages of a stream
+// are treated as one response to its single request. Since the max-age is
+// only known once the whole stream has been sent, cache-control is emitted
+// in the trailer rather than the header. Client-streaming and bidirectional
+// calls are passed through as-is.
+
+// streamResponse represents the messages of a server stream as a single
+// response.
+type streamResponse struct {
+	messages []proto.Message
+}
+
+func (r *streamResponse) Reset() {
+	r.messages = nil
+}
+
+func (r *streamResponse) String() string {
+	parts := make([]string, len(r.messages))
+	for i, message := range r.messages {
+		parts[i] = message.String()
+	}
+	return strings.Join(parts, "\n")
+}
+
+func (r *streamResponse) ProtoMessage() {}
+
+func (r *streamResponse) Merge(src proto.Message) {
+	for _, message := range src.(*streamResponse).messages {
+		r.messages = append(r.messages, proto.Clone(message))
+	}
+}
+
+// StreamServerInterceptor creates the server-side gRPC Stream Interceptor
+// that is used to inject the cache-control trailer and the estimated
+// maximum age of server streams.
+func (e *ConfigurableValidityEstimator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !info.IsServerStream || info.IsClientStream {
+			return handler(srv, ss)
+		}
+
+		stream := &recordingServerStream{ServerStream: ss, ctx: ss.Context()}
+		stream.recorder = &headerRecorder{ServerTransportStream: grpc.ServerTransportStreamFromContext(stream.ctx)}
+		if stream.recorder.ServerTransportStream != nil {
+			stream.ctx = grpc.NewContextWithServerTransportStream(stream.ctx, stream.recorder)
+		}
+
+		if err := handler(srv, stream); err != nil {
+			e.logger().Warn("Upstream stream failed", "method", info.FullMethod, "error", err)
+			return err
+		}
+		if stream.req == nil {
+			return nil
+		}
+
+		resp := &streamResponse{messages: stream.sent}
+		cacheControl, decision, err := e.cacheControl(stream.ctx, info.FullMethod, stream.req, resp, stream.recorder.uncacheable())
+		if err != nil {
+			return err
+		}
+		if cacheControl != "" {
+			if e.ObserveOnly {
+				decision = append(decision, "observed_only", true)
+			} else {
+				ss.SetTrailer(metadata.Pairs("cache-control", cacheControl))
+			}
+		}
+
+		requestHash := hashing.String(stream.req.String())
+		e.logCall("Streamed from upstream", append([]interface{}{"method", info.FullMethod, "hash", requestHash, "messages", len(stream.sent)}, decision...)...)
+
+		return nil
+	}
+}
+
+// recordingServerStream is a grpc.ServerStream that records the request,
+// the messages sent, and the headers set by the handler.
+type recordingServerStream struct {
+	grpc.ServerStream
+
+	ctx      context.Context
+	recorder *headerRecorder
+
+	req  proto.Message
+	sent []proto.Message
+}
+
+func (s *recordingServerStream) Context() context.Context {
+	return s.ctx
+}
+
+func (s *recordingServerStream) SetHeader(md metadata.MD) error {
+	s.recorder.record(md)
+	return s.ServerStream.SetHeader(md)
+}
+
+func (s *recordingServerStream) SendHeader(md metadata.MD) error {
+	s.recorder.record(md)
+	return s.ServerStream.SendHeader(md)
+}
+
+func (s *recordingServerStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil && s.req == nil {
+		s.req = proto.Clone(m.(proto.Message))
+	}
+	return err
+}
+
+func (s *recordingServerStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		s.sent = append(s.sent, proto.Clone(m.(proto.Message)))
+	}
+	return err
+}
+
+// StreamClientInterceptor creates the client-side gRPC Stream Interceptor
+// that sets up verification of server streams, once they have completed
+// successfully.
+func (e *ConfigurableValidityEstimator) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		cs, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			e.logger().Warn("Failed to open upstream stream", "method", method, "error", err)
+			return cs, err
+		}
+		if !desc.ServerStreams || desc.ClientStreams {
+			return cs, nil
+		}
+
+		return &verifyingClientStream{ClientStream: cs, e: e, ctx: ctx, target: cc.Target(), method: method}, nil
+	}
+}
+
+// verifyingClientStream is a grpc.ClientStream that records the request and
+// the messages of a server stream, and starts verifying them once the stream
+// ends. Streams that fail partway through are not verified.
+type verifyingClientStream struct {
+	grpc.ClientStream
+
+	e      *ConfigurableValidityEstimator
+	ctx    context.Context
+	target string
+	method string
+
+	req      proto.Message
+	messages []proto.Message
+}
+
+func (s *verifyingClientStream) SendMsg(m interface{}) error {
+	if s.req == nil {
+		s.req = proto.Clone(m.(proto.Message))
+	}
+	return s.ClientStream.SendMsg(m)
+}
+
+func (s *verifyingClientStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	if err == nil {
+		s.messages = append(s.messages, proto.Clone(m.(proto.Message)))
+	} else if err == io.EOF && s.req != nil {
+		md, _ := metadata.FromIncomingContext(s.ctx)
+		created := s.e.startVerification(s.target, s.method, md, s.req, &streamResponse{messages: s.messages}, nil)
+		trace.SpanFromContext(s.ctx).SetAttributes(attribute.Bool("cache.verifier_created", created))
+	}
+	return err
+}
@@ -0,0 +1,148 @@
+package server
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// fakeServerStream is a grpc.ServerStream that receives a single request,
+// and records the trailer set on it.
+type fakeServerStream struct {
+	grpc.ServerStream
+
+	req      proto.Message
+	received bool
+	trailer  metadata.MD
+}
+
+func (s *fakeServerStream) Context() context.Context {
+	return context.Background()
+}
+
+func (s *fakeServerStream) SetHeader(md metadata.MD) error {
+	return nil
+}
+
+func (s *fakeServerStream) SetTrailer(md metadata.MD) {
+	s.trailer = metadata.Join(s.trailer, md)
+}
+
+func (s *fakeServerStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *fakeServerStream) RecvMsg(m interface{}) error {
+	if s.received {
+		return io.EOF
+	}
+	s.received = true
+	proto.Merge(m.(proto.Message), s.req)
+	return nil
+}
+
+// fakeClientStream is a grpc.ClientStream that answers with its messages.
+type fakeClientStream struct {
+	grpc.ClientStream
+
+	messages []proto.Message
+}
+
+func (s *fakeClientStream) SendMsg(m interface{}) error {
+	return nil
+}
+
+func (s *fakeClientStream) RecvMsg(m interface{}) error {
+	if len(s.messages) == 0 {
+		return io.EOF
+	}
+	proto.Merge(m.(proto.Message), s.messages[0])
+	s.messages = s.messages[1:]
+	return nil
+}
+
+// streamHandler sends the values as a server stream.
+func streamHandler(values ...string) grpc.StreamHandler {
+	return func(srv interface{}, stream grpc.ServerStream) error {
+		if err := stream.RecvMsg(&wrappers.StringValue{}); err != nil {
+			return err
+		}
+		for _, value := range values {
+			if err := stream.SendMsg(&wrappers.StringValue{Value: value}); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+func TestServerStreamGetsCacheControlTrailer(test *testing.T) {
+	e := newTestEstimator()
+	req := &wrappers.StringValue{Value: "req"}
+	v := addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+
+	ss := &fakeServerStream{req: req}
+	info := &grpc.StreamServerInfo{FullMethod: testMethod, IsServerStream: true}
+	if err := e.StreamServerInterceptor()(nil, ss, info, streamHandler("0", "1", "2")); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	got := ss.trailer.Get("cache-control")
+	if len(got) != 1 || got[0] != "must-revalidate, max-age=10" {
+		test.Errorf("Wanted max-age of 10 in trailer, got %v", got)
+	}
+	if got := v.observationCount(); got != 1 {
+		test.Errorf("Wanted the stream to be observed once, got %d", got)
+	}
+}
+
+func TestCompletedClientStreamIsVerified(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+
+	cc, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+	if err != nil {
+		test.Fatalf("Unable to dial: %v", err)
+	}
+	defer cc.Close()
+
+	upstream := &fakeClientStream{messages: []proto.Message{
+		&wrappers.StringValue{Value: "0"},
+		&wrappers.StringValue{Value: "1"},
+		&wrappers.StringValue{Value: "2"},
+	}}
+	streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return upstream, nil
+	}
+	desc := &grpc.StreamDesc{StreamName: "Method", ServerStreams: true}
+	cs, err := e.StreamClientInterceptor()(context.Background(), desc, cc, testMethod, streamer)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	req := &wrappers.StringValue{Value: "req"}
+	cs.SendMsg(req)
+	for cs.RecvMsg(&wrappers.StringValue{}) == nil {
+		if _, found := e.verifiers.Get(hash(testMethod, req)); found {
+			test.Errorf("Wanted no verifier before the stream completed")
+		}
+	}
+
+	value, found := e.verifiers.Get(hash(testMethod, req))
+	if !found {
+		test.Fatalf("Wanted a verifier for the completed stream")
+	}
+	v := value.(*verifier)
+	defer v.stop()
+	if got := len(v.responseArchetype.(*streamResponse).messages); got != 3 {
+		test.Errorf("Wanted the stream of 3 messages to be verified, got %d", got)
+	}
+}
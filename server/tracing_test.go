@@ -0,0 +1,90 @@
+package server
+
+import (
+	"context"
+	"io/ioutil"
+	"log"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+// recordingSpan is a trace.Span that remembers its attributes.
+type recordingSpan struct {
+	trace.Span
+	attributes map[attribute.Key]attribute.Value
+}
+
+func (s *recordingSpan) SetAttributes(kv ...attribute.KeyValue) {
+	for _, attr := range kv {
+		s.attributes[attr.Key] = attr.Value
+	}
+}
+
+func tracedContext() (context.Context, *recordingSpan) {
+	span := &recordingSpan{Span: trace.SpanFromContext(context.Background()), attributes: make(map[attribute.Key]attribute.Value)}
+	return trace.ContextWithSpan(context.Background(), span), span
+}
+
+func TestSpanAnnotatedWithCacheControl(test *testing.T) {
+	e := newTestEstimator()
+	req := sample{value: "req"}
+	addVerifier(e, testMethod, req, time.Now().Add(time.Minute))
+
+	ctx, span := tracedContext()
+	if _, _, err := e.cacheControl(ctx, testMethod, req, sample{value: "resp"}, false); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := span.attributes["cache.max_age_seconds"]; got.AsInt64() != 10 {
+		test.Errorf("Wanted cache.max_age_seconds 10, got %v", got.AsInt64())
+	}
+	if got, found := span.attributes["cache.blacklisted"]; !found || got.AsBool() {
+		test.Errorf("Wanted cache.blacklisted false, got %v (found %v)", got.AsBool(), found)
+	}
+
+	blacklisting := &ConfigurableValidityEstimator{}
+	blacklisting.InitializeWithConfig(Config{BlacklistPattern: "Method$"}, log.New(ioutil.Discard, "", 0))
+	ctx, span = tracedContext()
+	blacklisting.cacheControl(ctx, testMethod, req, sample{value: "resp"}, false)
+	if got := span.attributes["cache.blacklisted"]; !got.AsBool() {
+		test.Errorf("Wanted cache.blacklisted true")
+	}
+	if _, found := span.attributes["cache.max_age_seconds"]; found {
+		test.Errorf("Wanted no max-age for a blacklisted method")
+	}
+}
+
+func TestSpanAnnotatedWithVerifierCreation(test *testing.T) {
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	e.Fetcher = staticFetcher{}
+	cc, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+	if err != nil {
+		test.Fatalf("Unable to dial: %v", err)
+	}
+	defer cc.Close()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*wrappers.StringValue).Value = "resp"
+		return nil
+	}
+	req := &wrappers.StringValue{Value: "req"}
+
+	for _, wanted := range []bool{true, false} {
+		ctx, span := tracedContext()
+		if err := e.UnaryClientInterceptor()(ctx, testMethod, req, &wrappers.StringValue{}, cc, invoker); err != nil {
+			test.Fatalf("Wanted no error, got %v", err)
+		}
+		if got, found := span.attributes["cache.verifier_created"]; !found || got.AsBool() != wanted {
+			test.Errorf("Wanted cache.verifier_created %v, got %v (found %v)", wanted, got.AsBool(), found)
+		}
+	}
+
+	for _, item := range e.verifiers.Items() {
+		item.Object.(*verifier).stop()
+	}
+}
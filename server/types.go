@@ -1,18 +1,274 @@
 package server
 
 import (
-	"log"
+	"log/slog"
+	"os"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/golang/protobuf/proto"
+	"github.com/llarsson/grpc-caching-interceptors/flags"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
+	"github.com/llarsson/grpc-caching-interceptors/metrics"
 	"github.com/patrickmn/go-cache"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 )
 
 // ConfigurableValidityEstimator is a configurable ValidityEstimator.
 type ConfigurableValidityEstimator struct {
+	// Counters are kept first, so that they are 64-bit aligned for atomic
+	// operations.
+	estimationErrors    uint64
+	verifierFailures    uint64
+	verifierConnections uint64
+
 	// We abuse the cache data structure here, s.t. it is used as a handy
 	// place to store items that expire and are then garbage collected.
 	verifiers *cache.Cache
 	// A channel where verifiers can specify their ID as being done.
 	done chan string
-	// Where to log CSV records
-	csvLog *log.Logger
+	// Where to log estimates, in the configured format
+	records recordEncoder
+
+	// Confirmations is the number of consecutive identical responses that
+	// must be observed before a cacheable TTL is advertised. Values below
+	// two disable the confirmation mode.
+	Confirmations int
+	// Cooldown is how long a response must stay unchanged after a detected
+	// change before it is advertised as cacheable again. Zero disables the
+	// cooldown.
+	Cooldown time.Duration
+	// MinSamples is the number of responses that the verifier of a request
+	// must have observed before its estimates are emitted. Until then, the
+	// response is not cached, whatever the strategy estimates. Zero
+	// disables the warm-up.
+	MinSamples int
+	// BackoffAfterUnchanged is the number of consecutive unchanged
+	// responses after which verifiers poll the upstream service less and
+	// less often, until the response changes. Zero disables the backoff.
+	BackoffAfterUnchanged int
+	// BackoffFactor multiplies the polling interval for each further
+	// unchanged response. Defaults to 2, which is also used for factors of
+	// one or less.
+	BackoffFactor float64
+	// MaxBackoffInterval is the longest interval that the backoff leads
+	// to. Defaults to 10 minutes.
+	MaxBackoffInterval time.Duration
+
+	// EstimationErrorPolicy determines what to do when the max-age of a
+	// response cannot be estimated.
+	EstimationErrorPolicy EstimationErrorPolicy
+	// FallbackMaxAge is the max-age to emit on estimation errors, when
+	// using the FallbackOnEstimationError policy.
+	FallbackMaxAge time.Duration
+
+	// CompactionInterval is how often verifiers that are no longer useful
+	// are proactively removed. Defaults to one minute.
+	CompactionInterval time.Duration
+
+	// MinTTL is the lowest max-age emitted for responses that are
+	// estimated to be cacheable at all.
+	MinTTL time.Duration
+	// MaxTTL is the highest max-age ever emitted. Zero means unbounded.
+	MaxTTL time.Duration
+	// SizeBasedTTLModifier, if set, adjusts the estimated max-age of a
+	// cacheable response by its size in bytes, e.g. to cache large
+	// responses that are expensive to fetch for longer, and trivial ones
+	// for shorter. It is applied before MinTTL and MaxTTL.
+	SizeBasedTTLModifier func(respSize int, baseTTL time.Duration) time.Duration
+	// RateAwareTTLModifier, if set, adjusts the estimated max-age of a
+	// cacheable response by the rate, in requests per second, at which
+	// clients ask for it, e.g. to give rarely requested responses, which
+	// gain little from caching, a shorter max-age or none at all. The rate
+	// is zero until a request has been seen twice. It is applied after
+	// SizeBasedTTLModifier, and before MinTTL and MaxTTL.
+	RateAwareTTLModifier func(requestsPerSecond float64, baseTTL time.Duration) time.Duration
+	// TTLJitter is the fraction, e.g. 0.1, by which emitted max-ages are
+	// randomly made longer or shorter, so that responses cached at the
+	// same time do not all expire at the same time either. Zero disables
+	// jitter.
+	TTLJitter float64
+	// MaxAgeOverrides maps methods to a fixed max-age, which is emitted
+	// instead of estimating one, and without verifying their responses.
+	// Keys are full method names, or regular expressions matched against
+	// them. An exact name wins over patterns, and of several matching
+	// patterns, the lexically first one is used.
+	MaxAgeOverrides map[string]time.Duration
+	overrides       []durationOverride
+	// StaleWhileRevalidate, if set, is advertised along with the max-age of
+	// cacheable responses. The max-age is then a soft TTL, after which
+	// caches may keep serving the response for this long while they
+	// refresh it in the background, instead of having to revalidate it.
+	StaleWhileRevalidate time.Duration
+	// ObserveOnly, if set, has responses estimated, verified and logged as
+	// usual, but without emitting cache-control, so that estimates can be
+	// validated against real traffic before they affect caching.
+	ObserveOnly bool
+	// CacheableResponsePredicate, if set, is asked whether each successful
+	// response may be cached, e.g. to not cache responses with empty
+	// results. Responses that it rejects get no cache-control. A streamed
+	// response is cacheable only if all its messages are.
+	CacheableResponsePredicate func(resp proto.Message) bool
+
+	// Fetcher, if set, is used by verifiers to fetch responses instead of
+	// dialing the upstream service.
+	Fetcher Fetcher
+	// DialOptions, if set, are used instead of the default (insecure)
+	// options when verifiers connect to the upstream service, e.g. to dial
+	// through a Unix socket, a proxy, or with a custom resolver.
+	DialOptions []grpc.DialOption
+	// TransportCredentials, if set, secure the connections of verifiers to
+	// the upstream service, e.g. with TLS or mTLS, instead of connecting
+	// insecurely. They are added to any DialOptions.
+	TransportCredentials credentials.TransportCredentials
+	// MaxVerifiers is the highest number of verifiers kept at once, which
+	// bounds how hard they poll the upstream service. Requests that would
+	// need another verifier are not verified, and so not cached, until one
+	// has finished. Concurrent requests may briefly exceed it. Zero means
+	// no limit.
+	MaxVerifiers int
+	// MaxVerifierConnections is the highest number of connections to the
+	// upstream service that verifiers may hold at once. Verifiers of the
+	// same target share a connection. Requests that would need another
+	// connection are not verified until one is closed. Zero means no limit.
+	MaxVerifierConnections int
+
+	// VerifierUpdateRetries is how many times the initial update of a new
+	// verifier is retried before the verifier is given up on. The retries
+	// are made by the verifier in the background, before it starts
+	// polling, and count as a failure of the method if all of them fail.
+	VerifierUpdateRetries int
+	// VerifierRetryBackoff is the delay before the first retry, doubled
+	// for each subsequent one. Defaults to 100ms.
+	VerifierRetryBackoff time.Duration
+	// VerifierLifetime is how long a verifier polls the upstream service
+	// for a request, after which it is created anew if the request is
+	// seen again. Defaults to 30 minutes.
+	VerifierLifetime time.Duration
+	// VerifierLifetimeOverrides maps methods to the lifetime of their
+	// verifiers, instead of VerifierLifetime. Keys are matched like those
+	// of MaxAgeOverrides.
+	VerifierLifetimeOverrides map[string]time.Duration
+	lifetimeOverrides         []durationOverride
+
+	// VerifierFetchTimeout is how long a verifier waits for the upstream
+	// service each time it polls it. A poll that times out is skipped, and
+	// the verifier tries again at its next interval. Defaults to 5s.
+	VerifierFetchTimeout time.Duration
+
+	// VerifierFailureThreshold is the number of consecutive failures to
+	// create a verifier for a method, after which the method is considered
+	// degraded. Zero disables the threshold.
+	VerifierFailureThreshold int
+	// VerifierFailureMaxAge is the max-age emitted for responses of
+	// degraded methods, which would otherwise not be cached at all. Zero
+	// means that they are only reported, via logs and Stats.
+	VerifierFailureMaxAge time.Duration
+
+	// StrategyConfig maps methods to strategies. If not set, it is loaded
+	// from StrategyConfigFile, or the file named by the
+	// PROXY_STRATEGY_CONFIG environment variable. Without either, the
+	// Strategy, or else the MaxAgeStrategy of the Config, is used for all
+	// methods.
+	StrategyConfig *StrategyConfig
+	// StrategyConfigFile is a JSON file holding the StrategyConfig. It is
+	// reloaded when the process receives SIGHUP.
+	StrategyConfigFile string
+
+	// KeyFunc, if set, replaces the request message when keying the
+	// verifiers of requests, e.g. to leave out fields such as request IDs,
+	// so that requests that only differ in those share a verifier.
+	KeyFunc func(fullMethod string, req proto.Message) string
+	// Vary lists the incoming metadata keys, e.g. "x-tenant-id" or
+	// "accept-language", that are part of the key of verifiers, like the
+	// Vary of the caching interceptor. Verifiers send the same metadata
+	// when they poll the upstream service.
+	Vary []string
+	// Hasher, if set, hashes the keys of verifiers instead of
+	// hashing.Default, e.g. hashing.SHA256.
+	Hasher hashing.Hasher
+
+	// Strategy, if set, is used for all methods instead of the
+	// MaxAgeStrategy of the Config, unless strategies are configured per
+	// method. It is assembled with the builders, e.g. Adaptive().
+	Strategy *Strategy
+
+	config    Config
+	blacklist *regexp.Regexp
+	whitelist *regexp.Regexp
+
+	// Metrics, if set, receives the estimated max-age of responses, e.g. to
+	// export them to Prometheus (see the metrics/prom package).
+	Metrics metrics.Recorder
+	// Logger, if set, receives the operational logs of the estimator and
+	// its verifiers, e.g. to filter them by level or emit them as JSON.
+	// Defaults to slog.Default(). The log of estimates is separate.
+	Logger *slog.Logger
+	// LogSampleRate is the fraction of calls, e.g. 0.01, whose records are
+	// logged when they go as expected, to keep busy services from flooding
+	// the logs. Zero logs every call, and a negative rate none of them.
+	// Failures and other events are always logged.
+	LogSampleRate float64
+
+	// Flags, if set, are consulted so that estimation can be turned off,
+	// and strategy parameters changed, by an external feature-flag system
+	// (see the flags package).
+	Flags flags.Source
+	// FlagPollInterval is how often the strategy parameter flags are
+	// polled. Defaults to 30 seconds.
+	FlagPollInterval time.Duration
+
+	strategies atomic.Value
+
+	convergence    map[string]*metrics.Histogram
+	convergenceMux sync.Mutex
+
+	// when responses of each method were last verified
+	verified    map[string]time.Time
+	verifiedMux sync.Mutex
+
+	// consecutive verifier creation failures per method
+	failures    map[string]int
+	failuresMux sync.Mutex
+
+	// requests passed through uncached per method, for lack of a strategy
+	passthrough    map[string]*passthroughMethod
+	passthroughMux sync.Mutex
+
+	// connections to upstream targets, shared by their verifiers
+	conns    map[string]*pooledConn
+	connsMux sync.Mutex
+
+	// closed on Shutdown, which stops the background work
+	quit chan struct{}
+	// receives SIGHUP, to reload the StrategyConfigFile, until Shutdown
+	hangups chan os.Signal
+	// verifiers whose goroutines are running, and whether we have been
+	// shut down, after which no more are started
+	live     map[*verifier]struct{}
+	running  sync.WaitGroup
+	shutDown bool
+	liveMux  sync.Mutex
+
+	// strategy parameters changed at runtime, per method, where the empty
+	// method holds those set for all methods
+	params    map[string]map[string]float64
+	paramsMux sync.Mutex
 }
+
+// EstimationErrorPolicy determines how the server interceptor behaves when
+// it fails to estimate the max-age of a response.
+type EstimationErrorPolicy int
+
+const (
+	// OmitHeaderOnEstimationError emits no cache-control header, so the
+	// response will not be cached. This is the default.
+	OmitHeaderOnEstimationError EstimationErrorPolicy = iota
+	// FallbackOnEstimationError emits the configured FallbackMaxAge.
+	FallbackOnEstimationError
+	// FailOnEstimationError fails the request altogether (strict mode).
+	FailOnEstimationError
+)
@@ -1,14 +1,19 @@
 package server
 
 import (
+	"context"
 	"fmt"
-	"log"
+	"log/slog"
+	"reflect"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/proto"
-	"github.com/hashicorp/terraform/helper/hashcode"
+	"github.com/llarsson/grpc-caching-interceptors/hashing"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 )
 
@@ -18,57 +23,230 @@ const (
 )
 
 type verifier struct {
-	target     string
-	method     string
-	req        proto.Message
+	target string
+	method string
+	req    proto.Message
+	// the metadata listed in Vary that the request was made with
+	md metadata.MD
+	// the key under which the verifier is stored
+	key        string
 	expiration time.Time
 	strategy   estimationStrategy
 
-	cc   *grpc.ClientConn
-	done chan string
+	fetcher      Fetcher
+	fetchTimeout time.Duration
+	// the connection used by the fetcher, unless the estimator has a
+	// Fetcher, and how to give it back to the pool once closed
+	cc        *grpc.ClientConn
+	release   func()
+	closeOnce sync.Once
+	done      chan string
+
+	// closed when the verifier is stopped ahead of its expiration
+	quit     chan struct{}
+	stopOnce sync.Once
+	// number of consecutive compaction passes that found the upstream
+	// unreachable
+	unreachablePasses int
 
 	responseArchetype proto.Message
+	// the last response fetched, which stands in for responses that the
+	// upstream leaves out since they have not changed, and its ETag, if the
+	// upstream gave one
+	lastReply proto.Message
+	etag      string
 
 	estimatedTTL time.Duration
+	observations int
+	// how many times clients have asked for the response, when they last
+	// did, and the average time between their requests
+	requests         int
+	lastRequest      time.Time
+	meanInterRequest time.Duration
+	// when the verifier was created, and whether it has produced a
+	// cacheable estimate since
+	created   time.Time
+	converged bool
+	// called with the time it took to converge, may be nil
+	onConverged func(time.Duration)
+	// called with the time of each successful update, may be nil
+	onVerified func(time.Time)
+	mux        sync.Mutex
 
 	stringRepresentation string
-	csvLog               *log.Logger
+	records              recordEncoder
+	// the logger of the estimator, with the method and hash of the request
+	logs *slog.Logger
+}
+
+// A Fetcher fetches responses from the upstream service on behalf of
+// verifiers. By default, verifiers fetch over a grpc.ClientConn to the
+// upstream, but an in-memory Fetcher lets the verification machinery run
+// without any upstream at all, e.g. for load testing.
+type Fetcher interface {
+	Fetch(ctx context.Context, method string, req, resp interface{}, opts ...grpc.CallOption) error
+}
+
+// connFetcher is a Fetcher that invokes methods over a grpc.ClientConn.
+type connFetcher struct {
+	cc *grpc.ClientConn
+}
+
+func (f connFetcher) Fetch(ctx context.Context, method string, req, resp interface{}, opts ...grpc.CallOption) error {
+	return f.cc.Invoke(ctx, method, req, resp, opts...)
 }
 
-// newVerifier creates a new verifier and starts its goroutine. It attempts
-// to establish a grpc.ClientConn to the upstream service. If that fails,
-// an error is returned.
-func newVerifier(target string, method string, req proto.Message, resp proto.Message, expiration time.Time, strategy estimationStrategy, csvLog *log.Logger, done chan string) (*verifier, error) {
-	opts := []grpc.DialOption{grpc.WithDefaultCallOptions(), grpc.WithInsecure()}
-	cc, err := grpc.Dial(target, opts...)
+// newVerifier creates a new verifier and starts its goroutine. Unless the
+// estimator has been configured with a Fetcher, it attempts to establish a
+// grpc.ClientConn to the upstream service. If that fails, an error is
+// returned.
+func (e *ConfigurableValidityEstimator) newVerifier(target string, method string, req proto.Message, resp proto.Message, expiration time.Time, strategy estimationStrategy) (*verifier, error) {
+	v, err := e.prepareVerifier(target, method, nil, req, expiration, strategy)
 	if err != nil {
-		log.Printf("Failed to dial %v", err)
 		return nil, err
 	}
 
-	v := verifier{
+	if err := e.startVerifier(v, resp, nil); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// verifierFetchTimeout returns how long verifiers wait for the upstream
+// service when polling it.
+func (e *ConfigurableValidityEstimator) verifierFetchTimeout() time.Duration {
+	if e.VerifierFetchTimeout <= 0 {
+		return defaultVerifierFetchTimeout
+	}
+	return e.VerifierFetchTimeout
+}
+
+// dialOptions returns the options verifiers use to connect to the upstream
+// service. Without DialOptions or TransportCredentials, they connect
+// insecurely.
+func (e *ConfigurableValidityEstimator) dialOptions() []grpc.DialOption {
+	opts := e.DialOptions
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithDefaultCallOptions()}
+		if e.TransportCredentials == nil {
+			opts = append(opts, grpc.WithInsecure())
+		}
+	}
+	if e.TransportCredentials != nil {
+		opts = append(opts[:len(opts):len(opts)], grpc.WithTransportCredentials(e.TransportCredentials))
+	}
+	return opts
+}
+
+// prepareVerifier creates a new verifier for the request, made with the
+// given metadata, connected to the upstream service unless the estimator
+// has been configured with a Fetcher, but does not start it.
+func (e *ConfigurableValidityEstimator) prepareVerifier(target string, method string, md metadata.MD, req proto.Message, expiration time.Time, strategy estimationStrategy) (*verifier, error) {
+	var cc *grpc.ClientConn
+	fetcher := e.Fetcher
+	var release func()
+	if fetcher == nil {
+		var err error
+		cc, release, err = e.connect(target)
+		if err == errConnectionBudgetExhausted {
+			return nil, err
+		}
+		if err != nil {
+			e.logger().Warn("Failed to dial upstream", "target", target, "error", err)
+			return nil, err
+		}
+		fetcher = connFetcher{cc: cc}
+	}
+
+	return &verifier{
 		target:               target,
 		method:               method,
-		req:                  req,
+		req:                  proto.Clone(req),
+		md:                   e.varied(md),
+		key:                  e.key(method, md, req),
 		expiration:           expiration,
 		strategy:             strategy,
+		fetcher:              fetcher,
+		fetchTimeout:         e.verifierFetchTimeout(),
 		cc:                   cc,
-		responseArchetype:    proto.Clone(resp),
+		release:              release,
 		estimatedTTL:         0,
-		csvLog:               csvLog,
-		done:                 done,
-		stringRepresentation: fmt.Sprintf("%s(%d)", method, hashcode.String(req.String())),
+		created:              time.Now(),
+		onConverged:          e.convergenceObserver(method),
+		onVerified:           e.verificationObserver(method),
+		records:              e.records,
+		done:                 e.done,
+		quit:                 make(chan struct{}),
+		stringRepresentation: fmt.Sprintf("%s(%d)", method, hashing.String(req.String())),
+		logs:                 e.logger().With("method", method, "hash", hashing.String(req.String())),
+	}, nil
+}
+
+// startVerifier makes the initial update of the verifier with the response,
+// and its header, if any, and starts its goroutine. If the update fails and
+// VerifierUpdateRetries is set, the goroutine retries it before it starts
+// polling, so that the client call is not held up by the backoff. Otherwise
+// the verifier is closed and an error is returned.
+func (e *ConfigurableValidityEstimator) startVerifier(v *verifier, resp proto.Message, header metadata.MD) error {
+	v.responseArchetype = proto.Clone(resp)
+	v.lastReply = v.responseArchetype
+	v.etag = responseETag(header)
+	v.observeHeader(header)
+
+	updateErr := v.update(resp, clientSource)
+	if updateErr != nil && e.VerifierUpdateRetries <= 0 {
+		v.logger().Warn("Unable to create verifier")
+		v.close()
+		return updateErr
 	}
 
-	err = v.update(resp, clientSource)
+	untrack, err := e.track(v)
 	if err != nil {
-		log.Printf("Unable to create verifier for %s", v.method)
-		return nil, err
+		v.close()
+		return err
 	}
+	go func() {
+		defer untrack()
+		if updateErr != nil {
+			updateErr = e.retryUpdate(v, resp, updateErr)
+		}
+		if updateErr == nil {
+			v.run()
+			return
+		}
 
-	go v.run()
+		// Stopped verifiers have already been removed, and are not
+		// failures of the method.
+		if v.stopped() {
+			return
+		}
+		v.logger().Warn("Unable to create verifier", "error", updateErr)
+		e.verifierFailed(v.method)
+		v.close()
+		v.done <- v.key
+	}()
 
-	return &v, nil
+	return nil
+}
+
+// retryUpdate retries the initial update of the verifier, which failed with
+// err, with exponential backoff, since strategies may fail transiently. It
+// returns the error of the last attempt, which is nil once one succeeds.
+func (e *ConfigurableValidityEstimator) retryUpdate(v *verifier, resp proto.Message, err error) error {
+	backoff := e.VerifierRetryBackoff
+	if backoff <= 0 {
+		backoff = defaultVerifierRetryBackoff
+	}
+	for attempt := 0; err != nil && attempt < e.VerifierUpdateRetries; attempt++ {
+		v.logger().Warn("Initial update of verifier failed, retrying", "backoff", backoff, "error", err)
+		if !v.sleep(backoff) {
+			return err
+		}
+		backoff *= 2
+		err = v.update(resp, clientSource)
+	}
+	return err
 }
 
 func (v *verifier) string() string {
@@ -79,45 +257,145 @@ func (v *verifier) string() string {
 func (v *verifier) run() {
 	// good housekeeping to close the grpc.ClientConn when this goroutine
 	// finishes.
-	defer v.cc.Close()
+	defer v.close()
 
+	backoff := notReadyBackoff
 	for {
 		delay := v.strategy.determineInterval()
-		if delay <= 0 {
-			time.Sleep(time.Duration(500 * time.Millisecond))
-			continue
+		polling := delay > 0
+		switch {
+		case delay < 0:
+			// Strategies that never verify are only updated by client
+			// calls, so there is nothing to do until expiration.
+			delay = time.Until(v.expiration)
+		case delay == 0:
+			// Strategies that are not ready to verify yet are checked
+			// on less and less often.
+			delay = backoff
+			if backoff *= 2; backoff > maxNotReadyBackoff {
+				backoff = maxNotReadyBackoff
+			}
+		default:
+			backoff = notReadyBackoff
+			v.logger().Debug("Verifier scheduled", "delay", delay, "expires", v.expiration)
 		}
 
-		log.Printf("%s scheduled for verification in %s (expires %s)", v.string(), delay, v.expiration)
-
-		time.Sleep(delay)
+		if !v.sleep(delay) {
+			v.logger().Debug("Verifier stopped")
+			break
+		}
 
-		if v.finished() {
-			log.Printf("%s needs no further verification", v.string())
+		if v.finished() || v.stopped() {
+			v.logger().Debug("Verifier needs no further verification")
 			break
 		}
+		if !polling {
+			continue
+		}
+
+		// Proactively polling the upstream data source lets the
+		// strategy detect changes before a client asks, which reduces
+		// data staleness. Streams cannot be fetched by a unary call, so
+		// they are only updated by client calls.
+		v.mux.Lock()
+		_, streamed := v.responseArchetype.(*streamResponse)
+		v.mux.Unlock()
+		if streamed {
+			continue
+		}
+
+		if err := v.verify(); err != nil {
+			v.logger().Warn("Verification failed", "error", err)
+		}
+	}
+
+	// signal that we are done and can be deleted. Stopped verifiers have
+	// already been removed, and may have been replaced by a new verifier.
+	if !v.stopped() {
+		v.done <- v.key
+	}
+}
+
+// verify fetches the response from the upstream service, and updates the
+// strategy with it. If the upstream echoes the ETag of the last response,
+// that response is used instead, since the upstream may have left out the
+// unchanged response. A fetch that times out leaves the strategy as it is,
+// since there is nothing new to learn from it.
+func (v *verifier) verify() error {
+	newReply, header, err := v.fetch()
+	if status.Code(err) == codes.DeadlineExceeded {
+		v.logger().Warn("Upstream did not respond in time, skipping this round", "timeout", v.fetchTimeout)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	etag := responseETag(header)
+	v.mux.Lock()
+	if etag != "" && etag == v.etag {
+		newReply = v.lastReply
+	}
+	v.etag = etag
+	v.lastReply = newReply
+	v.mux.Unlock()
+	v.observeHeader(header)
+
+	return v.update(newReply, verifierSource)
+}
 
-		// Research idea:
-		//
-		// Add a verification step here, where data is fetched from the
-		// upstream service. Periodically polling the upstream data
-		// source in a proactive manner should make it possible to
-		// reduce data staleness.
-		//
-		// The code below shows how this could be added.
-		//
-		//		newReply, err := v.fetch()
-		//		if err != nil {
-		//			log.Printf("Upstream fetch %s failed: %v", v.string(), err)
-		//			continue
-		//		}
+// sleep for the given duration, unless the verifier is stopped before
+// that, in which case false is returned right away.
+func (v *verifier) sleep(duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
 
-		// v.update(newReply, verifierSource)
+	select {
+	case <-timer.C:
+		return true
+	case <-v.quit:
+		return false
 	}
+}
+
+// stop the verifier ahead of its expiration, closing its connection to the
+// upstream service right away.
+func (v *verifier) stop() {
+	v.stopOnce.Do(func() {
+		close(v.quit)
+		v.close()
+	})
+}
 
-	// signal that we are done and can be deleted.
-	v.done <- hash(v.method, v.req)
-	return
+// close the connection to the upstream service, if the verifier holds one.
+// It is shared with the other verifiers of the same target, and only closed
+// once none of them use it.
+func (v *verifier) close() {
+	v.closeOnce.Do(func() {
+		if v.release != nil {
+			v.release()
+		}
+	})
+}
+
+// stopped is a predicate that indicates if this verifier has been stopped.
+func (v *verifier) stopped() bool {
+	select {
+	case <-v.quit:
+		return true
+	default:
+		return false
+	}
+}
+
+// unreachable is a predicate that indicates if the connection to the
+// upstream service is currently failing.
+func (v *verifier) unreachable() bool {
+	if v.cc == nil {
+		return false
+	}
+	state := v.cc.GetState()
+	return state == connectivity.TransientFailure || state == connectivity.Shutdown
 }
 
 // update internal data structures and estimations based on new data.
@@ -127,36 +405,142 @@ func (v *verifier) update(reply proto.Message, source string) error {
 	}
 
 	now := time.Now()
-	v.strategy.update(now, reply)
-	v.estimatedTTL = v.strategy.determineEstimation()
+	if err := v.strategy.update(now, reply); err != nil {
+		return err
+	}
+	estimatedTTL := v.strategy.determineEstimation()
 
-	v.csvLog.Printf("%d,%s,%s,%d\n", time.Now().UnixNano(), source, v.string(), int(v.estimatedTTL.Seconds()))
+	v.mux.Lock()
+	v.estimatedTTL = estimatedTTL
+	v.observations++
+	converged := !v.converged && estimatedTTL > 0
+	if converged {
+		v.converged = true
+	}
+	v.mux.Unlock()
+
+	if converged && v.onConverged != nil {
+		v.onConverged(now.Sub(v.created))
+	}
+	if v.onVerified != nil {
+		v.onVerified(now)
+	}
+
+	v.records.write(estimateRecord{Timestamp: time.Now().UnixNano(), Source: source, Method: v.string(), EstimateSeconds: int(estimatedTTL.Seconds())})
 
 	return nil
 }
 
+// observeHeader lets the strategy take note of the header of an upstream
+// response, if it cares about them. A nil header is ignored, since it means
+// that the header is not known, rather than empty.
+func (v *verifier) observeHeader(header metadata.MD) {
+	if header == nil {
+		return
+	}
+	if observer, ok := v.strategy.(headerObserver); ok {
+		observer.observeHeader(time.Now(), header)
+	}
+}
+
 // finished is a predicate that indicates if this verifier has completed its work.
 func (v *verifier) finished() bool {
 	return time.Now().After(v.expiration)
 }
 
-// This code is for illustration purposes only. Initial testing shows that it
-// contains bugs, and cannot be used in its current state.
-//
-// fetch a new response from the upstream service (proactive operation).
-// func (v *verifier) fetch() (proto.Message, error) {
-// 	reply := proto.Clone(v.responseArchetype)
-// 	reply.Reset()
-//
-// 	err := v.cc.Invoke(context.Background(), v.method, v.req, reply)
-// 	if err != nil {
-// 		log.Printf("Failed to invoke call over established connection %v", err)
-// 		return nil, err
-// 	}
-//
-// 	return reply, err
-// }
+// fetch a new response from the upstream service (proactive operation),
+// along with its header. The header is nil if the Fetcher does not provide
+// it.
+func (v *verifier) fetch() (proto.Message, metadata.MD, error) {
+	v.mux.Lock()
+	reply := emptyLike(v.responseArchetype)
+	v.mux.Unlock()
+
+	var header metadata.MD
+	opts := []grpc.CallOption{grpc.Header(&header)}
+	if _, ok := reply.(*rawResponse); ok {
+		opts = append(opts, grpc.ForceCodec(rawCodec{}))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), v.fetchTimeout)
+	defer cancel()
+	if v.md != nil {
+		ctx = metadata.NewOutgoingContext(ctx, v.md)
+	}
+	if v.etag != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, ifNoneMatchHeader, v.etag)
+	}
+	// stopping the verifier abandons the fetch, too
+	go func() {
+		select {
+		case <-v.quit:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := v.fetcher.Fetch(ctx, v.method, proto.Clone(v.req), reply, opts...)
+	if err != nil {
+		v.logger().Warn("Failed to invoke call over established connection", "error", err)
+		return nil, nil, err
+	}
+
+	return reply, header, nil
+}
+
+// adoptResponseType makes a seeded verifier, which keeps responses in their
+// wire format for lack of their type, fetch responses of the type of the
+// reply to a client call from now on. The last response is decoded into
+// that type as well. Other verifiers are left alone.
+func (v *verifier) adoptResponseType(reply proto.Message) {
+	switch reply.(type) {
+	case *rawResponse, *streamResponse:
+		return
+	}
+
+	v.mux.Lock()
+	defer v.mux.Unlock()
+
+	if _, ok := v.responseArchetype.(*rawResponse); !ok {
+		return
+	}
+	v.responseArchetype = proto.Clone(reply)
+	if last, ok := v.lastReply.(*rawResponse); ok {
+		decoded := emptyLike(reply)
+		if err := proto.Unmarshal(last.data, decoded); err != nil {
+			decoded = proto.Clone(reply)
+		}
+		v.lastReply = decoded
+	}
+}
+
+// emptyLike returns a new, zero-valued, message of the same concrete type as
+// the archetype, for a response to be unmarshalled into.
+func emptyLike(archetype proto.Message) proto.Message {
+	t := reflect.TypeOf(archetype)
+	if t.Kind() != reflect.Ptr {
+		return archetype
+	}
+	return reflect.New(t.Elem()).Interface().(proto.Message)
+}
 
 func (v *verifier) estimate() (time.Duration, error) {
+	v.mux.Lock()
+	defer v.mux.Unlock()
 	return v.estimatedTTL, nil
 }
+
+// observationCount returns the number of responses that the verifier has
+// observed so far.
+func (v *verifier) observationCount() int {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return v.observations
+}
+
+// reply returns the last response observed.
+func (v *verifier) reply() proto.Message {
+	v.mux.Lock()
+	defer v.mux.Unlock()
+	return v.lastReply
+}
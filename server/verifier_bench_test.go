@@ -0,0 +1,61 @@
+package server
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"google.golang.org/grpc"
+)
+
+// staticFetcher is an in-memory Fetcher that always answers with the same
+// response.
+type staticFetcher struct {
+	resp proto.Message
+}
+
+func (f staticFetcher) Fetch(ctx context.Context, method string, req, resp interface{}, opts ...grpc.CallOption) error {
+	if f.resp != nil {
+		proto.Merge(resp.(proto.Message), f.resp)
+	}
+	return nil
+}
+
+func BenchmarkVerifierOverhead(b *testing.B) {
+	e := newTestEstimator()
+	resp := &wrappers.StringValue{Value: "resp"}
+	e.Fetcher = staticFetcher{resp: resp}
+	expiration := time.Now().Add(1 * time.Hour)
+
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	goroutines := runtime.NumGoroutine()
+
+	verifiers := make([]*verifier, 0, b.N)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		strategy := &adaptiveStrategy{alpha: 0.5}
+		strategy.initialize()
+		req := &wrappers.StringValue{Value: strconv.Itoa(i)}
+		v, err := e.newVerifier("in-memory", testMethod, req, resp, expiration, strategy)
+		if err != nil {
+			b.Fatalf("Unable to create verifier: %v", err)
+		}
+		verifiers = append(verifiers, v)
+	}
+	b.StopTimer()
+
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	b.ReportMetric(float64(runtime.NumGoroutine()-goroutines)/float64(b.N), "goroutines/verifier")
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-bytes/verifier")
+
+	for _, v := range verifiers {
+		v.stop()
+	}
+}
@@ -0,0 +1,539 @@
+package server
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func TestCompactionRemovesUselessVerifiers(test *testing.T) {
+	os.Setenv("PROXY_CACHE_BLACKLIST", "Blacklisted")
+	defer os.Unsetenv("PROXY_CACHE_BLACKLIST")
+
+	e := newTestEstimator()
+	later := time.Now().Add(1 * time.Hour)
+
+	healthy := addVerifier(e, testMethod, sample{value: "healthy"}, later)
+	blacklisted := addVerifier(e, "/test.Service/Blacklisted", sample{value: "blacklisted"}, later)
+	expired := addVerifier(e, testMethod, sample{value: "expired"}, time.Now().Add(-1*time.Second))
+
+	unreachable := addVerifier(e, testMethod, sample{value: "unreachable"}, later)
+	cc, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+	if err != nil {
+		test.Fatalf("Unable to dial: %v", err)
+	}
+	unreachable.cc = cc
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for cc.GetState() != connectivity.TransientFailure {
+		if !cc.WaitForStateChange(ctx, cc.GetState()) {
+			test.Fatalf("Connection never failed, state is %v", cc.GetState())
+		}
+	}
+
+	// An unreachable upstream must be persistently so.
+	if got := e.compact(); got != 2 {
+		test.Errorf("Wanted 2 verifiers compacted on first pass, got %d", got)
+	}
+	if got := e.compact(); got != 1 {
+		test.Errorf("Wanted 1 verifier compacted on second pass, got %d", got)
+	}
+
+	if got := e.verifiers.ItemCount(); got != 1 {
+		test.Errorf("Wanted 1 verifier left, got %d", got)
+	}
+	if _, found := e.verifiers.Get(hash(testMethod, healthy.req)); !found {
+		test.Errorf("Wanted healthy verifier to remain")
+	}
+	for _, v := range []*verifier{blacklisted, expired, unreachable} {
+		if !v.stopped() {
+			test.Errorf("Wanted %s to be stopped", v.req)
+		}
+	}
+	if healthy.stopped() {
+		test.Errorf("Wanted healthy verifier to keep running")
+	}
+}
+
+func TestCompactionKeepsReplacedVerifiers(test *testing.T) {
+	e := newTestEstimator()
+	req := sample{value: "req"}
+
+	replaced := addVerifier(e, testMethod, req, time.Now().Add(-1*time.Second))
+	replacement := addVerifier(e, testMethod, req, time.Now().Add(1*time.Hour))
+
+	if e.removeVerifier(replaced.key, replaced) {
+		test.Errorf("Wanted the replaced verifier not to be removed")
+	}
+	if value, found := e.verifiers.Get(replaced.key); !found || value.(*verifier) != replacement {
+		test.Errorf("Wanted the replacement to remain, got %v", value)
+	}
+	if !e.removeVerifier(replacement.key, replacement) {
+		test.Errorf("Wanted the current verifier to be removed")
+	}
+}
+
+// flakyStrategy fails its first updates, and then behaves like its wrapped
+// strategy.
+type flakyStrategy struct {
+	estimationStrategy
+	failures int
+	updates  int
+	mux      sync.Mutex
+}
+
+func (strat *flakyStrategy) update(timestamp time.Time, reply proto.Message) error {
+	strat.mux.Lock()
+	strat.updates++
+	failed := strat.updates <= strat.failures
+	strat.mux.Unlock()
+	if failed {
+		return status.Errorf(codes.Unavailable, "Momentarily inconsistent")
+	}
+	return strat.estimationStrategy.update(timestamp, reply)
+}
+
+func (strat *flakyStrategy) attempts() int {
+	strat.mux.Lock()
+	defer strat.mux.Unlock()
+	return strat.updates
+}
+
+func TestVerifierCreationRetriesInitialUpdate(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	e.VerifierUpdateRetries = 2
+	e.VerifierRetryBackoff = time.Millisecond
+	strategy := &flakyStrategy{estimationStrategy: &staticStrategy{ttl: 10 * time.Second}, failures: 1}
+
+	req := &wrappers.StringValue{Value: "req"}
+	v, err := e.newVerifier("in-memory", testMethod, req, &wrappers.StringValue{Value: "resp"}, time.Now().Add(1*time.Hour), strategy)
+	if err != nil {
+		test.Fatalf("Wanted verifier to be created, got %v", err)
+	}
+	defer v.stop()
+
+	deadline := time.Now().Add(time.Second)
+	for strategy.attempts() < 2 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if got := strategy.attempts(); got != 2 {
+		test.Errorf("Wanted 2 update attempts, got %d", got)
+	}
+	if got, _ := v.estimate(); got != 10*time.Second {
+		test.Errorf("Wanted 10s estimate, got %v", got)
+	}
+}
+
+func TestVerifierCreationDoesNotWaitForRetries(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	e.VerifierUpdateRetries = 1
+	e.VerifierRetryBackoff = time.Hour
+	strategy := &flakyStrategy{estimationStrategy: &staticStrategy{ttl: 10 * time.Second}, failures: 1}
+
+	start := time.Now()
+	req := &wrappers.StringValue{Value: "req"}
+	v, err := e.newVerifier("in-memory", testMethod, req, &wrappers.StringValue{Value: "resp"}, time.Now().Add(1*time.Hour), strategy)
+	if err != nil {
+		test.Fatalf("Wanted verifier to be created, got %v", err)
+	}
+	defer v.stop()
+
+	if elapsed := time.Since(start); elapsed > time.Second {
+		test.Errorf("Wanted creation to return without waiting for the backoff, took %v", elapsed)
+	}
+	if got := strategy.attempts(); got != 1 {
+		test.Errorf("Wanted 1 update attempt before the backoff, got %d", got)
+	}
+}
+
+func TestVerifierCreationGivesUp(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	e.VerifierUpdateRetries = 1
+	e.VerifierRetryBackoff = time.Millisecond
+	strategy := &flakyStrategy{estimationStrategy: &staticStrategy{ttl: 10 * time.Second}, failures: 5}
+
+	req := &wrappers.StringValue{Value: "req"}
+	v, err := e.newVerifier("in-memory", testMethod, req, &wrappers.StringValue{Value: "resp"}, time.Now().Add(1*time.Hour), strategy)
+	if err != nil {
+		test.Fatalf("Wanted verifier to retry in the background, got %v", err)
+	}
+	defer v.stop()
+
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadUint64(&e.verifierFailures) == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if failures := atomic.LoadUint64(&e.verifierFailures); failures != 1 {
+		test.Errorf("Wanted the verifier to count as 1 failure, got %d", failures)
+	}
+	if got := strategy.attempts(); got != 2 {
+		test.Errorf("Wanted 2 update attempts, got %d", got)
+	}
+}
+
+func TestVerifierCreationFailsWithoutRetries(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	strategy := &flakyStrategy{estimationStrategy: &staticStrategy{ttl: 10 * time.Second}, failures: 1}
+
+	req := &wrappers.StringValue{Value: "req"}
+	if _, err := e.newVerifier("in-memory", testMethod, req, &wrappers.StringValue{Value: "resp"}, time.Now().Add(1*time.Hour), strategy); err == nil {
+		test.Errorf("Wanted verifier creation to fail")
+	}
+}
+
+func TestVerifierObservesRepliesRatherThanRequests(test *testing.T) {
+	e := newTestEstimator()
+	e.Fetcher = staticFetcher{}
+	e.StrategyConfig = &StrategyConfig{Default: "dynamic-adaptive-0.5"}
+	e.loadStrategyConfig()
+
+	cc, err := grpc.Dial("localhost:1", grpc.WithInsecure())
+	if err != nil {
+		test.Fatalf("Unable to dial: %v", err)
+	}
+	defer cc.Close()
+
+	req := &wrappers.StringValue{Value: "req"}
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reply.(*wrappers.StringValue).Value = "original"
+		return nil
+	}
+	if err := e.UnaryClientInterceptor()(context.Background(), testMethod, req, &wrappers.StringValue{}, cc, invoker); err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+
+	value, found := e.verifiers.Get(hash(testMethod, req))
+	if !found {
+		test.Fatalf("Wanted a verifier for the request")
+	}
+	v := value.(*verifier)
+	defer v.stop()
+	if !proto.Equal(v.responseArchetype, &wrappers.StringValue{Value: "original"}) {
+		test.Errorf("Wanted the reply as response archetype, got %v", v.responseArchetype)
+	}
+
+	tracker := v.strategy.(changeTracker)
+	created := tracker.lastChange()
+
+	time.Sleep(10 * time.Millisecond)
+	e.estimateMaxAge(testMethod, nil, req, &wrappers.StringValue{Value: "original"})
+	if got := tracker.lastChange(); !got.Equal(created) {
+		test.Errorf("Wanted unchanged reply not to be seen as an update, last change moved to %v", got)
+	}
+
+	e.estimateMaxAge(testMethod, nil, req, &wrappers.StringValue{Value: "updated"})
+	if got := tracker.lastChange(); !got.After(created) {
+		test.Errorf("Wanted changed reply to be seen as an update, last change still %v", got)
+	}
+}
+
+// pollingStrategy wraps a strategy, and verifies at a short interval.
+type pollingStrategy struct {
+	estimationStrategy
+}
+
+func (strat *pollingStrategy) determineInterval() time.Duration {
+	return 10 * time.Millisecond
+}
+
+func TestVerifierPollsUpstream(test *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		test.Fatalf("Unable to listen: %v", err)
+	}
+	var current atomic.Value
+	current.Store("original")
+	defer serveUpstream(listener, func() string { return current.Load().(string) })()
+
+	e := newTestEstimator()
+	adaptive := &adaptiveStrategy{alpha: 0.5}
+	adaptive.initialize()
+	resp := &wrappers.StringValue{Value: "original"}
+	v, err := e.newVerifier(listener.Addr().String(), testMethod, &wrappers.StringValue{Value: "req"}, resp, time.Now().Add(1*time.Hour), &pollingStrategy{adaptive})
+	if err != nil {
+		test.Fatalf("Unable to create verifier: %v", err)
+	}
+	defer v.stop()
+
+	created := adaptive.lastChange()
+	current.Store("updated")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !adaptive.lastChange().After(created) {
+		if time.Now().After(deadline) {
+			test.Fatalf("Wanted verifier to detect the upstream change, after %d observations", v.observationCount())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if got := v.observationCount(); got < 2 {
+		test.Errorf("Wanted the verifier to have polled upstream, got %d observations", got)
+	}
+	if estimate, _ := v.estimate(); estimate > time.Since(created) {
+		test.Errorf("Wanted the estimate to adapt to the change, got %v", estimate)
+	}
+}
+
+func TestNoVerifierForNilReply(test *testing.T) {
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return nil
+	}
+
+	var reply *wrappers.StringValue
+	err := e.UnaryClientInterceptor()(context.Background(), testMethod, &wrappers.StringValue{Value: "req"}, reply, nil, invoker)
+	if err != nil {
+		test.Fatalf("Wanted no error, got %v", err)
+	}
+	if got := e.verifiers.ItemCount(); got != 0 {
+		test.Errorf("Wanted no verifier for a nil reply, got %d", got)
+	}
+}
+
+// sleepyStrategy verifies so rarely that its verifiers are always asleep.
+type sleepyStrategy struct {
+	estimationStrategy
+}
+
+func (strat *sleepyStrategy) determineInterval() time.Duration {
+	return maxVerifierLifetime
+}
+
+func TestStoppedVerifierWakesUp(test *testing.T) {
+	e := newTestEstimator()
+	v := addVerifier(e, testMethod, sample{value: "req"}, time.Now().Add(maxVerifierLifetime))
+	v.strategy = &sleepyStrategy{v.strategy}
+
+	exited := make(chan struct{})
+	go func() {
+		v.run()
+		close(exited)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	v.stop()
+
+	select {
+	case <-exited:
+	case <-time.After(100 * time.Millisecond):
+		test.Errorf("Wanted stopped verifier to exit promptly")
+	}
+}
+
+// intervalCounter counts how often its strategy is asked for an interval.
+type intervalCounter struct {
+	estimationStrategy
+	interval time.Duration
+	calls    int32
+}
+
+func (strat *intervalCounter) determineInterval() time.Duration {
+	atomic.AddInt32(&strat.calls, 1)
+	return strat.interval
+}
+
+func TestNonVerifyingVerifierDoesNotSpin(test *testing.T) {
+	e := newTestEstimator()
+	v := addVerifier(e, testMethod, sample{value: "req"}, time.Now().Add(200*time.Millisecond))
+	counter := &intervalCounter{estimationStrategy: v.strategy, interval: v.strategy.determineInterval()}
+	v.strategy = counter
+
+	start := time.Now()
+	v.run()
+
+	if calls := atomic.LoadInt32(&counter.calls); calls != 1 {
+		test.Errorf("Wanted the static strategy to be asked for an interval once, got %d", calls)
+	}
+	if elapsed := time.Since(start); elapsed < 200*time.Millisecond || elapsed > time.Second {
+		test.Errorf("Wanted the verifier to exit at its expiration, after %v", elapsed)
+	}
+}
+
+func TestNotReadyStrategyBacksOff(test *testing.T) {
+	e := newTestEstimator()
+	v := addVerifier(e, testMethod, sample{value: "req"}, time.Now().Add(1200*time.Millisecond))
+	counter := &intervalCounter{estimationStrategy: v.strategy}
+	v.strategy = counter
+
+	v.run()
+
+	// asked at 0 and 0.5 seconds, and expired by the next time at 1.5,
+	// rather than asked every half second
+	if calls := atomic.LoadInt32(&counter.calls); calls != 2 {
+		test.Errorf("Wanted 2 intervals asked for while backing off, got %d", calls)
+	}
+}
+
+func TestVerifierFetchGivesUpOnSlowUpstream(test *testing.T) {
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		test.Fatalf("Unable to listen: %v", err)
+	}
+	defer serveUpstream(listener, func() string {
+		time.Sleep(2 * time.Second)
+		return "late"
+	})()
+
+	e := newTestEstimator()
+	e.VerifierFetchTimeout = 100 * time.Millisecond
+	v, err := e.prepareVerifier(listener.Addr().String(), testMethod, nil, &wrappers.StringValue{Value: "req"}, time.Now().Add(time.Hour), &staticStrategy{ttl: 10 * time.Second})
+	if err != nil {
+		test.Fatalf("Wanted a verifier, got %v", err)
+	}
+	defer v.stop()
+	v.responseArchetype = &wrappers.StringValue{}
+
+	start := time.Now()
+	_, _, err = v.fetch()
+	if elapsed := time.Since(start); elapsed > time.Second {
+		test.Errorf("Wanted the fetch to give up after the timeout, took %s", elapsed)
+	}
+	if status.Code(err) != codes.DeadlineExceeded {
+		test.Errorf("Wanted %s, got %v", codes.DeadlineExceeded, err)
+	}
+
+	if err := v.verify(); err != nil {
+		test.Errorf("Wanted a timed out fetch to be skipped, got %v", err)
+	}
+	if got := v.observationCount(); got != 0 {
+		test.Errorf("Wanted nothing observed from a timed out fetch, got %d observations", got)
+	}
+}
+
+func TestVerifierFetchTimeoutDefault(test *testing.T) {
+	if got := newTestEstimator().verifierFetchTimeout(); got != defaultVerifierFetchTimeout {
+		test.Errorf("Wanted %s, got %s", defaultVerifierFetchTimeout, got)
+	}
+}
+
+func TestVerifierDialsWithCustomOptions(test *testing.T) {
+	listener := bufconn.Listen(1024 * 1024)
+	defer serveUpstream(listener, func() string { return "resp" })()
+
+	dials := 0
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	e.DialOptions = []grpc.DialOption{
+		grpc.WithInsecure(),
+		grpc.WithContextDialer(func(ctx context.Context, target string) (net.Conn, error) {
+			dials++
+			return listener.Dial()
+		}),
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := &wrappers.StringValue{Value: "req"}
+	if err := e.SeedVerifier(ctx, "in-memory", testMethod, req); err != nil {
+		test.Fatalf("Wanted verifier to connect through the custom dialer, got %v", err)
+	}
+	if dials == 0 {
+		test.Errorf("Wanted the custom dialer to be used")
+	}
+
+	value, found := e.verifiers.Get(hash(testMethod, req))
+	if !found {
+		test.Fatalf("Wanted a verifier for the request")
+	}
+	value.(*verifier).stop()
+}
+
+// selfSignedCredentials creates TLS credentials for a server on localhost,
+// and client credentials that trust it.
+func selfSignedCredentials(test *testing.T) (credentials.TransportCredentials, credentials.TransportCredentials) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		test.Fatalf("Unable to generate key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		test.Fatalf("Unable to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		test.Fatalf("Unable to parse certificate: %v", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+
+	serverCreds := credentials.NewServerTLSFromCert(&tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key})
+	clientCreds := credentials.NewClientTLSFromCert(pool, "localhost")
+	return serverCreds, clientCreds
+}
+
+func TestVerifierDialsWithTransportCredentials(test *testing.T) {
+	serverCreds, clientCreds := selfSignedCredentials(test)
+
+	listener, err := net.Listen("tcp", "localhost:0")
+	if err != nil {
+		test.Fatalf("Unable to listen: %v", err)
+	}
+	defer serveUpstream(listener, func() string { return "resp" }, grpc.Creds(serverCreds))()
+	target := listener.Addr().String()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req := &wrappers.StringValue{Value: "req"}
+
+	insecure := newTestEstimator()
+	insecure.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	insecure.loadStrategyConfig()
+	if err := insecure.SeedVerifier(ctx, target, testMethod, req); err == nil {
+		test.Errorf("Wanted insecure verifier to fail against a TLS upstream")
+	}
+
+	e := newTestEstimator()
+	e.StrategyConfig = &StrategyConfig{Default: "static-10"}
+	e.loadStrategyConfig()
+	e.TransportCredentials = clientCreds
+	if err := e.SeedVerifier(ctx, target, testMethod, req); err != nil {
+		test.Fatalf("Wanted verifier to connect over TLS, got %v", err)
+	}
+
+	value, found := e.verifiers.Get(hash(testMethod, req))
+	if !found {
+		test.Fatalf("Wanted a verifier for the request")
+	}
+	value.(*verifier).stop()
+}